@@ -0,0 +1,93 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/524D/galms/convert"
+	"github.com/524D/galms/msfile"
+
+	"github.com/spf13/cobra"
+)
+
+// convertCmd represents the convert command
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert between mzML and mzXML",
+	Long: `The 'convert' subcommand converts an mzML file to mzXML, or an mzXML file to mzML
+
+	The input file is specified by the last argument, and may be gzip
+	compressed. The output format is the other format. Information that
+	can't be represented in the output format is listed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			log.Fatal("Last argument must be name of mzML or mzXML file")
+		}
+		out, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Fatalf("GetString 'output' flag failed: %v", err)
+		}
+		if out == `` {
+			log.Fatal("Output file must be specified with --output")
+		}
+		lost, err := convertFile(args[0], out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, l := range lost {
+			fmt.Fprintf(os.Stderr, "Not converted: %s\n", l)
+		}
+	},
+}
+
+// convertFile converts an mzML file to mzXML or an mzXML file to mzML,
+// and returns the information that can't be represented in the output
+func convertFile(in string, out string) ([]string, error) {
+	src, err := msfile.Open(in)
+	if err != nil {
+		return nil, fmt.Errorf("can't open file %s: %w", in, err)
+	}
+	defer src.Close()
+
+	var lost []string
+	var write func(io.Writer) error
+	if f := msfile.MzMLFile(src); f != nil {
+		x, l, err := convert.MzMLToMzXML(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", in, err)
+		}
+		lost, write = l, x.Write
+	} else if x := msfile.MzXMLFile(src); x != nil {
+		f, l, err := convert.MzXMLToMzML(x)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", in, err)
+		}
+		lost, write = l, f.WriteIndexed
+	} else {
+		return nil, fmt.Errorf("%s: %w", in, msfile.ErrUnknownFormat)
+	}
+
+	w, err := os.Create(out)
+	if err != nil {
+		return nil, fmt.Errorf("can't create file %s: %w", out, err)
+	}
+	err = write(w)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", out, err)
+	}
+	return lost, nil
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+
+	convertCmd.PersistentFlags().StringP("output", "o", "", "Output file")
+}
@@ -4,7 +4,12 @@
 package cmd
 
 import (
-	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/524D/galms/digest"
+	"github.com/524D/galms/fasta"
 
 	"github.com/spf13/cobra"
 )
@@ -14,23 +19,96 @@ var decoyCmd = &cobra.Command{
 	Use:   "decoy",
 	Short: "Generate decoy FASTA database",
 	Long: `This command generates a decoy database according to
-the one of the methods set by the --method flag.
-`,
+the one of the methods set by the --method flag:
+
+	reverse:        reverse the protein sequence
+	pseudo-reverse: reverse each peptide, keeping the cleavage residues in place
+	shuffle:        shuffle each peptide, keeping the cleavage residues in place
+
+	The target FASTA file is specified by the last argument. By default the
+	output contains the target followed by the decoy proteins, with --separate
+	only the decoy proteins are written. Without --output, the result is
+	written to stdout.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("decoy called")
+		if len(args) != 1 {
+			log.Fatal("Last argument must be name of FASTA file")
+		}
+		methodName, err := cmd.Flags().GetString("method")
+		if err != nil {
+			log.Fatalf("GetString 'method' flag failed: %v", err)
+		}
+		method, err := fasta.ParseDecoyMethod(methodName)
+		if err != nil {
+			log.Fatalf("%s: %v", methodName, err)
+		}
+		enzymeName, err := cmd.Flags().GetString("enzyme")
+		if err != nil {
+			log.Fatalf("GetString 'enzyme' flag failed: %v", err)
+		}
+		enzyme, err := digest.NamedEnzyme(enzymeName)
+		if err != nil {
+			log.Fatalf("%s: %v", enzymeName, err)
+		}
+		prefix, err := cmd.Flags().GetString("prefix")
+		if err != nil {
+			log.Fatalf("GetString 'prefix' flag failed: %v", err)
+		}
+		seed, err := cmd.Flags().GetInt64("seed")
+		if err != nil {
+			log.Fatalf("GetInt64 'seed' flag failed: %v", err)
+		}
+		separate, err := cmd.Flags().GetBool("separate")
+		if err != nil {
+			log.Fatalf("GetBool 'separate' flag failed: %v", err)
+		}
+		out, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Fatalf("GetString 'output' flag failed: %v", err)
+		}
+
+		file, err := os.Open(args[0])
+		if err != nil {
+			log.Fatalf("Can't open file %s: %v", args[0], err)
+		}
+		defer file.Close()
+		target, err := fasta.Read(file)
+		if err != nil {
+			log.Fatalf("%s: %v", args[0], err)
+		}
+		decoys, err := fasta.NewDecoyGenerator(method, enzyme, seed).Decoys(target, prefix)
+		if err != nil {
+			log.Fatalf("%s: %v", args[0], err)
+		}
+
+		var w io.Writer = os.Stdout
+		if out != `` {
+			f, err := os.Create(out)
+			if err != nil {
+				log.Fatalf("Can't create file %s: %v", out, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if !separate {
+			err = target.Write(w)
+			if err != nil {
+				log.Fatalf("%s: %v", out, err)
+			}
+		}
+		err = decoys.Write(w)
+		if err != nil {
+			log.Fatalf("%s: %v", out, err)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(decoyCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// decoyCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// decoyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	decoyCmd.PersistentFlags().StringP("method", "m", "reverse", "Decoy method {reverse,pseudo-reverse,shuffle}")
+	decoyCmd.PersistentFlags().StringP("enzyme", "e", "trypsin", "Cleavage enzyme for pseudo-reverse and shuffle {Trypsin,Trypsin_Simple, Trypsin/P,Lys_C,PepsinA,Chymotrypsin}")
+	decoyCmd.PersistentFlags().StringP("prefix", "p", fasta.DefaultDecoyPrefix, "Prefix of decoy protein IDs")
+	decoyCmd.PersistentFlags().Int64P("seed", "s", 1, "Seed of the random generator for shuffle")
+	decoyCmd.PersistentFlags().Bool("separate", false, "Only write the decoy proteins")
+	decoyCmd.PersistentFlags().StringP("output", "o", "", "Output file")
 }
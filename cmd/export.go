@@ -0,0 +1,103 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package cmd
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/524D/galms/msfile"
+	"github.com/524D/galms/mzidentml"
+	"github.com/524D/galms/mztab"
+	"github.com/524D/galms/pepxml"
+
+	"github.com/spf13/cobra"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export identifications to a report format",
+	Long: `The 'export' subcommand converts an mzIdentML or pepXML file to a
+	report format. The only supported format is mzTab.
+
+	The input file is specified by the last argument, and may be gzip
+	compressed. Without --output, the result is written to stdout.
+	--score selects the search scores that are reported. For pepXML
+	input, scores are given by name and all scores are reported by
+	default. For mzIdentML input, scores are given by PSI-MS accession
+	and the known search engine scores are reported by default.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			log.Fatal("Last argument must be name of mzIdentML or pepXML file")
+		}
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			log.Fatalf("GetString 'format' flag failed: %v", err)
+		}
+		if format != "mztab" {
+			log.Fatalf("Unsupported export format %s", format)
+		}
+		out, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Fatalf("GetString 'output' flag failed: %v", err)
+		}
+		scores, err := cmd.Flags().GetStringSlice("score")
+		if err != nil {
+			log.Fatalf("GetStringSlice 'score' flag failed: %v", err)
+		}
+		r, inFormat, err := msfile.OpenReader(args[0])
+		if err != nil {
+			log.Fatalf("Can't open file %s: %v", args[0], err)
+		}
+		defer r.Close()
+
+		var t mztab.MzTab
+		switch inFormat {
+		case msfile.MzIdentML:
+			m, err := mzidentml.Read(r)
+			if err != nil {
+				log.Fatalf("%s: %v", args[0], err)
+			}
+			t, err = mztab.FromMzIdentML(&m, scores...)
+			if err != nil {
+				log.Fatalf("%s: %v", args[0], err)
+			}
+		case msfile.PepXML:
+			p, err := pepxml.Read(r)
+			if err != nil {
+				log.Fatalf("%s: %v", args[0], err)
+			}
+			t, err = mztab.FromPepXML(&p, scores...)
+			if err != nil {
+				log.Fatalf("%s: %v", args[0], err)
+			}
+		default:
+			log.Fatalf("%s: %v", args[0], msfile.ErrUnknownFormat)
+		}
+
+		var w io.Writer = os.Stdout
+		if out != `` {
+			f, err := os.Create(out)
+			if err != nil {
+				log.Fatalf("Can't create file %s: %v", out, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		err = t.Write(w)
+		if err != nil {
+			log.Fatalf("%s: %v", out, err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.PersistentFlags().StringP("format", "f", "mztab", "Output format")
+	exportCmd.PersistentFlags().StringP("output", "o", "", "Output file")
+	exportCmd.PersistentFlags().StringSlice("score", nil, "Search scores to report, by name (pepXML) or accession (mzIdentML)")
+}
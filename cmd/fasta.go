@@ -42,7 +42,7 @@ var fastaCmd = &cobra.Command{
 		// Make dir in case it does not exist
 		os.MkdirAll(dataDir, os.ModePerm)
 
-		fastas := make([]fasta.Fasta, 0)
+		srcs := make([]fasta.Source, 0)
 		for _, n := range args {
 			upd, err := cmd.Flags().GetBool("update")
 			if err != nil {
@@ -59,17 +59,8 @@ var fastaCmd = &cobra.Command{
 			if err != nil {
 				log.Fatalf("%s is not a valid filename nor a fuzzy name: %v", n, err)
 			}
-			file, err := os.Open(fn)
-			if err != nil {
-				log.Fatalf("Can't open file %s: %v", args[0], err)
-			}
-			defer file.Close()
-
-			f, err := fasta.Read(file)
-			if err != nil {
-				log.Fatal("fasta Read failed")
-			}
-			fastas = append(fastas, f)
+			// Files are read as a stream, so they don't need to fit in memory
+			srcs = append(srcs, fasta.FileSource(fn))
 		}
 
 		missing, err := cmd.Flags().GetString("missing")
@@ -96,26 +87,51 @@ var fastaCmd = &cobra.Command{
 		if err != nil {
 			log.Fatalf("Getstrings 'proteotypic' flag failed: %v", err)
 		}
+		var expand fasta.Expand
+		variants, err := cmd.Flags().GetBool("variants")
+		if err != nil {
+			log.Fatalf("Getstrings 'variants' flag failed: %v", err)
+		}
+		if variants {
+			expand |= fasta.ExpandVariants
+		}
+		mods, err := cmd.Flags().GetBool("mods")
+		if err != nil {
+			log.Fatalf("Getstrings 'mods' flag failed: %v", err)
+		}
+		if mods {
+			expand |= fasta.ExpandMods
+		}
 
-		for _, f := range fastas {
+		for i, src := range srcs {
 			if an {
-				fasta.Analyse(f, enzyme)
+				err = fasta.AnalyseSource(src, enzyme)
+				if err != nil {
+					log.Fatalf("%s: %v", args[i], err)
+				}
 			}
 
 			if contains != `` || missing != `` {
-				for _, p := range f.Prots() {
+				err = src(func(p fasta.Prot) error {
 					if contains == `` || strings.Contains(p.Sequence(), contains) {
 
 						if missing == `` || !strings.Contains(p.Sequence(), missing) {
 							fmt.Printf("Length: %d %s %s\n", len(p.Sequence()), p.ID(), p.Description())
 						}
 					}
+					return nil
+				})
+				if err != nil {
+					log.Fatalf("%s: %v", args[i], err)
 				}
 			}
 		}
 
 		if pt {
-			pts := fasta.ProteotypicPeps(fastas, enzyme)
+			pts, err := fasta.ProteotypicPepsSource(srcs, enzyme, expand)
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
 			fasta.WriteProteotypicPeps(os.Stdout, pts)
 		}
 
@@ -131,5 +147,7 @@ func init() {
 	fastaCmd.PersistentFlags().BoolP("update", "u", false, "Update FASTA file")
 	fastaCmd.PersistentFlags().BoolP("analyse", "a", false, "Analyse proteins")
 	fastaCmd.PersistentFlags().BoolP("proteotypic", "p", false, "List proteotypic peptides")
+	fastaCmd.PersistentFlags().Bool("variants", false, "Include PEFF annotated variants in proteotypic peptides")
+	fastaCmd.PersistentFlags().Bool("mods", false, "Include PEFF annotated modifications in proteotypic peptides")
 
 }
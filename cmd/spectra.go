@@ -0,0 +1,75 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/524D/galms/msfile"
+	"github.com/524D/galms/spectra"
+
+	"github.com/spf13/cobra"
+)
+
+// spectraCmd represents the spectra command
+var spectraCmd = &cobra.Command{
+	Use:   "spectra",
+	Short: "List the spectra of mzML or mzXML files",
+	Long: `The 'spectra' subcommand lists the spectra of one or more files
+
+	The files are specified by the last argument(s). mzML and mzXML files
+	are supported, optionally gzip compressed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			log.Fatal("Last argument must be name of mzML or mzXML file")
+		}
+		msLevels, err := cmd.Flags().GetIntSlice("mslevel")
+		if err != nil {
+			log.Fatalf("GetIntSlice 'mslevel' flag failed: %v", err)
+		}
+		minRT, err := cmd.Flags().GetFloat64("minrt")
+		if err != nil {
+			log.Fatalf("GetFloat64 'minrt' flag failed: %v", err)
+		}
+		maxRT, err := cmd.Flags().GetFloat64("maxrt")
+		if err != nil {
+			log.Fatalf("GetFloat64 'maxrt' flag failed: %v", err)
+		}
+		filter := spectra.Filter{
+			MSLevels: msLevels,
+			MinRT:    minRT,
+			MaxRT:    maxRT,
+		}
+
+		for _, fn := range args {
+			f, err := msfile.Open(fn)
+			if err != nil {
+				log.Fatalf("Can't open file %s: %v", fn, err)
+			}
+			it := f.Spectra(filter)
+			for it.Next() {
+				s := it.Spectrum()
+				fmt.Printf("%s\t%d\t%s\t%d\t%.3f\t%d", fn, s.Index, s.ID,
+					s.MSLevel, s.RetentionTime, len(s.Peaks))
+				for _, p := range s.Precursors {
+					fmt.Printf("\t%.4f/%d", p.Mz, p.Charge)
+				}
+				fmt.Println()
+			}
+			if err = it.Err(); err != nil {
+				log.Fatalf("%s: %v", fn, err)
+			}
+			f.Close()
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(spectraCmd)
+
+	spectraCmd.PersistentFlags().IntSliceP("mslevel", "l", nil, "Only list spectra with the specified MS level(s)")
+	spectraCmd.PersistentFlags().Float64("minrt", 0, "Minimum retention time (s)")
+	spectraCmd.PersistentFlags().Float64("maxrt", 0, "Maximum retention time (s)")
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+// Package convert converts between the mzML and mzXML file formats
+package convert
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Name and version of the software that is recorded in converted files
+const (
+	softwareName    = "galms"
+	softwareVersion = "0.1"
+)
+
+// report collects the information that could not be converted
+type report struct {
+	counts map[string]int
+	order  []string
+}
+
+// add records that info of a spectrum could not be converted
+func (r *report) add(info string) {
+	if r.counts == nil {
+		r.counts = make(map[string]int)
+	}
+	if _, ok := r.counts[info]; !ok {
+		r.order = append(r.order, info)
+	}
+	r.counts[info]++
+}
+
+// lines returns a line for each type of information that could not
+// be converted, with the number of occurrences
+func (r *report) lines() []string {
+	lines := make([]string, 0, len(r.order))
+	for _, info := range r.order {
+		lines = append(lines, fmt.Sprintf("%s (%d times)", info, r.counts[info]))
+	}
+	return lines
+}
+
+// componentTerm is a CV term of an instrument component, together
+// with the names under which it can appear in mzXML
+type componentTerm struct {
+	kind      string // "source", "analyzer" or "detector"
+	accession string
+	name      string
+	aliases   []string
+}
+
+var componentTerms = []componentTerm{
+	{"source", "MS:1000073", "electrospray ionization", []string{"ESI"}},
+	{"source", "MS:1000398", "nanoelectrospray", []string{"NSI", "nanoESI"}},
+	{"source", "MS:1000075", "matrix-assisted laser desorption ionization", []string{"MALDI"}},
+	{"source", "MS:1000070", "atmospheric pressure chemical ionization", []string{"APCI"}},
+	{"analyzer", "MS:1000484", "orbitrap", []string{"Orbitrap"}},
+	{"analyzer", "MS:1000079", "fourier transform ion cyclotron resonance mass spectrometer", []string{"FTMS", "FTICR"}},
+	{"analyzer", "MS:1000264", "ion trap", []string{"ITMS", "IT"}},
+	{"analyzer", "MS:1000083", "radial ejection linear ion trap", []string{"LIT"}},
+	{"analyzer", "MS:1000082", "quadrupole ion trap", nil},
+	{"analyzer", "MS:1000081", "quadrupole", []string{"Q", "Quadrupole"}},
+	{"analyzer", "MS:1000084", "time-of-flight", []string{"TOF", "TOFMS"}},
+	{"detector", "MS:1000253", "electron multiplier", []string{"EMT"}},
+	{"detector", "MS:1000624", "inductive detector", nil},
+	{"detector", "MS:1000114", "microchannel plate detector", []string{"MCP"}},
+}
+
+// findComponentTerm returns the CV term with the given mzXML name
+func findComponentTerm(kind string, name string) (componentTerm, bool) {
+	for _, t := range componentTerms {
+		if t.kind != kind {
+			continue
+		}
+		if strings.EqualFold(t.name, name) {
+			return t, true
+		}
+		for _, a := range t.aliases {
+			if strings.EqualFold(a, name) {
+				return t, true
+			}
+		}
+	}
+	return componentTerm{}, false
+}
+
+// mzXML activation methods and the corresponding mzML CV terms
+var activationMethods = []struct {
+	name       string
+	accessions []string
+}{
+	{"CID", []string{"MS:1000133"}},
+	{"HCD", []string{"MS:1000422"}},
+	{"ETD", []string{"MS:1000598"}},
+	{"ECD", []string{"MS:1000250"}},
+	{"ETD+SA", []string{"MS:1000598", "MS:1002679"}},
+}
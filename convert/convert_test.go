@@ -0,0 +1,209 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package convert
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/524D/galms/mzml"
+	"github.com/524D/galms/mzxml"
+)
+
+// testMzML builds an mzML file with an MS1 and an MS2 spectrum
+func testMzML(t *testing.T) mzml.MzML {
+	f := mzml.New("run1")
+	err := f.SetFileDescription([]mzml.CVParam{{CvRef: `MS`, Accession: `MS:1000580`, Name: `MSn spectrum`}},
+		[]mzml.SourceFile{{ID: `RAW1`, Name: `test.raw`, Location: `file:///data`,
+			CvPar: []mzml.CVParam{{CvRef: `MS`, Accession: `MS:1000569`, Name: `SHA-1`,
+				Value: `0123456789abcdef0123456789abcdef01234567`}}}})
+	if err != nil {
+		t.Fatalf("SetFileDescription: error return %v", err)
+	}
+	err = f.AppendInstrumentConfiguration(mzml.InstrumentConfiguration{
+		ID:    `IC1`,
+		CvPar: []mzml.CVParam{{CvRef: `MS`, Accession: `MS:1001742`, Name: `LTQ Orbitrap Velos`}},
+		Components: []mzml.Component{
+			{Kind: `source`, CvPar: []mzml.CVParam{{CvRef: `MS`, Accession: `MS:1000073`, Name: `electrospray ionization`}}},
+			{Kind: `analyzer`, CvPar: []mzml.CVParam{{CvRef: `MS`, Accession: `MS:1000484`, Name: `orbitrap`}}},
+			{Kind: `detector`, CvPar: []mzml.CVParam{{CvRef: `MS`, Accession: `MS:1000624`, Name: `inductive detector`}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("AppendInstrumentConfiguration: error return %v", err)
+	}
+	_, err = f.AppendSpectrum(mzml.SpectrumData{
+		ID:            `controllerType=0 controllerNumber=1 scan=7`,
+		MSLevel:       1,
+		RetentionTime: 120.5,
+		Centroid:      false,
+		Polarity:      mzml.Positive,
+		Peaks:         []mzml.Peak{{Mz: 400.25, Intens: 100}, {Mz: 500.125, Intens: 300}},
+		ScanCvPar: []mzml.CVParam{
+			{CvRef: `MS`, Accession: `MS:1000512`, Name: `filter string`, Value: `FTMS + p ESI Full ms [350.00-1800.00]`},
+			{CvRef: `MS`, Accession: `MS:1000927`, Name: `ion injection time`, Value: `10`,
+				UnitCvRef: `UO`, UnitAccession: `UO:0000028`, UnitName: `millisecond`},
+		},
+		ScanWindows: []mzml.ScanWindow{{LowerLimit: 350, UpperLimit: 1800}},
+		Compression: mzml.Zlib,
+	})
+	if err != nil {
+		t.Fatalf("AppendSpectrum: error return %v", err)
+	}
+	prec := mzml.NewPrecursor()
+	prec.ScanIndex = 0
+	prec.IsolationWindow = mzml.IsolationWindow{TargetMz: 500.13, LowerOffset: 1, UpperOffset: 1}
+	prec.SelectedIons = []mzml.SelectedIon{{Mz: 500.125, Charge: 2, PossibleCharges: []int{2, 3}, Intensity: 300}}
+	prec.Activation = []string{`MS:1000422`}
+	prec.CollisionEnergy = 35
+	_, err = f.AppendSpectrum(mzml.SpectrumData{
+		ID:            `controllerType=0 controllerNumber=1 scan=8`,
+		MSLevel:       2,
+		RetentionTime: 121,
+		Centroid:      true,
+		Polarity:      mzml.Positive,
+		Peaks:         []mzml.Peak{{Mz: 200.5, Intens: 10}},
+		Precursors:    []mzml.Precursor{prec},
+		Arrays: []mzml.BinaryArray{{Accession: `MS:1000516`, Name: `charge array`,
+			DataType: mzml.Int32, Int32: []int32{1}}},
+	})
+	if err != nil {
+		t.Fatalf("AppendSpectrum: error return %v", err)
+	}
+	_, err = f.AppendChromatogram(mzml.ChromatogramData{ID: `TIC`, Type: `MS:1000235`,
+		Points: []mzml.ChromatogramPoint{{Time: 120.5, Intens: 400}, {Time: 121, Intens: 10}}})
+	if err != nil {
+		t.Fatalf("AppendChromatogram: error return %v", err)
+	}
+	return f
+}
+
+// contains returns true if one of the lines contains s
+func contains(lines []string, s string) bool {
+	for _, l := range lines {
+		if strings.Contains(l, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMzMLToMzXML(t *testing.T) {
+	f := testMzML(t)
+	x, lost, err := MzMLToMzXML(&f)
+	if err != nil {
+		t.Fatalf("MzMLToMzXML: error return %v", err)
+	}
+	for _, s := range []string{"chromatogram (1 times)", "ion injection time", "binary data array MS:1000516"} {
+		if !contains(lost, s) {
+			t.Errorf("MzMLToMzXML: %q not reported in %v", s, lost)
+		}
+	}
+	var b bytes.Buffer
+	err = x.Write(&b)
+	if err != nil {
+		t.Fatalf("Write: error return %v", err)
+	}
+	x, err = mzxml.Read(&b)
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	if n := x.NumSpecs(); n != 2 {
+		t.Fatalf("NumSpecs: %d, should be 2", n)
+	}
+	instr := x.Instruments()
+	if len(instr) != 1 || instr[0].Model != `LTQ Orbitrap Velos` || instr[0].Ionisation != `electrospray ionization` ||
+		instr[0].MassAnalyzer != `orbitrap` || instr[0].Detector != `inductive detector` {
+		t.Errorf("Instruments: %+v", instr)
+	}
+	parents := x.ParentFiles()
+	if len(parents) != 1 || parents[0].FileName != `/data/test.raw` ||
+		parents[0].FileSha1 != `0123456789abcdef0123456789abcdef01234567` {
+		t.Errorf("ParentFiles: %+v", parents)
+	}
+	info, err := x.ScanInfo(0)
+	if err != nil || info.ScanNum != 7 || info.MSLevel != 1 || info.RetentionTime != 120.5 ||
+		info.Centroid || info.Polarity != mzxml.Positive || info.StartMz != 350 || info.EndMz != 1800 ||
+		info.FilterLine != `FTMS + p ESI Full ms [350.00-1800.00]` {
+		t.Errorf("ScanInfo(0): %+v (%v)", info, err)
+	}
+	info, err = x.ScanInfo(1)
+	if err != nil || info.ScanNum != 8 || info.MSLevel != 2 || !info.Centroid {
+		t.Errorf("ScanInfo(1): %+v (%v)", info, err)
+	}
+	p, err := x.ReadScan(0)
+	if err != nil || len(p) != 2 || p[1].Mz != 500.125 || p[1].Intens != 300 {
+		t.Errorf("ReadScan: %v (%v)", p, err)
+	}
+	prec, err := x.Precursors(1)
+	if err != nil || len(prec) != 1 {
+		t.Fatalf("Precursors: %v (%v)", prec, err)
+	}
+	if prec[0].Mz != 500.125 || prec[0].ScanNum != 7 || prec[0].Charge != 2 || len(prec[0].PossibleCharges) != 2 ||
+		prec[0].WindowWideness != 2 || prec[0].ActivationMethod != `HCD` || prec[0].CollisionEnergy != 35 {
+		t.Errorf("Precursors: %+v", prec[0])
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	f := testMzML(t)
+	x, _, err := MzMLToMzXML(&f)
+	if err != nil {
+		t.Fatalf("MzMLToMzXML: error return %v", err)
+	}
+	f2, lost, err := MzXMLToMzML(&x)
+	if err != nil {
+		t.Fatalf("MzXMLToMzML: error return %v", err)
+	}
+	if len(lost) != 0 {
+		t.Errorf("MzXMLToMzML: lost %v", lost)
+	}
+	var b bytes.Buffer
+	err = f2.WriteIndexed(&b)
+	if err != nil {
+		t.Fatalf("WriteIndexed: error return %v", err)
+	}
+	f2, err = mzml.Read(&b)
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	if n := f2.NumSpecs(); n != 2 {
+		t.Fatalf("NumSpecs: %d, should be 2", n)
+	}
+	id, err := f2.ScanID(1)
+	if err != nil || id != `scan=8` {
+		t.Errorf("ScanID: %s (%v), should be scan=8", id, err)
+	}
+	info, err := f2.SpectrumInfo(0)
+	if err != nil || info.MSLevel != 1 || info.RetentionTime != 120.5 || info.Centroid ||
+		info.Polarity != mzml.Positive || info.FilterString != `FTMS + p ESI Full ms [350.00-1800.00]` ||
+		len(info.ScanWindows) != 1 || info.ScanWindows[0].UpperLimit != 1800 ||
+		info.BasePeakMz != 500.125 || info.TotalIonCurrent != 400 {
+		t.Errorf("SpectrumInfo(0): %+v (%v)", info, err)
+	}
+	p, err := f2.ReadScan(1)
+	if err != nil || len(p) != 1 || p[0].Mz != 200.5 || p[0].Intens != 10 {
+		t.Errorf("ReadScan: %v (%v)", p, err)
+	}
+	prec, err := f2.Precursors(1)
+	if err != nil || len(prec) != 1 {
+		t.Fatalf("Precursors: %v (%v)", prec, err)
+	}
+	if prec[0].ScanIndex != 0 || prec[0].IsolationWindow.LowerOffset != 1 ||
+		len(prec[0].SelectedIons) != 1 || prec[0].SelectedIons[0].Mz != 500.125 ||
+		prec[0].SelectedIons[0].Charge != 2 || len(prec[0].Activation) != 1 ||
+		prec[0].Activation[0] != `MS:1000422` || prec[0].CollisionEnergy != 35 {
+		t.Errorf("Precursors: %+v", prec[0])
+	}
+	confs, err := f2.InstrumentConfigurations()
+	if err != nil || len(confs) != 1 || len(confs[0].Components) != 3 ||
+		confs[0].Components[1].CvPar[0].Accession != `MS:1000484` {
+		t.Errorf("InstrumentConfigurations: %+v (%v)", confs, err)
+	}
+	sourceFiles, err := f2.SourceFiles()
+	if err != nil || len(sourceFiles) != 1 || sourceFiles[0].Name != `test.raw` {
+		t.Errorf("SourceFiles: %+v (%v)", sourceFiles, err)
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package convert
+
+import (
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/524D/galms/mzml"
+	"github.com/524D/galms/mzxml"
+)
+
+// MzXMLToMzML converts an mzXML file to mzML.
+// The returned lines describe the information that could not be converted.
+func MzXMLToMzML(x *mzxml.MzXML) (mzml.MzML, []string, error) {
+	var r report
+	parentFiles := x.ParentFiles()
+	runID := "run1"
+	if len(parentFiles) > 0 {
+		base := path.Base(strings.ReplaceAll(parentFiles[0].FileName, `\`, `/`))
+		if base = strings.TrimSuffix(base, path.Ext(base)); base != `` {
+			runID = base
+		}
+	}
+	f := mzml.New(runID)
+
+	var sourceFiles []mzml.SourceFile
+	for i, p := range parentFiles {
+		name := strings.ReplaceAll(p.FileName, `\`, `/`)
+		sf := mzml.SourceFile{
+			ID:       "SF" + strconv.Itoa(i+1),
+			Name:     path.Base(name),
+			Location: "file://" + path.Dir(name),
+		}
+		if p.FileSha1 != `` {
+			sf.CvPar = append(sf.CvPar, mzml.CVParam{CvRef: `MS`, Accession: `MS:1000569`,
+				Name: `SHA-1`, Value: p.FileSha1})
+		}
+		sourceFiles = append(sourceFiles, sf)
+	}
+	fileContent, err := fileContent(x)
+	if err != nil {
+		return f, nil, err
+	}
+	err = f.SetFileDescription(fileContent, sourceFiles)
+	if err != nil {
+		return f, nil, err
+	}
+
+	f.AppendSoftware(softwareName, softwareVersion, []mzml.CVParam{{CvRef: `MS`,
+		Accession: `MS:1000799`, Name: `custom unreleased software tool`, Value: softwareName}})
+	for i, instr := range x.Instruments() {
+		conf := instrumentToMzML(&instr, "IC"+strconv.Itoa(i+1), &r)
+		err = f.AppendInstrumentConfiguration(conf)
+		if err != nil {
+			return f, nil, err
+		}
+	}
+	err = f.AppendDataProcessing(mzml.DataProcessing{
+		ID: "galms_conversion",
+		ProcessingMeth: []mzml.ProcessingMethod{{
+			SoftwareRef: softwareName,
+			CvPar:       []mzml.CVParam{{CvRef: `MS`, Accession: `MS:1000544`, Name: `Conversion to mzML`}},
+		}},
+	})
+	if err != nil {
+		return f, nil, err
+	}
+
+	for i := int64(0); i < x.NumSpecs(); i++ {
+		s, err := spectrumToMzML(x, i, &r)
+		if err != nil {
+			return f, nil, err
+		}
+		_, err = f.AppendSpectrum(s)
+		if err != nil {
+			return f, nil, err
+		}
+	}
+	return f, r.lines(), nil
+}
+
+// fileContent returns the spectrum types that are present in the file
+func fileContent(x *mzxml.MzXML) ([]mzml.CVParam, error) {
+	var ms1, msn bool
+	for i := int64(0); i < x.NumSpecs(); i++ {
+		msLevel, err := x.MSLevel(i)
+		if err != nil {
+			return nil, err
+		}
+		if msLevel == 1 {
+			ms1 = true
+		} else {
+			msn = true
+		}
+	}
+	var cvPar []mzml.CVParam
+	if ms1 {
+		cvPar = append(cvPar, mzml.CVParam{CvRef: `MS`, Accession: `MS:1000579`, Name: `MS1 spectrum`})
+	}
+	if msn {
+		cvPar = append(cvPar, mzml.CVParam{CvRef: `MS`, Accession: `MS:1000580`, Name: `MSn spectrum`})
+	}
+	return cvPar, nil
+}
+
+// spectrumToMzML converts an mzXML scan
+func spectrumToMzML(x *mzxml.MzXML, scanIndex int64, r *report) (mzml.SpectrumData, error) {
+	var s mzml.SpectrumData
+	info, err := x.ScanInfo(scanIndex)
+	if err != nil {
+		return s, err
+	}
+	s.ID = "scan=" + strconv.FormatInt(info.ScanNum, 10)
+	s.MSLevel = info.MSLevel
+	s.RetentionTime = info.RetentionTime
+	s.Centroid = info.Centroid
+	s.Polarity = info.Polarity
+	if info.FilterLine != `` {
+		s.ScanCvPar = append(s.ScanCvPar, mzml.CVParam{CvRef: `MS`, Accession: `MS:1000512`,
+			Name: `filter string`, Value: info.FilterLine})
+	}
+	if !math.IsNaN(info.StartMz) && !math.IsNaN(info.EndMz) {
+		s.ScanWindows = []mzml.ScanWindow{{LowerLimit: info.StartMz, UpperLimit: info.EndMz}}
+	}
+	for _, t := range []struct {
+		accession string
+		name      string
+		value     float64
+		mz        bool
+	}{
+		{`MS:1000285`, `total ion current`, info.TotalIonCurrent, false},
+		{`MS:1000504`, `base peak m/z`, info.BasePeakMz, true},
+		{`MS:1000505`, `base peak intensity`, info.BasePeakIntens, false},
+		{`MS:1000528`, `lowest observed m/z`, info.LowMz, true},
+		{`MS:1000527`, `highest observed m/z`, info.HighMz, true},
+	} {
+		if math.IsNaN(t.value) {
+			continue
+		}
+		cvParam := mzml.CVParam{CvRef: `MS`, Accession: t.accession, Name: t.name,
+			Value: strconv.FormatFloat(t.value, 'f', -1, 64)}
+		if t.mz {
+			cvParam.UnitCvRef, cvParam.UnitAccession, cvParam.UnitName = `MS`, `MS:1000040`, `m/z`
+		} else {
+			cvParam.UnitCvRef, cvParam.UnitAccession, cvParam.UnitName = `MS`, `MS:1000131`, `number of detector counts`
+		}
+		s.CvPar = append(s.CvPar, cvParam)
+	}
+
+	s.Peaks, err = x.ReadScan(scanIndex)
+	if err != nil {
+		return s, err
+	}
+	precursors, err := x.Precursors(scanIndex)
+	if err != nil {
+		return s, err
+	}
+	for _, p := range precursors {
+		prec := mzml.NewPrecursor()
+		prec.ScanIndex = int(p.ScanIndex)
+		prec.IsolationWindow = mzml.IsolationWindow{
+			TargetMz:    p.Mz,
+			LowerOffset: p.WindowWideness / 2,
+			UpperOffset: p.WindowWideness / 2,
+		}
+		prec.SelectedIons = []mzml.SelectedIon{{
+			Mz:              p.Mz,
+			Charge:          p.Charge,
+			PossibleCharges: p.PossibleCharges,
+			Intensity:       p.Intensity,
+		}}
+		prec.CollisionEnergy = p.CollisionEnergy
+		if p.ScanIndex < 0 && p.ScanNum != 0 {
+			// The precursor scan is not in the file, keep the reference
+			prec.SpectrumRef = "scan=" + strconv.FormatInt(p.ScanNum, 10)
+		}
+		if p.ActivationMethod != `` {
+			prec.Activation = activationToMzML(p.ActivationMethod, r)
+		}
+		s.Precursors = append(s.Precursors, prec)
+	}
+	return s, nil
+}
+
+// activationToMzML returns the CV terms of an mzXML activation method
+func activationToMzML(method string, r *report) []string {
+	for _, m := range activationMethods {
+		if strings.EqualFold(m.name, method) {
+			return m.accessions
+		}
+	}
+	r.add("activation method " + method)
+	return nil
+}
+
+// instrumentToMzML converts an mzXML instrument
+func instrumentToMzML(instr *mzxml.Instrument, id string, r *report) mzml.InstrumentConfiguration {
+	conf := mzml.InstrumentConfiguration{ID: id}
+	if instr.Model != `` {
+		conf.CvPar = append(conf.CvPar, mzml.CVParam{CvRef: `MS`, Accession: `MS:1000031`,
+			Name: `instrument model`, Value: instr.Model})
+	}
+	if instr.Manufacturer != `` {
+		r.add("instrument manufacturer")
+	}
+	if instr.SoftwareName != `` {
+		r.add("instrument software")
+	}
+	for _, c := range []struct {
+		kind  string
+		value string
+	}{
+		{"source", instr.Ionisation},
+		{"analyzer", instr.MassAnalyzer},
+		{"detector", instr.Detector},
+	} {
+		if c.value == `` {
+			continue
+		}
+		t, ok := findComponentTerm(c.kind, c.value)
+		if !ok {
+			r.add("instrument " + c.kind + " " + c.value)
+			continue
+		}
+		conf.Components = append(conf.Components, mzml.Component{Kind: c.kind,
+			CvPar: []mzml.CVParam{{CvRef: `MS`, Accession: t.accession, Name: t.name}}})
+	}
+	return conf
+}
@@ -0,0 +1,255 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package convert
+
+import (
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/524D/galms/mzml"
+	"github.com/524D/galms/mzxml"
+)
+
+// Matches the scan number in a native spectrum ID, e.g.
+// "controllerType=0 controllerNumber=1 scan=42"
+var reScanNumber = regexp.MustCompile(`(?:^|\s)scan=([0-9]+)(?:\s|$)`)
+
+// MzMLToMzXML converts an mzML file to mzXML.
+// The returned lines describe the information that could not be converted.
+func MzMLToMzXML(f *mzml.MzML) (mzxml.MzXML, []string, error) {
+	var r report
+	x := mzxml.New()
+
+	sourceFiles, err := f.SourceFiles()
+	if err != nil {
+		return x, nil, err
+	}
+	for _, sf := range sourceFiles {
+		x.AppendParentFile(mzxml.ParentFile{
+			FileName: sourceFileName(&sf),
+			FileType: "RAWData",
+			FileSha1: cvValue(sf.CvPar, "MS:1000569"), // SHA-1
+		})
+	}
+	confs, err := f.InstrumentConfigurations()
+	if err != nil {
+		return x, nil, err
+	}
+	for i := range confs {
+		x.AppendInstrument(instrumentToMzXML(&confs[i], &r))
+	}
+	x.AppendSoftware("conversion", softwareName, softwareVersion)
+
+	for i := 0; i < f.NumSpecs(); i++ {
+		s, err := scanToMzXML(f, i, &r)
+		if err != nil {
+			return x, nil, err
+		}
+		_, err = x.AppendScan(s)
+		if err != nil {
+			return x, nil, err
+		}
+	}
+	for i := 0; i < f.NumChromatograms(); i++ {
+		r.add("chromatogram")
+	}
+	return x, r.lines(), nil
+}
+
+// scanToMzXML converts an mzML spectrum
+func scanToMzXML(f *mzml.MzML, scanIndex int, r *report) (mzxml.ScanData, error) {
+	s := mzxml.ScanData{
+		CollisionEnergy: math.NaN(),
+		StartMz:         math.NaN(),
+		EndMz:           math.NaN(),
+	}
+	id, err := f.ScanID(scanIndex)
+	if err != nil {
+		return s, err
+	}
+	if m := reScanNumber.FindStringSubmatch(id); m != nil {
+		s.ScanNum, err = strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return s, err
+		}
+	} else {
+		// mzXML scans are numbered, use the position in the file
+		s.ScanNum = int64(scanIndex) + 1
+		r.add("spectrum ID without scan number")
+	}
+	info, err := f.SpectrumInfo(scanIndex)
+	if err != nil {
+		return s, err
+	}
+	s.MSLevel = info.MSLevel
+	s.RetentionTime = info.RetentionTime
+	s.Centroid = info.Centroid
+	s.Polarity = info.Polarity
+	s.FilterLine = info.FilterString
+	if len(info.ScanWindows) > 0 {
+		s.StartMz = info.ScanWindows[0].LowerLimit
+		s.EndMz = info.ScanWindows[0].UpperLimit
+	}
+	if len(info.ScanWindows) > 1 {
+		r.add("additional scan window")
+	}
+	if !math.IsNaN(info.IonInjectionTime) {
+		r.add("ion injection time")
+	}
+
+	s.Peaks, err = f.ReadScan(scanIndex)
+	if err != nil {
+		return s, err
+	}
+	arrays, err := f.ReadArrays(scanIndex)
+	if err != nil {
+		return s, err
+	}
+	for key := range arrays {
+		if key != "MS:1000514" && key != "MS:1000515" { // m/z array, intensity array
+			r.add("binary data array " + key)
+		}
+	}
+
+	precursors, err := f.Precursors(scanIndex)
+	if err != nil {
+		return s, err
+	}
+	for _, p := range precursors {
+		if !math.IsNaN(p.CollisionEnergy) {
+			if !math.IsNaN(s.CollisionEnergy) && s.CollisionEnergy != p.CollisionEnergy {
+				r.add("different collision energies of precursors")
+			}
+			s.CollisionEnergy = p.CollisionEnergy
+		}
+		if !math.IsNaN(p.NormalizedCollisionEnergy) {
+			r.add("normalized collision energy")
+		}
+		activation := activationToMzXML(p.Activation, r)
+		windowWideness := p.IsolationWindow.LowerOffset + p.IsolationWindow.UpperOffset
+		ions := p.SelectedIons
+		if len(ions) == 0 {
+			// Use the isolation window as precursor
+			if math.IsNaN(p.IsolationWindow.TargetMz) {
+				r.add("precursor without m/z")
+				continue
+			}
+			ions = []mzml.SelectedIon{{Mz: p.IsolationWindow.TargetMz, Intensity: math.NaN()}}
+		}
+		for _, ion := range ions {
+			if math.IsNaN(ion.Mz) {
+				r.add("selected ion without m/z")
+				continue
+			}
+			s.Precursors = append(s.Precursors, mzxml.Precursor{
+				Mz:               ion.Mz,
+				ScanIndex:        int64(p.ScanIndex),
+				Charge:           ion.Charge,
+				PossibleCharges:  ion.PossibleCharges,
+				Intensity:        ion.Intensity,
+				WindowWideness:   windowWideness,
+				ActivationMethod: activation,
+			})
+		}
+	}
+	return s, nil
+}
+
+// activationToMzXML returns the mzXML activation method for
+// the CV terms of the dissociation methods
+func activationToMzXML(activation []string, r *report) string {
+	if len(activation) == 0 {
+		return ``
+	}
+	for _, m := range activationMethods {
+		if sameTerms(m.accessions, activation) {
+			return m.name
+		}
+	}
+	r.add("activation method " + strings.Join(activation, "+"))
+	return ``
+}
+
+// sameTerms returns true if a and b contain the same CV terms
+func sameTerms(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			if x == y {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// instrumentToMzXML converts an instrument configuration.
+// The CV term names are used as mzXML values.
+func instrumentToMzXML(conf *mzml.InstrumentConfiguration, r *report) mzxml.Instrument {
+	var instr mzxml.Instrument
+	for _, cvPar := range conf.CvPar {
+		if cvPar.Accession == "MS:1000529" { // instrument serial number
+			r.add("instrument serial number")
+			continue
+		}
+		if instr.Model == `` {
+			instr.Model = cvPar.Name
+			if cvPar.Value != `` {
+				instr.Model = cvPar.Value
+			}
+		}
+	}
+	for _, c := range conf.Components {
+		if len(c.CvPar) == 0 {
+			continue
+		}
+		name := c.CvPar[0].Name
+		var value *string
+		switch c.Kind {
+		case "source":
+			value = &instr.Ionisation
+		case "analyzer":
+			value = &instr.MassAnalyzer
+		case "detector":
+			value = &instr.Detector
+		default:
+			continue
+		}
+		if *value != `` {
+			r.add("additional instrument " + c.Kind)
+			continue
+		}
+		*value = name
+	}
+	return instr
+}
+
+// sourceFileName returns the full name of a source file
+func sourceFileName(sf *mzml.SourceFile) string {
+	location := strings.TrimPrefix(sf.Location, "file://")
+	if location == `` {
+		return sf.Name
+	}
+	return path.Join(location, sf.Name)
+}
+
+// cvValue returns the value of a CV param, or an empty string
+// if it's not present
+func cvValue(cvPar []mzml.CVParam, accession string) string {
+	for _, cvParam := range cvPar {
+		if cvParam.Accession == accession {
+			return cvParam.Value
+		}
+	}
+	return ``
+}
@@ -29,23 +29,28 @@ import (
 //   print prots with no peptides that can be measured or uniquely identified, e.g. because of mass range, ionizability
 //
 func Analyse(f Fasta, enzyme digest.Enzyme) {
+	AnalyseSource(f.Each, enzyme)
+}
+
+// AnalyseSource analyses the proteins of a Source, see Analyse
+func AnalyseSource(src Source, enzyme digest.Enzyme) error {
 	e := elements.New()
 	pepProteins := make(map[string][]Prot)
 	maxOccur := 0
 	f6to30 := func(s string) bool { l := len(s); return l >= 6 && l <= 30 }
 	dig := digest.New(0, 1, f6to30, enzyme)
 	sep := ``
-	for _, p := range f.Prots() {
+	err := src(func(p Prot) error {
 		seq := p.Sequence()
 		m, err := molecule.PepProt(seq)
 		if err != nil {
 			log.Printf("Can't convert protein seq to chemical formula for %s %s: %v\n", p.ID(), seq, err)
-			continue
+			return nil
 		}
 		minm, maxm, err := mass.MinMax(m, e)
 		if err != nil {
 			log.Printf("Can't compute mass for %v: %v\n", m, err)
-			continue
+			return nil
 		}
 		fmt.Printf("%s%s %s\n", sep, p.ID(), p.Description())
 		sep = "\n"
@@ -58,11 +63,15 @@ func Analyse(f Fasta, enzyme digest.Enzyme) {
 				maxOccur = len(pepProteins[pep])
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 	occurCnt := make([]string, maxOccur+1)
 	for pep, prots := range pepProteins {
 		occurCnt[len(prots)] = pep
 	}
 	fmt.Printf("The most peptide (%s) occurs in %d proteins\n", occurCnt[len(occurCnt)-1], len(occurCnt))
-
+	return nil
 }
@@ -0,0 +1,173 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package fasta
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+
+	"github.com/524D/galms/digest"
+)
+
+// DecoyMethod is the method used to create decoy sequences
+type DecoyMethod int
+
+// Supported decoy methods
+const (
+	// Reverse reverses the protein sequence
+	Reverse DecoyMethod = iota
+	// PseudoReverse reverses each peptide, keeping the cleavage residues in place
+	PseudoReverse
+	// Shuffle shuffles each peptide, keeping the cleavage residues in place
+	Shuffle
+)
+
+// DefaultDecoyPrefix is the usual prefix of decoy protein IDs
+const DefaultDecoyPrefix = "DECOY_"
+
+// Number of times a peptide is shuffled to obtain a peptide that is not in the target
+const maxShuffles = 10
+
+var ErrUnknownDecoyMethod = errors.New("fasta: unknown decoy method")
+
+var decoyMethodNames = []string{`reverse`, `pseudo-reverse`, `shuffle`}
+
+// ParseDecoyMethod returns the decoy method with the given name:
+// reverse, pseudo-reverse or shuffle
+func ParseDecoyMethod(name string) (DecoyMethod, error) {
+	for i, n := range decoyMethodNames {
+		if strings.EqualFold(name, n) {
+			return DecoyMethod(i), nil
+		}
+	}
+	return Reverse, ErrUnknownDecoyMethod
+}
+
+// String returns the name of the decoy method
+func (m DecoyMethod) String() string {
+	if m < 0 || int(m) >= len(decoyMethodNames) {
+		return `unknown`
+	}
+	return decoyMethodNames[m]
+}
+
+// DecoyGenerator creates decoy proteins
+type DecoyGenerator struct {
+	method DecoyMethod
+	enzyme digest.Enzyme
+	rnd    *rand.Rand
+}
+
+// NewDecoyGenerator returns a new DecoyGenerator. The enzyme determines the
+// cleavage sites for pseudo-reversal and shuffling, if nil Trypsin is used.
+// The seed initializes the random generator for shuffling, so that the
+// same seed produces the same decoys.
+func NewDecoyGenerator(method DecoyMethod, enzyme digest.Enzyme, seed int64) *DecoyGenerator {
+	if enzyme == nil {
+		enzyme = digest.Trypsin
+	}
+	return &DecoyGenerator{
+		method: method,
+		enzyme: enzyme,
+		rnd:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Decoys returns a FASTA with a decoy for each protein in f. The ID of each
+// decoy is the target ID with the given prefix. When shuffling, peptides
+// that occur in the target proteins are avoided where possible.
+func (g *DecoyGenerator) Decoys(f Fasta, prefix string) (Fasta, error) {
+	var decoys Fasta
+	var targetPeps map[string]bool
+	if g.method == Shuffle {
+		targetPeps = make(map[string]bool)
+		for _, p := range f.prot {
+			for _, pep := range g.peptides(p.seq) {
+				targetPeps[pep] = true
+			}
+		}
+	}
+	for _, p := range f.prot {
+		var seq string
+		switch g.method {
+		case Reverse:
+			seq = ReverseSequence(p.seq)
+		case PseudoReverse:
+			seq = g.pseudoReverse(p.seq)
+		case Shuffle:
+			seq = g.shuffle(p.seq, targetPeps)
+		default:
+			return decoys, ErrUnknownDecoyMethod
+		}
+		decoys.prot = append(decoys.prot, Prot{id: prefix + p.id, desc: p.desc, seq: seq})
+	}
+	return decoys, nil
+}
+
+// ReverseSequence returns the reversed sequence
+func ReverseSequence(seq string) string {
+	b := []byte(seq)
+	reverse(b)
+	return string(b)
+}
+
+// peptides splits a sequence at all cleavage sites
+func (g *DecoyGenerator) peptides(seq string) []string {
+	var peps []string
+	prev := 0
+	for i := 1; i < len(seq); i++ {
+		if g.enzyme(seq, i) {
+			peps = append(peps, seq[prev:i])
+			prev = i
+		}
+	}
+	return append(peps, seq[prev:])
+}
+
+// pseudoReverse reverses each peptide, except for its C-terminal residue.
+// The last peptide of the protein is reversed completely.
+func (g *DecoyGenerator) pseudoReverse(seq string) string {
+	peps := g.peptides(seq)
+	var sb strings.Builder
+	for i, pep := range peps {
+		b := []byte(pep)
+		if i < len(peps)-1 {
+			reverse(b[:len(b)-1])
+		} else {
+			reverse(b)
+		}
+		sb.Write(b)
+	}
+	return sb.String()
+}
+
+// shuffle shuffles each peptide, except for its C-terminal residue. The
+// last peptide of the protein is shuffled completely. A shuffled peptide
+// that is present in targetPeps is shuffled again.
+func (g *DecoyGenerator) shuffle(seq string, targetPeps map[string]bool) string {
+	peps := g.peptides(seq)
+	var sb strings.Builder
+	for i, pep := range peps {
+		b := []byte(pep)
+		s := b
+		if i < len(peps)-1 {
+			s = b[:len(b)-1]
+		}
+		for n := 0; n < maxShuffles; n++ {
+			g.rnd.Shuffle(len(s), func(i, j int) { s[i], s[j] = s[j], s[i] })
+			if !targetPeps[string(b)] {
+				break
+			}
+		}
+		sb.Write(b)
+	}
+	return sb.String()
+}
+
+func reverse(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package fasta
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/524D/galms/digest"
+)
+
+const testDecoyFasta = `>P1 Protein one
+MAGICKPEPTIDERAAAK
+>P2 Protein two
+SAMPLERQQQ
+`
+
+func TestDecoys(t *testing.T) {
+	f, err := Read(strings.NewReader(testDecoyFasta))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	tests := []struct {
+		method DecoyMethod
+		want   []string
+	}{
+		{Reverse, []string{"KAAAREDITPEPKCIGAM", "QQQRELPMAS"}},
+		// Trypsin doesn't cleave KP, so MAGICKPEPTIDER is a single peptide
+		{PseudoReverse, []string{"EDITPEPKCIGAMRKAAA", "ELPMASRQQQ"}},
+	}
+	for _, tt := range tests {
+		g := NewDecoyGenerator(tt.method, digest.Trypsin, 1)
+		d, err := g.Decoys(f, DefaultDecoyPrefix)
+		if err != nil {
+			t.Fatalf("Decoys %v: error return %v", tt.method, err)
+		}
+		prots := d.Prots()
+		if len(prots) != 2 {
+			t.Fatalf("Decoys %v: %d proteins, should be 2", tt.method, len(prots))
+		}
+		for i, p := range prots {
+			if p.Sequence() != tt.want[i] {
+				t.Errorf("Decoys %v: sequence %s, should be %s", tt.method, p.Sequence(), tt.want[i])
+			}
+			if p.ID() != DefaultDecoyPrefix+f.Prots()[i].ID() || p.Description() != f.Prots()[i].Description() {
+				t.Errorf("Decoys %v: ID %s description %s", tt.method, p.ID(), p.Description())
+			}
+		}
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	f, err := Read(strings.NewReader(testDecoyFasta))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	decoys := func(seed int64) []Prot {
+		d, err := NewDecoyGenerator(Shuffle, nil, seed).Decoys(f, "REV_")
+		if err != nil {
+			t.Fatalf("Decoys: error return %v", err)
+		}
+		return d.Prots()
+	}
+	d1 := decoys(42)
+	d2 := decoys(42)
+	g := NewDecoyGenerator(Shuffle, nil, 0)
+	targetPeps := make(map[string]bool)
+	for _, p := range f.Prots() {
+		for _, pep := range g.peptides(p.Sequence()) {
+			targetPeps[pep] = true
+		}
+	}
+	for i, p := range d1 {
+		if p.Sequence() != d2[i].Sequence() {
+			t.Errorf("Shuffle: same seed gives %s and %s", p.Sequence(), d2[i].Sequence())
+		}
+		if sortedSeq(p.Sequence()) != sortedSeq(f.Prots()[i].Sequence()) {
+			t.Errorf("Shuffle: %s is not a permutation of %s", p.Sequence(), f.Prots()[i].Sequence())
+		}
+		peps := g.peptides(p.Sequence())
+		for _, pep := range peps {
+			if len(pep) > 4 && targetPeps[pep] {
+				t.Errorf("Shuffle: decoy peptide %s is in target", pep)
+			}
+		}
+	}
+	if !strings.HasPrefix(d1[0].ID(), "REV_") {
+		t.Errorf("Shuffle: ID %s should start with REV_", d1[0].ID())
+	}
+}
+
+func TestParseDecoyMethod(t *testing.T) {
+	for _, m := range []DecoyMethod{Reverse, PseudoReverse, Shuffle} {
+		got, err := ParseDecoyMethod(strings.ToUpper(m.String()))
+		if err != nil || got != m {
+			t.Errorf("ParseDecoyMethod(%s): got %v, error return %v", m, got, err)
+		}
+	}
+	_, err := ParseDecoyMethod("random")
+	if err != ErrUnknownDecoyMethod {
+		t.Errorf("ParseDecoyMethod: error return %v, should be %v", err, ErrUnknownDecoyMethod)
+	}
+}
+
+func sortedSeq(s string) string {
+	b := []byte(s)
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	return string(b)
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package fasta
+
+import (
+	"strings"
+
+	"github.com/524D/galms/digest"
+)
+
+// Expand selects the PEFF annotations that are expanded when digesting
+type Expand int
+
+// PEFF annotations that can be expanded
+const (
+	ExpandVariants Expand = 1 << iota
+	ExpandMods
+)
+
+// DigestProt digests a protein. Depending on expand, peptides that contain
+// a PEFF annotated variant or modified residue are added. Modified residues
+// are followed by the accession (or name) of the modification between
+// brackets, e.g. PEPS[UNIMOD:21]TIDE. Each added peptide contains a
+// single variant or modification.
+func DigestProt(dig *digest.Digestor, p Prot, expand Expand) ([]string, error) {
+	peps := dig.Cut(p.seq)
+	if expand == 0 {
+		return peps, nil
+	}
+	e, err := p.PEFF()
+	if err != nil {
+		return peps, err
+	}
+	seen := make(map[string]bool)
+	for _, pep := range peps {
+		seen[pep] = true
+	}
+	if expand&ExpandMods != 0 {
+		basePeps, _ := unique(peps)
+		for _, m := range e.Mods {
+			id := m.Accession
+			if id == `` {
+				id = m.Name
+			}
+			for _, pos := range m.Positions {
+				for _, pep := range basePeps {
+					for _, start := range occurrences(p.seq, pep) {
+						i := pos - 1 - start
+						if i < 0 || i >= len(pep) {
+							continue
+						}
+						modPep := pep[:i+1] + "[" + id + "]" + pep[i+1:]
+						if !seen[modPep] {
+							seen[modPep] = true
+							peps = append(peps, modPep)
+						}
+					}
+				}
+			}
+		}
+	}
+	if expand&ExpandVariants != 0 {
+		for _, v := range e.Variants {
+			seq, ok := v.apply(p.seq)
+			if !ok {
+				continue
+			}
+			for _, pep := range dig.Cut(seq) {
+				if !seen[pep] {
+					seen[pep] = true
+					peps = append(peps, pep)
+				}
+			}
+		}
+	}
+	return peps, nil
+}
+
+// apply returns the sequence with the variant applied. It returns
+// false if the variant doesn't fit the sequence.
+func (v *Variant) apply(seq string) (string, bool) {
+	if v.Start < 1 || v.End < v.Start || v.End > len(seq) {
+		return ``, false
+	}
+	for _, aa := range v.Seq {
+		if aa < 'A' || aa > 'Z' {
+			return ``, false
+		}
+	}
+	return seq[:v.Start-1] + v.Seq + seq[v.End:], true
+}
+
+// occurrences returns the start positions of all occurrences of pep in seq
+func occurrences(seq string, pep string) []int {
+	var pos []int
+	for offset := 0; ; {
+		i := strings.Index(seq[offset:], pep)
+		if i < 0 {
+			return pos
+		}
+		pos = append(pos, offset+i)
+		offset += i + 1
+	}
+}
@@ -4,12 +4,9 @@
 package fasta
 
 import (
-	"bufio"
 	"fmt"
 	"io"
-	"regexp"
 	"strconv"
-	"strings"
 )
 
 // Fasta wraps the contents of the FASTA file
@@ -27,51 +24,32 @@ type Prot struct {
 // Filter should return true if sequence must be stored
 type Filter func(Prot) bool
 
-func (f *Fasta) appendProtFiltered(prot Prot, filter Filter, fArgs ...interface{}) {
-	if filter == nil || filter(prot) {
-		if prot.id != `` || prot.desc != `` || prot.seq != `` {
-			f.prot = append(f.prot, prot)
-		}
-	}
-}
-
 // ReadFiltered reads an FASTA file from an io.Reader,
-// only storing the entries where the filter function returns 'true'
+// only storing the entries where the filter function returns 'true'.
+// Use Reader to process large files without storing all entries.
 func ReadFiltered(reader io.Reader, filter Filter) (Fasta, error) {
-	var fasta Fasta
-	var prot Prot
-	re := regexp.MustCompile(`>([^ \t]*)(?:[ \t]+(.+)?)?`)
+	return readFiltered(reader, filter, nil)
+}
 
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		l := scanner.Text()
-		if strings.HasPrefix(l, "#") {
-			// Skip PEFF header
-		} else if strings.HasPrefix(l, ">") {
-			fasta.appendProtFiltered(prot, filter)
-			m := re.FindStringSubmatch(l)
-			if m == nil || len(m) < 2 || m[1] == `` {
-				// Parsing ID/description failed
-				// Make up a fake ID
-				prot.id = `DUMMY_ID_` + strconv.FormatInt(int64(len(fasta.prot))+1, 10)
-			} else {
-				prot.id = m[1]
-				if len(m) >= 3 {
-					prot.desc = m[2]
-				} else {
-					prot.desc = ``
-				}
-			}
-			prot.seq = ``
-		} else {
-			// Add to sequence, remove superfluous spacing
-			prot.seq += strings.TrimSpace(l)
-		}
+// readFiltered reads an FASTA file, header lines starting with '#'
+// are passed to the header function, or skipped if it is nil
+func readFiltered(reader io.Reader, filter Filter, header func(string) error) (Fasta, error) {
+	var fasta Fasta
+	r, err := NewReader(reader)
+	if err != nil {
+		return fasta, err
 	}
-	fasta.appendProtFiltered(prot, filter)
-
-	err := scanner.Err()
-
+	r.header = header
+	err = r.Each(func(prot Prot) error {
+		if r.retDummy {
+			// Number made up IDs by the stored entries
+			prot.id = `DUMMY_ID_` + strconv.Itoa(len(fasta.prot)+1)
+		}
+		if filter == nil || filter(prot) {
+			fasta.prot = append(fasta.prot, prot)
+		}
+		return nil
+	})
 	return fasta, err
 }
 
@@ -82,9 +60,14 @@ func Read(reader io.Reader) (Fasta, error) {
 
 // Write writes a new FASTA file to an io.writer
 func (f *Fasta) Write(writer io.Writer) error {
+	return f.write(writer, "\t")
+}
+
+// write writes the entries, sep separates the ID and description
+func (f *Fasta) write(writer io.Writer, sep string) error {
 	seqLineLen := 60
 	for _, p := range f.prot {
-		fmt.Fprintf(writer, ">%s\t%s\n", p.id, p.desc)
+		fmt.Fprintf(writer, ">%s%s%s\n", p.id, sep, p.desc)
 		i := 0
 		l := ``
 		for _, a := range p.seq {
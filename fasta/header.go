@@ -0,0 +1,186 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package fasta
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Header contains the fields of a FASTA header. Fields that are not
+// present in the header are empty or 0.
+type Header struct {
+	Database         string // e.g. "sp", "tr", "ref" or "ENSEMBL"
+	Accession        string // Accession without sequence version
+	EntryName        string // UniProt entry name, e.g. "ALBU_HUMAN"
+	ProteinName      string
+	Organism         string
+	TaxonomyID       int
+	GeneName         string
+	ProteinExistence int // UniProt protein existence level (1-5)
+	SequenceVersion  int
+}
+
+// HeaderParser parses the ID and description of a FASTA entry.
+// It returns false if the header is not in the format of the parser.
+type HeaderParser func(id string, desc string) (Header, bool)
+
+// DefaultHeaderParsers are tried in order by ParseHeader.
+// GenericHeader must be last, because it accepts any header.
+var DefaultHeaderParsers = []HeaderParser{PEFFHeader, UniProtHeader, RefSeqHeader, EnsemblHeader, GenericHeader}
+
+// ParseHeader parses the ID and description of a FASTA entry with the
+// first parser that accepts it. If no parsers are given,
+// DefaultHeaderParsers are used.
+func ParseHeader(id string, desc string, parsers ...HeaderParser) Header {
+	if len(parsers) == 0 {
+		parsers = DefaultHeaderParsers
+	}
+	for _, parse := range parsers {
+		if h, ok := parse(id, desc); ok {
+			return h
+		}
+	}
+	return Header{}
+}
+
+// Header returns the parsed header of the protein
+func (p *Prot) Header() Header {
+	return ParseHeader(p.id, p.desc)
+}
+
+var uniProtTagRe = regexp.MustCompile(`(?:^|\s)(OS|OX|GN|PE|SV)=`)
+
+// UniProtHeader parses UniProtKB headers, e.g.
+// >sp|P02768|ALBU_HUMAN Albumin OS=Homo sapiens OX=9606 GN=ALB PE=1 SV=2
+func UniProtHeader(id string, desc string) (Header, bool) {
+	f := strings.Split(id, "|")
+	if len(f) != 3 || (f[0] != "sp" && f[0] != "tr") {
+		return Header{}, false
+	}
+	h := Header{Database: f[0], Accession: f[1], EntryName: f[2]}
+	tags := uniProtTagRe.FindAllStringSubmatchIndex(desc, -1)
+	if len(tags) == 0 {
+		h.ProteinName = strings.TrimSpace(desc)
+		return h, true
+	}
+	h.ProteinName = strings.TrimSpace(desc[:tags[0][0]])
+	for i, t := range tags {
+		end := len(desc)
+		if i+1 < len(tags) {
+			end = tags[i+1][0]
+		}
+		v := strings.TrimSpace(desc[t[1]:end])
+		switch desc[t[2]:t[3]] {
+		case "OS":
+			h.Organism = v
+		case "OX":
+			h.TaxonomyID, _ = strconv.Atoi(v)
+		case "GN":
+			h.GeneName = v
+		case "PE":
+			h.ProteinExistence, _ = strconv.Atoi(v)
+		case "SV":
+			h.SequenceVersion, _ = strconv.Atoi(v)
+		}
+	}
+	return h, true
+}
+
+var refSeqAccRe = regexp.MustCompile(`^([ANWXYZ]P_\d+)(?:\.(\d+))?$`)
+
+// RefSeqHeader parses NCBI RefSeq protein headers, e.g.
+// >NP_000468.1 albumin preproprotein [Homo sapiens]
+// >gi|4502027|ref|NP_000468.1| albumin preproprotein [Homo sapiens]
+func RefSeqHeader(id string, desc string) (Header, bool) {
+	f := strings.Split(strings.TrimSuffix(id, "|"), "|")
+	acc := f[0]
+	for i := 0; i+1 < len(f); i++ {
+		if f[i] == "ref" {
+			acc = f[i+1]
+		}
+	}
+	m := refSeqAccRe.FindStringSubmatch(acc)
+	if m == nil {
+		return Header{}, false
+	}
+	h := Header{Database: "ref", Accession: m[1]}
+	h.SequenceVersion, _ = strconv.Atoi(m[2])
+	h.ProteinName = strings.TrimSpace(desc)
+	if strings.HasSuffix(h.ProteinName, "]") {
+		if i := strings.LastIndex(h.ProteinName, "["); i >= 0 {
+			h.Organism = h.ProteinName[i+1 : len(h.ProteinName)-1]
+			h.ProteinName = strings.TrimSpace(h.ProteinName[:i])
+		}
+	}
+	return h, true
+}
+
+var ensemblAccRe = regexp.MustCompile(`^(ENS[A-Z]*P\d+)(?:\.(\d+))?$`)
+
+// EnsemblHeader parses Ensembl peptide headers, e.g.
+// >ENSP00000295897.4 pep chromosome:GRCh38:4:73404256:73421482:1 gene:ENSG00000163631.17
+// transcript:ENST00000295897.9 gene_biotype:protein_coding transcript_biotype:protein_coding
+// gene_symbol:ALB description:albumin [Source:HGNC Symbol;Acc:HGNC:399]
+func EnsemblHeader(id string, desc string) (Header, bool) {
+	m := ensemblAccRe.FindStringSubmatch(id)
+	if m == nil {
+		return Header{}, false
+	}
+	h := Header{Database: "ENSEMBL", Accession: m[1]}
+	h.SequenceVersion, _ = strconv.Atoi(m[2])
+	if i := strings.Index(desc, "description:"); i >= 0 {
+		h.ProteinName = desc[i+len("description:"):]
+		desc = desc[:i]
+		if j := strings.Index(h.ProteinName, " [Source:"); j >= 0 {
+			h.ProteinName = h.ProteinName[:j]
+		}
+		h.ProteinName = strings.TrimSpace(h.ProteinName)
+	}
+	for _, field := range strings.Fields(desc) {
+		if strings.HasPrefix(field, "gene_symbol:") {
+			h.GeneName = strings.TrimPrefix(field, "gene_symbol:")
+		}
+	}
+	return h, true
+}
+
+// GenericHeader accepts any header, the ID is used as accession
+// and the description as protein name
+func GenericHeader(id string, desc string) (Header, bool) {
+	return Header{Accession: id, ProteinName: strings.TrimSpace(desc)}, true
+}
+
+// HeaderFilter returns a Filter that selects proteins on their parsed header
+func HeaderFilter(keep func(Header) bool) Filter {
+	return func(p Prot) bool {
+		return keep(p.Header())
+	}
+}
+
+// TaxonomyFilter returns a Filter that selects proteins of the given taxonomy IDs
+func TaxonomyFilter(taxIDs ...int) Filter {
+	return HeaderFilter(func(h Header) bool {
+		for _, id := range taxIDs {
+			if h.TaxonomyID == id {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// GeneFilter returns a Filter that selects proteins of the given genes,
+// gene names are compared case-insensitive
+func GeneFilter(genes ...string) Filter {
+	return HeaderFilter(func(h Header) bool {
+		for _, g := range genes {
+			if strings.EqualFold(h.GeneName, g) {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package fasta
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		desc string
+		want Header
+	}{
+		{
+			name: "UniProt",
+			id:   "sp|P02768|ALBU_HUMAN",
+			desc: "Albumin OS=Homo sapiens OX=9606 GN=ALB PE=1 SV=2",
+			want: Header{Database: "sp", Accession: "P02768", EntryName: "ALBU_HUMAN", ProteinName: "Albumin",
+				Organism: "Homo sapiens", TaxonomyID: 9606, GeneName: "ALB", ProteinExistence: 1, SequenceVersion: 2},
+		},
+		{
+			name: "UniProt without gene",
+			id:   "tr|A0A024R161|A0A024R161_HUMAN",
+			desc: "Guanine nucleotide-binding protein subunit gamma OS=Homo sapiens (Human) OX=9606 PE=3 SV=1",
+			want: Header{Database: "tr", Accession: "A0A024R161", EntryName: "A0A024R161_HUMAN",
+				ProteinName: "Guanine nucleotide-binding protein subunit gamma", Organism: "Homo sapiens (Human)",
+				TaxonomyID: 9606, ProteinExistence: 3, SequenceVersion: 1},
+		},
+		{
+			name: "RefSeq",
+			id:   "NP_000468.1",
+			desc: "albumin preproprotein [Homo sapiens]",
+			want: Header{Database: "ref", Accession: "NP_000468", ProteinName: "albumin preproprotein",
+				Organism: "Homo sapiens", SequenceVersion: 1},
+		},
+		{
+			name: "RefSeq with gi",
+			id:   "gi|4502027|ref|NP_000468.1|",
+			desc: "albumin preproprotein [Homo sapiens]",
+			want: Header{Database: "ref", Accession: "NP_000468", ProteinName: "albumin preproprotein",
+				Organism: "Homo sapiens", SequenceVersion: 1},
+		},
+		{
+			name: "Ensembl",
+			id:   "ENSP00000295897.4",
+			desc: "pep chromosome:GRCh38:4:73404256:73421482:1 gene:ENSG00000163631.17 transcript:ENST00000295897.9 " +
+				"gene_biotype:protein_coding transcript_biotype:protein_coding gene_symbol:ALB " +
+				"description:albumin [Source:HGNC Symbol;Acc:HGNC:399]",
+			want: Header{Database: "ENSEMBL", Accession: "ENSP00000295897", ProteinName: "albumin",
+				GeneName: "ALB", SequenceVersion: 4},
+		},
+		{
+			name: "Generic",
+			id:   "PROT1",
+			desc: "Some protein",
+			want: Header{Accession: "PROT1", ProteinName: "Some protein"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseHeader(tt.id, tt.desc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseHeader() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Custom parser takes precedence
+	custom := func(id string, desc string) (Header, bool) {
+		return Header{Database: "custom", Accession: strings.ToLower(id)}, true
+	}
+	if got := ParseHeader("ABC", ``, custom); got.Database != "custom" || got.Accession != "abc" {
+		t.Errorf("ParseHeader() with custom parser = %+v", got)
+	}
+}
+
+func TestHeaderFilter(t *testing.T) {
+	in := `>sp|P02768|ALBU_HUMAN Albumin OS=Homo sapiens OX=9606 GN=ALB PE=1 SV=2
+MKWVTFISLLFLFSSAYS
+>sp|P07724|ALBU_MOUSE Albumin OS=Mus musculus OX=10090 GN=Alb PE=1 SV=3
+MKWVTFLLLLFVSGSAFS
+>sp|P69905|HBA_HUMAN Hemoglobin subunit alpha OS=Homo sapiens OX=9606 GN=HBA1 PE=1 SV=2
+MVLSPADKTNVKAAWGKV
+`
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"taxonomy", TaxonomyFilter(9606), []string{"sp|P02768|ALBU_HUMAN", "sp|P69905|HBA_HUMAN"}},
+		{"gene", GeneFilter("alb"), []string{"sp|P02768|ALBU_HUMAN", "sp|P07724|ALBU_MOUSE"}},
+		{"header", HeaderFilter(func(h Header) bool { return h.SequenceVersion == 3 }), []string{"sp|P07724|ALBU_MOUSE"}},
+	}
+	for _, tt := range tests {
+		f, err := ReadFiltered(strings.NewReader(in), tt.filter)
+		if err != nil {
+			t.Fatalf("ReadFiltered %s: error return %v", tt.name, err)
+		}
+		var got []string
+		for _, p := range f.Prots() {
+			got = append(got, p.ID())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ReadFiltered %s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package fasta
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// IndexEntry is an entry of a .fai index, as created by samtools faidx
+type IndexEntry struct {
+	Name      string // ID of the protein
+	Length    int64  // Length of the sequence
+	Offset    int64  // Offset in the file of the first residue
+	LineBases int64  // Number of residues per line
+	LineWidth int64  // Number of bytes per line, including the line end
+}
+
+// Index is a .fai index of a FASTA file
+type Index struct {
+	entries  []IndexEntry
+	name2idx map[string]int // Index of entries by name and by accession
+}
+
+// IndexedFasta retrieves proteins from an uncompressed FASTA file using its index
+type IndexedFasta struct {
+	r   io.ReaderAt
+	idx *Index
+}
+
+var (
+	ErrInvalidIndex  = errors.New("fasta: invalid index")
+	ErrLineLength    = errors.New("fasta: sequence lines have different length")
+	ErrDuplicateName = errors.New("fasta: duplicate name")
+	ErrNotFound      = errors.New("fasta: name or accession not found")
+	ErrInvalidRegion = errors.New("fasta: invalid region")
+)
+
+// BuildIndex reads an uncompressed FASTA file and returns its index.
+// Within an entry, all sequence lines except the last must have the same length.
+func BuildIndex(reader io.Reader) (Index, error) {
+	var idx Index
+	br := bufio.NewReader(reader)
+	var e *IndexEntry
+	var offset int64
+	lastLine := false // A shorter line was seen, this must be the last line
+	var long []byte
+	for lineNr := 1; ; lineNr++ {
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			long = append(long[:0], line...)
+			for err == bufio.ErrBufferFull {
+				line, err = br.ReadSlice('\n')
+				long = append(long, line...)
+			}
+			line = long
+		}
+		if err != nil && err != io.EOF {
+			return idx, err
+		}
+		width := int64(len(line))
+		bases := int64(len(bytes.TrimRight(line, "\r\n")))
+		switch {
+		case bases > 0 && line[0] == '#':
+			// PEFF header
+		case bases > 0 && line[0] == '>':
+			name := string(bytes.TrimRight(line[1:], "\r\n"))
+			if i := strings.IndexAny(name, " \t"); i >= 0 {
+				name = name[:i]
+			}
+			idx.entries = append(idx.entries, IndexEntry{Name: name, Offset: offset + width})
+			e = &idx.entries[len(idx.entries)-1]
+			lastLine = false
+		case e != nil && bases == 0:
+			// Empty line, only allowed at the end of the entry
+			lastLine = e.Length > 0
+		case e != nil:
+			if lastLine || (e.LineBases > 0 && bases > e.LineBases) {
+				return idx, fmt.Errorf("%w: line %d", ErrLineLength, lineNr)
+			}
+			if e.LineBases == 0 {
+				// Empty lines may precede the sequence
+				e.Offset = offset
+				e.LineBases, e.LineWidth = bases, width
+			} else if bases < e.LineBases || width != e.LineWidth {
+				lastLine = true
+			}
+			e.Length += bases
+		case bases > 0:
+			return idx, fmt.Errorf("%w: sequence before first header", ErrInvalidIndex)
+		}
+		offset += width
+		if err == io.EOF {
+			break
+		}
+	}
+	return idx, idx.buildMap()
+}
+
+// ReadIndex reads a .fai index
+func ReadIndex(reader io.Reader) (Index, error) {
+	var idx Index
+	scanner := bufio.NewScanner(reader)
+	for lineNr := 1; scanner.Scan(); lineNr++ {
+		f := strings.Split(scanner.Text(), "\t")
+		if len(f) < 5 {
+			return idx, fmt.Errorf("%w: line %d", ErrInvalidIndex, lineNr)
+		}
+		e := IndexEntry{Name: f[0]}
+		for i, v := range []*int64{&e.Length, &e.Offset, &e.LineBases, &e.LineWidth} {
+			var err error
+			*v, err = strconv.ParseInt(f[i+1], 10, 64)
+			if err != nil {
+				return idx, fmt.Errorf("%w: line %d", ErrInvalidIndex, lineNr)
+			}
+		}
+		// Only empty sequences may have no residues per line
+		if e.Length < 0 || e.Offset < 0 || e.LineWidth < e.LineBases ||
+			(e.LineBases <= 0 && e.Length > 0) {
+			return idx, fmt.Errorf("%w: line %d", ErrInvalidIndex, lineNr)
+		}
+		idx.entries = append(idx.entries, e)
+	}
+	err := scanner.Err()
+	if err != nil {
+		return idx, err
+	}
+	return idx, idx.buildMap()
+}
+
+// Write writes the index in .fai format
+func (idx *Index) Write(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+	for _, e := range idx.entries {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", e.Name, e.Length, e.Offset, e.LineBases, e.LineWidth)
+	}
+	return w.Flush()
+}
+
+// Entries returns the entries of the index, in the order of the FASTA file
+func (idx *Index) Entries() []IndexEntry {
+	return idx.entries
+}
+
+// Entry returns the entry with the given name or accession
+func (idx *Index) Entry(name string) (IndexEntry, error) {
+	i, ok := idx.name2idx[name]
+	if !ok {
+		return IndexEntry{}, ErrNotFound
+	}
+	return idx.entries[i], nil
+}
+
+// buildMap maps names and accessions to entries. Accessions are
+// parsed from the name, e.g. P02768 for sp|P02768|ALBU_HUMAN.
+func (idx *Index) buildMap() error {
+	idx.name2idx = make(map[string]int, len(idx.entries))
+	for i, e := range idx.entries {
+		if _, ok := idx.name2idx[e.Name]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateName, e.Name)
+		}
+		idx.name2idx[e.Name] = i
+	}
+	for i, e := range idx.entries {
+		acc := ParseHeader(e.Name, ``).Accession
+		if _, ok := idx.name2idx[acc]; !ok && acc != `` {
+			idx.name2idx[acc] = i
+		}
+	}
+	return nil
+}
+
+// NewIndexed returns an IndexedFasta that reads from r using the index idx
+func NewIndexed(r io.ReaderAt, idx *Index) *IndexedFasta {
+	return &IndexedFasta{r: r, idx: idx}
+}
+
+// Get returns the protein with the given name or accession
+func (f *IndexedFasta) Get(name string) (Prot, error) {
+	e, err := f.idx.Entry(name)
+	if err != nil {
+		return Prot{}, err
+	}
+	seq, err := f.read(&e, 0, e.Length)
+	if err != nil {
+		return Prot{}, err
+	}
+	p := Prot{id: e.Name, seq: seq}
+	p.desc, err = f.description(&e)
+	return p, err
+}
+
+// Region returns the residues start to end (1-based, inclusive) of the
+// protein with the given name or accession. The end is limited to the
+// length of the protein.
+func (f *IndexedFasta) Region(name string, start int64, end int64) (string, error) {
+	e, err := f.idx.Entry(name)
+	if err != nil {
+		return ``, err
+	}
+	if end > e.Length {
+		end = e.Length
+	}
+	if start < 1 || start > end {
+		return ``, ErrInvalidRegion
+	}
+	return f.read(&e, start-1, end)
+}
+
+// read returns residues start to end (0-based, exclusive end)
+func (f *IndexedFasta) read(e *IndexEntry, start int64, end int64) (string, error) {
+	if start >= end {
+		return ``, nil
+	}
+	pos := func(i int64) int64 {
+		return e.Offset + i/e.LineBases*e.LineWidth + i%e.LineBases
+	}
+	from := pos(start)
+	buf := make([]byte, pos(end-1)+1-from)
+	_, err := f.r.ReadAt(buf, from)
+	if err != nil && err != io.EOF {
+		return ``, err
+	}
+	seq := make([]byte, 0, end-start)
+	for _, c := range buf {
+		if c != '\n' && c != '\r' {
+			seq = append(seq, c)
+		}
+	}
+	if int64(len(seq)) != end-start {
+		return ``, ErrInvalidIndex
+	}
+	return string(seq), nil
+}
+
+// description reads the header line before the sequence and returns the description
+func (f *IndexedFasta) description(e *IndexEntry) (string, error) {
+	end := e.Offset
+	for size := int64(256); ; size *= 2 {
+		from := end - size
+		if from < 0 {
+			from = 0
+		}
+		buf := make([]byte, end-from)
+		_, err := f.r.ReadAt(buf, from)
+		if err != nil && err != io.EOF {
+			return ``, err
+		}
+		buf = bytes.TrimRight(buf, "\r\n")
+		i := bytes.LastIndexByte(buf, '\n')
+		if i < 0 && from > 0 {
+			continue
+		}
+		line := string(buf[i+1:])
+		m := headerRe.FindStringSubmatch(line)
+		if m == nil || m[1] != e.Name {
+			return ``, ErrInvalidIndex
+		}
+		return m[2], nil
+	}
+}
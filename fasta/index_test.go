@@ -0,0 +1,145 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package fasta
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testIndexFasta = ">sp|P02768|ALBU_HUMAN Albumin OS=Homo sapiens\n" +
+	"MKWVTFISLL\n" +
+	"FLFSSAYSRG\n" +
+	"VFRR\n" +
+	">P2\r\n" +
+	"ACDEF\r\n" +
+	"GH\r\n" +
+	">EMPTY nothing\n" +
+	">P3 Single line\n" +
+	"WEARECPM\n"
+
+func TestIndex(t *testing.T) {
+	idx, err := BuildIndex(strings.NewReader(testIndexFasta))
+	if err != nil {
+		t.Fatalf("BuildIndex: error return %v", err)
+	}
+	want := []IndexEntry{
+		{Name: "sp|P02768|ALBU_HUMAN", Length: 24, Offset: 46, LineBases: 10, LineWidth: 11},
+		{Name: "P2", Length: 7, Offset: 78, LineBases: 5, LineWidth: 7},
+		{Name: "EMPTY", Length: 0, Offset: 104},
+		{Name: "P3", Length: 8, Offset: 120, LineBases: 8, LineWidth: 9},
+	}
+	if !reflect.DeepEqual(idx.Entries(), want) {
+		t.Errorf("BuildIndex: got %+v, want %+v", idx.Entries(), want)
+	}
+
+	// Write and read back
+	var sb strings.Builder
+	err = idx.Write(&sb)
+	if err != nil {
+		t.Fatalf("Write: error return %v", err)
+	}
+	if !strings.HasPrefix(sb.String(), "sp|P02768|ALBU_HUMAN\t24\t46\t10\t11\n") {
+		t.Errorf("Write: got %q", sb.String())
+	}
+	idx2, err := ReadIndex(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatalf("ReadIndex: error return %v", err)
+	}
+	if !reflect.DeepEqual(idx, idx2) {
+		t.Errorf("ReadIndex: got %+v, want %+v", idx2, idx)
+	}
+
+	f := NewIndexed(strings.NewReader(testIndexFasta), &idx2)
+	for _, tt := range []struct {
+		name string
+		want Prot
+	}{
+		{"P02768", Prot{id: "sp|P02768|ALBU_HUMAN", desc: "Albumin OS=Homo sapiens", seq: "MKWVTFISLLFLFSSAYSRGVFRR"}},
+		{"P2", Prot{id: "P2", seq: "ACDEFGH"}},
+		{"EMPTY", Prot{id: "EMPTY", desc: "nothing"}},
+		{"P3", Prot{id: "P3", desc: "Single line", seq: "WEARECPM"}},
+	} {
+		p, err := f.Get(tt.name)
+		if err != nil {
+			t.Errorf("Get(%s): error return %v", tt.name, err)
+		} else if p != tt.want {
+			t.Errorf("Get(%s): got %+v, want %+v", tt.name, p, tt.want)
+		}
+	}
+	_, err = f.Get("P4")
+	if err != ErrNotFound {
+		t.Errorf("Get: error return %v, should be %v", err, ErrNotFound)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		start, end int64
+		want       string
+		err        error
+	}{
+		{"P02768", 1, 3, "MKW", nil},
+		{"P02768", 9, 12, "LLFL", nil},
+		{"P02768", 20, 100, "GVFRR", nil},
+		{"P2", 5, 6, "FG", nil},
+		{"P2", 0, 3, ``, ErrInvalidRegion},
+		{"P2", 5, 4, ``, ErrInvalidRegion},
+		{"P5", 1, 2, ``, ErrNotFound},
+	} {
+		got, err := f.Region(tt.name, tt.start, tt.end)
+		if err != tt.err || got != tt.want {
+			t.Errorf("Region(%s, %d, %d): got %q, error return %v", tt.name, tt.start, tt.end, got, err)
+		}
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		err  error
+	}{
+		{"longer line", ">P1\nAAA\nAAAA\n", ErrLineLength},
+		{"line after short line", ">P1\nAAA\nAA\nAAA\n", ErrLineLength},
+		{"empty line inside", ">P1\nAAA\n\nAAA\n", ErrLineLength},
+		{"duplicate", ">P1\nAAA\n>P1\nAAA\n", ErrDuplicateName},
+		{"no header", "AAA\n", ErrInvalidIndex},
+	}
+	for _, tt := range tests {
+		_, err := BuildIndex(strings.NewReader(tt.in))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("BuildIndex %s: error return %v, should be %v", tt.name, err, tt.err)
+		}
+	}
+	for _, in := range []string{
+		"P1\t3\tx\t3\t4\n",
+		"P1\t5\t3\t0\t0\n",
+		"P1\t5\t3\t4\t3\n",
+		"P1\t5\t-3\t4\t5\n",
+		"P1\t-5\t3\t4\t5\n",
+	} {
+		_, err := ReadIndex(strings.NewReader(in))
+		if !errors.Is(err, ErrInvalidIndex) {
+			t.Errorf("ReadIndex %q: error return %v, should be %v", in, err, ErrInvalidIndex)
+		}
+	}
+}
+
+func TestIndexEmptyLineAfterHeader(t *testing.T) {
+	const in = ">a desc\n\nACGT\nAC\n"
+	idx, err := BuildIndex(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("BuildIndex: error return %v", err)
+	}
+	want := []IndexEntry{{Name: "a", Length: 6, Offset: 9, LineBases: 4, LineWidth: 5}}
+	if !reflect.DeepEqual(idx.Entries(), want) {
+		t.Errorf("BuildIndex: got %+v, want %+v", idx.Entries(), want)
+	}
+	p, err := NewIndexed(strings.NewReader(in), &idx).Get("a")
+	if err != nil || p != (Prot{id: "a", desc: "desc", seq: "ACGTAC"}) {
+		t.Errorf("Get(a): got %+v, error return %v", p, err)
+	}
+}
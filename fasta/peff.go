@@ -0,0 +1,384 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package fasta
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PEFF contains the file header of a PEFF (PSI Extended FASTA Format) file
+type PEFF struct {
+	Version   string // e.g. "1.0"
+	Databases []PEFFDatabase
+}
+
+// PEFFDatabase contains the keys of a database section of the file header
+type PEFFDatabase struct {
+	Keys []KeyValue
+}
+
+// KeyValue is a key with its (unparsed) value
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// PEFFEntry contains the annotations of a PEFF entry. Keys that are
+// not parsed into one of the other fields are kept in Keys.
+type PEFFEntry struct {
+	Keys      []KeyValue
+	Length    int
+	Variants  []Variant
+	Mods      []ModRes
+	Processed []Processed
+}
+
+// Variant is a sequence variant. Simple variants replace a single residue.
+type Variant struct {
+	Start   int    // 1-based position of the first replaced residue
+	End     int    // 1-based position of the last replaced residue
+	Seq     string // Replacement sequence, empty for a deletion
+	Tag     string // Optional tag of a simple variant
+	Complex bool   // Stored as \VariantComplex instead of \VariantSimple
+}
+
+// ModRes is a modified residue
+type ModRes struct {
+	Positions []int  // 1-based positions of the modified residues
+	Accession string // e.g. UNIMOD:21 or MOD:00046, empty if not in a CV
+	Name      string
+}
+
+// Processed is a mature protein product, e.g. after removal of a signal peptide
+type Processed struct {
+	Start     int
+	End       int
+	Accession string
+	Name      string
+}
+
+var ErrInvalidPEFF = errors.New("fasta: invalid PEFF")
+
+var peffKeyRe = regexp.MustCompile(`(?:^|\s)\\([A-Za-z]+)=`)
+
+// ReadPEFF reads a PEFF file from an io.Reader, only storing the
+// entries where the filter function returns 'true'
+func ReadPEFF(reader io.Reader, filter Filter) (PEFF, Fasta, error) {
+	var p PEFF
+	inDB := false
+	header := func(l string) error {
+		l = strings.TrimSpace(strings.TrimPrefix(l, "#"))
+		switch {
+		case p.Version == ``:
+			if !strings.HasPrefix(l, "PEFF ") {
+				return fmt.Errorf("%w: missing version", ErrInvalidPEFF)
+			}
+			p.Version = strings.TrimSpace(strings.TrimPrefix(l, "PEFF "))
+		case l == "//":
+			inDB = false
+		case l == ``:
+		default:
+			key, value, ok := strings.Cut(l, "=")
+			if !ok {
+				return fmt.Errorf("%w: header line %q", ErrInvalidPEFF, l)
+			}
+			if !inDB {
+				p.Databases = append(p.Databases, PEFFDatabase{})
+				inDB = true
+			}
+			db := &p.Databases[len(p.Databases)-1]
+			db.Keys = append(db.Keys, KeyValue{Key: strings.TrimSpace(key), Value: strings.TrimSpace(value)})
+		}
+		return nil
+	}
+	f, err := readFiltered(reader, filter, header)
+	if err == nil && p.Version == `` {
+		err = fmt.Errorf("%w: missing version", ErrInvalidPEFF)
+	}
+	return p, f, err
+}
+
+// Write writes the PEFF header followed by the entries of f
+func (p *PEFF) Write(writer io.Writer, f *Fasta) error {
+	_, err := fmt.Fprintf(writer, "# PEFF %s\n", p.Version)
+	if err != nil {
+		return err
+	}
+	for _, db := range p.Databases {
+		for _, kv := range db.Keys {
+			_, err = fmt.Fprintf(writer, "# %s=%s\n", kv.Key, kv.Value)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprint(writer, "# //\n")
+		if err != nil {
+			return err
+		}
+	}
+	return f.write(writer, " ")
+}
+
+// Value returns the value of a key, or an empty string if the key is not present
+func (db *PEFFDatabase) Value(key string) string {
+	return keyValue(db.Keys, key)
+}
+
+// Value returns the value of a key that is kept in Keys,
+// or an empty string if the key is not present
+func (e *PEFFEntry) Value(key string) string {
+	return keyValue(e.Keys, key)
+}
+
+func keyValue(kvs []KeyValue, key string) string {
+	for _, kv := range kvs {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return ``
+}
+
+// PEFF parses the annotations in the description of the protein
+func (p *Prot) PEFF() (PEFFEntry, error) {
+	return ParsePEFFEntry(p.desc)
+}
+
+// SetPEFF replaces the description of the protein by the annotations of e
+func (p *Prot) SetPEFF(e PEFFEntry) {
+	p.desc = e.String()
+}
+
+// ParsePEFFEntry parses the annotations in the description of a PEFF entry
+func ParsePEFFEntry(desc string) (PEFFEntry, error) {
+	var e PEFFEntry
+	keys := peffKeyRe.FindAllStringSubmatchIndex(desc, -1)
+	for i, k := range keys {
+		end := len(desc)
+		if i+1 < len(keys) {
+			end = keys[i+1][0]
+		}
+		key := desc[k[2]:k[3]]
+		value := strings.TrimSpace(desc[k[1]:end])
+		err := e.parseKey(key, value)
+		if err != nil {
+			return e, fmt.Errorf("%w: \\%s=%s", ErrInvalidPEFF, key, value)
+		}
+	}
+	return e, nil
+}
+
+func (e *PEFFEntry) parseKey(key string, value string) error {
+	var err error
+	switch key {
+	case "Length":
+		e.Length, err = strconv.Atoi(value)
+		return err
+	case "VariantSimple", "VariantComplex":
+		return parseTuples(value, func(f []string) error {
+			var v Variant
+			v.Complex = key == "VariantComplex"
+			if v.Complex {
+				if len(f) != 3 {
+					return ErrInvalidPEFF
+				}
+				v.Seq = f[2]
+			} else {
+				if len(f) < 2 || len(f) > 3 {
+					return ErrInvalidPEFF
+				}
+				v.Seq = f[1]
+				if len(f) == 3 {
+					v.Tag = f[2]
+				}
+			}
+			v.Start, err = strconv.Atoi(f[0])
+			if err != nil {
+				return err
+			}
+			v.End = v.Start
+			if v.Complex {
+				v.End, err = strconv.Atoi(f[1])
+			}
+			e.Variants = append(e.Variants, v)
+			return err
+		})
+	case "ModResPsi", "ModResUnimod", "ModRes":
+		return parseTuples(value, func(f []string) error {
+			var m ModRes
+			switch len(f) {
+			case 2:
+				m.Name = f[1]
+			case 3:
+				m.Accession, m.Name = f[1], f[2]
+			default:
+				return ErrInvalidPEFF
+			}
+			for _, pos := range strings.Split(f[0], ",") {
+				p, err := strconv.Atoi(strings.TrimSpace(pos))
+				if err != nil {
+					return err
+				}
+				m.Positions = append(m.Positions, p)
+			}
+			e.Mods = append(e.Mods, m)
+			return nil
+		})
+	case "Processed":
+		return parseTuples(value, func(f []string) error {
+			var p Processed
+			switch len(f) {
+			case 3:
+				p.Name = f[2]
+			case 4:
+				p.Accession, p.Name = f[2], f[3]
+			default:
+				return ErrInvalidPEFF
+			}
+			p.Start, err = strconv.Atoi(f[0])
+			if err != nil {
+				return err
+			}
+			p.End, err = strconv.Atoi(f[1])
+			e.Processed = append(e.Processed, p)
+			return err
+		})
+	}
+	e.Keys = append(e.Keys, KeyValue{Key: key, Value: value})
+	return nil
+}
+
+// parseTuples splits a value like (1|A)(5|C) into tuples,
+// and calls fn with the fields of each tuple
+func parseTuples(value string, fn func([]string) error) error {
+	depth := 0
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '(':
+			if depth == 0 {
+				start = i + 1
+			}
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return ErrInvalidPEFF
+			}
+			if depth == 0 {
+				err := fn(strings.Split(value[start:i], "|"))
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			if depth == 0 && value[i] != ' ' {
+				return ErrInvalidPEFF
+			}
+		}
+	}
+	if depth != 0 {
+		return ErrInvalidPEFF
+	}
+	return nil
+}
+
+// String formats the annotations as the description of a PEFF entry
+func (e *PEFFEntry) String() string {
+	var sb strings.Builder
+	add := func(key string, value string) {
+		if sb.Len() > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(`\` + key + "=" + value)
+	}
+	for _, kv := range e.Keys {
+		add(kv.Key, kv.Value)
+	}
+	if e.Length > 0 {
+		add("Length", strconv.Itoa(e.Length))
+	}
+	var simple, cplx string
+	for _, v := range e.Variants {
+		if v.Complex {
+			cplx += "(" + strconv.Itoa(v.Start) + "|" + strconv.Itoa(v.End) + "|" + v.Seq + ")"
+		} else if v.Tag != `` {
+			simple += "(" + strconv.Itoa(v.Start) + "|" + v.Seq + "|" + v.Tag + ")"
+		} else {
+			simple += "(" + strconv.Itoa(v.Start) + "|" + v.Seq + ")"
+		}
+	}
+	if simple != `` {
+		add("VariantSimple", simple)
+	}
+	if cplx != `` {
+		add("VariantComplex", cplx)
+	}
+	mods := make(map[string]string)
+	for _, m := range e.Mods {
+		pos := make([]string, len(m.Positions))
+		for i, p := range m.Positions {
+			pos[i] = strconv.Itoa(p)
+		}
+		key := "ModRes"
+		if strings.HasPrefix(m.Accession, "UNIMOD:") {
+			key = "ModResUnimod"
+		} else if strings.HasPrefix(m.Accession, "MOD:") {
+			key = "ModResPsi"
+		}
+		// Without accession, the accession field is left empty: (pos||name)
+		mods[key] += "(" + strings.Join(pos, ",") + "|" + m.Accession + "|" + m.Name + ")"
+	}
+	modKeys := make([]string, 0, len(mods))
+	for k := range mods {
+		modKeys = append(modKeys, k)
+	}
+	sort.Strings(modKeys)
+	for _, k := range modKeys {
+		add(k, mods[k])
+	}
+	var processed string
+	for _, p := range e.Processed {
+		// Without accession, the accession field is left empty: (start|end||name)
+		processed += "(" + strconv.Itoa(p.Start) + "|" + strconv.Itoa(p.End) + "|" +
+			p.Accession + "|" + p.Name + ")"
+	}
+	if processed != `` {
+		add("Processed", processed)
+	}
+	return sb.String()
+}
+
+// PEFFHeader parses the header of a PEFF entry, e.g.
+// >sp:P02768 \DbUniqueId=P02768 \PName=Albumin \NcbiTaxId=9606 \TaxName=Homo sapiens \GName=ALB
+func PEFFHeader(id string, desc string) (Header, bool) {
+	prefix, acc, ok := strings.Cut(id, ":")
+	if !ok || !peffKeyRe.MatchString(desc) {
+		return Header{}, false
+	}
+	e, err := ParsePEFFEntry(desc)
+	if err != nil {
+		return Header{}, false
+	}
+	h := Header{
+		Database:    prefix,
+		Accession:   acc,
+		ProteinName: e.Value("PName"),
+		Organism:    e.Value("TaxName"),
+		GeneName:    e.Value("GName"),
+	}
+	if v := e.Value("DbUniqueId"); v != `` {
+		h.Accession = v
+	}
+	h.TaxonomyID, _ = strconv.Atoi(e.Value("NcbiTaxId"))
+	h.ProteinExistence, _ = strconv.Atoi(e.Value("PE"))
+	h.SequenceVersion, _ = strconv.Atoi(e.Value("SV"))
+	return h, true
+}
@@ -0,0 +1,163 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package fasta
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/524D/galms/digest"
+)
+
+const testPEFF = `# PEFF 1.0
+# DbName=uniprot_sp
+# Prefix=sp
+# NumberOfEntries=2
+# SequenceType=AA
+# //
+>sp:P00001 \DbUniqueId=P00001 \PName=Test protein one \NcbiTaxId=9606 \TaxName=Homo sapiens \GName=TP1 \Length=14 \VariantSimple=(3|C)(9|P|rs123) \ModResUnimod=(2,8|UNIMOD:21|Phospho) \Processed=(1|4|PEFF:0001021|signal peptide)
+MSAKPEPTIDERAK
+>sp:P00002 \DbUniqueId=P00002 \PName=Test protein two \Length=10 \VariantComplex=(5|7|) \ModRes=(1|Acetyl)
+AAAKWWWRGG
+`
+
+func TestReadPEFF(t *testing.T) {
+	p, f, err := ReadPEFF(strings.NewReader(testPEFF), nil)
+	if err != nil {
+		t.Fatalf("ReadPEFF: error return %v", err)
+	}
+	if p.Version != "1.0" || len(p.Databases) != 1 || p.Databases[0].Value("DbName") != "uniprot_sp" {
+		t.Errorf("ReadPEFF: header %+v", p)
+	}
+	prots := f.Prots()
+	if len(prots) != 2 {
+		t.Fatalf("ReadPEFF: %d proteins, should be 2", len(prots))
+	}
+	e, err := prots[0].PEFF()
+	if err != nil {
+		t.Fatalf("PEFF: error return %v", err)
+	}
+	want := PEFFEntry{
+		Keys: []KeyValue{{"DbUniqueId", "P00001"}, {"PName", "Test protein one"}, {"NcbiTaxId", "9606"},
+			{"TaxName", "Homo sapiens"}, {"GName", "TP1"}},
+		Length:    14,
+		Variants:  []Variant{{Start: 3, End: 3, Seq: "C"}, {Start: 9, End: 9, Seq: "P", Tag: "rs123"}},
+		Mods:      []ModRes{{Positions: []int{2, 8}, Accession: "UNIMOD:21", Name: "Phospho"}},
+		Processed: []Processed{{Start: 1, End: 4, Accession: "PEFF:0001021", Name: "signal peptide"}},
+	}
+	if !reflect.DeepEqual(e, want) {
+		t.Errorf("PEFF: got %+v, want %+v", e, want)
+	}
+	e, err = prots[1].PEFF()
+	if err != nil {
+		t.Fatalf("PEFF: error return %v", err)
+	}
+	if !reflect.DeepEqual(e.Variants, []Variant{{Start: 5, End: 7, Complex: true}}) ||
+		!reflect.DeepEqual(e.Mods, []ModRes{{Positions: []int{1}, Name: "Acetyl"}}) {
+		t.Errorf("PEFF: got %+v", e)
+	}
+	// A ModRes or Processed without accession keeps the empty accession field
+	e.Processed = []Processed{{Start: 1, End: 3, Name: "propeptide"}}
+	desc := e.String()
+	for _, s := range []string{`\ModRes=(1||Acetyl)`, `\Processed=(1|3||propeptide)`} {
+		if !strings.Contains(desc, s) {
+			t.Errorf("String: got %s, should contain %s", desc, s)
+		}
+	}
+	if e2, err := ParsePEFFEntry(desc); err != nil || !reflect.DeepEqual(e2, e) {
+		t.Errorf("ParsePEFFEntry(String()): got %+v, should be %+v, error return %v", e2, e, err)
+	}
+
+	h := prots[0].Header()
+	wantHeader := Header{Database: "sp", Accession: "P00001", ProteinName: "Test protein one",
+		Organism: "Homo sapiens", TaxonomyID: 9606, GeneName: "TP1"}
+	if h != wantHeader {
+		t.Errorf("Header: got %+v, want %+v", h, wantHeader)
+	}
+
+	// Write and read back
+	var sb strings.Builder
+	err = p.Write(&sb, &f)
+	if err != nil {
+		t.Fatalf("Write: error return %v", err)
+	}
+	p2, f2, err := ReadPEFF(strings.NewReader(sb.String()), nil)
+	if err != nil {
+		t.Fatalf("ReadPEFF: error return %v", err)
+	}
+	if !reflect.DeepEqual(p, p2) {
+		t.Errorf("Write: header %+v, should be %+v", p2, p)
+	}
+	for i, prot := range f2.Prots() {
+		e1, _ := prots[i].PEFF()
+		e2, err := prot.PEFF()
+		if err != nil || !reflect.DeepEqual(e1, e2) || prot.Sequence() != prots[i].Sequence() {
+			t.Errorf("Write: entry %d is %+v, should be %+v", i, e2, e1)
+		}
+	}
+}
+
+func TestReadPEFFErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"no version", "# DbName=x\n>sp:P1\nAAA\n"},
+		{"plain FASTA", ">sp:P1\nAAA\n"},
+		{"invalid header line", "# PEFF 1.0\n# Something\n"},
+	}
+	for _, tt := range tests {
+		_, _, err := ReadPEFF(strings.NewReader(tt.in), nil)
+		if !errors.Is(err, ErrInvalidPEFF) {
+			t.Errorf("ReadPEFF %s: error return %v, should be %v", tt.name, err, ErrInvalidPEFF)
+		}
+	}
+	for _, desc := range []string{`\Length=x`, `\VariantSimple=(3)`, `\ModResPsi=(x|MOD:00046|name)`,
+		`\Processed=(1|4`, `\VariantSimple=3|C`} {
+		_, err := ParsePEFFEntry(desc)
+		if !errors.Is(err, ErrInvalidPEFF) {
+			t.Errorf("ParsePEFFEntry(%s): error return %v, should be %v", desc, err, ErrInvalidPEFF)
+		}
+	}
+}
+
+func TestDigestProt(t *testing.T) {
+	_, f, err := ReadPEFF(strings.NewReader(testPEFF), nil)
+	if err != nil {
+		t.Fatalf("ReadPEFF: error return %v", err)
+	}
+	dig := digest.New(0, 0, nil, digest.Trypsin)
+	tests := []struct {
+		expand Expand
+		want   []string
+	}{
+		{0, []string{"AK", "MSAKPEPTIDER"}},
+		{ExpandVariants, []string{"AK", "MSAKPEPTIDER", "MSAKPEPTPDER", "MSCKPEPTIDER"}},
+		{ExpandMods, []string{"AK", "MSAKPEPTIDER", "MSAKPEPT[UNIMOD:21]IDER", "MS[UNIMOD:21]AKPEPTIDER"}},
+	}
+	for _, tt := range tests {
+		got, err := DigestProt(dig, f.Prots()[0], tt.expand)
+		if err != nil {
+			t.Fatalf("DigestProt: error return %v", err)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("DigestProt(%d): got %v, want %v", tt.expand, got, tt.want)
+		}
+	}
+
+	// Deletion of WWW
+	got, err := DigestProt(dig, f.Prots()[1], ExpandVariants|ExpandMods)
+	if err != nil {
+		t.Fatalf("DigestProt: error return %v", err)
+	}
+	sort.Strings(got)
+	want := []string{"AAAK", "A[Acetyl]AAK", "GG", "R", "WWWR"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DigestProt: got %v, want %v", got, want)
+	}
+}
@@ -27,14 +27,34 @@ type pepInfo struct {
 // Unique should be interpreted in a Mass Spectrometric way:
 //  equal mass amino acids are treated as the same.
 func ProteotypicPeps(fastas []Fasta, enzyme digest.Enzyme) []proteoTypic {
+	pts, _ := ProteotypicPepsExpanded(fastas, enzyme, 0)
+	return pts
+}
+
+// ProteotypicPepsExpanded computes proteotypic peptides, including the
+// peptides with PEFF annotated variants or modifications selected by expand
+func ProteotypicPepsExpanded(fastas []Fasta, enzyme digest.Enzyme, expand Expand) ([]proteoTypic, error) {
+	srcs := make([]Source, len(fastas))
+	for i := range fastas {
+		srcs[i] = fastas[i].Each
+	}
+	return ProteotypicPepsSource(srcs, enzyme, expand)
+}
+
+// ProteotypicPepsSource computes proteotypic peptides of proteins from
+// Sources. Each Source is called twice, so that the proteins don't
+// need to be kept in memory: only their ID and description are stored.
+func ProteotypicPepsSource(srcs []Source, enzyme digest.Enzyme, expand Expand) ([]proteoTypic, error) {
 	// Count number of occurrences in different proteins of each peptide
 	isoPepCount := make(map[string]int)
 	dig := digest.New(0, 0, nil, enzyme)
 	// Pass one: determine which peptides are proteotypic
-	for _, f := range fastas {
-		for _, p := range f.Prots() {
-			seq := p.Sequence()
-			peps := dig.Cut(seq)
+	for _, src := range srcs {
+		err := src(func(p Prot) error {
+			peps, err := DigestProt(dig, p, expand)
+			if err != nil {
+				return err
+			}
 			peps = removeInvalidSeq(peps) // Remove peptides that contain invalid amino acid codes
 			// Convert isoleucines to leucines
 			for i := range peps {
@@ -46,17 +66,23 @@ func ProteotypicPeps(fastas []Fasta, enzyme digest.Enzyme) []proteoTypic {
 			for _, p := range peps {
 				isoPepCount[p]++
 			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
 	// Pass 2: collect proteotypic peptide details
 	result := make([]proteoTypic, 0)
-	for _, f := range fastas {
-		for _, p := range f.Prots() {
+	for _, src := range srcs {
+		err := src(func(p Prot) error {
 			var pt proteoTypic
-			pt.prot = p
+			pt.prot = Prot{id: p.id, desc: p.desc}
 			pPeps := make([]string, 0)
-			seq := p.Sequence()
-			peps := dig.Cut(seq)
+			peps, err := DigestProt(dig, p, expand)
+			if err != nil {
+				return err
+			}
 			peps = removeInvalidSeq(peps) // Remove peptides that contain invalid amino acid codes
 
 			// If is proteotypic, add it to list
@@ -86,9 +112,13 @@ func ProteotypicPeps(fastas []Fasta, enzyme digest.Enzyme) []proteoTypic {
 				}
 			}
 			result = append(result, pt)
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
-	return result
+	return result, nil
 }
 
 // WriteProteotypicPeps outputs proteotypic peptide info in a human readable format
@@ -145,12 +175,28 @@ func isofyPep(pep string) string {
 }
 
 // Remove peptides that contain invalid characters from slice
+// Modifications between brackets are not checked
 func removeInvalidSeq(peps []string) []string {
 	validPeps := make([]string, 0)
 	for _, pep := range peps {
-		if !strings.ContainsAny(pep, "BJXZ") {
+		if !strings.ContainsAny(stripMods(pep), "BJXZ") {
 			validPeps = append(validPeps, pep)
 		}
 	}
 	return validPeps
 }
+
+// stripMods removes modifications between brackets from a peptide
+func stripMods(pep string) string {
+	for {
+		i := strings.IndexByte(pep, '[')
+		if i < 0 {
+			return pep
+		}
+		j := strings.IndexByte(pep[i:], ']')
+		if j < 0 {
+			return pep[:i]
+		}
+		pep = pep[:i] + pep[i+j+1:]
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package fasta
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// Reader reads the entries of a FASTA file one at a time,
+// so that the file doesn't need to fit in memory
+type Reader struct {
+	br       *bufio.Reader
+	header   func(string) error // Called for header lines starting with '#'
+	inEntry  bool
+	n        int  // Number of entries read
+	dummyID  bool // ID of the current entry is made up
+	retDummy bool // ID of the last returned entry is made up
+	id       string
+	desc     string
+	seq      []byte
+	long     []byte // Buffer for lines that don't fit in br
+}
+
+// Source calls fn for each protein, until fn returns an error.
+// Sources that can be called more than once, like the method value
+// of Fasta.Each or FileSource, yield the same proteins each time.
+type Source func(fn func(Prot) error) error
+
+var headerRe = regexp.MustCompile(`>([^ \t]*)(?:[ \t]+(.+)?)?`)
+
+// NewReader returns a Reader that reads from r.
+// Gzip compressed input is decompressed transparently.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(gz)
+	}
+	return &Reader{br: br}, nil
+}
+
+// Read returns the next protein. At the end of the file, io.EOF is returned.
+func (r *Reader) Read() (Prot, error) {
+	for {
+		line, err := r.readLine()
+		if err != nil && err != io.EOF {
+			return Prot{}, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		switch {
+		case len(line) > 0 && line[0] == '#':
+			// PEFF header
+			if r.header != nil {
+				err := r.header(string(line))
+				if err != nil {
+					return Prot{}, err
+				}
+			}
+		case len(line) > 0 && line[0] == '>':
+			var p Prot
+			done := r.inEntry
+			if done {
+				p = r.prot()
+			}
+			r.startEntry(string(line))
+			if done {
+				return p, nil
+			}
+		default:
+			// Add to sequence, remove superfluous spacing
+			line = bytes.TrimSpace(line)
+			if len(line) > 0 {
+				r.seq = append(r.seq, line...)
+				r.inEntry = true
+			}
+		}
+		if err == io.EOF {
+			if r.inEntry {
+				r.inEntry = false
+				return r.prot(), nil
+			}
+			return Prot{}, io.EOF
+		}
+	}
+}
+
+// Each calls fn for each remaining protein
+func (r *Reader) Each(fn func(Prot) error) error {
+	for {
+		p, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = fn(p)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Each calls fn for each protein
+func (f *Fasta) Each(fn func(Prot) error) error {
+	for _, p := range f.prot {
+		err := fn(p)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileSource returns a Source that reads the proteins from a (gzip
+// compressed) FASTA file. The file is read again each time the Source
+// is called.
+func FileSource(path string) Source {
+	return func(fn func(Prot) error) error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r, err := NewReader(file)
+		if err != nil {
+			return err
+		}
+		return r.Each(fn)
+	}
+}
+
+// readLine returns the next line, which is valid until the next call
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.br.ReadSlice('\n')
+	if err != bufio.ErrBufferFull {
+		return line, err
+	}
+	r.long = append(r.long[:0], line...)
+	for err == bufio.ErrBufferFull {
+		line, err = r.br.ReadSlice('\n')
+		r.long = append(r.long, line...)
+	}
+	return r.long, err
+}
+
+// startEntry parses the header line of the next entry
+func (r *Reader) startEntry(l string) {
+	r.n++
+	r.inEntry = true
+	r.seq = r.seq[:0]
+	m := headerRe.FindStringSubmatch(l)
+	if m == nil || len(m) < 2 || m[1] == `` {
+		// Parsing ID/description failed
+		// Make up a fake ID
+		r.id = `DUMMY_ID_` + strconv.Itoa(r.n)
+		r.desc = ``
+		r.dummyID = true
+	} else {
+		r.dummyID = false
+		r.id = m[1]
+		r.desc = m[2]
+	}
+}
+
+func (r *Reader) prot() Prot {
+	r.retDummy = r.dummyID
+	return Prot{id: r.id, desc: r.desc, seq: string(r.seq)}
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package fasta
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/524D/galms/digest"
+)
+
+const testReaderFasta = `>P1 Protein one
+MAGICK
+PEPTIDER
+>P2
+SAMPLER
+
+>
+WEARE
+`
+
+func TestReader(t *testing.T) {
+	long := strings.Repeat("ACDEFGHIKL", 10000)
+	in := testReaderFasta + ">LONG " + strings.Repeat("x", 5000) + "\r\n" + long + "\r\n"
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(in))
+	zw.Close()
+	want := []Prot{
+		{id: "P1", desc: "Protein one", seq: "MAGICKPEPTIDER"},
+		{id: "P2", desc: "", seq: "SAMPLER"},
+		{id: "DUMMY_ID_3", desc: "", seq: "WEARE"},
+		{id: "LONG", desc: strings.Repeat("x", 5000), seq: long},
+	}
+	for name, data := range map[string][]byte{"plain": []byte(in), "gzip": gz.Bytes()} {
+		r, err := NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("NewReader %s: error return %v", name, err)
+		}
+		var got []Prot
+		for {
+			p, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Read %s: error return %v", name, err)
+			}
+			got = append(got, p)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Read %s: got %d proteins, want %d", name, len(got), len(want))
+			for i := range got {
+				if i < len(want) && !reflect.DeepEqual(got[i], want[i]) {
+					t.Errorf("Read %s: protein %d is %.40v, want %.40v", name, i, got[i], want[i])
+				}
+			}
+		}
+	}
+
+	// Read of a gzip compressed file
+	f, err := ReadFiltered(bytes.NewReader(gz.Bytes()), nil)
+	if err != nil || len(f.Prots()) != 4 {
+		t.Errorf("ReadFiltered gzip: %d proteins, error return %v", len(f.Prots()), err)
+	}
+}
+
+func TestSource(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.fasta")
+	err := os.WriteFile(fn, []byte(testReaderFasta), 0o644)
+	if err != nil {
+		t.Fatalf("WriteFile: error return %v", err)
+	}
+	f, err := Read(strings.NewReader(testReaderFasta))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	src := FileSource(fn)
+	for i := 0; i < 2; i++ {
+		var got []Prot
+		err = src(func(p Prot) error {
+			got = append(got, p)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("FileSource: error return %v", err)
+		}
+		if !reflect.DeepEqual(got, f.Prots()) {
+			t.Errorf("FileSource: got %v, want %v", got, f.Prots())
+		}
+	}
+
+	// Iteration stops at the first error
+	errStop := errors.New("stop")
+	n := 0
+	err = src(func(p Prot) error {
+		n++
+		return errStop
+	})
+	if err != errStop || n != 1 {
+		t.Errorf("FileSource: %d calls, error return %v", n, err)
+	}
+	err = FileSource(filepath.Join(t.TempDir(), "missing.fasta"))(func(p Prot) error { return nil })
+	if err == nil {
+		t.Errorf("FileSource: missing file gives no error")
+	}
+
+	// Proteotypic peptides from a file equal those from memory
+	pts, err := ProteotypicPepsSource([]Source{src}, digest.Trypsin, 0)
+	if err != nil {
+		t.Fatalf("ProteotypicPepsSource: error return %v", err)
+	}
+	if want := ProteotypicPeps([]Fasta{f}, digest.Trypsin); !reflect.DeepEqual(pts, want) {
+		t.Errorf("ProteotypicPepsSource: got %v, want %v", pts, want)
+	}
+}
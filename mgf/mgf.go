@@ -0,0 +1,230 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+// Package mgf reads and writes Mascot Generic Format (MGF) files
+package mgf
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/524D/galms/spectra"
+)
+
+// Peak contains the actual ms peak info
+type Peak = spectra.Peak
+
+// Param is a key/value pair of an MGF header
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Spectrum contains a single BEGIN IONS/END IONS block
+type Spectrum struct {
+	Title         string
+	PepMass       float64 // Precursor m/z
+	PepIntensity  float64 // Precursor intensity, NaN if not present
+	Charges       []int   // Precursor charges, negative for negative ions
+	RetentionTime float64 // RTINSECONDS, NaN if not present
+	Scans         string  // Scan number(s), e.g. "1234" or "1234-1236"
+	Params        []Param // Other headers, in order of appearance
+	Peaks         []Peak
+	PeakCharges   []int // Charge of each peak, 0 if unknown; nil if no peak has a charge
+}
+
+// Reader reads spectra from an MGF file
+type Reader struct {
+	scanner *bufio.Scanner
+	header  []Param
+}
+
+var (
+	ErrInvalidFormat = errors.New("mgf: invalid format")
+	ErrInvalidCharge = errors.New("mgf: invalid charge")
+	ErrMissingEnd    = errors.New("mgf: missing END IONS")
+	ErrNoPrecursor   = errors.New("mgf: spectrum has no precursor m/z")
+)
+
+// Maximum length of a line
+const maxLineLen = 1024 * 1024
+
+// NewReader returns a Reader that reads from r
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLen)
+	return &Reader{scanner: scanner}
+}
+
+// Header returns the global parameters that precede the spectra.
+// They are available after the first call to Read.
+func (r *Reader) Header() []Param {
+	return r.header
+}
+
+// Read reads the next spectrum. At the end of the file, io.EOF is returned.
+func (r *Reader) Read() (Spectrum, error) {
+	var s *Spectrum
+	for r.scanner.Scan() {
+		l := strings.TrimSpace(r.scanner.Text())
+		if l == `` || strings.IndexAny(l[:1], "#;!/") == 0 {
+			// Skip empty lines and comments
+			continue
+		}
+		upper := strings.ToUpper(l)
+		switch {
+		case upper == "BEGIN IONS":
+			if s != nil {
+				return Spectrum{}, ErrMissingEnd
+			}
+			s = &Spectrum{PepIntensity: math.NaN(), RetentionTime: math.NaN()}
+		case upper == "END IONS":
+			if s == nil {
+				return Spectrum{}, ErrInvalidFormat
+			}
+			return *s, nil
+		case s == nil:
+			// Global parameter
+			key, value, ok := splitParam(l)
+			if !ok {
+				return Spectrum{}, ErrInvalidFormat
+			}
+			r.header = append(r.header, Param{Key: key, Value: value})
+		default:
+			var err error
+			if key, value, ok := splitParam(l); ok {
+				err = s.setParam(key, value)
+			} else {
+				err = s.appendPeak(l)
+			}
+			if err != nil {
+				return Spectrum{}, err
+			}
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Spectrum{}, err
+	}
+	if s != nil {
+		return Spectrum{}, ErrMissingEnd
+	}
+	return Spectrum{}, io.EOF
+}
+
+// splitParam splits a KEY=value line. Keys are converted to upper case.
+func splitParam(l string) (string, string, bool) {
+	i := strings.IndexByte(l, '=')
+	if i <= 0 {
+		return ``, ``, false
+	}
+	c := l[0]
+	if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z') {
+		return ``, ``, false
+	}
+	return strings.ToUpper(strings.TrimSpace(l[:i])), strings.TrimSpace(l[i+1:]), true
+}
+
+// setParam sets a header of the spectrum
+func (s *Spectrum) setParam(key string, value string) error {
+	var err error
+	switch key {
+	case "TITLE":
+		s.Title = value
+	case "PEPMASS":
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			return ErrInvalidFormat
+		}
+		s.PepMass, err = strconv.ParseFloat(fields[0], 64)
+		if err == nil && len(fields) > 1 {
+			s.PepIntensity, err = strconv.ParseFloat(fields[1], 64)
+		}
+	case "CHARGE":
+		s.Charges, err = ParseCharges(value)
+	case "RTINSECONDS":
+		s.RetentionTime, err = strconv.ParseFloat(value, 64)
+	case "SCANS":
+		s.Scans = value
+	default:
+		s.Params = append(s.Params, Param{Key: key, Value: value})
+	}
+	return err
+}
+
+// appendPeak parses a peak line: m/z, intensity and optionally the charge
+func (s *Spectrum) appendPeak(l string) error {
+	fields := strings.Fields(l)
+	if len(fields) < 2 {
+		return ErrInvalidFormat
+	}
+	var p Peak
+	var err error
+	p.Mz, err = strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return err
+	}
+	p.Intens, err = strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return err
+	}
+	charge := 0
+	if len(fields) > 2 {
+		charges, err := ParseCharges(fields[2])
+		if err != nil || len(charges) != 1 {
+			return ErrInvalidCharge
+		}
+		charge = charges[0]
+		if s.PeakCharges == nil {
+			s.PeakCharges = make([]int, len(s.Peaks), len(s.Peaks)+1)
+		}
+	}
+	if s.PeakCharges != nil {
+		s.PeakCharges = append(s.PeakCharges, charge)
+	}
+	s.Peaks = append(s.Peaks, p)
+	return nil
+}
+
+// ParseCharges parses an MGF charge specification, e.g. "2+", "2+ and 3+",
+// "2+,3+" or "-1". Charges without sign are positive.
+func ParseCharges(value string) ([]int, error) {
+	var charges []int
+	value = strings.ReplaceAll(value, " and ", ",")
+	for _, c := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+		sign := 1
+		switch {
+		case strings.HasSuffix(c, "+"):
+			c = c[:len(c)-1]
+		case strings.HasSuffix(c, "-"):
+			c = c[:len(c)-1]
+			sign = -1
+		case strings.HasPrefix(c, "+"):
+			c = c[1:]
+		case strings.HasPrefix(c, "-"):
+			c = c[1:]
+			sign = -1
+		}
+		charge, err := strconv.Atoi(c)
+		if err != nil || charge < 0 {
+			return nil, ErrInvalidCharge
+		}
+		charges = append(charges, sign*charge)
+	}
+	return charges, nil
+}
+
+// Param returns the value of a header that is stored in Params,
+// or an empty string if it's not present
+func (s *Spectrum) Param(key string) string {
+	key = strings.ToUpper(key)
+	for _, p := range s.Params {
+		if p.Key == key {
+			return p.Value
+		}
+	}
+	return ``
+}
@@ -0,0 +1,225 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mgf
+
+import (
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/524D/galms/mzml"
+)
+
+const testMGF = `# Comment
+COM=Test file
+CHARGE=2+ and 3+
+
+BEGIN IONS
+TITLE=Spectrum 1
+PEPMASS=500.25 1200.5
+CHARGE=2+ and 3+
+RTINSECONDS=120.5
+SCANS=1234
+SEQ=PEPTIDE
+100.5 10
+200.25	20.5	1+
+END IONS
+
+begin ions
+title=Spectrum 2
+pepmass=700.125
+charge=-2
+300 30
+end ions
+`
+
+func TestRead(t *testing.T) {
+	r := NewReader(strings.NewReader(testMGF))
+	s, err := r.Read()
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	header := r.Header()
+	if len(header) != 2 || header[0] != (Param{Key: "COM", Value: "Test file"}) {
+		t.Errorf("Header: %v", header)
+	}
+	if s.Title != "Spectrum 1" || s.PepMass != 500.25 || s.PepIntensity != 1200.5 ||
+		!reflect.DeepEqual(s.Charges, []int{2, 3}) || s.RetentionTime != 120.5 || s.Scans != "1234" {
+		t.Errorf("Read: %+v", s)
+	}
+	if s.Param("seq") != "PEPTIDE" || len(s.Params) != 1 {
+		t.Errorf("Params: %v", s.Params)
+	}
+	if len(s.Peaks) != 2 || s.Peaks[1] != (Peak{Mz: 200.25, Intens: 20.5}) {
+		t.Errorf("Peaks: %v", s.Peaks)
+	}
+	if !reflect.DeepEqual(s.PeakCharges, []int{0, 1}) {
+		t.Errorf("PeakCharges: %v, should be [0 1]", s.PeakCharges)
+	}
+	s, err = r.Read()
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	if s.Title != "Spectrum 2" || s.PepMass != 700.125 || !math.IsNaN(s.PepIntensity) ||
+		!reflect.DeepEqual(s.Charges, []int{-2}) || !math.IsNaN(s.RetentionTime) || len(s.Peaks) != 1 {
+		t.Errorf("Read: %+v", s)
+	}
+	_, err = r.Read()
+	if err != io.EOF {
+		t.Errorf("Read: error return %v, should be io.EOF", err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		mgf  string
+		err  error
+	}{
+		{name: "Missing end", mgf: "BEGIN IONS\n100 10\n", err: ErrMissingEnd},
+		{name: "Nested begin", mgf: "BEGIN IONS\nBEGIN IONS\nEND IONS\n", err: ErrMissingEnd},
+		{name: "End without begin", mgf: "END IONS\n", err: ErrInvalidFormat},
+		{name: "Invalid charge", mgf: "BEGIN IONS\nCHARGE=x\nEND IONS\n", err: ErrInvalidCharge},
+		{name: "Invalid peak", mgf: "BEGIN IONS\n100\nEND IONS\n", err: ErrInvalidFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(strings.NewReader(tt.mgf)).Read()
+			if err != tt.err {
+				t.Errorf("Read: error return %v, should be %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseCharges(t *testing.T) {
+	tests := []struct {
+		charge string
+		want   []int
+	}{
+		{"2+", []int{2}},
+		{"3", []int{3}},
+		{"2+ and 3+", []int{2, 3}},
+		{"2+,3+", []int{2, 3}},
+		{"1-", []int{-1}},
+		{"-2", []int{-2}},
+		{"+1", []int{1}},
+	}
+	for _, tt := range tests {
+		charges, err := ParseCharges(tt.charge)
+		if err != nil || !reflect.DeepEqual(charges, tt.want) {
+			t.Errorf("ParseCharges(%q): %v (%v), should be %v", tt.charge, charges, err, tt.want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	r := NewReader(strings.NewReader(testMGF))
+	var specs []Spectrum
+	for {
+		s, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read: error return %v", err)
+		}
+		specs = append(specs, s)
+	}
+	var sb strings.Builder
+	w := NewWriter(&sb)
+	err := w.WriteHeader(r.Header())
+	if err != nil {
+		t.Fatalf("WriteHeader: error return %v", err)
+	}
+	for i := range specs {
+		err = w.Write(&specs[i])
+		if err != nil {
+			t.Fatalf("Write: error return %v", err)
+		}
+	}
+	err = w.Flush()
+	if err != nil {
+		t.Fatalf("Flush: error return %v", err)
+	}
+
+	r2 := NewReader(strings.NewReader(sb.String()))
+	for i := range specs {
+		s, err := r2.Read()
+		if err != nil {
+			t.Fatalf("Read after write: error return %v", err)
+		}
+		// NaN != NaN, so compare those separately
+		if math.IsNaN(specs[i].PepIntensity) != math.IsNaN(s.PepIntensity) ||
+			math.IsNaN(specs[i].RetentionTime) != math.IsNaN(s.RetentionTime) {
+			t.Errorf("Read after write: %+v, should be %+v", s, specs[i])
+		}
+		s.PepIntensity, specs[i].PepIntensity = 0, 0
+		s.RetentionTime, specs[i].RetentionTime = 0, 0
+		if !reflect.DeepEqual(s, specs[i]) {
+			t.Errorf("Read after write: %+v, should be %+v", s, specs[i])
+		}
+	}
+	if !reflect.DeepEqual(r2.Header(), r.Header()) {
+		t.Errorf("Header after write: %v, should be %v", r2.Header(), r.Header())
+	}
+}
+
+func TestWriteMzML(t *testing.T) {
+	f := mzml.New("run1")
+	for i := 0; i < 4; i++ {
+		s := mzml.SpectrumData{
+			MSLevel:       1 + i%2,
+			RetentionTime: 60 * float64(i),
+			Centroid:      true,
+			Peaks:         []mzml.Peak{{Mz: 100 + float64(i), Intens: 1000}},
+		}
+		if i%2 == 1 {
+			p := mzml.NewPrecursor()
+			p.ScanIndex = i - 1
+			p.IsolationWindow.TargetMz = 500.5
+			p.SelectedIons = []mzml.SelectedIon{{Mz: 500.25, Charge: 2, Intensity: 300}}
+			s.Precursors = []mzml.Precursor{p}
+		}
+		if i == 3 {
+			// No selected ion, use the isolation window target
+			s.Precursors[0].SelectedIons = nil
+		}
+		_, err := f.AppendSpectrum(s)
+		if err != nil {
+			t.Fatalf("AppendSpectrum: error return %v", err)
+		}
+	}
+	var sb strings.Builder
+	w := NewWriter(&sb)
+	err := w.WriteMzML(&f)
+	if err != nil {
+		t.Fatalf("WriteMzML: error return %v", err)
+	}
+	w.Flush()
+
+	r := NewReader(strings.NewReader(sb.String()))
+	s, err := r.Read()
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	if s.Title != "scan=2" || s.Scans != "2" || s.PepMass != 500.25 || s.PepIntensity != 300 ||
+		!reflect.DeepEqual(s.Charges, []int{2}) || s.RetentionTime != 60 ||
+		len(s.Peaks) != 1 || s.Peaks[0].Mz != 101 {
+		t.Errorf("Read: %+v", s)
+	}
+	s, err = r.Read()
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	if s.Title != "scan=4" || s.PepMass != 500.5 || len(s.Charges) != 0 {
+		t.Errorf("Read: %+v", s)
+	}
+	_, err = r.Read()
+	if err != io.EOF {
+		t.Errorf("Read: error return %v, should be io.EOF", err)
+	}
+}
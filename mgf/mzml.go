@@ -0,0 +1,90 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mgf
+
+import (
+	"math"
+	"regexp"
+
+	"github.com/524D/galms/mzml"
+)
+
+// Matches the scan number in a native spectrum ID, e.g.
+// "controllerType=0 controllerNumber=1 scan=42"
+var reScanNumber = regexp.MustCompile(`(?:^|\s)scan=([0-9]+)(?:\s|$)`)
+
+// FromMzML returns an MS2 (or higher) spectrum of an mzML file as MGF
+// spectrum. The precursor m/z, intensity and charge are taken from the
+// first selected ion of the first precursor. If no selected ion is
+// present, the target m/z of the isolation window is used.
+func FromMzML(f *mzml.MzML, scanIndex int) (Spectrum, error) {
+	s := Spectrum{PepMass: math.NaN(), PepIntensity: math.NaN()}
+	id, err := f.ScanID(scanIndex)
+	if err != nil {
+		return s, err
+	}
+	s.Title = id
+	if m := reScanNumber.FindStringSubmatch(id); m != nil {
+		s.Scans = m[1]
+	}
+	s.RetentionTime, err = f.RetentionTime(scanIndex)
+	if err != nil {
+		return s, err
+	}
+	if s.RetentionTime < 0 {
+		// No retention time present
+		s.RetentionTime = math.NaN()
+	}
+	precursors, err := f.Precursors(scanIndex)
+	if err != nil {
+		return s, err
+	}
+	if len(precursors) > 0 {
+		p := &precursors[0]
+		s.PepMass = p.IsolationWindow.TargetMz
+		if len(p.SelectedIons) > 0 {
+			ion := &p.SelectedIons[0]
+			if !math.IsNaN(ion.Mz) {
+				s.PepMass = ion.Mz
+			}
+			s.PepIntensity = ion.Intensity
+			if ion.Charge != 0 {
+				s.Charges = []int{ion.Charge}
+			} else {
+				s.Charges = ion.PossibleCharges
+			}
+		}
+	}
+	if math.IsNaN(s.PepMass) {
+		return s, ErrNoPrecursor
+	}
+	s.Peaks, err = f.ReadScan(scanIndex)
+	return s, err
+}
+
+// WriteMzML writes all MS2 (or higher) spectra of an mzML file.
+// Spectra without precursor m/z are skipped.
+func (w *Writer) WriteMzML(f *mzml.MzML) error {
+	for i := 0; i < f.NumSpecs(); i++ {
+		msLevel, err := f.MSLevel(i)
+		if err != nil {
+			return err
+		}
+		if msLevel < 2 {
+			continue
+		}
+		s, err := FromMzML(f, i)
+		if err == ErrNoPrecursor {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = w.Write(&s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mgf
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Writer writes spectra to an MGF file
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter returns a Writer that writes to w.
+// Flush must be called when all spectra are written.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// WriteHeader writes global parameters. It must be called before
+// any spectrum is written.
+func (w *Writer) WriteHeader(params []Param) error {
+	for _, p := range params {
+		w.param(p.Key, p.Value)
+	}
+	_, err := w.w.WriteString("\n")
+	return err
+}
+
+// Write writes a spectrum
+func (w *Writer) Write(s *Spectrum) error {
+	w.w.WriteString("BEGIN IONS\n")
+	if s.Title != `` {
+		w.param("TITLE", s.Title)
+	}
+	pepMass := formatFloat(s.PepMass)
+	if !math.IsNaN(s.PepIntensity) {
+		pepMass += " " + formatFloat(s.PepIntensity)
+	}
+	w.param("PEPMASS", pepMass)
+	if len(s.Charges) > 0 {
+		w.param("CHARGE", FormatCharges(s.Charges))
+	}
+	if !math.IsNaN(s.RetentionTime) {
+		w.param("RTINSECONDS", formatFloat(s.RetentionTime))
+	}
+	if s.Scans != `` {
+		w.param("SCANS", s.Scans)
+	}
+	for _, p := range s.Params {
+		w.param(p.Key, p.Value)
+	}
+	for i, p := range s.Peaks {
+		w.w.WriteString(formatFloat(p.Mz) + " " + formatFloat(p.Intens))
+		if i < len(s.PeakCharges) && s.PeakCharges[i] != 0 {
+			w.w.WriteString(" " + FormatCharges(s.PeakCharges[i:i+1]))
+		}
+		w.w.WriteString("\n")
+	}
+	_, err := w.w.WriteString("END IONS\n\n")
+	return err
+}
+
+// Flush writes any buffered data to the underlying io.Writer
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *Writer) param(key string, value string) {
+	w.w.WriteString(strings.ToUpper(key) + "=" + value + "\n")
+}
+
+// FormatCharges returns the MGF representation of charges, e.g. "2+ and 3+"
+func FormatCharges(charges []int) string {
+	s := make([]string, len(charges))
+	for i, c := range charges {
+		if c < 0 {
+			s[i] = strconv.Itoa(-c) + "-"
+		} else {
+			s[i] = strconv.Itoa(c) + "+"
+		}
+	}
+	return strings.Join(s, " and ")
+}
+
+func formatFloat(x float64) string {
+	return strconv.FormatFloat(x, 'f', -1, 64)
+}
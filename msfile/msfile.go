@@ -0,0 +1,218 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+// Package msfile opens mass spectrometry files independent of their format
+package msfile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/524D/galms/mzml"
+	"github.com/524D/galms/mzxml"
+	"github.com/524D/galms/spectra"
+)
+
+// SpectrumSource contains the methods that are implemented by all
+// spectrum file formats. Scans are identified by their index (0-based).
+type SpectrumSource interface {
+	NumSpecs() int
+	ScanID(scanIndex int) (string, error)
+	ScanIndex(scanID string) (int, error)
+	ReadScan(scanIndex int) ([]spectra.Peak, error)
+	RetentionTime(scanIndex int) (float64, error)
+	MSLevel(scanIndex int) (int, error)
+	Centroid(scanIndex int) (bool, error)
+	Spectra(filter spectra.Filter) *spectra.Iterator
+	Close() error
+}
+
+// Format is the file format of a spectrum or identification file
+type Format int
+
+// Supported file formats
+const (
+	Unknown Format = iota
+	MzML
+	MzXML
+	MzIdentML
+	PepXML
+)
+
+// ErrUnknownFormat is returned when the file format can't be determined
+var ErrUnknownFormat = errors.New("msfile: unknown file format")
+
+// Number of bytes that are inspected to determine the file format
+const sniffLen = 4096
+
+// Open opens a spectrum file. The format is determined from the content
+// of the file. Gzip compressed files are decompressed on the fly.
+func Open(path string) (SpectrumSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	src, err := open(file, strings.HasSuffix(strings.ToLower(path), ".gz"))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return src, nil
+}
+
+func open(file *os.File, gzipped bool) (SpectrumSource, error) {
+	br := bufio.NewReader(file)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipped = true
+	}
+	var r io.Reader = br
+	if gzipped {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(gz)
+		r = br
+	}
+	format, err := sniff(br)
+	if err != nil {
+		return nil, err
+	}
+	// Uncompressed files are read lazily using the index
+	switch format {
+	case MzML:
+		if !gzipped {
+			_, err = file.Seek(0, io.SeekStart)
+			if err != nil {
+				return nil, err
+			}
+			f, err := mzml.ReadIndexed(file)
+			if err != nil {
+				return nil, err
+			}
+			return &mzMLSource{MzML: &f, file: file}, nil
+		}
+		f, err := mzml.Read(r)
+		if err != nil {
+			return nil, err
+		}
+		file.Close()
+		return &mzMLSource{MzML: &f}, nil
+	case MzXML:
+		if !gzipped {
+			_, err = file.Seek(0, io.SeekStart)
+			if err != nil {
+				return nil, err
+			}
+			f, err := mzxml.ReadIndexed(file)
+			if err != nil {
+				return nil, err
+			}
+			return &mzXMLSource{f: &f, file: file}, nil
+		}
+		f, err := mzxml.Read(r)
+		if err != nil {
+			return nil, err
+		}
+		file.Close()
+		return &mzXMLSource{f: &f}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// MzMLFile returns the mzML file of a SpectrumSource from Open,
+// or nil if it is not an mzML file
+func MzMLFile(src SpectrumSource) *mzml.MzML {
+	if s, ok := src.(*mzMLSource); ok {
+		return s.MzML
+	}
+	return nil
+}
+
+// MzXMLFile returns the mzXML file of a SpectrumSource from Open,
+// or nil if it is not an mzXML file
+func MzXMLFile(src SpectrumSource) *mzxml.MzXML {
+	if s, ok := src.(*mzXMLSource); ok {
+		return s.f
+	}
+	return nil
+}
+
+// OpenReader opens a spectrum file for sequential reading, and returns
+// its (decompressed) content together with the file format
+func OpenReader(path string) (io.ReadCloser, Format, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, Unknown, err
+	}
+	br := bufio.NewReader(file)
+	magic, err := br.Peek(2)
+	if (err == nil && magic[0] == 0x1f && magic[1] == 0x8b) ||
+		strings.HasSuffix(strings.ToLower(path), ".gz") {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			file.Close()
+			return nil, Unknown, err
+		}
+		br = bufio.NewReader(gz)
+	}
+	format, err := sniff(br)
+	if err != nil {
+		file.Close()
+		return nil, Unknown, err
+	}
+	return readCloser{Reader: br, Closer: file}, format, nil
+}
+
+// readCloser reads from a (decompressing) reader and closes the file
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// sniff determines the file format from the root element
+func sniff(br *bufio.Reader) (Format, error) {
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return Unknown, err
+	}
+	return DetectFormat(head), nil
+}
+
+// DetectFormat determines the file format from the start of the
+// (uncompressed) file content
+func DetectFormat(head []byte) Format {
+	switch {
+	case bytes.Contains(head, []byte("<indexedmzML")) ||
+		bytes.Contains(head, []byte("<mzML")):
+		return MzML
+	case bytes.Contains(head, []byte("<mzXML")):
+		return MzXML
+	case bytes.Contains(head, []byte("<MzIdentML")):
+		return MzIdentML
+	case bytes.Contains(head, []byte("<msms_pipeline_analysis")):
+		return PepXML
+	}
+	return Unknown
+}
+
+// mzMLSource keeps the file of a lazily read mzML file open
+type mzMLSource struct {
+	*mzml.MzML
+	file *os.File
+}
+
+func (s *mzMLSource) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package msfile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/524D/galms/mzml"
+	"github.com/524D/galms/spectra"
+)
+
+// testMzXML generates an mzXML document with numSpecs spectra.
+// Spectrum i has scan number 10+i, MS level 1+(i%2), retention time
+// i minutes and two peaks with m/z 100+i and 200+i.
+func testMzXML(numSpecs int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<?xml version="1.0" encoding="ISO-8859-1"?>
+<mzXML xmlns="http://sashimi.sourceforge.net/schema_revision/mzXML_3.2">
+  <msRun scanCount="%d">
+`, numSpecs)
+	for i := 0; i < numSpecs; i++ {
+		b := make([]byte, 16)
+		binary.BigEndian.PutUint32(b[0:], math.Float32bits(100+float32(i)))
+		binary.BigEndian.PutUint32(b[4:], math.Float32bits(1000))
+		binary.BigEndian.PutUint32(b[8:], math.Float32bits(200+float32(i)))
+		binary.BigEndian.PutUint32(b[12:], math.Float32bits(2000))
+		fmt.Fprintf(&sb, `    <scan num="%d" msLevel="%d" peaksCount="2" retentionTime="PT%dS" polarity="+">
+      <peaks precision="32" byteOrder="network" pairOrder="m/z-int">%s</peaks>
+    </scan>
+`, 10+i, 1+(i%2), 60*i, base64.StdEncoding.EncodeToString(b))
+	}
+	sb.WriteString("  </msRun>\n</mzXML>\n")
+	return sb.String()
+}
+
+// testMzML generates an mzML document with the same spectra as testMzXML
+func testMzML(t *testing.T, numSpecs int) string {
+	f := mzml.New("run1")
+	for i := 0; i < numSpecs; i++ {
+		_, err := f.AppendSpectrum(mzml.SpectrumData{
+			ID:            fmt.Sprintf("scan=%d", 10+i),
+			MSLevel:       1 + (i % 2),
+			RetentionTime: 60 * float64(i),
+			Polarity:      mzml.Positive,
+			Peaks: []mzml.Peak{
+				{Mz: 100 + float64(i), Intens: 1000},
+				{Mz: 200 + float64(i), Intens: 2000},
+			},
+		})
+		if err != nil {
+			t.Fatalf("AppendSpectrum: error return %v", err)
+		}
+	}
+	var sb strings.Builder
+	err := f.Write(&sb)
+	if err != nil {
+		t.Fatalf("Write: error return %v", err)
+	}
+	return sb.String()
+}
+
+func gzipped(s string) string {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write([]byte(s))
+	w.Close()
+	return b.String()
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	mzML := testMzML(t, 5)
+	mzXML := testMzXML(5)
+	tests := []struct {
+		name    string
+		content string
+		id      string
+	}{
+		{name: "test.mzML", content: mzML, id: "scan=13"},
+		{name: "test.mzML.gz", content: gzipped(mzML), id: "scan=13"},
+		{name: "test.mzXML", content: mzXML, id: "13"},
+		{name: "test.mzXML.gz", content: gzipped(mzXML), id: "13"},
+		// The format is determined from the content, not the name
+		{name: "test.xml", content: mzXML, id: "13"},
+		{name: "test.dat", content: gzipped(mzML), id: "scan=13"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := filepath.Join(dir, tt.name)
+			err := os.WriteFile(fn, []byte(tt.content), 0o644)
+			if err != nil {
+				t.Fatalf("WriteFile: error return %v", err)
+			}
+			f, err := Open(fn)
+			if err != nil {
+				t.Fatalf("Open: error return %v", err)
+			}
+			defer f.Close()
+			if isMzML := strings.Contains(tt.id, "="); (MzMLFile(f) != nil) != isMzML || (MzXMLFile(f) != nil) == isMzML {
+				t.Errorf("MzMLFile/MzXMLFile: wrong format")
+			}
+			if n := f.NumSpecs(); n != 5 {
+				t.Fatalf("NumSpecs: %d, should be 5", n)
+			}
+			scanIndex, err := f.ScanIndex(tt.id)
+			if err != nil || scanIndex != 3 {
+				t.Errorf("ScanIndex: %d (%v), should be 3", scanIndex, err)
+			}
+			id, err := f.ScanID(3)
+			if err != nil || id != tt.id {
+				t.Errorf("ScanID: %s (%v), should be %s", id, err, tt.id)
+			}
+			p, err := f.ReadScan(3)
+			if err != nil || len(p) != 2 || p[0].Mz != 103 || p[1].Intens != 2000 {
+				t.Errorf("ReadScan: %v (%v)", p, err)
+			}
+			rt, err := f.RetentionTime(3)
+			if err != nil || rt != 180 {
+				t.Errorf("RetentionTime: %f (%v), should be 180", rt, err)
+			}
+			msLevel, err := f.MSLevel(3)
+			if err != nil || msLevel != 2 {
+				t.Errorf("MSLevel: %d (%v), should be 2", msLevel, err)
+			}
+			n := 0
+			it := f.Spectra(spectra.Filter{MSLevels: []int{1}})
+			for it.Next() {
+				n++
+			}
+			if it.Err() != nil || n != 3 {
+				t.Errorf("Spectra: %d MS1 spectra (%v), should be 3", n, it.Err())
+			}
+		})
+	}
+}
+
+func TestOpenUnknown(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.txt")
+	err := os.WriteFile(fn, []byte("<html></html>"), 0o644)
+	if err != nil {
+		t.Fatalf("WriteFile: error return %v", err)
+	}
+	_, err = Open(fn)
+	if err != ErrUnknownFormat {
+		t.Errorf("Open: error return %v, should be ErrUnknownFormat", err)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		head string
+		want Format
+	}{
+		{`<?xml version="1.0"?><indexedmzML>`, MzML},
+		{`<?xml version="1.0"?><mzML>`, MzML},
+		{`<?xml version="1.0"?><mzXML>`, MzXML},
+		{`<?xml version="1.0"?><MzIdentML id="x">`, MzIdentML},
+		{`<?xml version="1.0"?><msms_pipeline_analysis>`, PepXML},
+		{`<html></html>`, Unknown},
+	}
+	for _, tt := range tests {
+		if got := DetectFormat([]byte(tt.head)); got != tt.want {
+			t.Errorf("DetectFormat(%q): got %v, want %v", tt.head, got, tt.want)
+		}
+	}
+}
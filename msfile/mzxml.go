@@ -0,0 +1,68 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package msfile
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/524D/galms/mzxml"
+	"github.com/524D/galms/spectra"
+)
+
+// mzXMLSource adapts the int64 indices of mzxml to SpectrumSource
+type mzXMLSource struct {
+	f    *mzxml.MzXML
+	file *os.File
+}
+
+func (s *mzXMLSource) NumSpecs() int {
+	return int(s.f.NumSpecs())
+}
+
+func (s *mzXMLSource) ScanID(scanIndex int) (string, error) {
+	id, err := s.f.ScanID(int64(scanIndex))
+	if err != nil {
+		return ``, err
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+func (s *mzXMLSource) ScanIndex(scanID string) (int, error) {
+	id, err := strconv.ParseInt(scanID, 10, 64)
+	if err != nil {
+		return 0, mzxml.ErrInvalidScanID
+	}
+	scanIndex, err := s.f.ScanIndex(id)
+	return int(scanIndex), err
+}
+
+func (s *mzXMLSource) ReadScan(scanIndex int) ([]spectra.Peak, error) {
+	return s.f.ReadScan(int64(scanIndex))
+}
+
+func (s *mzXMLSource) RetentionTime(scanIndex int) (float64, error) {
+	return s.f.RetentionTime(int64(scanIndex))
+}
+
+func (s *mzXMLSource) MSLevel(scanIndex int) (int, error) {
+	return s.f.MSLevel(int64(scanIndex))
+}
+
+func (s *mzXMLSource) Centroid(scanIndex int) (bool, error) {
+	return s.f.Centroid(int64(scanIndex))
+}
+
+func (s *mzXMLSource) Spectra(filter spectra.Filter) *spectra.Iterator {
+	return s.f.Spectra(filter)
+}
+
+func (s *mzXMLSource) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
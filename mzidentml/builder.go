@@ -0,0 +1,397 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzidentml
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SearchProtocol contains the search settings that are written to the
+// SpectrumIdentificationProtocol
+type SearchProtocol struct {
+	Enzymes           []Enzyme
+	Modifications     []SearchModification
+	FragmentTolerance Tolerance
+	ParentTolerance   Tolerance
+	AdditionalParams  []CVParam
+	Threshold         []CVParam // If empty, MS:1001494 (no threshold) is used
+}
+
+// Enzyme describes an enzyme that was used in the search
+type Enzyme struct {
+	Name            string // Name of the enzyme, e.g. "Trypsin"
+	Accession       string // PSI-MS accession of the enzyme, e.g. MS:1001251
+	SiteRegexp      string // Regular expression of the cleavage site
+	MissedCleavages int
+	SemiSpecific    bool
+}
+
+// SearchModification describes a fixed or variable modification
+// that was specified for the search
+type SearchModification struct {
+	Residues        string // Modified residues, "." for any residue
+	MassDelta       float64
+	Fixed           bool
+	Accession       string // UNIMOD or PSI-MOD accession, e.g. UNIMOD:35
+	Name            string
+	Terminus        string // "N" or "C" for terminal modifications
+	ProteinTerminus bool   // Terminus is the protein terminus
+}
+
+// Tolerance is a mass tolerance. A zero tolerance is not written.
+type Tolerance struct {
+	Plus  float64
+	Minus float64
+	PPM   bool // Tolerance is in ppm, otherwise in Dalton
+}
+
+// New returns an MzIdentML without identifications. Software, search
+// protocol, databases, spectrum files and identifications can be added,
+// after which the result can be written.
+func New(id string) MzIdentML {
+	var m MzIdentML
+	m.id = id
+	m.creationDate = time.Now()
+	m.seqID2PepIdx = make(map[string]int)
+	m.evidenceID2Idx = make(map[string]int)
+	m.dbSeqID2Idx = make(map[string]int)
+	m.spectraDataID2Idx = make(map[string]int)
+	m.pepKey2ID = make(map[string]string)
+	m.evidenceKey2ID = make(map[string]string)
+	m.accession2DBSeqID = make(map[string]string)
+	m.sirKey2Idx = make(map[string]int)
+	m.sirID2Idx = make(map[string]int)
+	m.siiID2Idx = make(map[string]int)
+	return m
+}
+
+// SetAnalysisSoftware sets the software that produced the identifications.
+// cvPar contains the CV term of the software, e.g. MS:1002251 (Comet).
+func (m *MzIdentML) SetAnalysisSoftware(name string, version string, cvPar []CVParam) {
+	software := analysisSoftware{
+		ID:           softwareID,
+		Name:         name,
+		Version:      version,
+		SoftwareName: paramList{CvPar: withCvRef(cvPar)},
+	}
+	if len(cvPar) == 0 {
+		software.SoftwareName.UserParam = []userParam{{Name: name}}
+	}
+	if len(m.content.AnalysisSoftware) > 0 {
+		// Keep the id that the protocols of a file that was read refer to
+		software.ID = m.content.AnalysisSoftware[0].ID
+		m.content.AnalysisSoftware[0] = software
+		return
+	}
+	m.content.AnalysisSoftware = []analysisSoftware{software}
+}
+
+// SetSearchProtocol sets the search settings. For a file that was read,
+// they replace the settings from the file.
+func (m *MzIdentML) SetSearchProtocol(p SearchProtocol) {
+	m.protocol = &p
+}
+
+// AppendSearchDatabase adds a sequence database and returns its id.
+// If the ID of db is empty, an id is generated.
+func (m *MzIdentML) AppendSearchDatabase(db SearchDatabase) (string, error) {
+	if db.Location == `` {
+		return ``, ErrMissingValue
+	}
+	if db.ID == `` {
+		db.ID = "SDB_" + strconv.Itoa(len(m.content.SearchDatabase)+1)
+	}
+	for _, d := range m.content.SearchDatabase {
+		if d.ID == db.ID {
+			return ``, ErrDuplicateID
+		}
+	}
+	name := db.Name
+	if name == `` {
+		name = db.Location
+	}
+	m.content.SearchDatabase = append(m.content.SearchDatabase, searchDatabase{
+		ID:                   db.ID,
+		Location:             db.Location,
+		Name:                 db.Name,
+		NumDatabaseSequences: db.NumSequences,
+		DatabaseName:         paramList{UserParam: []userParam{{Name: name}}},
+	})
+	return db.ID, nil
+}
+
+// AppendSpectraData adds a spectrum file and returns its id.
+// If the ID of sd is empty, an id is generated.
+func (m *MzIdentML) AppendSpectraData(sd SpectraData) (string, error) {
+	if sd.Location == `` || sd.SpectrumIDFormat.Accession == `` {
+		return ``, ErrMissingValue
+	}
+	if sd.ID == `` {
+		sd.ID = "SD_" + strconv.Itoa(len(m.content.SpectraData)+1)
+	}
+	if _, ok := m.spectraDataID2Idx[sd.ID]; ok {
+		return ``, ErrDuplicateID
+	}
+	s := spectraData{
+		ID:       sd.ID,
+		Location: sd.Location,
+		Name:     sd.Name,
+	}
+	if sd.FileFormat.Accession != `` {
+		fileFormat := withCvRef([]CVParam{sd.FileFormat})[0]
+		s.FileFormat = &fileFormat
+	}
+	spectrumIDFormat := withCvRef([]CVParam{sd.SpectrumIDFormat})[0]
+	s.SpectrumIDFormat = &spectrumIDFormat
+	m.spectraDataID2Idx[sd.ID] = len(m.content.SpectraData)
+	m.content.SpectraData = append(m.content.SpectraData, s)
+	return sd.ID, nil
+}
+
+// AppendDBSequence adds a protein and returns its id. This is only needed
+// to store the sequence, length or description of a protein, proteins that
+// are referenced by identifications are added automatically. If the
+// SearchDatabaseRef of seq is empty, the first search database is used.
+func (m *MzIdentML) AppendDBSequence(seq DBSequence) (string, error) {
+	if seq.Accession == `` {
+		return ``, ErrMissingValue
+	}
+	if _, ok := m.accession2DBSeqID[seq.Accession]; ok {
+		return ``, ErrDuplicateID
+	}
+	if seq.SearchDatabaseRef == `` {
+		if len(m.content.SearchDatabase) == 0 {
+			return ``, ErrMissingValue
+		}
+		seq.SearchDatabaseRef = m.content.SearchDatabase[0].ID
+	}
+	found := false
+	for _, d := range m.content.SearchDatabase {
+		found = found || d.ID == seq.SearchDatabaseRef
+	}
+	if !found {
+		return ``, ErrUnknownRef
+	}
+	id := newID("DBSeq_", len(m.content.DBSequence)+1, m.dbSeqID2Idx)
+	d := dbSequence{
+		ID:                id,
+		Accession:         seq.Accession,
+		Length:            seq.Length,
+		SearchDatabaseRef: seq.SearchDatabaseRef,
+		Seq:               seq.Sequence,
+		CvPar:             withCvRef(seq.Cv),
+	}
+	if d.Length == 0 {
+		d.Length = len(d.Seq)
+	}
+	if seq.Description != `` {
+		d.CvPar = append(d.CvPar, CVParam{CvRef: "PSI-MS", Accession: "MS:1001088",
+			Name: "protein description", Value: seq.Description})
+	}
+	m.dbSeqID2Idx[id] = len(m.content.DBSequence)
+	m.accession2DBSeqID[seq.Accession] = id
+	m.content.DBSequence = append(m.content.DBSequence, d)
+	return id, nil
+}
+
+// AppendIdentification adds a peptide spectrum match and returns its index.
+// The peptide, peptide evidence, proteins and spectrum identification result
+// are created or shared with earlier identifications, and the ids that
+// reference them are assigned. PepID, ItemID, ModMass and the ID and
+// DBSequenceRef of the evidence are ignored. Identifications of the same
+// spectrum (SpecID and SpectraDataRef) are stored in one result.
+// A RetentionTime < 0 is not stored.
+func (m *MzIdentML) AppendIdentification(ident Identification) (int, error) {
+	if ident.PepSeq == `` || ident.SpecID == `` || len(ident.Evidence) == 0 {
+		return 0, ErrMissingValue
+	}
+	if ident.SpectraDataRef == `` && len(m.content.SpectraData) == 1 {
+		ident.SpectraDataRef = m.content.SpectraData[0].ID
+	}
+	if _, ok := m.spectraDataID2Idx[ident.SpectraDataRef]; !ok {
+		return 0, ErrUnknownRef
+	}
+	pepID := m.appendPeptide(ident.PepSeq, ident.Mods)
+	item := spectrumIdentificationItem{
+		ID:                       newID("SII_", len(m.identList)+1, m.siiID2Idx),
+		ChargeState:              ident.Charge,
+		PeptideRef:               pepID,
+		Rank:                     ident.Rank,
+		ExperimentalMassToCharge: ident.ExperimentalMassToCharge,
+		CalculatedMassToCharge:   ident.CalculatedMassToCharge,
+		PassThreshold:            ident.PassThreshold,
+		CvPar:                    withCvRef(ident.Cv),
+	}
+	for _, e := range ident.Evidence {
+		evidenceID, err := m.appendPeptideEvidence(pepID, e)
+		if err != nil {
+			return 0, err
+		}
+		item.PeptideEvidenceRef = append(item.PeptideEvidenceRef, peptideEvidenceRef{PeptideEvidenceRef: evidenceID})
+	}
+
+	key := sirKey(ident.SpectraDataRef, ident.SpecID)
+	sirIdx, ok := m.sirKey2Idx[key]
+	if !ok {
+		sirIdx = len(m.content.SpectrumIdentificationResult)
+		sir := spectrumIdentificationResult{
+			ID:             newID("SIR_", sirIdx+1, m.sirID2Idx),
+			SpectrumID:     ident.SpecID,
+			SpectraDataRef: ident.SpectraDataRef,
+		}
+		if ident.RetentionTime >= 0 {
+			sir.CvPar = append(sir.CvPar, CVParam{CvRef: "PSI-MS", Accession: "MS:1000016",
+				Name: "scan start time", Value: formatFloat(ident.RetentionTime),
+				UnitCvRef: "UO", UnitAccession: "UO:0000010", UnitName: "second"})
+		}
+		m.sirKey2Idx[key] = sirIdx
+		m.sirID2Idx[sir.ID] = sirIdx
+		m.content.SpectrumIdentificationResult = append(m.content.SpectrumIdentificationResult, sir)
+	}
+	sir := &m.content.SpectrumIdentificationResult[sirIdx]
+	sir.SpectrumIdentificationItem = append(sir.SpectrumIdentificationItem, item)
+	m.siiID2Idx[item.ID] = len(m.identList)
+	m.identList = append(m.identList, identRef{
+		specIDIdx:     sirIdx,
+		specResultIdx: len(sir.SpectrumIdentificationItem) - 1,
+	})
+	return len(m.identList) - 1, nil
+}
+
+// appendPeptide returns the id of the peptide with the given sequence and
+// modifications, the peptide is added if it doesn't exist yet
+func (m *MzIdentML) appendPeptide(seq string, mods []Modification) string {
+	key := pepKey(seq, mods)
+	if id, ok := m.pepKey2ID[key]; ok {
+		return id
+	}
+	id := newID("Pep_", len(m.content.Peptide)+1, m.seqID2PepIdx)
+	pep := peptide{ID: id, PeptideSequence: seq}
+	for _, mod := range mods {
+		xmlMod := modification{
+			MonoisotopicMassDelta: mod.MassDelta,
+			Residues:              mod.Residues,
+		}
+		if mod.Location >= 0 {
+			location := mod.Location
+			xmlMod.Location = &location
+		}
+		if mod.Accession != `` {
+			xmlMod.CvPar = withCvRef([]CVParam{{Accession: mod.Accession, Name: mod.Name}})
+		} else {
+			xmlMod.CvPar = []CVParam{{CvRef: "PSI-MS", Accession: "MS:1001460",
+				Name: "unknown modification", Value: mod.Name}}
+		}
+		pep.Modification = append(pep.Modification, xmlMod)
+	}
+	m.seqID2PepIdx[id] = len(m.content.Peptide)
+	m.pepKey2ID[key] = id
+	m.content.Peptide = append(m.content.Peptide, pep)
+	return id
+}
+
+// appendPeptideEvidence returns the id of the evidence of a peptide in a
+// protein, the evidence and protein are added if they don't exist yet
+func (m *MzIdentML) appendPeptideEvidence(pepID string, e PeptideEvidence) (string, error) {
+	if e.Accession == `` {
+		return ``, ErrMissingValue
+	}
+	dbSeqID, ok := m.accession2DBSeqID[e.Accession]
+	if !ok {
+		var err error
+		dbSeqID, err = m.AppendDBSequence(DBSequence{Accession: e.Accession})
+		if err != nil {
+			return ``, err
+		}
+	}
+	key := evidenceKey(pepID, dbSeqID, e)
+	if id, ok := m.evidenceKey2ID[key]; ok {
+		return id, nil
+	}
+	id := newID("PE_", len(m.content.PeptideEvidence)+1, m.evidenceID2Idx)
+	m.evidenceID2Idx[id] = len(m.content.PeptideEvidence)
+	m.evidenceKey2ID[key] = id
+	m.content.PeptideEvidence = append(m.content.PeptideEvidence, peptideEvidence{
+		ID:            id,
+		DBSequenceRef: dbSeqID,
+		PeptideRef:    pepID,
+		Start:         e.Start,
+		End:           e.End,
+		Pre:           e.Pre,
+		Post:          e.Post,
+		IsDecoy:       e.IsDecoy,
+	})
+	return id, nil
+}
+
+// newID returns the first id prefix+n, prefix+n+1, ... that is not used yet.
+// Files that were read may use other ids than the ones we generate.
+func newID(prefix string, n int, used map[string]int) string {
+	for {
+		id := prefix + strconv.Itoa(n)
+		if _, ok := used[id]; !ok {
+			return id
+		}
+		n++
+	}
+}
+
+// pepKey returns the key under which a peptide is stored in pepKey2ID
+func pepKey(seq string, mods []Modification) string {
+	var key strings.Builder
+	key.WriteString(seq)
+	for _, mod := range mods {
+		key.WriteString("|" + strconv.Itoa(mod.Location) + mod.Residues + ":" +
+			formatFloat(mod.MassDelta) + ":" + mod.Accession)
+	}
+	return key.String()
+}
+
+// evidenceKey returns the key under which a peptide evidence is stored in evidenceKey2ID
+func evidenceKey(pepID string, dbSeqID string, e PeptideEvidence) string {
+	return pepID + "\x00" + dbSeqID + "\x00" + strconv.Itoa(e.Start) + "\x00" +
+		strconv.Itoa(e.End) + "\x00" + e.Pre + e.Post + strconv.FormatBool(e.IsDecoy)
+}
+
+// sirKey returns the key under which a spectrum identification result is stored in sirKey2Idx
+func sirKey(spectraDataRef string, specID string) string {
+	return spectraDataRef + "\x00" + specID
+}
+
+// withCvRef returns a copy of cvPar in which missing cvRefs are
+// derived from the accessions
+func withCvRef(cvPar []CVParam) []CVParam {
+	if cvPar == nil {
+		return nil
+	}
+	res := make([]CVParam, len(cvPar))
+	for i, cv := range cvPar {
+		if cv.CvRef == `` {
+			cv.CvRef = cvRef(cv.Accession)
+		}
+		if cv.UnitCvRef == `` && cv.UnitAccession != `` {
+			cv.UnitCvRef = cvRef(cv.UnitAccession)
+		}
+		res[i] = cv
+	}
+	return res
+}
+
+// cvRef returns the id of the controlled vocabulary of an accession
+func cvRef(accession string) string {
+	prefix, _, _ := strings.Cut(accession, ":")
+	switch prefix {
+	case "MS":
+		return "PSI-MS"
+	case "MOD":
+		return "PSI-MOD"
+	}
+	return prefix
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -6,6 +6,7 @@ package mzidentml
 import (
 	"encoding/xml"
 	"errors"
+	"time"
 )
 
 // Types for parsing mzIdentML
@@ -13,9 +14,22 @@ import (
 // MzIdentML holds only the part of mzIdentML files
 // in which we are interested
 type MzIdentML struct {
-	seqID2PepIdx map[string]int
-	identList    []identRef
-	content      mzIdentMLContent
+	seqID2PepIdx      map[string]int
+	evidenceID2Idx    map[string]int
+	dbSeqID2Idx       map[string]int
+	spectraDataID2Idx map[string]int
+	identList         []identRef
+	content           mzIdentMLContent
+	// Only used when building files
+	id                string
+	creationDate      time.Time
+	protocol          *SearchProtocol
+	pepKey2ID         map[string]string
+	evidenceKey2ID    map[string]string
+	accession2DBSeqID map[string]string
+	sirKey2Idx        map[string]int
+	sirID2Idx         map[string]int
+	siiID2Idx         map[string]int
 }
 
 type identRef struct {
@@ -35,13 +49,91 @@ type Identification struct {
 	ModMass                  float64
 	SpecID                   string
 	RetentionTime            float64
-	Cv                       []cvParam
+	Cv                       []CVParam
+	ItemID                   string // ID of the SpectrumIdentificationItem
+	SpectraDataRef           string // ID of the SpectraData that contains the spectrum
+	Mods                     []Modification
+	Evidence                 []PeptideEvidence
+}
+
+// Modification is a modified residue of a peptide
+type Modification struct {
+	Location  int // 0 for the N-terminus, peptide length+1 for the C-terminus, -1 if unknown
+	Residues  string
+	MassDelta float64
+	Accession string // UNIMOD or PSI-MOD accession, e.g. UNIMOD:35
+	Name      string
+}
+
+// PeptideEvidence is an occurrence of a peptide in a protein
+type PeptideEvidence struct {
+	ID            string
+	DBSequenceRef string
+	Accession     string // Accession of the protein
+	Pre           string // Residue before the peptide, "-" for the protein N-terminus
+	Post          string // Residue after the peptide, "-" for the protein C-terminus
+	Start         int    // 1-based position of the first residue in the protein, 0 if unknown
+	End           int    // 1-based position of the last residue in the protein, 0 if unknown
+	IsDecoy       bool
+}
+
+// Software is the software that produced the identifications
+type Software struct {
+	ID      string
+	Name    string
+	Version string
+	Cv      []CVParam // CV term of the software, e.g. MS:1002251 (Comet)
+}
+
+// SearchDatabase is a reference to a searched sequence database
+type SearchDatabase struct {
+	ID           string
+	Location     string
+	Name         string
+	NumSequences int64
+}
+
+// SpectraData is a reference to a spectrum file
+type SpectraData struct {
+	ID               string
+	Location         string
+	Name             string
+	FileFormat       CVParam
+	SpectrumIDFormat CVParam
 }
 
 type mzIdentMLContent struct {
-	XMLName                      xml.Name                       `xml:"MzIdentML"`
-	Peptide                      []peptide                      `xml:"SequenceCollection>Peptide"`
-	SpectrumIdentificationResult []spectrumIdentificationResult `xml:"DataCollection>AnalysisData>SpectrumIdentificationList>SpectrumIdentificationResult"`
+	XMLName                      xml.Name                         `xml:"MzIdentML"`
+	ID                           string                           `xml:"id,attr"`
+	CreationDate                 string                           `xml:"creationDate,attr"`
+	AnalysisSoftware             []analysisSoftware               `xml:"AnalysisSoftwareList>AnalysisSoftware"`
+	DBSequence                   []dbSequence                     `xml:"SequenceCollection>DBSequence"`
+	Peptide                      []peptide                        `xml:"SequenceCollection>Peptide"`
+	PeptideEvidence              []peptideEvidence                `xml:"SequenceCollection>PeptideEvidence"`
+	SearchDatabase               []searchDatabase                 `xml:"DataCollection>Inputs>SearchDatabase"`
+	SpectraData                  []spectraData                    `xml:"DataCollection>Inputs>SpectraData"`
+	SpectrumIdentificationResult []spectrumIdentificationResult   `xml:"DataCollection>AnalysisData>SpectrumIdentificationList>SpectrumIdentificationResult"`
+	ProteinDetectionList         *proteinDetectionList            `xml:"DataCollection>AnalysisData>ProteinDetectionList"`
+	SpectrumIdentification       []spectrumIdentification         `xml:"AnalysisCollection>SpectrumIdentification"`
+	ProteinDetection             *proteinDetection                `xml:"AnalysisCollection>ProteinDetection"`
+	Protocol                     []spectrumIdentificationProtocol `xml:"AnalysisProtocolCollection>SpectrumIdentificationProtocol"`
+	ProteinDetectionProtocol     *proteinDetectionProtocol        `xml:"AnalysisProtocolCollection>ProteinDetectionProtocol"`
+}
+
+type analysisSoftware struct {
+	ID           string    `xml:"id,attr"`
+	Name         string    `xml:"name,attr,omitempty"`
+	Version      string    `xml:"version,attr,omitempty"`
+	SoftwareName paramList `xml:"SoftwareName"`
+}
+
+type dbSequence struct {
+	ID                string    `xml:"id,attr"`
+	Accession         string    `xml:"accession,attr"`
+	Length            int       `xml:"length,attr,omitempty"`
+	SearchDatabaseRef string    `xml:"searchDatabase_ref,attr"`
+	Seq               string    `xml:"Seq,omitempty"`
+	CvPar             []CVParam `xml:"cvParam"`
 }
 
 type peptide struct {
@@ -54,32 +146,121 @@ type modification struct {
 	// Note: monoisotopicMassDelta is optional according the the schema, but
 	// appears to be no other way to determine mass shift, as other
 	// corresponding cvParam's don't carry this info either
-	MonoisotopicMassDelta float64 `xml:"monoisotopicMassDelta,attr"`
+	MonoisotopicMassDelta float64   `xml:"monoisotopicMassDelta,attr"`
+	Location              *int      `xml:"location,attr"`
+	Residues              string    `xml:"residues,attr,omitempty"`
+	CvPar                 []CVParam `xml:"cvParam"`
+}
+
+type peptideEvidence struct {
+	ID            string `xml:"id,attr"`
+	DBSequenceRef string `xml:"dBSequence_ref,attr"`
+	PeptideRef    string `xml:"peptide_ref,attr"`
+	Start         int    `xml:"start,attr,omitempty"`
+	End           int    `xml:"end,attr,omitempty"`
+	Pre           string `xml:"pre,attr,omitempty"`
+	Post          string `xml:"post,attr,omitempty"`
+	IsDecoy       bool   `xml:"isDecoy,attr"`
+}
+
+type spectraData struct {
+	ID               string   `xml:"id,attr"`
+	Location         string   `xml:"location,attr"`
+	Name             string   `xml:"name,attr,omitempty"`
+	FileFormat       *CVParam `xml:"FileFormat>cvParam"`
+	SpectrumIDFormat *CVParam `xml:"SpectrumIDFormat>cvParam"`
+}
+
+type searchDatabase struct {
+	ID                   string     `xml:"id,attr"`
+	Location             string     `xml:"location,attr"`
+	Name                 string     `xml:"name,attr,omitempty"`
+	NumDatabaseSequences int64      `xml:"numDatabaseSequences,attr,omitempty"`
+	FileFormat           *paramList `xml:"FileFormat"`
+	DatabaseName         paramList  `xml:"DatabaseName"`
+}
+
+// paramList contains the cvParams and userParams of an element
+type paramList struct {
+	CvPar     []CVParam   `xml:"cvParam"`
+	UserParam []userParam `xml:"userParam"`
+}
+
+type userParam struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr,omitempty"`
 }
 
 type spectrumIdentificationResult struct {
+	ID                         string `xml:"id,attr"`
 	SpectrumID                 string `xml:"spectrumID,attr"`
+	SpectraDataRef             string `xml:"spectraData_ref,attr"`
 	SpectrumIdentificationItem []spectrumIdentificationItem
-	CvPar                      []cvParam `xml:"cvParam"`
+	CvPar                      []CVParam `xml:"cvParam"`
 }
 
 type spectrumIdentificationItem struct {
-	ChargeState              int       `xml:"chargeState,attr"`
-	PeptideRef               string    `xml:"peptide_ref,attr"`
-	Rank                     int       `xml:"rank,attr"`
-	ExperimentalMassToCharge float64   `xml:"experimentalMassToCharge,attr"`
-	CalculatedMassToCharge   float64   `xml:"calculatedMassToCharge,attr"`
-	PassThreshold            bool      `xml:"passThreshold,attr"`
-	CvPar                    []cvParam `xml:"cvParam"`
+	ID                       string               `xml:"id,attr"`
+	ChargeState              int                  `xml:"chargeState,attr"`
+	PeptideRef               string               `xml:"peptide_ref,attr"`
+	Rank                     int                  `xml:"rank,attr"`
+	ExperimentalMassToCharge float64              `xml:"experimentalMassToCharge,attr"`
+	CalculatedMassToCharge   float64              `xml:"calculatedMassToCharge,attr"`
+	PassThreshold            bool                 `xml:"passThreshold,attr"`
+	PeptideEvidenceRef       []peptideEvidenceRef `xml:"PeptideEvidenceRef"`
+	CvPar                    []CVParam            `xml:"cvParam"`
+}
+
+type peptideEvidenceRef struct {
+	PeptideEvidenceRef string `xml:"peptideEvidence_ref,attr"`
+}
+
+type proteinDetectionList struct {
+	ID                    string                  `xml:"id,attr"`
+	ProteinAmbiguityGroup []proteinAmbiguityGroup `xml:"ProteinAmbiguityGroup"`
+	CvPar                 []CVParam               `xml:"cvParam"`
+}
+
+type proteinAmbiguityGroup struct {
+	ID                         string                       `xml:"id,attr"`
+	ProteinDetectionHypothesis []proteinDetectionHypothesis `xml:"ProteinDetectionHypothesis"`
+	CvPar                      []CVParam                    `xml:"cvParam"`
+}
+
+type proteinDetectionHypothesis struct {
+	ID                string              `xml:"id,attr"`
+	DBSequenceRef     string              `xml:"dBSequence_ref,attr"`
+	PassThreshold     bool                `xml:"passThreshold,attr"`
+	PeptideHypothesis []peptideHypothesis `xml:"PeptideHypothesis"`
+	CvPar             []CVParam           `xml:"cvParam"`
+}
+
+type peptideHypothesis struct {
+	PeptideEvidenceRef            string                          `xml:"peptideEvidence_ref,attr"`
+	SpectrumIdentificationItemRef []spectrumIdentificationItemRef `xml:"SpectrumIdentificationItemRef"`
+}
+
+type spectrumIdentificationItemRef struct {
+	SpectrumIdentificationItemRef string `xml:"spectrumIdentificationItem_ref,attr"`
 }
 
-type cvParam struct {
+// CVParam is a controlled vocabulary term with its value
+type CVParam struct {
+	CvRef         string `xml:"cvRef,attr"`
 	Accession     string `xml:"accession,attr"`
 	Name          string `xml:"name,attr"`
-	Value         string `xml:"value,attr"`
-	UnitAccession string `xml:"unitAccession,attr"`
+	Value         string `xml:"value,attr,omitempty"`
+	UnitCvRef     string `xml:"unitCvRef,attr,omitempty"`
+	UnitAccession string `xml:"unitAccession,attr,omitempty"`
+	UnitName      string `xml:"unitName,attr,omitempty"`
 }
 
 var (
 	ErrInvalidIdentIndex = errors.New("mzIdentML: invalid identification index")
+	ErrInvalidSeqIndex   = errors.New("mzIdentML: invalid sequence index")
+	ErrUnknownRef        = errors.New("mzIdentML: reference to unknown id")
+	ErrNoScore           = errors.New("mzIdentML: score not present")
+	ErrMissingValue      = errors.New("mzIdentML: missing required value")
+	ErrDuplicateID       = errors.New("mzIdentML: duplicate id")
+	ErrMultipleSearches  = errors.New("mzIdentML: can't write more than one SpectrumIdentification")
 )
@@ -0,0 +1,112 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzidentml
+
+// DBSequence is a protein sequence from the searched database
+type DBSequence struct {
+	ID                string
+	Accession         string
+	Length            int
+	Sequence          string // Often not present
+	Description       string // Value of cvParam MS:1001088 (protein description)
+	SearchDatabaseRef string
+	Cv                []CVParam
+}
+
+// ProteinGroup is a group of proteins that can't be distinguished
+// based on the identified peptides (ProteinAmbiguityGroup)
+type ProteinGroup struct {
+	ID         string
+	Hypotheses []ProteinHypothesis
+	Cv         []CVParam
+}
+
+// ProteinHypothesis is a protein that was inferred from the
+// identified peptides (ProteinDetectionHypothesis)
+type ProteinHypothesis struct {
+	ID            string
+	DBSequenceRef string
+	Accession     string
+	PassThreshold bool
+	Peptides      []PeptideHypothesis
+	Cv            []CVParam
+}
+
+// PeptideHypothesis is the evidence of a peptide for a protein,
+// with the ids of the SpectrumIdentificationItems that identified it
+type PeptideHypothesis struct {
+	PeptideEvidenceRef string
+	ItemRefs           []string
+}
+
+// NumDBSequences returns the number of database sequences
+func (m *MzIdentML) NumDBSequences() int {
+	return len(m.content.DBSequence)
+}
+
+// DBSequence returns a database sequence. Parameter i is the index
+// of the sequence, it runs from 0 to NumDBSequences()-1
+func (m *MzIdentML) DBSequence(i int) (DBSequence, error) {
+	if i < 0 || i >= len(m.content.DBSequence) {
+		return DBSequence{}, ErrInvalidSeqIndex
+	}
+	d := m.content.DBSequence[i]
+	seq := DBSequence{
+		ID:                d.ID,
+		Accession:         d.Accession,
+		Length:            d.Length,
+		Sequence:          d.Seq,
+		SearchDatabaseRef: d.SearchDatabaseRef,
+		Cv:                d.CvPar,
+	}
+	for _, cv := range d.CvPar {
+		if cv.Accession == "MS:1001088" {
+			seq.Description = cv.Value
+		}
+	}
+	return seq, nil
+}
+
+// DBSequenceByID returns the database sequence with the given id
+func (m *MzIdentML) DBSequenceByID(id string) (DBSequence, error) {
+	i, ok := m.dbSeqID2Idx[id]
+	if !ok {
+		return DBSequence{}, ErrUnknownRef
+	}
+	return m.DBSequence(i)
+}
+
+// ProteinGroups returns the protein ambiguity groups of the
+// ProteinDetectionList. It returns nil if no protein inference was done.
+func (m *MzIdentML) ProteinGroups() []ProteinGroup {
+	if m.content.ProteinDetectionList == nil {
+		return nil
+	}
+	pagList := m.content.ProteinDetectionList.ProteinAmbiguityGroup
+	groups := make([]ProteinGroup, 0, len(pagList))
+	for _, pag := range pagList {
+		group := ProteinGroup{ID: pag.ID, Cv: pag.CvPar}
+		for _, pdh := range pag.ProteinDetectionHypothesis {
+			h := ProteinHypothesis{
+				ID:            pdh.ID,
+				DBSequenceRef: pdh.DBSequenceRef,
+				PassThreshold: pdh.PassThreshold,
+				Cv:            pdh.CvPar,
+			}
+			if i, ok := m.dbSeqID2Idx[pdh.DBSequenceRef]; ok {
+				h.Accession = m.content.DBSequence[i].Accession
+			}
+			for _, ph := range pdh.PeptideHypothesis {
+				pep := PeptideHypothesis{PeptideEvidenceRef: ph.PeptideEvidenceRef}
+				for _, ref := range ph.SpectrumIdentificationItemRef {
+					pep.ItemRefs = append(pep.ItemRefs, ref.SpectrumIdentificationItemRef)
+				}
+				h.Peptides = append(h.Peptides, pep)
+			}
+			group.Hypotheses = append(group.Hypotheses, h)
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
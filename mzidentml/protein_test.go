@@ -0,0 +1,54 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzidentml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProteins(t *testing.T) {
+	f, err := Read(strings.NewReader(testMzID))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	if f.NumDBSequences() != 2 {
+		t.Errorf("NumDBSequences is %d, expected 2", f.NumDBSequences())
+	}
+	seq, err := f.DBSequence(0)
+	if err != nil {
+		t.Fatalf("DBSequence: error return %v", err)
+	}
+	if seq.Accession != "sp|P1|PROT1" || seq.Length != 20 || seq.Sequence != "MKPEPTMCKAAAAAPEPTMR" ||
+		seq.Description != "Protein one" || seq.SearchDatabaseRef != "SDB_1" {
+		t.Errorf("DBSequence: %+v", seq)
+	}
+	_, err = f.DBSequence(2)
+	if err != ErrInvalidSeqIndex {
+		t.Errorf("DBSequence: error return %v, expected %v", err, ErrInvalidSeqIndex)
+	}
+	seq, err = f.DBSequenceByID("DBSeq_2")
+	if err != nil || seq.Accession != "DECOY_sp|P1|PROT1" {
+		t.Errorf("DBSequenceByID: %+v, error return %v", seq, err)
+	}
+	_, err = f.DBSequenceByID("DBSeq_3")
+	if err != ErrUnknownRef {
+		t.Errorf("DBSequenceByID: error return %v, expected %v", err, ErrUnknownRef)
+	}
+
+	groups := f.ProteinGroups()
+	if len(groups) != 1 || groups[0].ID != "PAG_1" || len(groups[0].Hypotheses) != 1 {
+		t.Fatalf("ProteinGroups: %+v", groups)
+	}
+	h := groups[0].Hypotheses[0]
+	if h.ID != "PDH_1" || h.Accession != "sp|P1|PROT1" || !h.PassThreshold ||
+		len(h.Cv) != 1 || h.Cv[0].Accession != "MS:1002403" {
+		t.Errorf("Hypothesis: %+v", h)
+	}
+	wantPeptides := []PeptideHypothesis{{PeptideEvidenceRef: "PE_1", ItemRefs: []string{"SII_1"}}}
+	if !reflect.DeepEqual(h.Peptides, wantPeptides) {
+		t.Errorf("Peptides: %+v, expected %+v", h.Peptides, wantPeptides)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"io"
 	"math"
 	"strconv"
+	"strings"
+	"time"
 
 	"golang.org/x/net/html/charset"
 )
@@ -22,9 +24,15 @@ func Read(reader io.Reader) (MzIdentML, error) {
 	if err != nil {
 		return mzIdentML, err
 	}
+	mzIdentML.id = mzIdentML.content.ID
+	mzIdentML.creationDate, err = time.Parse("2006-01-02T15:04:05", mzIdentML.content.CreationDate)
+	if err != nil {
+		mzIdentML.creationDate = time.Now()
+	}
 	mzIdentML.buildPepID2Sequence()
+	mzIdentML.buildRefMaps()
 	mzIdentML.buildIdentList()
-	return mzIdentML, err
+	return mzIdentML, nil
 }
 
 func (m *MzIdentML) buildPepID2Sequence() {
@@ -34,9 +42,56 @@ func (m *MzIdentML) buildPepID2Sequence() {
 	}
 }
 
+// buildRefMaps builds the maps from ids to the index of
+// the referenced elements
+func (m *MzIdentML) buildRefMaps() {
+	m.evidenceID2Idx = make(map[string]int, len(m.content.PeptideEvidence))
+	for i, e := range m.content.PeptideEvidence {
+		m.evidenceID2Idx[e.ID] = i
+	}
+	m.dbSeqID2Idx = make(map[string]int, len(m.content.DBSequence))
+	for i, d := range m.content.DBSequence {
+		m.dbSeqID2Idx[d.ID] = i
+	}
+	m.spectraDataID2Idx = make(map[string]int, len(m.content.SpectraData))
+	for i, s := range m.content.SpectraData {
+		m.spectraDataID2Idx[s.ID] = i
+	}
+
+	// Maps that are used when identifications are appended
+	m.pepKey2ID = make(map[string]string, len(m.content.Peptide))
+	for _, p := range m.content.Peptide {
+		var mods []Modification
+		for _, mod := range p.Modification {
+			mods = append(mods, mod.toModification())
+		}
+		m.pepKey2ID[pepKey(p.PeptideSequence, mods)] = p.ID
+	}
+	m.evidenceKey2ID = make(map[string]string, len(m.content.PeptideEvidence))
+	for _, e := range m.content.PeptideEvidence {
+		key := evidenceKey(e.PeptideRef, e.DBSequenceRef, PeptideEvidence{
+			Start: e.Start, End: e.End, Pre: e.Pre, Post: e.Post, IsDecoy: e.IsDecoy})
+		m.evidenceKey2ID[key] = e.ID
+	}
+	m.accession2DBSeqID = make(map[string]string, len(m.content.DBSequence))
+	for _, d := range m.content.DBSequence {
+		m.accession2DBSeqID[d.Accession] = d.ID
+	}
+	m.sirKey2Idx = make(map[string]int, len(m.content.SpectrumIdentificationResult))
+	for i, sir := range m.content.SpectrumIdentificationResult {
+		m.sirKey2Idx[sirKey(sir.SpectraDataRef, sir.SpectrumID)] = i
+	}
+	m.sirID2Idx = make(map[string]int, len(m.content.SpectrumIdentificationResult))
+	for i, sir := range m.content.SpectrumIdentificationResult {
+		m.sirID2Idx[sir.ID] = i
+	}
+}
+
 func (m *MzIdentML) buildIdentList() {
+	m.siiID2Idx = make(map[string]int)
 	for i := range m.content.SpectrumIdentificationResult {
-		for j := range m.content.SpectrumIdentificationResult[i].SpectrumIdentificationItem {
+		for j, sii := range m.content.SpectrumIdentificationResult[i].SpectrumIdentificationItem {
+			m.siiID2Idx[sii.ID] = len(m.identList)
 			var iRef identRef
 			iRef.specIDIdx = i
 			iRef.specResultIdx = j
@@ -77,10 +132,20 @@ func (m *MzIdentML) Ident(i int) (Identification, error) {
 	ident.ExperimentalMassToCharge = SpectrumIdentificationItem.ExperimentalMassToCharge
 	ident.PassThreshold = SpectrumIdentificationItem.PassThreshold
 	ident.Rank = SpectrumIdentificationItem.Rank
+	ident.ItemID = SpectrumIdentificationItem.ID
 	for _, mod := range m.content.Peptide[pepIdx].Modification {
 		ident.ModMass += mod.MonoisotopicMassDelta
+		ident.Mods = append(ident.Mods, mod.toModification())
+	}
+	for _, ref := range SpectrumIdentificationItem.PeptideEvidenceRef {
+		evidence, err := m.peptideEvidence(ref.PeptideEvidenceRef)
+		if err != nil {
+			return ident, err
+		}
+		ident.Evidence = append(ident.Evidence, evidence)
 	}
 	ident.SpecID = m.content.SpectrumIdentificationResult[specIDIdx].SpectrumID
+	ident.SpectraDataRef = m.content.SpectrumIdentificationResult[specIDIdx].SpectraDataRef
 	ident.RetentionTime = float64(-1)
 	prio := math.MaxInt32
 	for _, cv := range m.content.SpectrumIdentificationResult[specIDIdx].CvPar {
@@ -133,3 +198,154 @@ func (m *MzIdentML) Ident(i int) (Identification, error) {
 
 	return ident, nil
 }
+
+// toModification converts a modification. The accession is taken from
+// the first UNIMOD or PSI-MOD cvParam.
+func (mod *modification) toModification() Modification {
+	m := Modification{
+		Location:  -1,
+		Residues:  mod.Residues,
+		MassDelta: mod.MonoisotopicMassDelta,
+	}
+	if mod.Location != nil {
+		m.Location = *mod.Location
+	}
+	for _, cv := range mod.CvPar {
+		if strings.HasPrefix(cv.Accession, "UNIMOD:") || strings.HasPrefix(cv.Accession, "MOD:") {
+			m.Accession = cv.Accession
+			m.Name = cv.Name
+			break
+		}
+	}
+	// Unknown modifications (MS:1001460) only have a name
+	if m.Name == `` && len(mod.CvPar) > 0 {
+		m.Name = mod.CvPar[0].Name
+	}
+	return m
+}
+
+// peptideEvidence returns the PeptideEvidence with the given id
+func (m *MzIdentML) peptideEvidence(id string) (PeptideEvidence, error) {
+	i, ok := m.evidenceID2Idx[id]
+	if !ok {
+		return PeptideEvidence{}, ErrUnknownRef
+	}
+	e := m.content.PeptideEvidence[i]
+	evidence := PeptideEvidence{
+		ID:            e.ID,
+		DBSequenceRef: e.DBSequenceRef,
+		Pre:           e.Pre,
+		Post:          e.Post,
+		Start:         e.Start,
+		End:           e.End,
+		IsDecoy:       e.IsDecoy,
+	}
+	if j, ok := m.dbSeqID2Idx[e.DBSequenceRef]; ok {
+		evidence.Accession = m.content.DBSequence[j].Accession
+	}
+	return evidence, nil
+}
+
+// SpectraData returns the spectrum files that were searched
+func (m *MzIdentML) SpectraData() []SpectraData {
+	res := make([]SpectraData, 0, len(m.content.SpectraData))
+	for _, s := range m.content.SpectraData {
+		sd := SpectraData{
+			ID:       s.ID,
+			Location: s.Location,
+			Name:     s.Name,
+		}
+		if s.FileFormat != nil {
+			sd.FileFormat = *s.FileFormat
+		}
+		if s.SpectrumIDFormat != nil {
+			sd.SpectrumIDFormat = *s.SpectrumIDFormat
+		}
+		res = append(res, sd)
+	}
+	return res
+}
+
+// Score returns the value of the score cvParam with the given accession,
+// e.g. MS:1002257 (Comet:expectation value)
+func (ident *Identification) Score(accession string) (float64, error) {
+	for _, cv := range ident.Cv {
+		if cv.Accession == accession {
+			return strconv.ParseFloat(cv.Value, 64)
+		}
+	}
+	return 0, ErrNoScore
+}
+
+// SearchDatabases returns the sequence databases that were searched
+func (m *MzIdentML) SearchDatabases() []SearchDatabase {
+	res := make([]SearchDatabase, 0, len(m.content.SearchDatabase))
+	for _, db := range m.content.SearchDatabase {
+		res = append(res, SearchDatabase{
+			ID:           db.ID,
+			Location:     db.Location,
+			Name:         db.Name,
+			NumSequences: db.NumDatabaseSequences,
+		})
+	}
+	return res
+}
+
+// AnalysisSoftware returns the software that produced the identifications
+func (m *MzIdentML) AnalysisSoftware() []Software {
+	res := make([]Software, 0, len(m.content.AnalysisSoftware))
+	for _, s := range m.content.AnalysisSoftware {
+		res = append(res, Software{
+			ID:      s.ID,
+			Name:    s.Name,
+			Version: s.Version,
+			Cv:      s.SoftwareName.CvPar,
+		})
+	}
+	return res
+}
+
+// SearchModifications returns the modifications that were
+// specified for the search
+func (m *MzIdentML) SearchModifications() []SearchModification {
+	if m.protocol != nil {
+		return m.protocol.Modifications
+	}
+	var searchMods []searchModification
+	for _, p := range m.content.Protocol {
+		if p.ModificationParams != nil {
+			searchMods = append(searchMods, p.ModificationParams.SearchModification...)
+		}
+	}
+	res := make([]SearchModification, 0, len(searchMods))
+	for _, sm := range searchMods {
+		mod := SearchModification{
+			Residues:  sm.Residues,
+			MassDelta: sm.MassDelta,
+			Fixed:     sm.FixedMod,
+		}
+		for _, cv := range sm.CvPar {
+			if strings.HasPrefix(cv.Accession, "UNIMOD:") || strings.HasPrefix(cv.Accession, "MOD:") {
+				mod.Accession = cv.Accession
+				mod.Name = cv.Name
+				break
+			}
+		}
+		if sm.SpecificityRules != nil {
+			for _, cv := range sm.SpecificityRules.CvPar {
+				switch cv.Accession {
+				case "MS:1001189":
+					mod.Terminus = "N"
+				case "MS:1001190":
+					mod.Terminus = "C"
+				case "MS:1002057":
+					mod.Terminus, mod.ProteinTerminus = "N", true
+				case "MS:1002058":
+					mod.Terminus, mod.ProteinTerminus = "C", true
+				}
+			}
+		}
+		res = append(res, mod)
+	}
+	return res
+}
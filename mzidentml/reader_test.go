@@ -5,7 +5,10 @@ package mzidentml
 
 import (
 	"log"
+	"math"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -67,3 +70,110 @@ func TestAll2(t *testing.T) {
 	log.Printf("ident: %+v", ident)
 
 }
+
+const testMzID = `<?xml version="1.0" encoding="UTF-8"?>
+<MzIdentML id="test" version="1.2.0" xmlns="http://psidev.info/psi/pi/mzIdentML/1.2">
+<SequenceCollection>
+<DBSequence id="DBSeq_1" accession="sp|P1|PROT1" length="20" searchDatabase_ref="SDB_1">
+<Seq>MKPEPTMCKAAAAAPEPTMR</Seq>
+<cvParam cvRef="PSI-MS" accession="MS:1001088" name="protein description" value="Protein one"/>
+</DBSequence>
+<DBSequence id="DBSeq_2" accession="DECOY_sp|P1|PROT1" length="20" searchDatabase_ref="SDB_1"/>
+<Peptide id="Pep_1">
+<PeptideSequence>PEPTMCK</PeptideSequence>
+<Modification location="5" residues="M" monoisotopicMassDelta="15.994915">
+<cvParam cvRef="UNIMOD" accession="UNIMOD:35" name="Oxidation"/>
+</Modification>
+<Modification location="6" residues="C" monoisotopicMassDelta="57.021464">
+<cvParam cvRef="UNIMOD" accession="UNIMOD:4" name="Carbamidomethyl"/>
+</Modification>
+<Modification location="0" monoisotopicMassDelta="42.010565">
+<cvParam cvRef="PSI-MOD" accession="MOD:00394" name="acetylated residue"/>
+</Modification>
+</Peptide>
+<PeptideEvidence id="PE_1" dBSequence_ref="DBSeq_1" peptide_ref="Pep_1" start="3" end="9" pre="K" post="A" isDecoy="false"/>
+<PeptideEvidence id="PE_2" dBSequence_ref="DBSeq_2" peptide_ref="Pep_1" start="10" end="16" pre="A" post="-" isDecoy="true"/>
+</SequenceCollection>
+<DataCollection>
+<Inputs>
+<SpectraData location="file:///data/run1.mzML" id="SD_1" name="run1">
+<FileFormat><cvParam cvRef="PSI-MS" accession="MS:1000584" name="mzML format"/></FileFormat>
+<SpectrumIDFormat><cvParam cvRef="PSI-MS" accession="MS:1000768" name="Thermo nativeID format"/></SpectrumIDFormat>
+</SpectraData>
+</Inputs>
+<AnalysisData>
+<SpectrumIdentificationList id="SIL_1">
+<SpectrumIdentificationResult id="SIR_1" spectrumID="scan=10" spectraData_ref="SD_1">
+<SpectrumIdentificationItem id="SII_1" chargeState="2" experimentalMassToCharge="500.25" calculatedMassToCharge="500.24" peptide_ref="Pep_1" rank="1" passThreshold="true">
+<PeptideEvidenceRef peptideEvidence_ref="PE_1"/>
+<PeptideEvidenceRef peptideEvidence_ref="PE_2"/>
+<cvParam cvRef="PSI-MS" accession="MS:1002252" name="Comet:xcorr" value="3.25"/>
+<cvParam cvRef="PSI-MS" accession="MS:1002257" name="Comet:expectation value" value="1.5E-5"/>
+</SpectrumIdentificationItem>
+<cvParam cvRef="PSI-MS" accession="MS:1000016" name="scan start time" value="10" unitCvRef="UO" unitAccession="UO:0000031" unitName="minute"/>
+</SpectrumIdentificationResult>
+</SpectrumIdentificationList>
+<ProteinDetectionList id="PDL_1">
+<ProteinAmbiguityGroup id="PAG_1">
+<ProteinDetectionHypothesis id="PDH_1" dBSequence_ref="DBSeq_1" passThreshold="true">
+<PeptideHypothesis peptideEvidence_ref="PE_1">
+<SpectrumIdentificationItemRef spectrumIdentificationItem_ref="SII_1"/>
+</PeptideHypothesis>
+<cvParam cvRef="PSI-MS" accession="MS:1002403" name="group representative"/>
+</ProteinDetectionHypothesis>
+</ProteinAmbiguityGroup>
+</ProteinDetectionList>
+</AnalysisData>
+</DataCollection>
+</MzIdentML>
+`
+
+func TestModel(t *testing.T) {
+	f, err := Read(strings.NewReader(testMzID))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	if f.NumIdents() != 1 {
+		t.Fatalf("NumIdents is %d, expected 1", f.NumIdents())
+	}
+	ident, err := f.Ident(0)
+	if err != nil {
+		t.Fatalf("Ident: error return %v", err)
+	}
+	if ident.PepSeq != "PEPTMCK" || ident.ItemID != "SII_1" || ident.SpecID != "scan=10" ||
+		ident.SpectraDataRef != "SD_1" || ident.RetentionTime != 600 || ident.Charge != 2 {
+		t.Errorf("Ident: %+v", ident)
+	}
+	if math.Abs(ident.ModMass-(15.994915+57.021464+42.010565)) > 1e-9 {
+		t.Errorf("ModMass is %v", ident.ModMass)
+	}
+	wantMods := []Modification{
+		{Location: 5, Residues: "M", MassDelta: 15.994915, Accession: "UNIMOD:35", Name: "Oxidation"},
+		{Location: 6, Residues: "C", MassDelta: 57.021464, Accession: "UNIMOD:4", Name: "Carbamidomethyl"},
+		{Location: 0, MassDelta: 42.010565, Accession: "MOD:00394", Name: "acetylated residue"},
+	}
+	if !reflect.DeepEqual(ident.Mods, wantMods) {
+		t.Errorf("Mods: %+v, expected %+v", ident.Mods, wantMods)
+	}
+	wantEvidence := []PeptideEvidence{
+		{ID: "PE_1", DBSequenceRef: "DBSeq_1", Accession: "sp|P1|PROT1", Pre: "K", Post: "A", Start: 3, End: 9},
+		{ID: "PE_2", DBSequenceRef: "DBSeq_2", Accession: "DECOY_sp|P1|PROT1", Pre: "A", Post: "-", Start: 10, End: 16, IsDecoy: true},
+	}
+	if !reflect.DeepEqual(ident.Evidence, wantEvidence) {
+		t.Errorf("Evidence: %+v, expected %+v", ident.Evidence, wantEvidence)
+	}
+	score, err := ident.Score("MS:1002257")
+	if err != nil || score != 1.5e-5 {
+		t.Errorf("Score: %v, error return %v", score, err)
+	}
+	_, err = ident.Score("MS:1002049")
+	if err != ErrNoScore {
+		t.Errorf("Score: error return %v, expected %v", err, ErrNoScore)
+	}
+
+	sd := f.SpectraData()
+	if len(sd) != 1 || sd[0].ID != "SD_1" || sd[0].Location != "file:///data/run1.mzML" ||
+		sd[0].FileFormat.Accession != "MS:1000584" || sd[0].SpectrumIDFormat.Accession != "MS:1000768" {
+		t.Errorf("SpectraData: %+v", sd)
+	}
+}
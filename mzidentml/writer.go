@@ -0,0 +1,375 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzidentml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+)
+
+// The controlled vocabularies that are used by the writer
+const writerCvList = `<cvList>
+  <cv id="PSI-MS" fullName="PSI-MS" uri="https://raw.githubusercontent.com/HUPO-PSI/psi-ms-CV/master/psi-ms.obo"/>
+  <cv id="UNIMOD" fullName="UNIMOD" uri="http://www.unimod.org/obo/unimod.obo"/>
+  <cv id="UO" fullName="UNIT-ONTOLOGY" uri="https://raw.githubusercontent.com/bio-ontology-research-group/unit-ontology/master/unit.obo"/>
+  <cv id="PSI-MOD" fullName="PSI-MOD" uri="https://raw.githubusercontent.com/HUPO-PSI/psi-mod-CV/master/PSI-MOD.obo"/>
+ </cvList>
+`
+
+// Ids of the elements of which the writer creates only one
+const (
+	softwareID = "AS_1"
+	protocolID = "SIP_1"
+	siID       = "SI_1"
+	silID      = "SIL_1"
+)
+
+type spectrumIdentificationProtocol struct {
+	ID                     string              `xml:"id,attr"`
+	Name                   string              `xml:"name,attr,omitempty"`
+	AnalysisSoftwareRef    string              `xml:"analysisSoftware_ref,attr"`
+	SearchType             paramList           `xml:"SearchType"`
+	AdditionalSearchParams *paramList          `xml:"AdditionalSearchParams"`
+	ModificationParams     *modificationParams `xml:"ModificationParams"`
+	Enzymes                *enzymes            `xml:"Enzymes"`
+	FragmentTolerance      *paramList          `xml:"FragmentTolerance"`
+	ParentTolerance        *paramList          `xml:"ParentTolerance"`
+	Threshold              paramList           `xml:"Threshold"`
+}
+
+type proteinDetectionProtocol struct {
+	ID                  string     `xml:"id,attr"`
+	Name                string     `xml:"name,attr,omitempty"`
+	AnalysisSoftwareRef string     `xml:"analysisSoftware_ref,attr"`
+	AnalysisParams      *paramList `xml:"AnalysisParams"`
+	Threshold           paramList  `xml:"Threshold"`
+}
+
+type spectrumIdentification struct {
+	ID                string              `xml:"id,attr"`
+	ProtocolRef       string              `xml:"spectrumIdentificationProtocol_ref,attr"`
+	ListRef           string              `xml:"spectrumIdentificationList_ref,attr"`
+	InputSpectra      []inputSpectra      `xml:"InputSpectra"`
+	SearchDatabaseRef []searchDatabaseRef `xml:"SearchDatabaseRef"`
+}
+
+type inputSpectra struct {
+	SpectraDataRef string `xml:"spectraData_ref,attr"`
+}
+
+type searchDatabaseRef struct {
+	SearchDatabaseRef string `xml:"searchDatabase_ref,attr"`
+}
+
+type proteinDetection struct {
+	ID                           string                         `xml:"id,attr"`
+	ProtocolRef                  string                         `xml:"proteinDetectionProtocol_ref,attr"`
+	ListRef                      string                         `xml:"proteinDetectionList_ref,attr"`
+	InputSpectrumIdentifications []inputSpectrumIdentifications `xml:"InputSpectrumIdentifications"`
+}
+
+type inputSpectrumIdentifications struct {
+	ListRef string `xml:"spectrumIdentificationList_ref,attr"`
+}
+
+type modificationParams struct {
+	SearchModification []searchModification `xml:"SearchModification"`
+}
+
+type searchModification struct {
+	FixedMod         bool       `xml:"fixedMod,attr"`
+	MassDelta        float64    `xml:"massDelta,attr"`
+	Residues         string     `xml:"residues,attr"`
+	SpecificityRules *paramList `xml:"SpecificityRules"`
+	CvPar            []CVParam  `xml:"cvParam"`
+}
+
+type enzymes struct {
+	Enzyme []enzyme `xml:"Enzyme"`
+}
+
+type enzyme struct {
+	ID              string     `xml:"id,attr"`
+	MissedCleavages int        `xml:"missedCleavages,attr"`
+	SemiSpecific    bool       `xml:"semiSpecific,attr"`
+	SiteRegexp      string     `xml:"SiteRegexp,omitempty"`
+	EnzymeName      *paramList `xml:"EnzymeName"`
+}
+
+type mzIdentMLWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (w *mzIdentMLWriter) str(s string) {
+	if w.err == nil {
+		_, w.err = w.w.WriteString(s)
+	}
+}
+
+// element writes v as XML element with the given name, indented by prefix
+func (w *mzIdentMLWriter) element(prefix string, name string, v interface{}) {
+	if w.err != nil {
+		return
+	}
+	var b bytes.Buffer
+	enc := xml.NewEncoder(&b)
+	enc.Indent(prefix, ` `)
+	w.err = enc.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}})
+	b.WriteString("\n")
+	w.str(b.String())
+}
+
+// startTag returns an XML start tag, attrs contains attribute name/value pairs
+func startTag(name string, attrs ...string) string {
+	var b bytes.Buffer
+	b.WriteString("<" + name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		b.WriteString(" " + attrs[i] + "=\"")
+		xml.EscapeText(&b, []byte(attrs[i+1]))
+		b.WriteString("\"")
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// Write writes an mzIdentML 1.2 file that was built with New or read with Read.
+// The analysis software, at least one search database, at least one
+// spectra data and at least one identification must be present.
+// For a file that was read, the search protocol and the protein detection
+// are written as read; files with more than one SpectrumIdentification
+// can't be written.
+func (m *MzIdentML) Write(writer io.Writer) error {
+	if len(m.content.AnalysisSoftware) == 0 || len(m.content.SearchDatabase) == 0 ||
+		len(m.content.SpectraData) == 0 || len(m.content.SpectrumIdentificationResult) == 0 {
+		return ErrMissingValue
+	}
+	si, err := m.spectrumIdentification()
+	if err != nil {
+		return err
+	}
+	protocol, err := m.xmlProtocol(si.ProtocolRef)
+	if err != nil {
+		return err
+	}
+	w := mzIdentMLWriter{w: bufio.NewWriter(writer)}
+	w.str(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	w.str(startTag("MzIdentML",
+		"id", m.id,
+		"version", "1.2.0",
+		"creationDate", m.creationDate.Format("2006-01-02T15:04:05"),
+		"xmlns", "http://psidev.info/psi/pi/mzIdentML/1.2",
+		"xmlns:xsi", "http://www.w3.org/2001/XMLSchema-instance",
+		"xsi:schemaLocation", "http://psidev.info/psi/pi/mzIdentML/1.2 https://raw.githubusercontent.com/HUPO-PSI/mzIdentML/master/schema/mzIdentML1.2.0.xsd") + "\n")
+	w.str(" " + writerCvList)
+	m.writeSoftware(&w)
+	m.writeSequenceCollection(&w)
+	m.writeAnalysisCollection(&w, si)
+	w.str(" <AnalysisProtocolCollection>\n")
+	w.element("  ", "SpectrumIdentificationProtocol", protocol)
+	if m.content.ProteinDetectionProtocol != nil {
+		w.element("  ", "ProteinDetectionProtocol", m.content.ProteinDetectionProtocol)
+	}
+	w.str(" </AnalysisProtocolCollection>\n")
+	m.writeDataCollection(&w, si.ListRef)
+	w.str("</MzIdentML>\n")
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+func (m *MzIdentML) writeSoftware(w *mzIdentMLWriter) {
+	w.str(" <AnalysisSoftwareList>\n")
+	for i := range m.content.AnalysisSoftware {
+		w.element("  ", "AnalysisSoftware", &m.content.AnalysisSoftware[i])
+	}
+	w.str(" </AnalysisSoftwareList>\n")
+}
+
+// spectrumIdentification returns the ids of the search and its protocol
+// and result list, as read or, for a new file, the ids of the writer.
+// The input spectra and databases are set to all spectra data and
+// search databases.
+func (m *MzIdentML) spectrumIdentification() (spectrumIdentification, error) {
+	si := spectrumIdentification{ID: siID, ProtocolRef: protocolID, ListRef: silID}
+	switch len(m.content.SpectrumIdentification) {
+	case 0:
+	case 1:
+		si = m.content.SpectrumIdentification[0]
+	default:
+		return si, ErrMultipleSearches
+	}
+	si.InputSpectra = make([]inputSpectra, 0, len(m.content.SpectraData))
+	for _, sd := range m.content.SpectraData {
+		si.InputSpectra = append(si.InputSpectra, inputSpectra{SpectraDataRef: sd.ID})
+	}
+	si.SearchDatabaseRef = make([]searchDatabaseRef, 0, len(m.content.SearchDatabase))
+	for _, db := range m.content.SearchDatabase {
+		si.SearchDatabaseRef = append(si.SearchDatabaseRef, searchDatabaseRef{SearchDatabaseRef: db.ID})
+	}
+	return si, nil
+}
+
+func (m *MzIdentML) writeSequenceCollection(w *mzIdentMLWriter) {
+	w.str(" <SequenceCollection>\n")
+	for i := range m.content.DBSequence {
+		w.element("  ", "DBSequence", &m.content.DBSequence[i])
+	}
+	for i := range m.content.Peptide {
+		w.element("  ", "Peptide", &m.content.Peptide[i])
+	}
+	for i := range m.content.PeptideEvidence {
+		w.element("  ", "PeptideEvidence", &m.content.PeptideEvidence[i])
+	}
+	w.str(" </SequenceCollection>\n")
+}
+
+func (m *MzIdentML) writeAnalysisCollection(w *mzIdentMLWriter, si spectrumIdentification) {
+	w.str(" <AnalysisCollection>\n")
+	w.element("  ", "SpectrumIdentification", &si)
+	if m.content.ProteinDetection != nil {
+		w.element("  ", "ProteinDetection", m.content.ProteinDetection)
+	}
+	w.str(" </AnalysisCollection>\n")
+}
+
+func (m *MzIdentML) writeDataCollection(w *mzIdentMLWriter, listID string) {
+	w.str(" <DataCollection>\n")
+	w.str("  <Inputs>\n")
+	for i := range m.content.SearchDatabase {
+		w.element("   ", "SearchDatabase", &m.content.SearchDatabase[i])
+	}
+	for i := range m.content.SpectraData {
+		w.element("   ", "SpectraData", &m.content.SpectraData[i])
+	}
+	w.str("  </Inputs>\n")
+	w.str("  <AnalysisData>\n")
+	w.str("   " + startTag("SpectrumIdentificationList", "id", listID) + "\n")
+	for i := range m.content.SpectrumIdentificationResult {
+		w.element("    ", "SpectrumIdentificationResult", &m.content.SpectrumIdentificationResult[i])
+	}
+	w.str("   </SpectrumIdentificationList>\n")
+	if m.content.ProteinDetectionList != nil {
+		w.element("   ", "ProteinDetectionList", m.content.ProteinDetectionList)
+	}
+	w.str("  </AnalysisData>\n")
+	w.str(" </DataCollection>\n")
+}
+
+// xmlProtocol converts the search protocol to the mzIdentML type. Without
+// a search protocol, the protocol of a file that was read is returned.
+func (m *MzIdentML) xmlProtocol(id string) (*spectrumIdentificationProtocol, error) {
+	if m.protocol == nil {
+		for i := range m.content.Protocol {
+			if m.content.Protocol[i].ID == id {
+				return &m.content.Protocol[i], nil
+			}
+		}
+	}
+	p := spectrumIdentificationProtocol{
+		ID:                  id,
+		AnalysisSoftwareRef: m.content.AnalysisSoftware[0].ID,
+		SearchType: paramList{CvPar: []CVParam{
+			{CvRef: "PSI-MS", Accession: "MS:1001083", Name: "ms-ms search"}}},
+		Threshold: paramList{CvPar: []CVParam{
+			{CvRef: "PSI-MS", Accession: "MS:1001494", Name: "no threshold"}}},
+	}
+	if m.protocol == nil {
+		return &p, nil
+	}
+	if len(m.protocol.AdditionalParams) > 0 {
+		p.AdditionalSearchParams = &paramList{CvPar: withCvRef(m.protocol.AdditionalParams)}
+	}
+	if len(m.protocol.Threshold) > 0 {
+		p.Threshold.CvPar = withCvRef(m.protocol.Threshold)
+	}
+	if len(m.protocol.Modifications) > 0 {
+		p.ModificationParams = &modificationParams{}
+		for i := range m.protocol.Modifications {
+			sm, err := xmlSearchModification(&m.protocol.Modifications[i])
+			if err != nil {
+				return nil, err
+			}
+			p.ModificationParams.SearchModification = append(p.ModificationParams.SearchModification, sm)
+		}
+	}
+	if len(m.protocol.Enzymes) > 0 {
+		p.Enzymes = &enzymes{}
+		for i, e := range m.protocol.Enzymes {
+			if e.Name == `` && e.Accession == `` {
+				return nil, ErrMissingValue
+			}
+			xmlEnzyme := enzyme{
+				ID:              "Enz_" + strconv.Itoa(i+1),
+				MissedCleavages: e.MissedCleavages,
+				SemiSpecific:    e.SemiSpecific,
+				SiteRegexp:      e.SiteRegexp,
+			}
+			if e.Accession != `` {
+				xmlEnzyme.EnzymeName = &paramList{CvPar: withCvRef([]CVParam{{Accession: e.Accession, Name: e.Name}})}
+			} else {
+				xmlEnzyme.EnzymeName = &paramList{UserParam: []userParam{{Name: e.Name}}}
+			}
+			p.Enzymes.Enzyme = append(p.Enzymes.Enzyme, xmlEnzyme)
+		}
+	}
+	p.FragmentTolerance = xmlTolerance(m.protocol.FragmentTolerance)
+	p.ParentTolerance = xmlTolerance(m.protocol.ParentTolerance)
+	return &p, nil
+}
+
+func xmlSearchModification(mod *SearchModification) (searchModification, error) {
+	sm := searchModification{
+		FixedMod:  mod.Fixed,
+		MassDelta: mod.MassDelta,
+		Residues:  mod.Residues,
+	}
+	if sm.Residues == `` {
+		sm.Residues = "."
+	}
+	if mod.Accession != `` {
+		sm.CvPar = withCvRef([]CVParam{{Accession: mod.Accession, Name: mod.Name}})
+	} else {
+		sm.CvPar = []CVParam{{CvRef: "PSI-MS", Accession: "MS:1001460",
+			Name: "unknown modification", Value: mod.Name}}
+	}
+	var rule CVParam
+	switch {
+	case mod.Terminus == ``:
+		return sm, nil
+	case mod.Terminus == "N" && mod.ProteinTerminus:
+		rule = CVParam{Accession: "MS:1002057", Name: "modification specificity protein N-term"}
+	case mod.Terminus == "C" && mod.ProteinTerminus:
+		rule = CVParam{Accession: "MS:1002058", Name: "modification specificity protein C-term"}
+	case mod.Terminus == "N":
+		rule = CVParam{Accession: "MS:1001189", Name: "modification specificity peptide N-term"}
+	case mod.Terminus == "C":
+		rule = CVParam{Accession: "MS:1001190", Name: "modification specificity peptide C-term"}
+	default:
+		return sm, ErrMissingValue
+	}
+	rule.CvRef = "PSI-MS"
+	sm.SpecificityRules = &paramList{CvPar: []CVParam{rule}}
+	return sm, nil
+}
+
+// xmlTolerance returns the search tolerance params, or nil
+// if the tolerance is zero
+func xmlTolerance(t Tolerance) *paramList {
+	if t.Plus == 0 && t.Minus == 0 {
+		return nil
+	}
+	unit := CVParam{UnitCvRef: "UO", UnitAccession: "UO:0000221", UnitName: "dalton"}
+	if t.PPM {
+		unit = CVParam{UnitCvRef: "UO", UnitAccession: "UO:0000169", UnitName: "parts per million"}
+	}
+	plus, minus := unit, unit
+	plus.CvRef, plus.Accession, plus.Name, plus.Value = "PSI-MS", "MS:1001412", "search tolerance plus value", formatFloat(t.Plus)
+	minus.CvRef, minus.Accession, minus.Name, minus.Value = "PSI-MS", "MS:1001413", "search tolerance minus value", formatFloat(t.Minus)
+	return &paramList{CvPar: []CVParam{plus, minus}}
+}
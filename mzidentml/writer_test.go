@@ -0,0 +1,348 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzidentml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testBuild returns an MzIdentML with two spectra and three identifications
+func testBuild(t *testing.T) MzIdentML {
+	m := New("test")
+	m.SetAnalysisSoftware("galms", "0.1", nil)
+	m.SetSearchProtocol(SearchProtocol{
+		Enzymes: []Enzyme{{Name: "Trypsin", Accession: "MS:1001251",
+			SiteRegexp: `(?<=[KR])(?!P)`, MissedCleavages: 2}},
+		Modifications: []SearchModification{
+			{Residues: "C", MassDelta: 57.021464, Fixed: true, Accession: "UNIMOD:4", Name: "Carbamidomethyl"},
+			{Residues: "M", MassDelta: 15.994915, Accession: "UNIMOD:35", Name: "Oxidation"},
+			{Residues: ".", MassDelta: 42.010565, Accession: "UNIMOD:1", Name: "Acetyl", Terminus: "N", ProteinTerminus: true},
+		},
+		FragmentTolerance: Tolerance{Plus: 0.02, Minus: 0.02},
+		ParentTolerance:   Tolerance{Plus: 10, Minus: 10, PPM: true},
+	})
+	_, err := m.AppendSearchDatabase(SearchDatabase{Location: "/db/human.fasta", NumSequences: 20000})
+	if err != nil {
+		t.Fatalf("AppendSearchDatabase: error return %v", err)
+	}
+	_, err = m.AppendSpectraData(SpectraData{
+		Location:         "/data/run1.mzML",
+		FileFormat:       CVParam{Accession: "MS:1000584", Name: "mzML format"},
+		SpectrumIDFormat: CVParam{Accession: "MS:1000768", Name: "Thermo nativeID format"},
+	})
+	if err != nil {
+		t.Fatalf("AppendSpectraData: error return %v", err)
+	}
+	_, err = m.AppendDBSequence(DBSequence{Accession: "sp|P1|PROT1", Sequence: "MKPEPTMCKAAAA", Description: "Protein one"})
+	if err != nil {
+		t.Fatalf("AppendDBSequence: error return %v", err)
+	}
+	idents := []Identification{
+		{PepSeq: "PEPTMCK", Charge: 2, ExperimentalMassToCharge: 500.25, CalculatedMassToCharge: 500.24,
+			PassThreshold: true, Rank: 1, SpecID: "scan=10", RetentionTime: 600,
+			Cv: []CVParam{{Accession: "MS:1002257", Name: "Comet:expectation value", Value: "1.5E-5"}},
+			Mods: []Modification{
+				{Location: 5, Residues: "M", MassDelta: 15.994915, Accession: "UNIMOD:35", Name: "Oxidation"},
+				{Location: 6, Residues: "C", MassDelta: 57.021464, Accession: "UNIMOD:4", Name: "Carbamidomethyl"},
+			},
+			Evidence: []PeptideEvidence{
+				{Accession: "sp|P1|PROT1", Pre: "K", Post: "A", Start: 3, End: 9},
+				{Accession: "DECOY_sp|P2|PROT2", Pre: "-", Post: "R", Start: 1, End: 7, IsDecoy: true},
+			}},
+		{PepSeq: "PEPTIDEK", Charge: 2, ExperimentalMassToCharge: 500.25, Rank: 2, SpecID: "scan=10", RetentionTime: 600,
+			Evidence: []PeptideEvidence{{Accession: "sp|P3|PROT3"}}},
+		// Same peptide and evidence as the first identification
+		{PepSeq: "PEPTMCK", Charge: 3, ExperimentalMassToCharge: 333.8, PassThreshold: true, Rank: 1,
+			SpecID: "scan=20", RetentionTime: -1,
+			Mods: []Modification{
+				{Location: 5, Residues: "M", MassDelta: 15.994915, Accession: "UNIMOD:35", Name: "Oxidation"},
+				{Location: 6, Residues: "C", MassDelta: 57.021464, Accession: "UNIMOD:4", Name: "Carbamidomethyl"},
+			},
+			Evidence: []PeptideEvidence{{Accession: "sp|P1|PROT1", Pre: "K", Post: "A", Start: 3, End: 9}}},
+	}
+	for i, ident := range idents {
+		n, err := m.AppendIdentification(ident)
+		if err != nil {
+			t.Fatalf("AppendIdentification: error return %v", err)
+		}
+		if n != i {
+			t.Errorf("AppendIdentification: index %d, should be %d", n, i)
+		}
+	}
+	return m
+}
+
+func TestBuild(t *testing.T) {
+	m := testBuild(t)
+	if m.NumIdents() != 3 || len(m.content.SpectrumIdentificationResult) != 2 ||
+		len(m.content.Peptide) != 2 || len(m.content.PeptideEvidence) != 3 || m.NumDBSequences() != 3 {
+		t.Errorf("Build: %d idents, %d results, %d peptides, %d evidence, %d proteins", m.NumIdents(),
+			len(m.content.SpectrumIdentificationResult), len(m.content.Peptide),
+			len(m.content.PeptideEvidence), m.NumDBSequences())
+	}
+	_, err := m.AppendIdentification(Identification{PepSeq: "PEPTIDE", SpecID: "scan=1",
+		SpectraDataRef: "SD_9", Evidence: []PeptideEvidence{{Accession: "P1"}}})
+	if err != ErrUnknownRef {
+		t.Errorf("AppendIdentification: error return %v, should be %v", err, ErrUnknownRef)
+	}
+	_, err = m.AppendIdentification(Identification{PepSeq: "PEPTIDE", SpecID: "scan=1"})
+	if err != ErrMissingValue {
+		t.Errorf("AppendIdentification: error return %v, should be %v", err, ErrMissingValue)
+	}
+	_, err = m.AppendDBSequence(DBSequence{Accession: "sp|P1|PROT1"})
+	if err != ErrDuplicateID {
+		t.Errorf("AppendDBSequence: error return %v, should be %v", err, ErrDuplicateID)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	m := testBuild(t)
+	var sb strings.Builder
+	err := m.Write(&sb)
+	if err != nil {
+		t.Fatalf("Write: error return %v", err)
+	}
+	out := sb.String()
+	for _, s := range []string{
+		`<SpectrumIdentificationProtocol id="SIP_1" analysisSoftware_ref="AS_1">`,
+		`<InputSpectra spectraData_ref="SD_1">`,
+		`<SearchDatabaseRef searchDatabase_ref="SDB_1">`,
+		`<SearchModification fixedMod="true" massDelta="57.021464" residues="C">`,
+		`accession="MS:1002057"`,
+		`<SiteRegexp>(?&lt;=[KR])(?!P)</SiteRegexp>`,
+		`unitAccession="UO:0000169"`,
+		`<SpectrumIdentificationList id="SIL_1">`,
+		`<cvParam cvRef="PSI-MS" accession="MS:1002257" name="Comet:expectation value" value="1.5E-5">`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Write: output doesn't contain %s", s)
+		}
+	}
+
+	f, err := Read(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("Read after write: error return %v", err)
+	}
+	if f.NumIdents() != m.NumIdents() {
+		t.Fatalf("NumIdents after write: %d, should be %d", f.NumIdents(), m.NumIdents())
+	}
+	for i := 0; i < m.NumIdents(); i++ {
+		want, err := m.Ident(i)
+		if err != nil {
+			t.Fatalf("Ident: error return %v", err)
+		}
+		got, err := f.Ident(i)
+		if err != nil {
+			t.Fatalf("Ident after write: error return %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Ident %d after write: %+v, should be %+v", i, got, want)
+		}
+	}
+	ident, _ := f.Ident(0)
+	if ident.RetentionTime != 600 || len(ident.Evidence) != 2 || ident.Evidence[1].Accession != "DECOY_sp|P2|PROT2" ||
+		!ident.Evidence[1].IsDecoy || ident.SpectraDataRef != "SD_1" {
+		t.Errorf("Ident after write: %+v", ident)
+	}
+	ident, _ = f.Ident(2)
+	if ident.RetentionTime != -1 || ident.PepID != "Pep_1" || ident.Evidence[0].ID != "PE_1" {
+		t.Errorf("Ident after write: %+v", ident)
+	}
+	seq, err := f.DBSequence(0)
+	if err != nil || seq.Description != "Protein one" || seq.Length != 13 {
+		t.Errorf("DBSequence after write: %+v, error return %v", seq, err)
+	}
+	if !reflect.DeepEqual(f.SpectraData(), m.SpectraData()) {
+		t.Errorf("SpectraData after write: %+v, should be %+v", f.SpectraData(), m.SpectraData())
+	}
+	if !reflect.DeepEqual(f.SearchDatabases(), m.SearchDatabases()) {
+		t.Errorf("SearchDatabases after write: %+v, should be %+v", f.SearchDatabases(), m.SearchDatabases())
+	}
+
+	sw := f.AnalysisSoftware()
+	if len(sw) != 1 || sw[0].Name != "galms" || sw[0].Version != "0.1" {
+		t.Errorf("AnalysisSoftware after write: %+v", sw)
+	}
+	if !reflect.DeepEqual(f.SearchModifications(), m.SearchModifications()) {
+		t.Errorf("SearchModifications after write: %+v, should be %+v", f.SearchModifications(), m.SearchModifications())
+	}
+
+	empty := New("empty")
+	err = empty.Write(&sb)
+	if err != ErrMissingValue {
+		t.Errorf("Write: error return %v, should be %v", err, ErrMissingValue)
+	}
+}
+
+func TestReadAppend(t *testing.T) {
+	m := testBuild(t)
+	var sb strings.Builder
+	err := m.Write(&sb)
+	if err != nil {
+		t.Fatalf("Write: error return %v", err)
+	}
+	f, err := Read(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	ident, err := f.Ident(0)
+	if err != nil {
+		t.Fatalf("Ident: error return %v", err)
+	}
+	// Same spectrum, peptide and evidence as an existing identification
+	ident.Rank = 3
+	n, err := f.AppendIdentification(ident)
+	if err != nil || n != 3 {
+		t.Fatalf("AppendIdentification: index %d, error return %v", n, err)
+	}
+	// New spectrum and protein
+	n, err = f.AppendIdentification(Identification{PepSeq: "NEWPEPK", Charge: 2, Rank: 1, SpecID: "scan=30",
+		RetentionTime: -1, Evidence: []PeptideEvidence{{Accession: "sp|P4|PROT4"}}})
+	if err != nil || n != 4 {
+		t.Fatalf("AppendIdentification: index %d, error return %v", n, err)
+	}
+	if len(f.content.SpectrumIdentificationResult) != 3 || len(f.content.Peptide) != 3 ||
+		len(f.content.PeptideEvidence) != 4 || f.NumDBSequences() != 4 {
+		t.Errorf("AppendIdentification: %d results, %d peptides, %d evidence, %d proteins",
+			len(f.content.SpectrumIdentificationResult), len(f.content.Peptide),
+			len(f.content.PeptideEvidence), f.NumDBSequences())
+	}
+	_, err = f.AppendDBSequence(DBSequence{Accession: "sp|P1|PROT1"})
+	if err != ErrDuplicateID {
+		t.Errorf("AppendDBSequence: error return %v, should be %v", err, ErrDuplicateID)
+	}
+
+	sb.Reset()
+	err = f.Write(&sb)
+	if err != nil {
+		t.Fatalf("Write after append: error return %v", err)
+	}
+	if !strings.Contains(sb.String(), `<MzIdentML id="test"`) {
+		t.Errorf("Write after append: id not preserved")
+	}
+	g, err := Read(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatalf("Read after append: error return %v", err)
+	}
+	if g.NumIdents() != 5 {
+		t.Fatalf("NumIdents after append: %d, should be 5", g.NumIdents())
+	}
+	// Identifications are read in the order of the results they belong to
+	want := make(map[string]Identification)
+	for i := 0; i < f.NumIdents(); i++ {
+		ident, _ := f.Ident(i)
+		want[ident.ItemID] = ident
+	}
+	for i := 0; i < g.NumIdents(); i++ {
+		got, err := g.Ident(i)
+		if err != nil || !reflect.DeepEqual(got, want[got.ItemID]) {
+			t.Errorf("Ident %s after append: %+v, should be %+v, error return %v", got.ItemID, got, want[got.ItemID], err)
+		}
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	m := testBuild(t)
+	var sb strings.Builder
+	err := m.Write(&sb)
+	if err != nil {
+		t.Fatalf("Write: error return %v", err)
+	}
+	// Add protein detection and a second software
+	doc := sb.String()
+	for _, r := range []struct{ old, new string }{
+		{" </AnalysisSoftwareList>", `  <AnalysisSoftware id="AS_2" name="ProteinProphet"><SoftwareName><userParam name="ProteinProphet"/></SoftwareName></AnalysisSoftware>
+ </AnalysisSoftwareList>`},
+		{" </AnalysisCollection>", `  <ProteinDetection id="PD_1" proteinDetectionProtocol_ref="PDP_1" proteinDetectionList_ref="PDL_1"><InputSpectrumIdentifications spectrumIdentificationList_ref="SIL_1"/></ProteinDetection>
+ </AnalysisCollection>`},
+		{" </AnalysisProtocolCollection>", `  <ProteinDetectionProtocol id="PDP_1" analysisSoftware_ref="AS_2"><Threshold><cvParam cvRef="PSI-MS" accession="MS:1001494" name="no threshold"/></Threshold></ProteinDetectionProtocol>
+ </AnalysisProtocolCollection>`},
+		{"  </AnalysisData>", `   <ProteinDetectionList id="PDL_1"><ProteinAmbiguityGroup id="PAG_1"><ProteinDetectionHypothesis id="PDH_1" dBSequence_ref="DBSeq_1" passThreshold="true"><PeptideHypothesis peptideEvidence_ref="PE_1"><SpectrumIdentificationItemRef spectrumIdentificationItem_ref="SII_1"/></PeptideHypothesis></ProteinDetectionHypothesis></ProteinAmbiguityGroup></ProteinDetectionList>
+  </AnalysisData>`},
+	} {
+		if !strings.Contains(doc, r.old) {
+			t.Fatalf("Write: output doesn't contain %s", r.old)
+		}
+		doc = strings.Replace(doc, r.old, r.new, 1)
+	}
+	f, err := Read(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	sb.Reset()
+	err = f.Write(&sb)
+	if err != nil {
+		t.Fatalf("Write after read: error return %v", err)
+	}
+	g, err := Read(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatalf("Read after write: error return %v", err)
+	}
+	if !reflect.DeepEqual(g.SearchModifications(), m.SearchModifications()) {
+		t.Errorf("SearchModifications: %v, should be %v", g.SearchModifications(), m.SearchModifications())
+	}
+	if !reflect.DeepEqual(g.content.Protocol, f.content.Protocol) || len(g.content.Protocol) != 1 ||
+		g.content.Protocol[0].Enzymes == nil || g.content.Protocol[0].ParentTolerance == nil {
+		t.Errorf("Protocol: %+v, should be %+v", g.content.Protocol, f.content.Protocol)
+	}
+	if len(g.AnalysisSoftware()) != 2 || !reflect.DeepEqual(g.ProteinGroups(), f.ProteinGroups()) ||
+		len(g.ProteinGroups()) != 1 {
+		t.Errorf("Write after read: software %v, protein groups %v", g.AnalysisSoftware(), g.ProteinGroups())
+	}
+	if !reflect.DeepEqual(g.content.ProteinDetection, f.content.ProteinDetection) ||
+		!reflect.DeepEqual(g.content.ProteinDetectionProtocol, f.content.ProteinDetectionProtocol) ||
+		g.content.ProteinDetectionProtocol == nil {
+		t.Errorf("Write after read: protein detection %+v, protocol %+v",
+			g.content.ProteinDetection, g.content.ProteinDetectionProtocol)
+	}
+
+	// More than one search can't be written
+	f.content.SpectrumIdentification = append(f.content.SpectrumIdentification, f.content.SpectrumIdentification[0])
+	err = f.Write(&sb)
+	if err != ErrMultipleSearches {
+		t.Errorf("Write: error return %v, should be %v", err, ErrMultipleSearches)
+	}
+}
+
+func TestAppendIDs(t *testing.T) {
+	m := testBuild(t)
+	var sb strings.Builder
+	err := m.Write(&sb)
+	if err != nil {
+		t.Fatalf("Write: error return %v", err)
+	}
+	// Ids that collide with the ones that are generated next
+	doc := strings.Replace(sb.String(), `id="SII_1"`, `id="SII_4"`, 1)
+	doc = strings.Replace(doc, `id="SIR_1"`, `id="SIR_3"`, 1)
+	f, err := Read(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	for _, specID := range []string{"scan=30", "scan=40"} {
+		_, err = f.AppendIdentification(Identification{PepSeq: "NEWPEPK", Charge: 2, Rank: 1, SpecID: specID,
+			RetentionTime: -1, Evidence: []PeptideEvidence{{Accession: "sp|P4|PROT4"}}})
+		if err != nil {
+			t.Fatalf("AppendIdentification: error return %v", err)
+		}
+	}
+	siiIDs := make(map[string]bool)
+	sirIDs := make(map[string]bool)
+	for _, sir := range f.content.SpectrumIdentificationResult {
+		if sirIDs[sir.ID] {
+			t.Errorf("AppendIdentification: duplicate id %s", sir.ID)
+		}
+		sirIDs[sir.ID] = true
+		for _, sii := range sir.SpectrumIdentificationItem {
+			if siiIDs[sii.ID] {
+				t.Errorf("AppendIdentification: duplicate id %s", sii.ID)
+			}
+			siiIDs[sii.ID] = true
+		}
+	}
+	if len(siiIDs) != 5 || len(sirIDs) != 4 {
+		t.Errorf("AppendIdentification: %d items, %d results", len(siiIDs), len(sirIDs))
+	}
+}
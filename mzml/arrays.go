@@ -0,0 +1,412 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// BinaryArray contains the values of a binary data array of a spectrum.
+// Depending on DataType, the values are stored in Float32, Float64,
+// Int32 or Int64.
+type BinaryArray struct {
+	Accession     string // CV term of the array type, e.g. MS:1000516 (charge array)
+	Name          string // Name of the array type
+	UnitAccession string // CV term of the unit, if any
+	DataType      DataType
+	Float32       []float32
+	Float64       []float64
+	Int32         []int32
+	Int64         []int64
+}
+
+// Non-standard arrays are identified by the value of this CV term,
+// or by a userParam
+const nonStandardArray = `MS:1000786`
+
+// CV terms for the encoding of binary data arrays. All other CV terms
+// of a binary data array describe the array type.
+var binaryEncodingTerms = map[string]bool{
+	`MS:1000519`: true, // 32-bit integer
+	`MS:1000521`: true, // 32-bit float
+	`MS:1000522`: true, // 64-bit integer
+	`MS:1000523`: true, // 64-bit float
+	`MS:1000574`: true, // zlib compression
+	`MS:1000576`: true, // no compression
+	`MS:1002312`: true,
+	`MS:1002313`: true,
+	`MS:1002314`: true,
+	`MS:1002746`: true,
+	`MS:1002747`: true,
+	`MS:1002748`: true,
+	`MS:1003089`: true,
+	`MS:1003090`: true,
+	`MS:1003091`: true,
+}
+
+// CV terms that describe the data type of binary data arrays
+var dataTypeCvParams = map[DataType]CVParam{
+	Float32: {CvRef: `MS`, Accession: `MS:1000521`, Name: `32-bit float`},
+	Float64: {CvRef: `MS`, Accession: `MS:1000523`, Name: `64-bit float`},
+	Int32:   {CvRef: `MS`, Accession: `MS:1000519`, Name: `32-bit integer`},
+	Int64:   {CvRef: `MS`, Accession: `MS:1000522`, Name: `64-bit integer`},
+}
+
+// Key returns the key of the array in the map returned by ReadArrays:
+// the accession of the array type, or the name for non-standard arrays
+func (a *BinaryArray) Key() string {
+	if a.Accession == `` || a.Accession == nonStandardArray {
+		return a.Name
+	}
+	return a.Accession
+}
+
+// Len returns the number of values in the array
+func (a *BinaryArray) Len() int {
+	switch a.DataType {
+	case Float64:
+		return len(a.Float64)
+	case Int32:
+		return len(a.Int32)
+	case Int64:
+		return len(a.Int64)
+	}
+	return len(a.Float32)
+}
+
+// Values returns the values of the array converted to float64
+func (a *BinaryArray) Values() []float64 {
+	values := make([]float64, a.Len())
+	for i := range values {
+		switch a.DataType {
+		case Float64:
+			values[i] = a.Float64[i]
+		case Int32:
+			values[i] = float64(a.Int32[i])
+		case Int64:
+			values[i] = float64(a.Int64[i])
+		default:
+			values[i] = float64(a.Float32[i])
+		}
+	}
+	return values
+}
+
+// setValues stores values in the array, converted to its data type
+func (a *BinaryArray) setValues(values []float64) {
+	a.Float32, a.Float64, a.Int32, a.Int64 = nil, nil, nil, nil
+	switch a.DataType {
+	case Float64:
+		a.Float64 = values
+	case Int32:
+		a.Int32 = make([]int32, len(values))
+		for i, v := range values {
+			a.Int32[i] = int32(math.Round(v))
+		}
+	case Int64:
+		a.Int64 = make([]int64, len(values))
+		for i, v := range values {
+			a.Int64[i] = int64(math.Round(v))
+		}
+	default:
+		a.Float32 = make([]float32, len(values))
+		for i, v := range values {
+			a.Float32[i] = float32(v)
+		}
+	}
+}
+
+// selected returns an array with the values at the given indices
+func (a *BinaryArray) selected(indices []int) BinaryArray {
+	s := *a
+	s.Float32, s.Float64, s.Int32, s.Int64 = nil, nil, nil, nil
+	for _, i := range indices {
+		switch a.DataType {
+		case Float64:
+			s.Float64 = append(s.Float64, a.Float64[i])
+		case Int32:
+			s.Int32 = append(s.Int32, a.Int32[i])
+		case Int64:
+			s.Int64 = append(s.Int64, a.Int64[i])
+		default:
+			s.Float32 = append(s.Float32, a.Float32[i])
+		}
+	}
+	return s
+}
+
+// bytes returns the little endian representation of the values
+func (a *BinaryArray) bytes() []byte {
+	var data []byte
+	switch a.DataType {
+	case Float64:
+		data = make([]byte, 8*len(a.Float64))
+		for i, v := range a.Float64 {
+			binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(v))
+		}
+	case Int32:
+		data = make([]byte, 4*len(a.Int32))
+		for i, v := range a.Int32 {
+			binary.LittleEndian.PutUint32(data[4*i:], uint32(v))
+		}
+	case Int64:
+		data = make([]byte, 8*len(a.Int64))
+		for i, v := range a.Int64 {
+			binary.LittleEndian.PutUint64(data[8*i:], uint64(v))
+		}
+	default:
+		data = make([]byte, 4*len(a.Float32))
+		for i, v := range a.Float32 {
+			binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+		}
+	}
+	return data
+}
+
+// arrayType returns the accession, name and unit of the type of
+// a binary data array
+func arrayType(b *binaryDataArray) (string, string, string) {
+	for _, cvParam := range cvParams(b.CvPar, b.groupCvPar) {
+		if binaryEncodingTerms[cvParam.Accession] {
+			continue
+		}
+		if cvParam.Accession == nonStandardArray && cvParam.Value != `` {
+			return cvParam.Accession, cvParam.Value, cvParam.UnitAccession
+		}
+		return cvParam.Accession, cvParam.Name, cvParam.UnitAccession
+	}
+	if len(b.UserPar) > 0 {
+		return ``, b.UserPar[0].Name, ``
+	}
+	return ``, ``, ``
+}
+
+// decodeArray decodes a binary data array
+func decodeArray(b *binaryDataArray) (BinaryArray, error) {
+	var a BinaryArray
+	compression, dataType, _, _, err := binaryDataPars(b)
+	if err != nil {
+		return a, err
+	}
+	a.Accession, a.Name, a.UnitAccession = arrayType(b)
+	a.DataType = dataType
+	numpress, zlibCompression := splitCompression(compression)
+	data, err := inflateBinary(b, zlibCompression)
+	if err != nil {
+		return a, err
+	}
+	if numpress != NoCompression {
+		values, err := decodeNumpress(data, numpress)
+		if err != nil {
+			return a, err
+		}
+		a.setValues(values)
+		return a, nil
+	}
+	switch dataType {
+	case Float64:
+		a.Float64 = make([]float64, len(data)/8)
+		for i := range a.Float64 {
+			a.Float64[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[8*i:]))
+		}
+	case Int32:
+		a.Int32 = make([]int32, len(data)/4)
+		for i := range a.Int32 {
+			a.Int32[i] = int32(binary.LittleEndian.Uint32(data[4*i:]))
+		}
+	case Int64:
+		a.Int64 = make([]int64, len(data)/8)
+		for i := range a.Int64 {
+			a.Int64[i] = int64(binary.LittleEndian.Uint64(data[8*i:]))
+		}
+	default:
+		a.Float32 = make([]float32, len(data)/4)
+		for i := range a.Float32 {
+			a.Float32[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+		}
+	}
+	return a, nil
+}
+
+// encodeArray stores the values of a in a binary data array,
+// using the given compression
+func encodeArray(b *binaryDataArray, a *BinaryArray, compression Compression) error {
+	numpress, zlibCompression := splitCompression(compression)
+	if numpress != NoCompression {
+		err := setBinary(b, a.Values(), compression, a.DataType)
+		if err != nil {
+			return err
+		}
+	} else {
+		b.Binary = deflateBinary(a.bytes(), zlibCompression)
+		b.ArrayLength = a.Len()
+		b.EncodedLength = len(b.Binary)
+	}
+	setDataTypeCvParams(b, a.DataType)
+	return nil
+}
+
+// setDataTypeCvParams replaces the data type CV term of a binary data array
+func setDataTypeCvParams(b *binaryDataArray, dataType DataType) {
+	expandParamGroups(b)
+	cvPar := make([]CVParam, 0, len(b.CvPar))
+	for _, cv := range b.CvPar {
+		switch cv.Accession {
+		case `MS:1000519`, `MS:1000521`, `MS:1000522`, `MS:1000523`:
+			// Remove
+		default:
+			cvPar = append(cvPar, cv)
+		}
+	}
+	b.CvPar = append(cvPar, dataTypeCvParams[dataType])
+}
+
+// newBinaryDataArray returns an uncompressed binary data array for a
+func newBinaryDataArray(a *BinaryArray) (binaryDataArray, error) {
+	var b binaryDataArray
+	switch {
+	case a.Accession == ``:
+		b.UserPar = []userParam{{Name: a.Name}}
+	case a.Accession == nonStandardArray:
+		b.CvPar = []CVParam{{CvRef: `MS`, Accession: a.Accession,
+			Name: `non-standard data array`, Value: a.Name,
+			UnitAccession: a.UnitAccession}}
+	default:
+		b.CvPar = []CVParam{{CvRef: `MS`, Accession: a.Accession,
+			Name: a.Name, UnitAccession: a.UnitAccession}}
+	}
+	b.CvPar = append(b.CvPar, compressionCvParams[NoCompression])
+	err := encodeArray(&b, a, NoCompression)
+	return b, err
+}
+
+// ReadArrays reads all binary data arrays of a scan, including arrays
+// other than m/z and intensity (e.g. ion mobility or charge arrays).
+// The arrays are keyed by the accession of the array type, or by
+// the name for non-standard arrays.
+func (f *MzML) ReadArrays(scanIndex int) (map[string]BinaryArray, error) {
+	spec, err := f.spectrum(scanIndex)
+	if err != nil {
+		return nil, err
+	}
+	arrays := make(map[string]BinaryArray, len(spec.BinaryDataArrayList.BinaryDataArray))
+	for i := range spec.BinaryDataArrayList.BinaryDataArray {
+		a, err := decodeArray(&spec.BinaryDataArrayList.BinaryDataArray[i])
+		if err != nil {
+			return nil, err
+		}
+		arrays[a.Key()] = a
+	}
+	return arrays, nil
+}
+
+// UpdateArrays replaces the binary data arrays of a scan by arrays.
+// Existing arrays keep their compression, new arrays are stored
+// uncompressed. Existing arrays that are not in arrays are removed.
+func (f *MzML) UpdateArrays(scanIndex int, arrays map[string]BinaryArray) error {
+	spec, err := f.updatedSpectrum(scanIndex)
+	if err != nil {
+		return err
+	}
+	done := make(map[string]bool, len(arrays))
+	var result []binaryDataArray
+	for i := range spec.BinaryDataArrayList.BinaryDataArray {
+		b := spec.BinaryDataArrayList.BinaryDataArray[i]
+		compression, _, _, _, err := binaryDataPars(&b)
+		if err != nil {
+			return err
+		}
+		accession, name, unit := arrayType(&b)
+		key := (&BinaryArray{Accession: accession, Name: name, UnitAccession: unit}).Key()
+		a, ok := arrays[key]
+		if !ok {
+			continue
+		}
+		err = encodeArray(&b, &a, compression)
+		if err != nil {
+			return err
+		}
+		result = append(result, b)
+		done[key] = true
+	}
+	// Add the new arrays in a fixed order
+	keys := make([]string, 0, len(arrays))
+	for key := range arrays {
+		if !done[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		a := arrays[key]
+		b, err := newBinaryDataArray(&a)
+		if err != nil {
+			return err
+		}
+		result = append(result, b)
+	}
+	spec.BinaryDataArrayList.BinaryDataArray = result
+	spec.BinaryDataArrayList.Count = len(result)
+	spec.DefaultArrayLength = 0
+	for _, a := range arrays {
+		if n := int64(a.Len()); n > spec.DefaultArrayLength {
+			spec.DefaultArrayLength = n
+		}
+	}
+	return nil
+}
+
+// hasOtherArrays returns true if spec has binary data arrays
+// besides the m/z and intensity arrays
+func hasOtherArrays(spec *spectrum) bool {
+	for i := range spec.BinaryDataArrayList.BinaryDataArray {
+		_, _, mzArray, intensityArray, _ := binaryDataPars(&spec.BinaryDataArrayList.BinaryDataArray[i])
+		if !mzArray && !intensityArray {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPeaks returns for each peak in p the index of the peak with the
+// same m/z in the m/z array of spec. If some peak has no match,
+// nil is returned.
+func matchPeaks(spec *spectrum, p []Peak) ([]int, error) {
+	var oldMzs []float64
+	for i := range spec.BinaryDataArrayList.BinaryDataArray {
+		b := &spec.BinaryDataArrayList.BinaryDataArray[i]
+		compression, dataType, mzArray, _, err := binaryDataPars(b)
+		if err != nil {
+			return nil, err
+		}
+		if mzArray {
+			oldMzs, err = decodeBinary(b, compression, dataType)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	indices := make([]int, len(p))
+	j := 0
+	for i, peak := range p {
+		// Peaks are normally sorted, so search from the last match first
+		k := j
+		for k < len(oldMzs) && oldMzs[k] != peak.Mz {
+			k++
+		}
+		if k == len(oldMzs) {
+			for k = 0; k < j && oldMzs[k] != peak.Mz; k++ {
+			}
+			if k == j {
+				return nil, nil
+			}
+		}
+		indices[i] = k
+		j = k + 1
+	}
+	return indices, nil
+}
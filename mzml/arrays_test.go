@@ -0,0 +1,141 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testArraysMzML returns a document in which the first spectrum
+// (peaks at m/z 100 and 200) has a charge array and a non-standard
+// ion mobility array
+func testArraysMzML() string {
+	charges := make([]byte, 8)
+	binary.LittleEndian.PutUint32(charges, 2)
+	binary.LittleEndian.PutUint32(charges[4:], 3)
+	mobility := make([]byte, 8)
+	binary.LittleEndian.PutUint32(mobility, math.Float32bits(1.25))
+	binary.LittleEndian.PutUint32(mobility[4:], math.Float32bits(0.75))
+	extra := fmt.Sprintf(`            <binaryDataArray encodedLength="12">
+              <cvParam cvRef="MS" accession="MS:1000519" name="32-bit integer" value=""/>
+              <cvParam cvRef="MS" accession="MS:1000516" name="charge array" value=""/>
+              <binary>%s</binary>
+            </binaryDataArray>
+            <binaryDataArray encodedLength="12">
+              <cvParam cvRef="MS" accession="MS:1000521" name="32-bit float" value=""/>
+              <userParam name="ion mobility" value=""/>
+              <binary>%s</binary>
+            </binaryDataArray>
+          </binaryDataArrayList>`,
+		base64.StdEncoding.EncodeToString(charges),
+		base64.StdEncoding.EncodeToString(mobility))
+	return strings.Replace(testMzML(2, -1), `          </binaryDataArrayList>`, extra, 1)
+}
+
+func TestReadArrays(t *testing.T) {
+	f, err := Read(strings.NewReader(testArraysMzML()))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	arrays, err := f.ReadArrays(0)
+	if err != nil {
+		t.Fatalf("ReadArrays: error return %v", err)
+	}
+	if len(arrays) != 4 {
+		t.Fatalf("ReadArrays: %d arrays, should be 4", len(arrays))
+	}
+	if a := arrays[`MS:1000514`]; a.DataType != Float64 || !reflect.DeepEqual(a.Float64, []float64{100, 200}) {
+		t.Errorf("ReadArrays: m/z array %v", a)
+	}
+	if a := arrays[`MS:1000516`]; a.DataType != Int32 || !reflect.DeepEqual(a.Int32, []int32{2, 3}) {
+		t.Errorf("ReadArrays: charge array %v", a)
+	}
+	if a := arrays[`ion mobility`]; a.DataType != Float32 || !reflect.DeepEqual(a.Float32, []float32{1.25, 0.75}) {
+		t.Errorf("ReadArrays: ion mobility array %v", a)
+	}
+
+	// Arrays must follow the peaks that are kept
+	err = f.UpdateScan(0, []Peak{{Mz: 200, Intens: 5}}, true, true)
+	if err != nil {
+		t.Fatalf("UpdateScan: error return %v", err)
+	}
+	arrays, err = f.ReadArrays(0)
+	if err != nil {
+		t.Fatalf("ReadArrays: error return %v", err)
+	}
+	if a := arrays[`MS:1000516`]; !reflect.DeepEqual(a.Int32, []int32{3}) {
+		t.Errorf("ReadArrays after UpdateScan: charge array %v", a)
+	}
+	if a := arrays[`ion mobility`]; !reflect.DeepEqual(a.Float32, []float32{0.75}) {
+		t.Errorf("ReadArrays after UpdateScan: ion mobility array %v", a)
+	}
+
+	// New m/z values can't be matched, with the same or a different number of peaks
+	for _, p := range [][]Peak{{{Mz: 300, Intens: 5}}, {{Mz: 150, Intens: 5}, {Mz: 250, Intens: 6}}} {
+		err = f.UpdateScan(0, p, true, true)
+		if err != ErrUnmatchedPeaks {
+			t.Errorf("UpdateScan(%v): error return %v, should be ErrUnmatchedPeaks", p, err)
+		}
+	}
+	arrays, err = f.ReadArrays(0)
+	if err != nil || len(arrays) != 4 || !reflect.DeepEqual(arrays[`MS:1000514`].Float64, []float64{200}) {
+		t.Errorf("ReadArrays after failed UpdateScan: %v (%v), should be unchanged", arrays, err)
+	}
+
+	// Without the other arrays, the peaks can be replaced
+	delete(arrays, `MS:1000516`)
+	delete(arrays, `ion mobility`)
+	err = f.UpdateArrays(0, arrays)
+	if err != nil {
+		t.Fatalf("UpdateArrays: error return %v", err)
+	}
+	err = f.UpdateScan(0, []Peak{{Mz: 150, Intens: 5}, {Mz: 250, Intens: 6}}, true, true)
+	if err != nil {
+		t.Fatalf("UpdateScan: error return %v", err)
+	}
+	arrays, err = f.ReadArrays(0)
+	if err != nil || len(arrays) != 2 {
+		t.Errorf("ReadArrays after UpdateScan: %v (%v), should have 2 arrays", arrays, err)
+	}
+
+	// Set all arrays, and write them
+	arrays[`MS:1000516`] = BinaryArray{Accession: `MS:1000516`, Name: `charge array`,
+		DataType: Int64, Int64: []int64{1, 1 << 40}}
+	arrays[`MS:1002816`] = BinaryArray{Accession: `MS:1002816`, Name: `mean ion mobility array`,
+		UnitAccession: `UO:0000028`, DataType: Float64, Float64: []float64{0.5, 0.25}}
+	err = f.SetCompression(0, Zlib, Zlib)
+	if err != nil {
+		t.Fatalf("SetCompression: error return %v", err)
+	}
+	err = f.UpdateArrays(0, arrays)
+	if err != nil {
+		t.Fatalf("UpdateArrays: error return %v", err)
+	}
+	var sb strings.Builder
+	err = f.Write(&sb)
+	if err != nil {
+		t.Fatalf("Write: error return %v", err)
+	}
+	f, err = Read(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	arrays2, err := f.ReadArrays(0)
+	if err != nil {
+		t.Fatalf("ReadArrays: error return %v", err)
+	}
+	if !reflect.DeepEqual(arrays, arrays2) {
+		t.Errorf("ReadArrays after write: %v, should be %v", arrays2, arrays)
+	}
+	p, err := f.ReadScan(0)
+	if err != nil || len(p) != 2 || p[1].Mz != 250 {
+		t.Errorf("ReadScan after write: %v (%v)", p, err)
+	}
+}
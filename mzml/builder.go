@@ -0,0 +1,425 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"encoding/xml"
+	"math"
+	"strconv"
+)
+
+// The controlled vocabularies that are used by the builder
+const builderCvList = `
+    <cv id="MS" fullName="Proteomics Standards Initiative Mass Spectrometry Ontology" version="4.1.0" URI="https://raw.githubusercontent.com/HUPO-PSI/psi-ms-CV/master/psi-ms.obo"/>
+    <cv id="UO" fullName="Unit Ontology" version="09:04:2014" URI="https://raw.githubusercontent.com/bio-ontology-research-group/unit-ontology/master/unit.obo"/>
+  `
+
+// SourceFile describes a file from which the mzML file was generated
+type SourceFile struct {
+	ID       string    `xml:"id,attr"`
+	Name     string    `xml:"name,attr"`
+	Location string    `xml:"location,attr"`
+	CvPar    []CVParam `xml:"cvParam,omitempty"`
+}
+
+// Component is a source, analyzer or detector of an instrument configuration
+type Component struct {
+	Kind  string // "source", "analyzer" or "detector"
+	CvPar []CVParam
+}
+
+// InstrumentConfiguration describes an instrument configuration
+type InstrumentConfiguration struct {
+	ID          string
+	CvPar       []CVParam
+	Components  []Component
+	SoftwareRef string
+}
+
+// SpectrumData contains the data of a spectrum that is added with
+// AppendSpectrum
+type SpectrumData struct {
+	ID            string // If empty, "scan=<n>" is used
+	MSLevel       int
+	RetentionTime float64 // Retention time in seconds, NaN if unknown
+	Centroid      bool
+	Polarity      Polarity
+	Peaks         []Peak
+	Precursors    []Precursor
+	CvPar         []CVParam // Additional CV params of the spectrum
+	ScanCvPar     []CVParam // Additional CV params of the scan, e.g. filter string
+	ScanWindows   []ScanWindow
+	Arrays        []BinaryArray // Binary data arrays other than m/z and intensity
+	Compression   Compression   // Compression of the m/z and intensity arrays
+}
+
+// ChromatogramData contains the data of a chromatogram that is added
+// with AppendChromatogram
+type ChromatogramData struct {
+	ID     string
+	Type   string // CV term of the chromatogram type, e.g. MS:1000235
+	Points []ChromatogramPoint
+	// Precursor and product of SRM chromatograms, nil if not applicable
+	Precursor *Precursor
+	Product   *IsolationWindow
+}
+
+// New returns an MzML without spectra. Metadata, spectra and
+// chromatograms can be added, after which the result can be written.
+func New(runID string) MzML {
+	var f MzML
+	f.content.CvList = cvList{Count: 2, CvListXML: []byte(builderCvList)}
+	f.content.Run.ID = runID
+	f.id2Index = make(map[string]int)
+	f.chromID2Index = make(map[string]int)
+	f.paramGroups = make(map[string][]CVParam)
+	return f
+}
+
+// SetFileDescription sets the file content and source files of the mzML file.
+// If it isn't called, the spectrum types are written as file content.
+func (f *MzML) SetFileDescription(fileContent []CVParam, sourceFiles []SourceFile) error {
+	desc, err := fileDescriptionXML(fileContent, sourceFiles)
+	if err != nil {
+		return err
+	}
+	f.content.FileDescription.FileDescriptionXML = desc
+	return nil
+}
+
+// defaultFileContent returns the spectrum types (MS1 or MSn spectrum)
+// of the spectra in the file
+func (f *MzML) defaultFileContent() []CVParam {
+	var fileContent []CVParam
+	seen := make(map[string]bool)
+	for i := range f.content.Run.SpectrumList.Spectrum {
+		for _, cv := range f.content.Run.SpectrumList.Spectrum[i].CvPar {
+			if (cv.Accession == `MS:1000579` || cv.Accession == `MS:1000580`) && !seen[cv.Accession] {
+				seen[cv.Accession] = true
+				fileContent = append(fileContent, cv)
+			}
+		}
+	}
+	return fileContent
+}
+
+// fileDescriptionXML returns the inner XML of a fileDescription element
+func fileDescriptionXML(fileContent []CVParam, sourceFiles []SourceFile) (string, error) {
+	type sourceFileList struct {
+		Count      int          `xml:"count,attr"`
+		SourceFile []SourceFile `xml:"sourceFile"`
+	}
+	type fileDescription struct {
+		FileContent struct {
+			CvPar []CVParam `xml:"cvParam,omitempty"`
+		} `xml:"fileContent"`
+		SourceFileList *sourceFileList `xml:"sourceFileList"`
+	}
+	var desc fileDescription
+	desc.FileContent.CvPar = fileContent
+	if len(sourceFiles) > 0 {
+		desc.SourceFileList = &sourceFileList{Count: len(sourceFiles), SourceFile: sourceFiles}
+	}
+	b, err := xml.Marshal(&desc)
+	if err != nil {
+		return ``, err
+	}
+	// Strip the <fileDescription> tags, only the inner XML is stored
+	return string(b[len(`<fileDescription>`) : len(b)-len(`</fileDescription>`)]), nil
+}
+
+// AppendSoftware adds software with CV params to the SoftwareList tag of the mzML file
+func (f *MzML) AppendSoftware(id string, version string, cvPar []CVParam) {
+	if f.content.SoftwareList == nil {
+		f.content.SoftwareList = &softwareList{}
+	}
+	f.content.SoftwareList.Count++
+	f.content.SoftwareList.Software = append(f.content.SoftwareList.Software,
+		software{ID: id, Version: version, CvPar: cvPar})
+}
+
+// AppendInstrumentConfiguration adds an instrument configuration. The
+// first configuration becomes the default configuration of the run.
+func (f *MzML) AppendInstrumentConfiguration(conf InstrumentConfiguration) error {
+	type component struct {
+		XMLName xml.Name
+		Order   int       `xml:"order,attr"`
+		CvPar   []CVParam `xml:"cvParam,omitempty"`
+	}
+	type softwareRef struct {
+		Ref string `xml:"ref,attr"`
+	}
+	type componentList struct {
+		Count     int         `xml:"count,attr"`
+		Component []component `xml:",any"`
+	}
+	type instrumentConfiguration struct {
+		XMLName       xml.Name       `xml:"instrumentConfiguration"`
+		ID            string         `xml:"id,attr"`
+		CvPar         []CVParam      `xml:"cvParam,omitempty"`
+		ComponentList *componentList `xml:"componentList"`
+		SoftwareRef   *softwareRef   `xml:"softwareRef"`
+	}
+	ic := instrumentConfiguration{ID: conf.ID, CvPar: conf.CvPar}
+	if len(conf.Components) > 0 {
+		ic.ComponentList = &componentList{Count: len(conf.Components)}
+		for i, c := range conf.Components {
+			ic.ComponentList.Component = append(ic.ComponentList.Component,
+				component{XMLName: xml.Name{Local: c.Kind}, Order: i + 1, CvPar: c.CvPar})
+		}
+	}
+	if conf.SoftwareRef != `` {
+		ic.SoftwareRef = &softwareRef{Ref: conf.SoftwareRef}
+	}
+	b, err := xml.Marshal(&ic)
+	if err != nil {
+		return err
+	}
+	if f.content.InstrumentConfigurationList == nil {
+		f.content.InstrumentConfigurationList = &instrumentConfigurationList{}
+	}
+	l := f.content.InstrumentConfigurationList
+	l.Count++
+	l.InstrumentConfigurationListXML = append(l.InstrumentConfigurationListXML, b...)
+	if f.content.Run.DefaultInstrumentConfigurationRef == `` {
+		f.content.Run.DefaultInstrumentConfigurationRef = conf.ID
+	}
+	return nil
+}
+
+// AppendSpectrum adds a spectrum, and returns its index.
+// This is not possible for files that are read with ReadIndexed.
+func (f *MzML) AppendSpectrum(s SpectrumData) (int, error) {
+	if f.reader != nil {
+		return 0, ErrAppendIndexed
+	}
+	scanIndex := len(f.content.Run.SpectrumList.Spectrum)
+	spec := spectrum{
+		Index:              scanIndex,
+		ID:                 s.ID,
+		DefaultArrayLength: int64(len(s.Peaks)),
+	}
+	if spec.ID == `` {
+		spec.ID = "scan=" + strconv.Itoa(scanIndex+1)
+	}
+	if _, ok := f.id2Index[spec.ID]; ok {
+		return 0, ErrInvalidScanID
+	}
+
+	spectrumType := CVParam{CvRef: `MS`, Accession: `MS:1000580`, Name: `MSn spectrum`}
+	if s.MSLevel == 1 {
+		spectrumType = CVParam{CvRef: `MS`, Accession: `MS:1000579`, Name: `MS1 spectrum`}
+	}
+	spec.CvPar = append(spec.CvPar, spectrumType,
+		CVParam{CvRef: `MS`, Accession: `MS:1000511`, Name: `ms level`, Value: strconv.Itoa(s.MSLevel)})
+	if s.Centroid {
+		spec.CvPar = append(spec.CvPar, CVParam{CvRef: `MS`, Accession: `MS:1000127`, Name: `centroid spectrum`})
+	} else {
+		spec.CvPar = append(spec.CvPar, CVParam{CvRef: `MS`, Accession: `MS:1000128`, Name: `profile spectrum`})
+	}
+	switch s.Polarity {
+	case Positive:
+		spec.CvPar = append(spec.CvPar, CVParam{CvRef: `MS`, Accession: `MS:1000130`, Name: `positive scan`})
+	case Negative:
+		spec.CvPar = append(spec.CvPar, CVParam{CvRef: `MS`, Accession: `MS:1000129`, Name: `negative scan`})
+	}
+	spec.CvPar = append(spec.CvPar, s.CvPar...)
+
+	spec.ScanList.Count = 1
+	spec.ScanList.CvPar = []CVParam{{CvRef: `MS`, Accession: `MS:1000795`, Name: `no combination`}}
+	var sc scan
+	if !math.IsNaN(s.RetentionTime) {
+		sc.CvPar = append(sc.CvPar, CVParam{CvRef: `MS`, Accession: `MS:1000016`, Name: `scan start time`,
+			Value: formatFloat(s.RetentionTime), UnitCvRef: `UO`, UnitAccession: `UO:0000010`, UnitName: `second`})
+	}
+	sc.CvPar = append(sc.CvPar, s.ScanCvPar...)
+	for _, w := range s.ScanWindows {
+		sc.ScanWindowList.ScanWindow = append(sc.ScanWindowList.ScanWindow, scanWindow{CvPar: []CVParam{
+			{CvRef: `MS`, Accession: `MS:1000501`, Name: `scan window lower limit`, Value: formatFloat(w.LowerLimit),
+				UnitCvRef: `MS`, UnitAccession: `MS:1000040`, UnitName: `m/z`},
+			{CvRef: `MS`, Accession: `MS:1000500`, Name: `scan window upper limit`, Value: formatFloat(w.UpperLimit),
+				UnitCvRef: `MS`, UnitAccession: `MS:1000040`, UnitName: `m/z`},
+		}})
+	}
+	sc.ScanWindowList.Count = len(sc.ScanWindowList.ScanWindow)
+	spec.ScanList.Scan = []scan{sc}
+
+	if len(s.Precursors) > 0 {
+		precList := precursorList{Count: len(s.Precursors)}
+		for i := range s.Precursors {
+			p := f.newXMLprecursor(&s.Precursors[i])
+			precList.Precursor = append(precList.Precursor, p)
+		}
+		spec.PrecursorList = []precursorList{precList}
+	}
+
+	mzs := make([]float64, len(s.Peaks))
+	intens := make([]float64, len(s.Peaks))
+	for i, p := range s.Peaks {
+		mzs[i] = p.Mz
+		intens[i] = p.Intens
+	}
+	mzArray, err := newPeakArray(mzs, s.Compression,
+		CVParam{CvRef: `MS`, Accession: `MS:1000514`, Name: `m/z array`,
+			UnitCvRef: `MS`, UnitAccession: `MS:1000040`, UnitName: `m/z`})
+	if err != nil {
+		return 0, err
+	}
+	intensArray, err := newPeakArray(intens, s.Compression,
+		CVParam{CvRef: `MS`, Accession: `MS:1000515`, Name: `intensity array`,
+			UnitCvRef: `MS`, UnitAccession: `MS:1000131`, UnitName: `number of detector counts`})
+	if err != nil {
+		return 0, err
+	}
+	arrays := []binaryDataArray{mzArray, intensArray}
+	for i := range s.Arrays {
+		b, err := newBinaryDataArray(&s.Arrays[i])
+		if err != nil {
+			return 0, err
+		}
+		arrays = append(arrays, b)
+	}
+	spec.BinaryDataArrayList = binaryDataArrayList{Count: len(arrays), BinaryDataArray: arrays}
+
+	f.content.Run.SpectrumList.Spectrum = append(f.content.Run.SpectrumList.Spectrum, spec)
+	f.content.Run.SpectrumList.Count = len(f.content.Run.SpectrumList.Spectrum)
+	f.index2id = append(f.index2id, spec.ID)
+	if f.id2Index == nil {
+		f.id2Index = make(map[string]int)
+	}
+	f.id2Index[spec.ID] = scanIndex
+	return scanIndex, nil
+}
+
+// AppendChromatogram adds a chromatogram, and returns its index
+func (f *MzML) AppendChromatogram(c ChromatogramData) (int, error) {
+	cl := &f.content.Run.ChromatogramList
+	index := len(cl.Chromatogram)
+	if _, ok := f.chromID2Index[c.ID]; ok || c.ID == `` {
+		return 0, ErrInvalidChromatogramID
+	}
+	chrom := chromatogram{
+		Index:              index,
+		ID:                 c.ID,
+		DefaultArrayLength: int64(len(c.Points)),
+	}
+	if c.Type != `` {
+		chrom.CvPar = []CVParam{{CvRef: `MS`, Accession: c.Type, Name: chromatogramTypes[c.Type]}}
+	}
+	if c.Precursor != nil {
+		chrom.Precursor = []XMLprecursor{f.newXMLprecursor(c.Precursor)}
+	}
+	if c.Product != nil {
+		chrom.Product = []product{{IsolationWindow: newIsolationWindow(c.Product)}}
+	}
+	times := make([]float64, len(c.Points))
+	intens := make([]float64, len(c.Points))
+	for i, p := range c.Points {
+		times[i] = p.Time
+		intens[i] = p.Intens
+	}
+	timeArray, err := newPeakArray(times, NoCompression,
+		CVParam{CvRef: `MS`, Accession: `MS:1000595`, Name: `time array`,
+			UnitCvRef: `UO`, UnitAccession: `UO:0000010`, UnitName: `second`})
+	if err != nil {
+		return 0, err
+	}
+	intensArray, err := newPeakArray(intens, NoCompression,
+		CVParam{CvRef: `MS`, Accession: `MS:1000515`, Name: `intensity array`,
+			UnitCvRef: `MS`, UnitAccession: `MS:1000131`, UnitName: `number of detector counts`})
+	if err != nil {
+		return 0, err
+	}
+	chrom.BinaryDataArrayList = binaryDataArrayList{Count: 2,
+		BinaryDataArray: []binaryDataArray{timeArray, intensArray}}
+
+	cl.Chromatogram = append(cl.Chromatogram, chrom)
+	cl.Count = len(cl.Chromatogram)
+	if f.chromID2Index == nil {
+		f.chromID2Index = make(map[string]int)
+	}
+	f.chromID2Index[c.ID] = index
+	return index, nil
+}
+
+// newPeakArray returns a 64-bit float binary data array of the given type
+func newPeakArray(values []float64, compression Compression, arrayType CVParam) (binaryDataArray, error) {
+	b := binaryDataArray{CvPar: []CVParam{
+		dataTypeCvParams[Float64],
+		compressionCvParams[compression],
+		arrayType,
+	}}
+	err := setBinary(&b, values, compression, Float64)
+	return b, err
+}
+
+// newXMLprecursor converts a Precursor to its mzML representation
+func (f *MzML) newXMLprecursor(p *Precursor) XMLprecursor {
+	var xp XMLprecursor
+	xp.SpectrumRef = p.SpectrumRef
+	if xp.SpectrumRef == `` && p.ScanIndex >= 0 && p.ScanIndex < len(f.index2id) {
+		xp.SpectrumRef = f.index2id[p.ScanIndex]
+	}
+	xp.IsolationWindow = newIsolationWindow(&p.IsolationWindow)
+	for _, ion := range p.SelectedIons {
+		var si selectedIon
+		if !math.IsNaN(ion.Mz) {
+			si.CvPar = append(si.CvPar, CVParam{CvRef: `MS`, Accession: `MS:1000744`, Name: `selected ion m/z`,
+				Value: formatFloat(ion.Mz), UnitCvRef: `MS`, UnitAccession: `MS:1000040`, UnitName: `m/z`})
+		}
+		if ion.Charge != 0 {
+			si.CvPar = append(si.CvPar, CVParam{CvRef: `MS`, Accession: `MS:1000041`, Name: `charge state`,
+				Value: strconv.Itoa(ion.Charge)})
+		}
+		for _, charge := range ion.PossibleCharges {
+			si.CvPar = append(si.CvPar, CVParam{CvRef: `MS`, Accession: `MS:1000633`, Name: `possible charge state`,
+				Value: strconv.Itoa(charge)})
+		}
+		if !math.IsNaN(ion.Intensity) {
+			si.CvPar = append(si.CvPar, CVParam{CvRef: `MS`, Accession: `MS:1000042`, Name: `peak intensity`,
+				Value: formatFloat(ion.Intensity), UnitCvRef: `MS`, UnitAccession: `MS:1000131`, UnitName: `number of detector counts`})
+		}
+		xp.SelectedIonList.SelectedIon = append(xp.SelectedIonList.SelectedIon, si)
+	}
+	xp.SelectedIonList.Count = len(xp.SelectedIonList.SelectedIon)
+	for _, method := range p.Activation {
+		xp.Activation.CvPar = append(xp.Activation.CvPar,
+			CVParam{CvRef: `MS`, Accession: method, Name: dissociationMethods[method]})
+	}
+	if !math.IsNaN(p.CollisionEnergy) {
+		xp.Activation.CvPar = append(xp.Activation.CvPar, CVParam{CvRef: `MS`, Accession: `MS:1000045`,
+			Name: `collision energy`, Value: formatFloat(p.CollisionEnergy),
+			UnitCvRef: `UO`, UnitAccession: `UO:0000266`, UnitName: `electronvolt`})
+	}
+	if !math.IsNaN(p.NormalizedCollisionEnergy) {
+		xp.Activation.CvPar = append(xp.Activation.CvPar, CVParam{CvRef: `MS`, Accession: `MS:1000138`,
+			Name: `normalized collision energy`, Value: formatFloat(p.NormalizedCollisionEnergy),
+			UnitCvRef: `UO`, UnitAccession: `UO:0000187`, UnitName: `percent`})
+	}
+	return xp
+}
+
+// newIsolationWindow converts an IsolationWindow to its mzML representation
+func newIsolationWindow(w *IsolationWindow) isolationWindow {
+	var iw isolationWindow
+	for _, t := range []struct {
+		accession string
+		name      string
+		value     float64
+	}{
+		{`MS:1000827`, `isolation window target m/z`, w.TargetMz},
+		{`MS:1000828`, `isolation window lower offset`, w.LowerOffset},
+		{`MS:1000829`, `isolation window upper offset`, w.UpperOffset},
+	} {
+		if !math.IsNaN(t.value) {
+			iw.CvPar = append(iw.CvPar, CVParam{CvRef: `MS`, Accession: t.accession, Name: t.name,
+				Value: formatFloat(t.value), UnitCvRef: `MS`, UnitAccession: `MS:1000040`, UnitName: `m/z`})
+		}
+	}
+	return iw
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	f := New("simulated")
+	err := f.SetFileDescription([]CVParam{{CvRef: `MS`, Accession: `MS:1000580`, Name: `MSn spectrum`}},
+		[]SourceFile{{ID: `RAW1`, Name: `sim.raw`, Location: `file:///data`}})
+	if err != nil {
+		t.Fatalf("SetFileDescription: error return %v", err)
+	}
+	f.AppendSoftware(`sim`, `1.0`, []CVParam{{CvRef: `MS`, Accession: `MS:1000799`, Name: `custom unreleased software tool`, Value: `sim`}})
+	err = f.AppendInstrumentConfiguration(InstrumentConfiguration{
+		ID: `IC1`,
+		Components: []Component{
+			{Kind: `source`, CvPar: []CVParam{{CvRef: `MS`, Accession: `MS:1000073`, Name: `electrospray ionization`}}},
+			{Kind: `analyzer`, CvPar: []CVParam{{CvRef: `MS`, Accession: `MS:1000484`, Name: `orbitrap`}}},
+			{Kind: `detector`, CvPar: []CVParam{{CvRef: `MS`, Accession: `MS:1000624`, Name: `inductive detector`}}},
+		},
+		SoftwareRef: `sim`,
+	})
+	if err != nil {
+		t.Fatalf("AppendInstrumentConfiguration: error return %v", err)
+	}
+	f.AppendDataProcessing(DataProcessing{ID: `dp`, ProcessingMeth: []ProcessingMethod{{SoftwareRef: `sim`}}})
+
+	_, err = f.AppendSpectrum(SpectrumData{MSLevel: 1, RetentionTime: 12.5, Centroid: true, Polarity: Positive,
+		Peaks: []Peak{{Mz: 400.25, Intens: 1e5}, {Mz: 500.5, Intens: 2e5}}})
+	if err != nil {
+		t.Fatalf("AppendSpectrum: error return %v", err)
+	}
+	prec := NewPrecursor()
+	prec.ScanIndex = 0
+	prec.IsolationWindow = IsolationWindow{TargetMz: 500.5, LowerOffset: 0.8, UpperOffset: 0.8}
+	prec.SelectedIons = []SelectedIon{{Mz: 500.5, Charge: 2, Intensity: math.NaN()}}
+	prec.Activation = []string{`MS:1000422`}
+	prec.CollisionEnergy = 27
+	_, err = f.AppendSpectrum(SpectrumData{MSLevel: 2, RetentionTime: 13, Centroid: true,
+		Peaks:       []Peak{{Mz: 175.119, Intens: 10}},
+		Precursors:  []Precursor{prec},
+		Arrays:      []BinaryArray{{Accession: `MS:1000516`, Name: `charge array`, DataType: Int32, Int32: []int32{1}}},
+		Compression: Zlib,
+	})
+	if err != nil {
+		t.Fatalf("AppendSpectrum: error return %v", err)
+	}
+	_, err = f.AppendSpectrum(SpectrumData{ID: `scan=2`})
+	if err != ErrInvalidScanID {
+		t.Errorf("AppendSpectrum: error return %v, should be ErrInvalidScanID", err)
+	}
+	_, err = f.AppendChromatogram(ChromatogramData{ID: `TIC`, Type: `MS:1000235`,
+		Points: []ChromatogramPoint{{Time: 12.5, Intens: 3e5}, {Time: 13, Intens: 10}}})
+	if err != nil {
+		t.Fatalf("AppendChromatogram: error return %v", err)
+	}
+
+	var b bytes.Buffer
+	err = f.WriteIndexed(&b)
+	if err != nil {
+		t.Fatalf("WriteIndexed: error return %v", err)
+	}
+	for _, indexed := range []bool{false, true} {
+		var f MzML
+		if indexed {
+			f, err = ReadIndexed(bytes.NewReader(b.Bytes()))
+		} else {
+			f, err = Read(bytes.NewReader(b.Bytes()))
+		}
+		if err != nil {
+			t.Fatalf("Read: error return %v", err)
+		}
+		if n := f.NumSpecs(); n != 2 {
+			t.Fatalf("NumSpecs: %d, should be 2", n)
+		}
+		info, err := f.SpectrumInfo(0)
+		if err != nil || info.MSLevel != 1 || info.RetentionTime != 12.5 || !info.Centroid || info.Polarity != Positive {
+			t.Errorf("SpectrumInfo(0): %+v (%v)", info, err)
+		}
+		p, err := f.ReadScan(0)
+		if err != nil || len(p) != 2 || p[0].Mz != 400.25 || p[1].Intens != 2e5 {
+			t.Errorf("ReadScan(0): %v (%v)", p, err)
+		}
+		p, err = f.ReadScan(1)
+		if err != nil || len(p) != 1 || p[0].Mz != 175.119 {
+			t.Errorf("ReadScan(1): %v (%v)", p, err)
+		}
+		precs, err := f.Precursors(1)
+		if err != nil || len(precs) != 1 {
+			t.Fatalf("Precursors: %v (%v)", precs, err)
+		}
+		if precs[0].SpectrumRef != `scan=1` || precs[0].ScanIndex != 0 || precs[0].SelectedIons[0].Charge != 2 ||
+			precs[0].IsolationWindow.LowerOffset != 0.8 || precs[0].CollisionEnergy != 27 || precs[0].Activation[0] != `MS:1000422` {
+			t.Errorf("Precursors: %+v", precs[0])
+		}
+		arrays, err := f.ReadArrays(1)
+		if err != nil || len(arrays[`MS:1000516`].Int32) != 1 {
+			t.Errorf("ReadArrays: %v (%v)", arrays, err)
+		}
+		points, err := f.ReadChromatogram(0)
+		if err != nil || len(points) != 2 || points[0].Time != 12.5 || points[1].Intens != 10 {
+			t.Errorf("ReadChromatogram: %v (%v)", points, err)
+		}
+		instruments, err := f.MSInstruments()
+		if err != nil || len(instruments) != 1 || instruments[0] != `MS:1000484` {
+			t.Errorf("MSInstruments: %v (%v)", instruments, err)
+		}
+	}
+	for _, s := range []string{`<sourceFile id="RAW1" name="sim.raw" location="file:///data">`,
+		`defaultInstrumentConfigurationRef="IC1"`, `defaultDataProcessingRef="dp"`, `<softwareRef ref="sim"></softwareRef>`} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("WriteIndexed: output doesn't contain %s", s)
+		}
+	}
+}
+
+func TestNewPrecursor(t *testing.T) {
+	f := New("simulated")
+	_, err := f.AppendSpectrum(SpectrumData{MSLevel: 1, Centroid: true, Peaks: []Peak{{Mz: 400.25, Intens: 1e5}}})
+	if err != nil {
+		t.Fatalf("AppendSpectrum: error return %v", err)
+	}
+	p := NewPrecursor()
+	xp := f.newXMLprecursor(&p)
+	if xp.SpectrumRef != `` || len(xp.IsolationWindow.CvPar) != 0 || len(xp.Activation.CvPar) != 0 {
+		t.Errorf("newXMLprecursor: unknown values are written: %+v", xp)
+	}
+	p.ScanIndex = 0
+	p.CollisionEnergy = 0
+	xp = f.newXMLprecursor(&p)
+	if xp.SpectrumRef != f.index2id[0] || len(xp.Activation.CvPar) != 1 {
+		t.Errorf("newXMLprecursor: %+v", xp)
+	}
+}
+
+func TestDefaultFileDescription(t *testing.T) {
+	f := New("simulated")
+	for _, msLevel := range []int{1, 2, 2} {
+		_, err := f.AppendSpectrum(SpectrumData{MSLevel: msLevel, Centroid: true, Peaks: []Peak{{Mz: 400.25, Intens: 1e5}}})
+		if err != nil {
+			t.Fatalf("AppendSpectrum: error return %v", err)
+		}
+	}
+	var b bytes.Buffer
+	err := f.Write(&b)
+	if err != nil {
+		t.Fatalf("Write: error return %v", err)
+	}
+	s := b.String()
+	start, end := strings.Index(s, `<fileDescription>`), strings.Index(s, `</fileDescription>`)
+	if start < 0 || end < start {
+		t.Fatalf("Write: no fileDescription in %s", s)
+	}
+	desc := s[start:end]
+	if !strings.Contains(desc, `<fileContent>`) || strings.Count(desc, `accession="MS:1000579"`) != 1 ||
+		strings.Count(desc, `accession="MS:1000580"`) != 1 {
+		t.Errorf("Write: fileDescription %s", desc)
+	}
+}
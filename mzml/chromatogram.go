@@ -0,0 +1,239 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"math"
+	"strconv"
+)
+
+// ChromatogramPoint contains a single point of a chromatogram
+type ChromatogramPoint struct {
+	Time   float64 // Time in seconds
+	Intens float64
+}
+
+// IsolationWindow contains the m/z range that was isolated for
+// a precursor or product ion. Fields that are not present are NaN.
+type IsolationWindow struct {
+	TargetMz    float64
+	LowerOffset float64
+	UpperOffset float64
+}
+
+// CV terms and names of chromatogram types
+var chromatogramTypes = map[string]string{
+	"MS:1000235": "total ion current chromatogram",
+	"MS:1000627": "selected ion current chromatogram",
+	"MS:1000628": "basepeak chromatogram",
+	"MS:1000810": "ion current chromatogram",
+	"MS:1001472": "selected ion monitoring chromatogram",
+	"MS:1001473": "selected reaction monitoring chromatogram",
+	"MS:1001474": "consecutive reaction monitoring chromatogram",
+}
+
+// findCvParam returns the CV parameter with the given accession, or nil
+func findCvParam(cvPar []CVParam, accession string) *CVParam {
+	for i := range cvPar {
+		if cvPar[i].Accession == accession {
+			return &cvPar[i]
+		}
+	}
+	return nil
+}
+
+// cvFloat returns the value of a CV parameter as float, or NaN if not present
+func cvFloat(cvPar []CVParam, accession string) (float64, error) {
+	cv := findCvParam(cvPar, accession)
+	if cv == nil {
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(cv.Value, 64)
+}
+
+// traverseChromatograms fills f.chromID2Index to make chromatograms
+// accessible by ID
+func (f *MzML) traverseChromatograms() {
+	chroms := f.content.Run.ChromatogramList.Chromatogram
+	f.chromID2Index = make(map[string]int, len(chroms))
+	for i := range chroms {
+		f.resolveChromatogram(&chroms[i])
+		f.chromID2Index[chroms[i].ID] = i
+	}
+}
+
+// chromatogram returns the chromatogram with the given index
+func (f *MzML) chromatogram(index int) (*chromatogram, error) {
+	if index < 0 || index >= f.NumChromatograms() {
+		return nil, ErrInvalidChromatogramIndex
+	}
+	return &f.content.Run.ChromatogramList.Chromatogram[index], nil
+}
+
+// NumChromatograms returns the number of chromatograms
+func (f *MzML) NumChromatograms() int {
+	return len(f.content.Run.ChromatogramList.Chromatogram)
+}
+
+// ChromatogramIndex converts a chromatogram identifier (the string used
+// in the mzML file) into an index that is used to access the chromatograms
+func (f *MzML) ChromatogramIndex(id string) (int, error) {
+	if index, ok := f.chromID2Index[id]; ok {
+		return index, nil
+	}
+	return 0, ErrInvalidChromatogramID
+}
+
+// ChromatogramID converts a chromatogram index into its identifier
+func (f *MzML) ChromatogramID(index int) (string, error) {
+	c, err := f.chromatogram(index)
+	if err != nil {
+		return "", err
+	}
+	return c.ID, nil
+}
+
+// ChromatogramType returns the CV term of the chromatogram type, e.g.
+// MS:1000235 (total ion current chromatogram), MS:1000628 (basepeak chromatogram)
+// or MS:1001473 (selected reaction monitoring chromatogram).
+// An empty string is returned if the type is not specified.
+func (f *MzML) ChromatogramType(index int) (string, error) {
+	c, err := f.chromatogram(index)
+	if err != nil {
+		return "", err
+	}
+	for _, cvParam := range cvParams(c.CvPar, c.groupCvPar) {
+		if _, ok := chromatogramTypes[cvParam.Accession]; ok {
+			return cvParam.Accession, nil
+		}
+	}
+	return "", nil
+}
+
+// ReadChromatogram reads the time and intensity values of a chromatogram
+func (f *MzML) ReadChromatogram(index int) ([]ChromatogramPoint, error) {
+	c, err := f.chromatogram(index)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]ChromatogramPoint, c.DefaultArrayLength)
+	for i := range c.BinaryDataArrayList.BinaryDataArray {
+		b := &c.BinaryDataArrayList.BinaryDataArray[i]
+		compression, dataType, _, intensityArray, err := binaryDataPars(b)
+		if err != nil {
+			return nil, err
+		}
+		timeScale, timeArray := timeArrayScale(b)
+		if !timeArray && !intensityArray {
+			continue
+		}
+		values, err := decodeBinary(b, compression, dataType)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) > len(points) {
+			return nil, ErrInvalidArrayLength
+		}
+		if timeArray {
+			for j, v := range values {
+				points[j].Time = v * timeScale
+			}
+		} else {
+			for j, v := range values {
+				points[j].Intens = v
+			}
+		}
+	}
+	return points, nil
+}
+
+// timeArrayScale checks if a binary data array contains time values.
+// If so, the factor to convert the values to seconds is returned.
+func timeArrayScale(b *binaryDataArray) (float64, bool) {
+	cv := findCvParam(cvParams(b.CvPar, b.groupCvPar), "MS:1000595") // time array
+	if cv == nil {
+		return 1, false
+	}
+	if cv.UnitAccession == "UO:0000031" || cv.UnitAccession == "MS:1000038" {
+		return 60, true // minutes
+	}
+	return 1, true
+}
+
+// ChromatogramIsolation returns the isolation windows of the precursor
+// and product ion of a chromatogram (e.g. the Q1 and Q3 settings of an
+// SRM transition). Fields of windows that are not present are NaN.
+func (f *MzML) ChromatogramIsolation(index int) (IsolationWindow, IsolationWindow, error) {
+	var prec, prod IsolationWindow
+	c, err := f.chromatogram(index)
+	if err != nil {
+		return prec, prod, err
+	}
+	var precCv, prodCv []CVParam
+	if len(c.Precursor) > 0 {
+		w := &c.Precursor[0].IsolationWindow
+		precCv = cvParams(w.CvPar, w.groupCvPar)
+	}
+	if len(c.Product) > 0 {
+		w := &c.Product[0].IsolationWindow
+		prodCv = cvParams(w.CvPar, w.groupCvPar)
+	}
+	prec, err = parseIsolationWindow(precCv)
+	if err != nil {
+		return prec, prod, err
+	}
+	prod, err = parseIsolationWindow(prodCv)
+	return prec, prod, err
+}
+
+func parseIsolationWindow(cvPar []CVParam) (IsolationWindow, error) {
+	var w IsolationWindow
+	var err error
+	w.TargetMz, err = cvFloat(cvPar, "MS:1000827") // isolation window target m/z
+	if err != nil {
+		return w, err
+	}
+	w.LowerOffset, err = cvFloat(cvPar, "MS:1000828") // isolation window lower offset
+	if err != nil {
+		return w, err
+	}
+	w.UpperOffset, err = cvFloat(cvPar, "MS:1000829") // isolation window upper offset
+	return w, err
+}
+
+// UpdateChromatogram sets the time/intensity values of a chromatogram.
+// The values are encoded using the compression and precision of the
+// original data.
+func (f *MzML) UpdateChromatogram(index int, points []ChromatogramPoint) error {
+	c, err := f.chromatogram(index)
+	if err != nil {
+		return err
+	}
+	c.DefaultArrayLength = int64(len(points))
+	values := make([]float64, len(points))
+	for i := range c.BinaryDataArrayList.BinaryDataArray {
+		b := &c.BinaryDataArrayList.BinaryDataArray[i]
+		compression, dataType, _, intensityArray, err := binaryDataPars(b)
+		if err != nil {
+			return err
+		}
+		timeScale, timeArray := timeArrayScale(b)
+		if timeArray {
+			for j, p := range points {
+				values[j] = p.Time / timeScale
+			}
+		} else if intensityArray {
+			for j, p := range points {
+				values[j] = p.Intens
+			}
+		} else {
+			continue
+		}
+		err = setBinary(b, values, compression, dataType)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestChromatograms(t *testing.T) {
+	f, err := ReadIndexed(strings.NewReader(testMzML(3, 0)))
+	if err != nil {
+		t.Fatalf("ReadIndexed: error return %v", err)
+	}
+	if n := f.NumChromatograms(); n != 2 {
+		t.Fatalf("NumChromatograms: %d, should be 2", n)
+	}
+	index, err := f.ChromatogramIndex(`SRM SIC Q1=500.5 Q3=600.6`)
+	if err != nil || index != 1 {
+		t.Errorf("ChromatogramIndex: %d (%v), should be 1", index, err)
+	}
+	_, err = f.ChromatogramIndex(`BPC`)
+	if err != ErrInvalidChromatogramID {
+		t.Errorf("ChromatogramIndex: error return %v, should be ErrInvalidChromatogramID", err)
+	}
+	id, err := f.ChromatogramID(0)
+	if err != nil || id != `TIC` {
+		t.Errorf("ChromatogramID: %s (%v), should be TIC", id, err)
+	}
+	_, err = f.ChromatogramID(2)
+	if err != ErrInvalidChromatogramIndex {
+		t.Errorf("ChromatogramID: error return %v, should be ErrInvalidChromatogramIndex", err)
+	}
+	cType, err := f.ChromatogramType(1)
+	if err != nil || cType != `MS:1001473` {
+		t.Errorf("ChromatogramType: %s (%v), should be MS:1001473", cType, err)
+	}
+	points, err := f.ReadChromatogram(0)
+	if err != nil {
+		t.Fatalf("ReadChromatogram: error return %v", err)
+	}
+	if len(points) != 3 || points[1].Time != 60 || points[2].Intens != 30 {
+		t.Errorf("ReadChromatogram: %v", points)
+	}
+	prec, prod, err := f.ChromatogramIsolation(1)
+	if err != nil || prec.TargetMz != 500.5 || prod.TargetMz != 600.6 || !math.IsNaN(prec.LowerOffset) {
+		t.Errorf("ChromatogramIsolation: %v %v (%v)", prec, prod, err)
+	}
+
+	// Round trip through the indexed writer
+	err = f.UpdateChromatogram(0, []ChromatogramPoint{{Time: 30, Intens: 5}, {Time: 90, Intens: 7}})
+	if err != nil {
+		t.Fatalf("UpdateChromatogram: error return %v", err)
+	}
+	var b bytes.Buffer
+	err = f.WriteIndexed(&b)
+	if err != nil {
+		t.Fatalf("WriteIndexed: error return %v", err)
+	}
+	if !bytes.Contains(b.Bytes(), []byte(`<index name="chromatogram">`)) {
+		t.Errorf("WriteIndexed: no chromatogram index")
+	}
+	f, err = ReadIndexed(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadIndexed: error return %v", err)
+	}
+	points, err = f.ReadChromatogram(0)
+	if err != nil || len(points) != 2 || points[1].Time != 90 || points[1].Intens != 7 {
+		t.Errorf("ReadChromatogram after write: %v (%v)", points, err)
+	}
+	prec, prod, err = f.ChromatogramIsolation(1)
+	if err != nil || prec.TargetMz != 500.5 || prod.TargetMz != 600.6 {
+		t.Errorf("ChromatogramIsolation after write: %v %v (%v)", prec, prod, err)
+	}
+}
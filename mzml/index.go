@@ -0,0 +1,414 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// The index of an indexedmzML file
+type indexList struct {
+	XMLName xml.Name     `xml:"indexList"`
+	Count   int          `xml:"count,attr"`
+	Index   []offsetList `xml:"index"`
+}
+
+type offsetList struct {
+	Name   string      `xml:"name,attr"`
+	Offset []offsetRef `xml:"offset"`
+}
+
+type offsetRef struct {
+	IDRef  string `xml:"idRef,attr"`
+	Offset string `xml:",chardata"`
+}
+
+// Number of bytes at the end of the file in which we look for <indexListOffset>
+const indexTailSize = 4096
+
+var reIndexListOffset = regexp.MustCompile(`<indexListOffset>\s*([0-9]+)\s*</indexListOffset>`)
+
+// ReadIndexed reads an (indexed) mzML file from an io.ReadSeeker.
+// Only the header of the file is read initially. Spectra are read
+// when they are accessed, using the offsets from <indexList>.
+// If the index is missing or doesn't match the file, it is rebuild
+// by scanning the file.
+// The reader must remain open for as long as the MzML is used,
+// and must not be used by other code in the meantime.
+func ReadIndexed(reader io.ReadSeeker) (MzML, error) {
+	var mzML MzML
+
+	mzML.reader = reader
+	mzML.cacheIndex = -1
+	err := mzML.readHeader()
+	if err != nil {
+		return mzML, err
+	}
+	mzML.traverseParamGroups()
+	ids, err := mzML.readIndex()
+	if err != nil || !mzML.checkIndex() {
+		ids, err = mzML.rebuildIndex()
+		if err != nil {
+			return mzML, err
+		}
+	}
+	mzML.setIDs(ids)
+	err = mzML.readTrailer()
+	mzML.traverseChromatograms()
+	return mzML, err
+}
+
+// newDecoderAt returns an XML decoder that starts reading at offset
+func (f *MzML) newDecoderAt(offset int64) (*xml.Decoder, error) {
+	_, err := f.reader.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	d := xml.NewDecoder(f.reader)
+	d.CharsetReader = charset.NewReaderLabel
+	return d, nil
+}
+
+// readHeader reads everything in the mzML file that precedes the spectra
+func (f *MzML) readHeader() error {
+	d, err := f.newDecoderAt(0)
+	if err != nil {
+		return err
+	}
+	for {
+		t, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		start, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		c := &f.content
+		switch start.Name.Local {
+		case "mzML":
+			c.XMLName = start.Name
+		case "cvList":
+			err = d.DecodeElement(&c.CvList, &start)
+		case "fileDescription":
+			err = d.DecodeElement(&c.FileDescription, &start)
+		case "referenceableParamGroupList":
+			c.ReferenceableParamGroupList = &referenceableParamGroupList{}
+			err = d.DecodeElement(c.ReferenceableParamGroupList, &start)
+		case "softwareList":
+			c.SoftwareList = &softwareList{}
+			err = d.DecodeElement(c.SoftwareList, &start)
+		case "instrumentConfigurationList":
+			c.InstrumentConfigurationList = &instrumentConfigurationList{}
+			err = d.DecodeElement(c.InstrumentConfigurationList, &start)
+		case "dataProcessingList":
+			c.DataProcessingList = &dataProcessingList{}
+			err = d.DecodeElement(c.DataProcessingList, &start)
+		case "run":
+			for _, a := range start.Attr {
+				switch a.Name.Local {
+				case "id":
+					c.Run.ID = a.Value
+				case "defaultInstrumentConfigurationRef":
+					c.Run.DefaultInstrumentConfigurationRef = a.Value
+				case "startTimeStamp":
+					c.Run.StartTimeStamp = a.Value
+				case "defaultSourceFileRef":
+					c.Run.DefaultSourceFileRef = a.Value
+				}
+			}
+		case "spectrumList":
+			for _, a := range start.Attr {
+				switch a.Name.Local {
+				case "count":
+					c.Run.SpectrumList.Count, _ = strconv.Atoi(a.Value)
+				case "defaultDataProcessingRef":
+					c.Run.SpectrumList.DefaultDataProcessingRef = a.Value
+				}
+			}
+			// The spectra themselves are read on demand
+			return nil
+		case "chromatogramList", "indexList":
+			// No spectra present
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readTrailer reads the part of the run that follows the spectra.
+// The chromatograms are read completely, as they are small compared
+// to the spectra.
+func (f *MzML) readTrailer() error {
+	// Start after the last spectrum, or at the beginning of the
+	// file if there are no spectra
+	base := int64(0)
+	var d *xml.Decoder
+	var err error
+	if n := len(f.specOffsets); n > 0 {
+		base = f.specOffsets[n-1]
+		d, _, err = f.elementDecoderAt(base, "spectrum")
+		if err == nil {
+			err = d.Skip()
+		}
+	} else {
+		d, err = f.newDecoderAt(0)
+	}
+	if err != nil {
+		return err
+	}
+	// We may start halfway the document, so the decoder can't check
+	// if elements are balanced; use RawToken to find the chromatogram list
+	for {
+		offset := d.InputOffset()
+		t, err := d.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "chromatogramList" {
+				d, start, err := f.elementDecoderAt(base+offset, "chromatogramList")
+				if err != nil {
+					return err
+				}
+				return d.DecodeElement(&f.content.Run.ChromatogramList, start)
+			}
+		case xml.EndElement:
+			if t.Name.Local == "run" {
+				return nil
+			}
+		}
+	}
+}
+
+// readIndex reads the offsets of the spectra from <indexList>
+func (f *MzML) readIndex() ([]string, error) {
+	size, err := f.reader.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	tailStart := size - indexTailSize
+	if tailStart < 0 {
+		tailStart = 0
+	}
+	_, err = f.reader.Seek(tailStart, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	tail, err := io.ReadAll(f.reader)
+	if err != nil {
+		return nil, err
+	}
+	m := reIndexListOffset.FindSubmatch(tail)
+	if m == nil {
+		return nil, ErrInvalidOffset
+	}
+	indexOffset, err := strconv.ParseInt(string(m[1]), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	var il indexList
+	d, start, err := f.elementDecoderAt(indexOffset, "indexList")
+	if err != nil {
+		return nil, err
+	}
+	err = d.DecodeElement(&il, start)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	f.specOffsets = nil
+	for _, index := range il.Index {
+		if index.Name != "spectrum" {
+			continue
+		}
+		for _, o := range index.Offset {
+			offset, err := strconv.ParseInt(strings.TrimSpace(o.Offset), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			f.specOffsets = append(f.specOffsets, offset)
+			ids = append(ids, o.IDRef)
+		}
+	}
+	return ids, nil
+}
+
+// checkIndex does a quick sanity check on the spectrum offsets. The
+// offsets must be increasing, and the first and last must point to a
+// spectrum. The other offsets are checked when the spectrum is read.
+func (f *MzML) checkIndex() bool {
+	n := len(f.specOffsets)
+	if n == 0 {
+		// An empty index is fine only if the header says so
+		return f.content.Run.SpectrumList.Count == 0
+	}
+	for i := 1; i < n; i++ {
+		if f.specOffsets[i] <= f.specOffsets[i-1] {
+			return false
+		}
+	}
+	return f.elementAt(f.specOffsets[0], "spectrum") &&
+		f.elementAt(f.specOffsets[n-1], "spectrum")
+}
+
+// elementAt returns true if the element with the given name starts at offset
+func (f *MzML) elementAt(offset int64, name string) bool {
+	_, err := f.reader.Seek(offset, io.SeekStart)
+	if err != nil {
+		return false
+	}
+	b := make([]byte, len(name)+2)
+	_, err = io.ReadFull(f.reader, b)
+	if err != nil {
+		return false
+	}
+	return bytes.HasPrefix(b, []byte("<"+name)) &&
+		(b[len(b)-1] == ' ' || b[len(b)-1] == '>' ||
+			b[len(b)-1] == '\t' || b[len(b)-1] == '\r' || b[len(b)-1] == '\n')
+}
+
+// rebuildIndex builds the spectrum offsets by scanning the complete file
+func (f *MzML) rebuildIndex() ([]string, error) {
+	d, err := f.newDecoderAt(0)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	f.specOffsets = nil
+	for {
+		offset := d.InputOffset()
+		t, err := d.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				return ids, nil
+			}
+			return nil, err
+		}
+		if start, ok := t.(xml.StartElement); ok && start.Name.Local == "spectrum" {
+			f.specOffsets = append(f.specOffsets, offset)
+			id := ""
+			for _, a := range start.Attr {
+				if a.Name.Local == "id" {
+					id = a.Value
+				}
+			}
+			ids = append(ids, id)
+		}
+	}
+}
+
+// setIDs fills the arrays f.index2id and f.id2Index from the index
+func (f *MzML) setIDs(ids []string) {
+	f.index2id = ids
+	f.id2Index = make(map[string]int, len(ids))
+	for i, id := range ids {
+		f.id2Index[id] = i
+	}
+}
+
+// elementDecoderAt returns a decoder positioned just after the start
+// of the element that begins at offset, together with the start element
+func (f *MzML) elementDecoderAt(offset int64, name string) (*xml.Decoder, *xml.StartElement, error) {
+	if !f.elementAt(offset, name) {
+		return nil, nil, ErrInvalidOffset
+	}
+	d, err := f.newDecoderAt(offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := d.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	start, ok := t.(xml.StartElement)
+	if !ok || start.Name.Local != name {
+		return nil, nil, ErrInvalidOffset
+	}
+	return d, &start, nil
+}
+
+// spectrumDecoderAt returns a decoder positioned just after the start of
+// a spectrum, using the offset from the index. ErrInvalidOffset is
+// returned if there is no spectrum at the offset, or if its id differs
+// from the id in the index.
+func (f *MzML) spectrumDecoderAt(scanIndex int) (*xml.Decoder, *xml.StartElement, error) {
+	d, start, err := f.elementDecoderAt(f.specOffsets[scanIndex], "spectrum")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, a := range start.Attr {
+		if a.Name.Local == "id" && a.Value != f.index2id[scanIndex] {
+			return nil, nil, ErrInvalidOffset
+		}
+	}
+	return d, start, nil
+}
+
+// readSpectrum reads a single spectrum from the underlying file
+func (f *MzML) readSpectrum(scanIndex int) (*spectrum, error) {
+	d, start, err := f.spectrumDecoderAt(scanIndex)
+	if err != nil {
+		// The index doesn't match the file, rebuild it
+		ids, err := f.rebuildIndex()
+		if err != nil {
+			return nil, err
+		}
+		f.setIDs(ids)
+		if scanIndex >= len(f.specOffsets) {
+			return nil, ErrInvalidScanIndex
+		}
+		d, start, err = f.spectrumDecoderAt(scanIndex)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var s spectrum
+	err = d.DecodeElement(&s, start)
+	if err != nil {
+		return nil, err
+	}
+	f.resolveSpectrum(&s)
+	return &s, nil
+}
+
+// spectrum returns the spectrum with the given index,
+// reading it from file if needed
+func (f *MzML) spectrum(scanIndex int) (*spectrum, error) {
+	if scanIndex < 0 || scanIndex >= f.NumSpecs() {
+		return nil, ErrInvalidScanIndex
+	}
+	if f.reader == nil {
+		return &f.content.Run.SpectrumList.Spectrum[scanIndex], nil
+	}
+	if s, ok := f.updated[scanIndex]; ok {
+		return s, nil
+	}
+	if f.cacheSpec != nil && f.cacheIndex == scanIndex {
+		return f.cacheSpec, nil
+	}
+	s, err := f.readSpectrum(scanIndex)
+	if err != nil {
+		return nil, err
+	}
+	f.cacheSpec = s
+	f.cacheIndex = scanIndex
+	return s, nil
+}
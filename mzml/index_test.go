@@ -0,0 +1,286 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// encode64 returns the base64 encoding of a little endian 64 bit float array
+func encode64(v []float64) string {
+	b := make([]byte, 8*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint64(b[8*i:], math.Float64bits(x))
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// testMzML generates a small mzML document with numSpecs spectra.
+// Spectrum i has MS level 1+(i%2), retention time i minutes
+// and two peaks with m/z 100+i and 200+i. MS2 spectra have a precursor
+// with m/z 500+i+0.5 and charge 2 that refers to the previous spectrum.
+// Two chromatograms are added: a TIC and an SRM chromatogram.
+// If offsetShift >= 0, an index is added with all offsets moved by
+// offsetShift bytes.
+func testMzML(numSpecs int, offsetShift int) string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="utf-8"?>
+<indexedmzML xmlns="http://psi.hupo.org/ms/mzml">
+  <mzML xmlns="http://psi.hupo.org/ms/mzml" version="1.1.0">
+    <cvList count="1">
+      <cv id="MS" fullName="Proteomics Standards Initiative Mass Spectrometry Ontology" version="4.1.0"/>
+    </cvList>
+    <fileDescription>
+      <fileContent>
+        <cvParam cvRef="MS" accession="MS:1000580" name="MSn spectrum" value=""/>
+      </fileContent>
+    </fileDescription>
+    <softwareList count="1">
+      <software id="test" version="1.0"/>
+    </softwareList>
+    <instrumentConfigurationList count="1">
+      <instrumentConfiguration id="IC1">
+        <componentList count="1">
+          <analyzer order="1">
+            <cvParam cvRef="MS" accession="MS:1000484" name="orbitrap" value=""/>
+          </analyzer>
+        </componentList>
+      </instrumentConfiguration>
+    </instrumentConfigurationList>
+    <dataProcessingList count="1">
+      <dataProcessing id="dp1">
+        <processingMethod order="0" softwareRef="test"/>
+      </dataProcessing>
+    </dataProcessingList>
+    <run id="run1" defaultInstrumentConfigurationRef="IC1">
+`)
+	fmt.Fprintf(&sb, "      <spectrumList count=\"%d\" defaultDataProcessingRef=\"dp1\">\n", numSpecs)
+	for i := 0; i < numSpecs; i++ {
+		mz := encode64([]float64{100 + float64(i), 200 + float64(i)})
+		intens := encode64([]float64{1000, 2000})
+		fmt.Fprintf(&sb, `        <spectrum index="%d" id="scan=%d" defaultArrayLength="2">
+          <cvParam cvRef="MS" accession="MS:1000511" name="ms level" value="%d"/>
+          <scanList count="1">
+            <scan>
+              <cvParam cvRef="MS" accession="MS:1000016" name="scan start time" value="%d" unitCvRef="UO" unitAccession="UO:0000031" unitName="minute"/>
+            </scan>
+          </scanList>
+`, i, i+1, 1+(i%2), i)
+		if i%2 == 1 {
+			fmt.Fprintf(&sb, `          <precursorList count="1">
+            <precursor spectrumRef="scan=%d">
+              <isolationWindow>
+                <cvParam cvRef="MS" accession="MS:1000827" name="isolation window target m/z" value="%d.5" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+                <cvParam cvRef="MS" accession="MS:1000828" name="isolation window lower offset" value="1" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+                <cvParam cvRef="MS" accession="MS:1000829" name="isolation window upper offset" value="1" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+              </isolationWindow>
+              <selectedIonList count="1">
+                <selectedIon>
+                  <cvParam cvRef="MS" accession="MS:1000744" name="selected ion m/z" value="%d.5" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+                  <cvParam cvRef="MS" accession="MS:1000041" name="charge state" value="2"/>
+                </selectedIon>
+              </selectedIonList>
+              <activation>
+                <cvParam cvRef="MS" accession="MS:1000422" name="beam-type collision-induced dissociation" value=""/>
+                <cvParam cvRef="MS" accession="MS:1000045" name="collision energy" value="30" unitCvRef="UO" unitAccession="UO:0000266" unitName="electronvolt"/>
+              </activation>
+            </precursor>
+          </precursorList>
+`, i, 500+i, 500+i)
+		}
+		fmt.Fprintf(&sb, `          <binaryDataArrayList count="2">
+            <binaryDataArray encodedLength="%d">
+              <cvParam cvRef="MS" accession="MS:1000523" name="64-bit float" value=""/>
+              <cvParam cvRef="MS" accession="MS:1000514" name="m/z array" value=""/>
+              <binary>%s</binary>
+            </binaryDataArray>
+            <binaryDataArray encodedLength="%d">
+              <cvParam cvRef="MS" accession="MS:1000523" name="64-bit float" value=""/>
+              <cvParam cvRef="MS" accession="MS:1000515" name="intensity array" value=""/>
+              <binary>%s</binary>
+            </binaryDataArray>
+          </binaryDataArrayList>
+        </spectrum>
+`, len(mz), mz, len(intens), intens)
+	}
+	sb.WriteString("      </spectrumList>\n")
+	times := encode64([]float64{0.5, 1.0, 1.5})
+	intens := encode64([]float64{10, 20, 30})
+	fmt.Fprintf(&sb, `      <chromatogramList count="2" defaultDataProcessingRef="dp1">
+        <chromatogram index="0" id="TIC" defaultArrayLength="3">
+          <cvParam cvRef="MS" accession="MS:1000235" name="total ion current chromatogram" value=""/>
+          <binaryDataArrayList count="2">
+            <binaryDataArray encodedLength="%d">
+              <cvParam cvRef="MS" accession="MS:1000523" name="64-bit float" value=""/>
+              <cvParam cvRef="MS" accession="MS:1000595" name="time array" value="" unitCvRef="UO" unitAccession="UO:0000031" unitName="minute"/>
+              <binary>%s</binary>
+            </binaryDataArray>
+            <binaryDataArray encodedLength="%d">
+              <cvParam cvRef="MS" accession="MS:1000523" name="64-bit float" value=""/>
+              <cvParam cvRef="MS" accession="MS:1000515" name="intensity array" value=""/>
+              <binary>%s</binary>
+            </binaryDataArray>
+          </binaryDataArrayList>
+        </chromatogram>
+        <chromatogram index="1" id="SRM SIC Q1=500.5 Q3=600.6" defaultArrayLength="3">
+          <cvParam cvRef="MS" accession="MS:1001473" name="selected reaction monitoring chromatogram" value=""/>
+          <precursor>
+            <isolationWindow>
+              <cvParam cvRef="MS" accession="MS:1000827" name="isolation window target m/z" value="500.5" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+            </isolationWindow>
+            <activation>
+              <cvParam cvRef="MS" accession="MS:1000133" name="collision-induced dissociation" value=""/>
+            </activation>
+          </precursor>
+          <product>
+            <isolationWindow>
+              <cvParam cvRef="MS" accession="MS:1000827" name="isolation window target m/z" value="600.6" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+            </isolationWindow>
+          </product>
+          <binaryDataArrayList count="2">
+            <binaryDataArray encodedLength="%d">
+              <cvParam cvRef="MS" accession="MS:1000523" name="64-bit float" value=""/>
+              <cvParam cvRef="MS" accession="MS:1000595" name="time array" value="" unitCvRef="UO" unitAccession="UO:0000031" unitName="minute"/>
+              <binary>%s</binary>
+            </binaryDataArray>
+            <binaryDataArray encodedLength="%d">
+              <cvParam cvRef="MS" accession="MS:1000523" name="64-bit float" value=""/>
+              <cvParam cvRef="MS" accession="MS:1000515" name="intensity array" value=""/>
+              <binary>%s</binary>
+            </binaryDataArray>
+          </binaryDataArrayList>
+        </chromatogram>
+      </chromatogramList>
+    </run>
+  </mzML>
+`, len(times), times, len(intens), intens, len(times), times, len(intens), intens)
+	if offsetShift >= 0 {
+		doc := sb.String()
+		indexOffset := len(doc)
+		sb.WriteString("  <indexList count=\"1\">\n    <index name=\"spectrum\">\n")
+		pos := 0
+		for i := 0; i < numSpecs; i++ {
+			pos += strings.Index(doc[pos:], "<spectrum ")
+			fmt.Fprintf(&sb, "      <offset idRef=\"scan=%d\">%d</offset>\n", i+1, pos+offsetShift)
+			pos++
+		}
+		fmt.Fprintf(&sb, "    </index>\n  </indexList>\n  <indexListOffset>%d</indexListOffset>\n", indexOffset)
+	}
+	sb.WriteString("</indexedmzML>\n")
+	return sb.String()
+}
+
+func TestReadIndexed(t *testing.T) {
+	tests := []struct {
+		name        string
+		offsetShift int
+	}{
+		{name: "Valid index", offsetShift: 0},
+		{name: "No index", offsetShift: -1},
+		{name: "Corrupt index", offsetShift: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ReadIndexed(strings.NewReader(testMzML(5, tt.offsetShift)))
+			if err != nil {
+				t.Fatalf("ReadIndexed: error return %v", err)
+			}
+			if n := f.NumSpecs(); n != 5 {
+				t.Fatalf("NumSpecs: %d, should be 5", n)
+			}
+			scanIndex, err := f.ScanIndex(`scan=4`)
+			if err != nil || scanIndex != 3 {
+				t.Errorf("ScanIndex: %d (%v), should be 3", scanIndex, err)
+			}
+			// Access in non-sequential order
+			for _, i := range []int{3, 0, 4, 3} {
+				p, err := f.ReadScan(i)
+				if err != nil {
+					t.Fatalf("ReadScan: error return %v", err)
+				}
+				if len(p) != 2 || p[0].Mz != 100+float64(i) || p[1].Intens != 2000 {
+					t.Errorf("ReadScan(%d): %v", i, p)
+				}
+				msLevel, err := f.MSLevel(i)
+				if err != nil || msLevel != 1+(i%2) {
+					t.Errorf("MSLevel(%d): %d (%v), should be %d", i, msLevel, err, 1+(i%2))
+				}
+				rt, err := f.RetentionTime(i)
+				if err != nil || rt != 60*float64(i) {
+					t.Errorf("RetentionTime(%d): %f (%v), should be %f", i, rt, err, 60*float64(i))
+				}
+			}
+			_, err = f.ReadScan(5)
+			if err != ErrInvalidScanIndex {
+				t.Errorf("ReadScan: error return %v, should be ErrInvalidScanIndex", err)
+			}
+			instruments, err := f.MSInstruments()
+			if err != nil || len(instruments) != 1 || instruments[0] != "MS:1000484" {
+				t.Errorf("MSInstruments: %v (%v)", instruments, err)
+			}
+
+			// Modified spectra must be written along with the others
+			err = f.UpdateScan(2, []Peak{{Mz: 42.0, Intens: 777.0}}, true, true)
+			if err != nil {
+				t.Fatalf("UpdateScan: error return %v", err)
+			}
+			var sb strings.Builder
+			err = f.Write(&sb)
+			if err != nil {
+				t.Fatalf("Write: error return %v", err)
+			}
+			f2, err := Read(strings.NewReader(sb.String()))
+			if err != nil {
+				t.Fatalf("Read: error return %v", err)
+			}
+			if n := f2.NumSpecs(); n != 5 {
+				t.Fatalf("NumSpecs after write: %d, should be 5", n)
+			}
+			p, err := f2.ReadScan(2)
+			if err != nil || len(p) != 1 || p[0].Mz != 42.0 {
+				t.Errorf("ReadScan after write: %v (%v)", p, err)
+			}
+			p, err = f2.ReadScan(4)
+			if err != nil || len(p) != 2 || p[0].Mz != 104.0 {
+				t.Errorf("ReadScan after write: %v (%v)", p, err)
+			}
+		})
+	}
+}
+
+func TestCorruptOffset(t *testing.T) {
+	// An offset in the middle of the index points to another spectrum
+	doc := testMzML(5, 0)
+	off := func(id string) string {
+		s := doc[strings.Index(doc, `<offset idRef="`+id+`">`):]
+		return s[:strings.Index(s, "\n")]
+	}
+	doc = strings.Replace(doc, off(`scan=3`), strings.Replace(off(`scan=2`), `scan=2`, `scan=3`, 1), 1)
+	f, err := ReadIndexed(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("ReadIndexed: error return %v", err)
+	}
+	p, err := f.ReadScan(2)
+	if err != nil || len(p) != 2 || p[0].Mz != 102 {
+		t.Errorf("ReadScan(2): %v (%v)", p, err)
+	}
+
+	// The offsets are increasing, but the index is out of sync with the file
+	f, err = ReadIndexed(strings.NewReader(testMzML(5, 0)))
+	if err != nil {
+		t.Fatalf("ReadIndexed: error return %v", err)
+	}
+	f.specOffsets[2] = f.specOffsets[3]
+	for _, i := range []int{2, 3} {
+		p, err = f.ReadScan(i)
+		if err != nil || len(p) != 2 || p[0].Mz != 100+float64(i) {
+			t.Errorf("ReadScan(%d): %v (%v)", i, p, err)
+		}
+	}
+}
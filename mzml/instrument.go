@@ -0,0 +1,84 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// InstrumentConfigurations returns the instrument configurations.
+// The CV params of referenced param groups are included.
+func (f *MzML) InstrumentConfigurations() ([]InstrumentConfiguration, error) {
+	type component struct {
+		XMLName       xml.Name
+		ParamGroupRef []referenceableParamGroupRef `xml:"referenceableParamGroupRef"`
+		CvPar         []CVParam                    `xml:"cvParam"`
+	}
+	type componentList struct {
+		Component []component `xml:",any"`
+	}
+	type instrumentConfiguration struct {
+		ID            string                       `xml:"id,attr"`
+		ParamGroupRef []referenceableParamGroupRef `xml:"referenceableParamGroupRef"`
+		CvPar         []CVParam                    `xml:"cvParam"`
+		ComponentList componentList                `xml:"componentList"`
+		SoftwareRef   struct {
+			Ref string `xml:"ref,attr"`
+		} `xml:"softwareRef"`
+	}
+
+	var confs []InstrumentConfiguration
+	if f.content.InstrumentConfigurationList == nil {
+		return nil, nil
+	}
+	// The instrument configurations are stored as raw XML
+	XML := f.content.InstrumentConfigurationList.InstrumentConfigurationListXML
+	d := xml.NewDecoder(strings.NewReader(string(XML)))
+	for {
+		t, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return confs, nil
+			}
+			return nil, err
+		}
+		start, ok := t.(xml.StartElement)
+		if !ok || start.Name.Local != "instrumentConfiguration" {
+			continue
+		}
+		var ic instrumentConfiguration
+		err = d.DecodeElement(&ic, &start)
+		if err != nil {
+			return nil, err
+		}
+		conf := InstrumentConfiguration{
+			ID:          ic.ID,
+			CvPar:       cvParams(ic.CvPar, f.groupCvParams(ic.ParamGroupRef)),
+			SoftwareRef: ic.SoftwareRef.Ref,
+		}
+		for _, c := range ic.ComponentList.Component {
+			conf.Components = append(conf.Components, Component{
+				Kind:  c.XMLName.Local,
+				CvPar: cvParams(c.CvPar, f.groupCvParams(c.ParamGroupRef)),
+			})
+		}
+		confs = append(confs, conf)
+	}
+}
+
+// SourceFiles returns the files from which the mzML file was generated
+func (f *MzML) SourceFiles() ([]SourceFile, error) {
+	type fileDescription struct {
+		SourceFile []SourceFile `xml:"sourceFileList>sourceFile"`
+	}
+	var desc fileDescription
+	err := xml.Unmarshal([]byte("<fileDescription>"+
+		f.content.FileDescription.FileDescriptionXML+"</fileDescription>"), &desc)
+	if err != nil {
+		return nil, err
+	}
+	return desc.SourceFile, nil
+}
@@ -6,20 +6,31 @@ package mzml
 import (
 	"encoding/xml"
 	"errors"
+	"io"
+
+	"github.com/524D/galms/spectra"
 )
 
 // MzML wraps the contents of the mzML file
 type MzML struct {
-	content  mzMLContent
-	index2id []string
-	id2Index map[string]int
+	content       mzMLContent
+	index2id      []string
+	id2Index      map[string]int
+	chromID2Index map[string]int
+	paramGroups   map[string][]CVParam
+
+	// The fields below are only used when the file is accessed through
+	// its index (see ReadIndexed). In that case, content contains
+	// no spectra; they are read from reader when needed.
+	reader      io.ReadSeeker
+	specOffsets []int64
+	cacheIndex  int
+	cacheSpec   *spectrum
+	updated     map[int]*spectrum
 }
 
 // Peak contains the actual ms peak info
-type Peak struct {
-	Mz     float64
-	Intens float64
-}
+type Peak = spectra.Peak
 
 // The mzML content that we read. Not all fields are parsed,
 // but we need to store them in order to write the result mzML.
@@ -36,32 +47,24 @@ type mzMLContent struct {
 	Run                         run                          `xml:"run"`
 }
 
-// We define a separte struct for writing XML because it is not possible
-// to write namespace info otherwise
-type mzMLContentWrite struct {
-	XMLName         xml.Name `xml:"http://psi.hupo.org/ms/mzml mzML"`
-	Sl1             string   `xml:"xsi:schemaLocation,attr"`
-	Version         string   `xml:"version,attr"`
-	Sl2             string   `xml:"xmlns:xsi,attr"`
-	CvList          cvList   `xml:"cvList"`
-	FileDescription struct {
-		FileDescriptionXML string `xml:",innerxml"`
-	} `xml:"fileDescription"`
-	ReferenceableParamGroupList *referenceableParamGroupList `xml:"referenceableParamGroupList,omitempty"`
-	SoftwareList                *softwareList                `xml:"softwareList"`
-	InstrumentConfigurationList *instrumentConfigurationList `xml:"instrumentConfigurationList"`
-	DataProcessingList          *dataProcessingList          `xml:"dataProcessingList"`
-	Run                         run                          `xml:"run"`
-}
-
 type cvList struct {
 	Count     int    `xml:"count,attr,omitempty"`
 	CvListXML []byte `xml:",innerxml"`
 }
 
 type referenceableParamGroupList struct {
-	Count                          int    `xml:"count,attr,omitempty"`
-	ReferenceableParamGroupListXML []byte `xml:",innerxml"`
+	Count                   int                       `xml:"count,attr,omitempty"`
+	ReferenceableParamGroup []referenceableParamGroup `xml:"referenceableParamGroup"`
+}
+
+type referenceableParamGroup struct {
+	ID      string      `xml:"id,attr"`
+	CvPar   []CVParam   `xml:"cvParam,omitempty"`
+	UserPar []userParam `xml:"userParam,omitempty"`
+}
+
+type referenceableParamGroupRef struct {
+	Ref string `xml:"ref,attr"`
 }
 
 type softwareList struct {
@@ -117,17 +120,39 @@ type spectrumList struct {
 }
 
 type chromatogramList struct {
-	Count                    int    `xml:"count,attr,omitempty"`
-	DefaultDataProcessingRef string `xml:"defaultDataProcessingRef,attr,omitempty"`
-	ChromatogramListXML      []byte `xml:",innerxml"`
+	Count                    int            `xml:"count,attr,omitempty"`
+	DefaultDataProcessingRef string         `xml:"defaultDataProcessingRef,attr,omitempty"`
+	Chromatogram             []chromatogram `xml:"chromatogram,omitempty"`
+}
+
+type chromatogram struct {
+	Index              int                          `xml:"index,attr"`
+	ID                 string                       `xml:"id,attr"`
+	DefaultArrayLength int64                        `xml:"defaultArrayLength,attr"`
+	DataProcessingRef  string                       `xml:"dataProcessingRef,attr,omitempty"`
+	ParamGroupRef      []referenceableParamGroupRef `xml:"referenceableParamGroupRef,omitempty"`
+	CvPar              []CVParam                    `xml:"cvParam,omitempty"`
+	groupCvPar         []CVParam
+	UserPar            []userParam `xml:"userParam,omitempty"`
+	// Precursor and product are optional, slices are used
+	// to prevent writing empty elements
+	Precursor           []XMLprecursor      `xml:"precursor,omitempty"`
+	Product             []product           `xml:"product,omitempty"`
+	BinaryDataArrayList binaryDataArrayList `xml:"binaryDataArrayList"`
+}
+
+type product struct {
+	IsolationWindow isolationWindow `xml:"isolationWindow,omitempty"`
 }
 
 type spectrum struct {
-	Index              int       `xml:"index,attr"`
-	ID                 string    `xml:"id,attr"`
-	DefaultArrayLength int64     `xml:"defaultArrayLength,attr"`
-	CvPar              []CVParam `xml:"cvParam,omitempty"`
-	ScanList           scanList  `xml:"scanList"`
+	Index              int                          `xml:"index,attr"`
+	ID                 string                       `xml:"id,attr"`
+	DefaultArrayLength int64                        `xml:"defaultArrayLength,attr"`
+	ParamGroupRef      []referenceableParamGroupRef `xml:"referenceableParamGroupRef,omitempty"`
+	CvPar              []CVParam                    `xml:"cvParam,omitempty"`
+	groupCvPar         []CVParam                    // CV params of the referenced param groups
+	ScanList           scanList                     `xml:"scanList"`
 	// precursorList is a slice, only the current version of
 	// the encoding/xml package does not handle "omitempty" properly on
 	// structures, and we don't want precursorList tags to appear in
@@ -142,10 +167,13 @@ type binaryDataArrayList struct {
 }
 
 type binaryDataArray struct {
-	EncodedLength int       `xml:"encodedLength,attr,omitempty"`
-	ArrayLength   int       `xml:"arrayLength,attr,omitempty"`
-	CvPar         []CVParam `xml:"cvParam,omitempty"`
-	Binary        string    `xml:"binary"`
+	EncodedLength int                          `xml:"encodedLength,attr,omitempty"`
+	ArrayLength   int                          `xml:"arrayLength,attr,omitempty"`
+	ParamGroupRef []referenceableParamGroupRef `xml:"referenceableParamGroupRef,omitempty"`
+	CvPar         []CVParam                    `xml:"cvParam,omitempty"`
+	groupCvPar    []CVParam
+	UserPar       []userParam `xml:"userParam,omitempty"`
+	Binary        string      `xml:"binary"`
 }
 
 type scanList struct {
@@ -155,8 +183,10 @@ type scanList struct {
 }
 
 type scan struct {
-	InstrConfRef   string         `xml:"instrumentConfigurationRef,attr,omitempty"`
-	CvPar          []CVParam      `xml:"cvParam,omitempty"`
+	InstrConfRef   string                       `xml:"instrumentConfigurationRef,attr,omitempty"`
+	ParamGroupRef  []referenceableParamGroupRef `xml:"referenceableParamGroupRef,omitempty"`
+	CvPar          []CVParam                    `xml:"cvParam,omitempty"`
+	groupCvPar     []CVParam
 	UserPar        []userParam    `xml:"userParam,omitempty"`
 	ScanWindowList scanWindowList `xml:"scanWindowList"`
 }
@@ -181,7 +211,18 @@ type XMLprecursor struct {
 }
 
 type isolationWindow struct {
-	CvPar []CVParam `xml:"cvParam,omitempty"`
+	ParamGroupRef []referenceableParamGroupRef `xml:"referenceableParamGroupRef,omitempty"`
+	CvPar         []CVParam                    `xml:"cvParam,omitempty"`
+	groupCvPar    []CVParam
+}
+
+// MarshalXML omits empty isolation windows
+func (w isolationWindow) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if len(w.CvPar) == 0 && len(w.ParamGroupRef) == 0 {
+		return nil
+	}
+	type plain isolationWindow
+	return e.EncodeElement(plain(w), start)
 }
 
 type selectedIonList struct {
@@ -190,22 +231,88 @@ type selectedIonList struct {
 	SelectedIon []selectedIon `xml:"selectedIon"`
 }
 
+// MarshalXML omits empty selected ion lists
+func (l selectedIonList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if len(l.SelectedIon) == 0 && len(l.CvPar) == 0 {
+		return nil
+	}
+	type plain selectedIonList
+	return e.EncodeElement(plain(l), start)
+}
+
 type selectedIon struct {
-	CvPar []CVParam `xml:"cvParam,omitempty"`
+	ParamGroupRef []referenceableParamGroupRef `xml:"referenceableParamGroupRef,omitempty"`
+	CvPar         []CVParam                    `xml:"cvParam,omitempty"`
+	groupCvPar    []CVParam
 }
 
 type activation struct {
-	CvPar []CVParam `xml:"cvParam,omitempty"`
+	ParamGroupRef []referenceableParamGroupRef `xml:"referenceableParamGroupRef,omitempty"`
+	CvPar         []CVParam                    `xml:"cvParam,omitempty"`
+	groupCvPar    []CVParam
 }
 
 type scanWindowList struct {
-	Count          int    `xml:"count,attr,omitempty"`
-	ScanWindowList string `xml:",innerxml"`
+	Count      int          `xml:"count,attr,omitempty"`
+	ScanWindow []scanWindow `xml:"scanWindow"`
+}
+
+// MarshalXML omits empty scan window lists
+func (l scanWindowList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if len(l.ScanWindow) == 0 {
+		return nil
+	}
+	type plain scanWindowList
+	return e.EncodeElement(plain(l), start)
+}
+
+type scanWindow struct {
+	ParamGroupRef []referenceableParamGroupRef `xml:"referenceableParamGroupRef,omitempty"`
+	CvPar         []CVParam                    `xml:"cvParam,omitempty"`
+	groupCvPar    []CVParam
+	UserPar       []userParam `xml:"userParam,omitempty"`
+}
+
+// Compression is the compression method of a binary data array
+type Compression int
+
+// Compression methods for binary data arrays
+const (
+	NoCompression Compression = iota
+	Zlib
+	NumpressLinear
+	NumpressPic
+	NumpressSlof
+	NumpressLinearZlib
+	NumpressPicZlib
+	NumpressSlofZlib
+)
+
+// DataType is the type of the values in a binary data array
+type DataType int
+
+// Data types of binary data arrays
+const (
+	Float32 DataType = iota
+	Float64
+	Int32
+	Int64
+)
+
+// UnsupportedEncodingError is returned when a binary data array is
+// encoded in a way that we can't handle
+type UnsupportedEncodingError struct {
+	Accession string // CV term of the encoding
+}
+
+func (e *UnsupportedEncodingError) Error() string {
+	return "MzML: unsupported binary data encoding (CV term " + e.Accession + ")"
 }
 
 // CVParam contains values and attributes of a mzML Controlled Vocabulary term
 // (http://www.peptideatlas.org/tmp/mzML1.1.0.html)
 type CVParam struct {
+	CvRef         string `xml:"cvRef,attr,omitempty"`
 	Accession     string `xml:"accession,attr,omitempty"`
 	Name          string `xml:"name,attr,omitempty"`
 	Value         string `xml:"value,attr,omitempty"`
@@ -221,4 +328,22 @@ var (
 	ErrInvalidScanIndex = errors.New("MzML: invalid scan index")
 	// ErrUnknownUnit means the file contains a unit that the software cannot handle
 	ErrUnknownUnit = errors.New("MzML: can't handle unit")
+	// ErrInvalidChromatogramID means an invalid chromatogram id is supplied
+	ErrInvalidChromatogramID = errors.New("MzML: invalid chromatogram id")
+	// ErrInvalidChromatogramIndex means an invalid chromatogram index is supplied
+	ErrInvalidChromatogramIndex = errors.New("MzML: invalid chromatogram index")
+	// ErrInvalidOffset means that an offset in the index does not point
+	// to the expected element
+	ErrInvalidOffset = errors.New("MzML: invalid offset in index")
+	// ErrInvalidArrayLength means a binary data array contains more values
+	// than the spectrum has peaks
+	ErrInvalidArrayLength = errors.New("MzML: binary data array too long")
+	// ErrInvalidNumpress means that MS-Numpress data can't be encoded or decoded
+	ErrInvalidNumpress = errors.New("MzML: invalid MS-Numpress data")
+	// ErrAppendIndexed means that spectra can't be added to a file that is
+	// read with ReadIndexed
+	ErrAppendIndexed = errors.New("MzML: can't append spectra to indexed file")
+	// ErrUnmatchedPeaks means that the other binary data arrays of a
+	// spectrum can't be kept, because a new peak has an unknown m/z
+	ErrUnmatchedPeaks = errors.New("MzML: peaks don't match the other binary data arrays")
 )
@@ -0,0 +1,301 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// MS-Numpress compression of binary data arrays.
+// This is a port of the reference implementation, see
+// https://github.com/ms-numpress/ms-numpress
+// and Teleman et al., Mol Cell Proteomics (2014) 13:1537-1542.
+
+// numpressAppendInt appends the half bytes that encode x to hb.
+// The first half byte holds the number of leading zero (0-8) or
+// leading 0xf (9-15) half bytes that are omitted, the remaining
+// half bytes hold the value, least significant first.
+func numpressAppendInt(hb []byte, x uint32) []byte {
+	const mask = uint32(0xf0000000)
+	switch x & mask {
+	case 0:
+		l := 8
+		for i := 0; i < 8; i++ {
+			if x&(mask>>(4*i)) != 0 {
+				l = i
+				break
+			}
+		}
+		hb = append(hb, byte(l))
+		for i := l; i < 8; i++ {
+			hb = append(hb, byte(x>>(4*(i-l)))&0xf)
+		}
+	case mask:
+		l := 7
+		for i := 0; i < 8; i++ {
+			m := mask >> (4 * i)
+			if x&m != m {
+				l = i
+				break
+			}
+		}
+		hb = append(hb, byte(l+8))
+		for i := l; i < 8; i++ {
+			hb = append(hb, byte(x>>(4*(i-l)))&0xf)
+		}
+	default:
+		hb = append(hb, 0)
+		for i := 0; i < 8; i++ {
+			hb = append(hb, byte(x>>(4*i))&0xf)
+		}
+	}
+	return hb
+}
+
+// numpressPackHalfBytes packs half bytes into bytes, high half byte first
+func numpressPackHalfBytes(res []byte, hb []byte) []byte {
+	for i := 1; i < len(hb); i += 2 {
+		res = append(res, hb[i-1]<<4|hb[i])
+	}
+	if len(hb)%2 != 0 {
+		res = append(res, hb[len(hb)-1]<<4)
+	}
+	return res
+}
+
+// numpressIntReader decodes integers that were encoded with numpressAppendInt
+type numpressIntReader struct {
+	data []byte
+	di   int  // Index of current byte
+	half bool // True if the next half byte is the low half of data[di]
+}
+
+// done returns true if all integers have been read
+func (r *numpressIntReader) done() bool {
+	if r.di >= len(r.data) {
+		return true
+	}
+	// A single trailing zero half byte is padding
+	return r.di == len(r.data)-1 && r.half && r.data[r.di]&0xf == 0
+}
+
+func (r *numpressIntReader) halfByte() (byte, error) {
+	if r.di >= len(r.data) {
+		return 0, ErrInvalidNumpress
+	}
+	var hb byte
+	if r.half {
+		hb = r.data[r.di] & 0xf
+		r.di++
+	} else {
+		hb = r.data[r.di] >> 4
+	}
+	r.half = !r.half
+	return hb, nil
+}
+
+func (r *numpressIntReader) readInt() (uint32, error) {
+	head, err := r.halfByte()
+	if err != nil {
+		return 0, err
+	}
+	var res uint32
+	n := int(head)
+	if head > 8 {
+		// n leading half bytes are 0xf
+		n = int(head) - 8
+		for i := 0; i < n; i++ {
+			res |= uint32(0xf0000000) >> (4 * i)
+		}
+	}
+	for i := n; i < 8; i++ {
+		hb, err := r.halfByte()
+		if err != nil {
+			return 0, err
+		}
+		res |= uint32(hb) << (4 * (i - n))
+	}
+	return res, nil
+}
+
+// numpressAppendFixedPoint appends the fixed point as big endian double
+func numpressAppendFixedPoint(res []byte, fixedPoint float64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], math.Float64bits(fixedPoint))
+	return append(res, b[:]...)
+}
+
+func numpressFixedPoint(data []byte) (float64, error) {
+	if len(data) < 8 {
+		return 0, ErrInvalidNumpress
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+}
+
+// numpressOptimalLinearFixedPoint returns the largest fixed point for which
+// the linear prediction of values does not overflow
+func numpressOptimalLinearFixedPoint(values []float64) float64 {
+	switch len(values) {
+	case 0:
+		return 0
+	case 1:
+		return math.Floor(0xFFFFFFFF / values[0])
+	}
+	maxDouble := math.Max(values[0], values[1])
+	for i := 2; i < len(values); i++ {
+		extrapol := values[i-1] + (values[i-1] - values[i-2])
+		diff := values[i] - extrapol
+		maxDouble = math.Max(maxDouble, math.Ceil(math.Abs(diff)+1))
+	}
+	return math.Floor(0x7FFFFFFF / maxDouble)
+}
+
+// numpressEncodeLinear compresses values using linear prediction.
+// This is best suited for m/z and retention time arrays.
+func numpressEncodeLinear(values []float64, fixedPoint float64) ([]byte, error) {
+	res := make([]byte, 0, 8+len(values)*5)
+	res = numpressAppendFixedPoint(res, fixedPoint)
+	if len(values) == 0 {
+		return res, nil
+	}
+	var ints [3]int64
+	var b [4]byte
+	ints[1] = int64(values[0]*fixedPoint + 0.5)
+	binary.LittleEndian.PutUint32(b[:], uint32(ints[1]))
+	res = append(res, b[:]...)
+	if len(values) == 1 {
+		return res, nil
+	}
+	ints[2] = int64(values[1]*fixedPoint + 0.5)
+	binary.LittleEndian.PutUint32(b[:], uint32(ints[2]))
+	res = append(res, b[:]...)
+
+	hb := make([]byte, 0, 9*(len(values)-2))
+	for i := 2; i < len(values); i++ {
+		ints[0] = ints[1]
+		ints[1] = ints[2]
+		ints[2] = int64(values[i]*fixedPoint + 0.5)
+		extrapol := ints[1] + (ints[1] - ints[0])
+		diff := ints[2] - extrapol
+		if diff > math.MaxInt32 || diff < math.MinInt32 {
+			return nil, ErrInvalidNumpress
+		}
+		hb = numpressAppendInt(hb, uint32(int32(diff)))
+	}
+	return numpressPackHalfBytes(res, hb), nil
+}
+
+// numpressDecodeLinear decodes data that was compressed with numpressEncodeLinear
+func numpressDecodeLinear(data []byte) ([]float64, error) {
+	fixedPoint, err := numpressFixedPoint(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 8 {
+		return []float64{}, nil
+	}
+	if len(data) < 12 {
+		return nil, ErrInvalidNumpress
+	}
+	var ints [3]int64
+	ints[1] = int64(binary.LittleEndian.Uint32(data[8:]))
+	res := []float64{float64(ints[1]) / fixedPoint}
+	if len(data) == 12 {
+		return res, nil
+	}
+	if len(data) < 16 {
+		return nil, ErrInvalidNumpress
+	}
+	ints[2] = int64(binary.LittleEndian.Uint32(data[12:]))
+	res = append(res, float64(ints[2])/fixedPoint)
+
+	r := numpressIntReader{data: data, di: 16}
+	for !r.done() {
+		x, err := r.readInt()
+		if err != nil {
+			return nil, err
+		}
+		ints[0] = ints[1]
+		ints[1] = ints[2]
+		extrapol := ints[1] + (ints[1] - ints[0])
+		ints[2] = extrapol + int64(int32(x))
+		res = append(res, float64(ints[2])/fixedPoint)
+	}
+	return res, nil
+}
+
+// numpressEncodePic compresses values by rounding them to positive integers.
+// This is suited for ion count data.
+func numpressEncodePic(values []float64) ([]byte, error) {
+	hb := make([]byte, 0, 9*len(values))
+	for _, v := range values {
+		if v < -0.5 || v+0.5 > math.MaxInt32 {
+			return nil, ErrInvalidNumpress
+		}
+		hb = numpressAppendInt(hb, uint32(v+0.5))
+	}
+	return numpressPackHalfBytes(make([]byte, 0, len(hb)/2+1), hb), nil
+}
+
+// numpressDecodePic decodes data that was compressed with numpressEncodePic
+func numpressDecodePic(data []byte) ([]float64, error) {
+	res := make([]float64, 0, len(data))
+	r := numpressIntReader{data: data}
+	for !r.done() {
+		x, err := r.readInt()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, float64(x))
+	}
+	return res, nil
+}
+
+// numpressOptimalSlofFixedPoint returns the largest fixed point for which
+// short logged float compression of values does not overflow
+func numpressOptimalSlofFixedPoint(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	maxDouble := 1.0
+	for _, v := range values {
+		maxDouble = math.Max(maxDouble, math.Log(v+1))
+	}
+	return math.Floor(0xFFFF / maxDouble)
+}
+
+// numpressEncodeSlof compresses values by storing the logarithm as
+// a 16 bit fixed point number. This is suited for intensity data.
+func numpressEncodeSlof(values []float64, fixedPoint float64) ([]byte, error) {
+	res := make([]byte, 0, 8+2*len(values))
+	res = numpressAppendFixedPoint(res, fixedPoint)
+	var b [2]byte
+	for _, v := range values {
+		temp := math.Log(v+1) * fixedPoint
+		if temp > math.MaxUint16 || temp < 0 || math.IsNaN(temp) {
+			return nil, ErrInvalidNumpress
+		}
+		binary.LittleEndian.PutUint16(b[:], uint16(temp+0.5))
+		res = append(res, b[:]...)
+	}
+	return res, nil
+}
+
+// numpressDecodeSlof decodes data that was compressed with numpressEncodeSlof
+func numpressDecodeSlof(data []byte) ([]float64, error) {
+	fixedPoint, err := numpressFixedPoint(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%2 != 0 {
+		return nil, ErrInvalidNumpress
+	}
+	res := make([]float64, 0, (len(data)-8)/2)
+	for i := 8; i < len(data); i += 2 {
+		x := binary.LittleEndian.Uint16(data[i:])
+		res = append(res, math.Exp(float64(x)/fixedPoint)-1)
+	}
+	return res, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestNumpressKnownValues(t *testing.T) {
+	linear, err := numpressEncodeLinear([]float64{100, 200, 300}, 1)
+	if err != nil {
+		t.Fatalf("numpressEncodeLinear: error return %v", err)
+	}
+	wantLinear := []byte{0x3f, 0xf0, 0, 0, 0, 0, 0, 0, 100, 0, 0, 0, 200, 0, 0, 0, 0x80}
+	if !bytes.Equal(linear, wantLinear) {
+		t.Errorf("numpressEncodeLinear = %x, want %x", linear, wantLinear)
+	}
+	pic, err := numpressEncodePic([]float64{0, 1, 255})
+	if err != nil {
+		t.Fatalf("numpressEncodePic: error return %v", err)
+	}
+	wantPic := []byte{0x87, 0x16, 0xff}
+	if !bytes.Equal(pic, wantPic) {
+		t.Errorf("numpressEncodePic = %x, want %x", pic, wantPic)
+	}
+	_, err = numpressDecodeLinear([]byte{0x3f, 0xf0, 0, 0})
+	if err != ErrInvalidNumpress {
+		t.Errorf("numpressDecodeLinear: error return %v, should be ErrInvalidNumpress", err)
+	}
+}
+
+func TestNumpressRoundTrip(t *testing.T) {
+	mzs := []float64{100.1234, 100.5678, 250.9999, 250.0001, 1999.87654, 512.3}
+	intens := []float64{0, 1, 17.3, 1234.5, 98765.4, 1e7}
+
+	fp := numpressOptimalLinearFixedPoint(mzs)
+	enc, err := numpressEncodeLinear(mzs, fp)
+	if err != nil {
+		t.Fatalf("numpressEncodeLinear: error return %v", err)
+	}
+	dec, err := numpressDecodeLinear(enc)
+	if err != nil {
+		t.Fatalf("numpressDecodeLinear: error return %v", err)
+	}
+	if len(dec) != len(mzs) {
+		t.Fatalf("numpressDecodeLinear: %d values, should be %d", len(dec), len(mzs))
+	}
+	for i := range mzs {
+		if math.Abs(dec[i]-mzs[i]) > 1/fp {
+			t.Errorf("Linear value %d: %f, should be %f", i, dec[i], mzs[i])
+		}
+	}
+
+	enc, err = numpressEncodePic(intens)
+	if err != nil {
+		t.Fatalf("numpressEncodePic: error return %v", err)
+	}
+	dec, err = numpressDecodePic(enc)
+	if err != nil {
+		t.Fatalf("numpressDecodePic: error return %v", err)
+	}
+	if len(dec) != len(intens) {
+		t.Fatalf("numpressDecodePic: %d values, should be %d", len(dec), len(intens))
+	}
+	for i := range intens {
+		if math.Abs(dec[i]-intens[i]) > 0.5 {
+			t.Errorf("Pic value %d: %f, should be %f", i, dec[i], intens[i])
+		}
+	}
+
+	fp = numpressOptimalSlofFixedPoint(intens)
+	enc, err = numpressEncodeSlof(intens, fp)
+	if err != nil {
+		t.Fatalf("numpressEncodeSlof: error return %v", err)
+	}
+	dec, err = numpressDecodeSlof(enc)
+	if err != nil {
+		t.Fatalf("numpressDecodeSlof: error return %v", err)
+	}
+	if len(dec) != len(intens) {
+		t.Fatalf("numpressDecodeSlof: %d values, should be %d", len(dec), len(intens))
+	}
+	for i := range intens {
+		if math.Abs(dec[i]-intens[i]) > 0.001*(intens[i]+1) {
+			t.Errorf("Slof value %d: %f, should be %f", i, dec[i], intens[i])
+		}
+	}
+}
+
+func TestSetCompression(t *testing.T) {
+	// Compression for m/z and intensity
+	compressions := [][2]Compression{
+		{NoCompression, NoCompression},
+		{Zlib, Zlib},
+		{NumpressLinear, NumpressPic},
+		{NumpressLinear, NumpressSlof},
+		{NumpressLinearZlib, NumpressPicZlib},
+		{NumpressLinearZlib, NumpressSlofZlib},
+	}
+	for c, cc := range compressions {
+		f, err := Read(strings.NewReader(testMzML(2, -1)))
+		if err != nil {
+			t.Fatalf("Read: error return %v", err)
+		}
+		err = f.SetCompression(1, cc[0], cc[1])
+		if err != nil {
+			t.Fatalf("SetCompression(%d): error return %v", c, err)
+		}
+		var sb strings.Builder
+		err = f.Write(&sb)
+		if err != nil {
+			t.Fatalf("Write: error return %v", err)
+		}
+		f, err = Read(strings.NewReader(sb.String()))
+		if err != nil {
+			t.Fatalf("Read: error return %v", err)
+		}
+		p, err := f.ReadScan(1)
+		if err != nil {
+			t.Fatalf("ReadScan(%d): error return %v", c, err)
+		}
+		if len(p) != 2 || math.Abs(p[1].Mz-201) > 0.001 || math.Abs(p[1].Intens-2000) > 2 {
+			t.Errorf("ReadScan(%d): %v", c, p)
+		}
+		// Peaks must be updated with the same compression
+		err = f.UpdateScan(1, []Peak{{Mz: 300.5, Intens: 30}}, true, true)
+		if err != nil {
+			t.Fatalf("UpdateScan(%d): error return %v", c, err)
+		}
+		p, err = f.ReadScan(1)
+		if err != nil || len(p) != 1 || math.Abs(p[0].Mz-300.5) > 0.001 || math.Abs(p[0].Intens-30) > 0.5 {
+			t.Errorf("ReadScan(%d) after update: %v (%v)", c, p, err)
+		}
+	}
+}
+
+func TestUnsupportedEncoding(t *testing.T) {
+	for _, tt := range []struct{ old, new, accession string }{
+		{`accession="MS:1000523"`, `accession="MS:1003091"`, `MS:1003091`},
+		// Unsupported compression in addition to zlib
+		{`name="64-bit float" value=""/>`,
+			`name="64-bit float" value=""/><cvParam cvRef="MS" accession="MS:1003089" name="truncation, delta prediction and zlib compression" value=""/>`,
+			`MS:1003089`},
+	} {
+		doc := strings.Replace(testMzML(1, -1), tt.old, tt.new, 1)
+		if doc == testMzML(1, -1) {
+			t.Fatalf("Test document doesn't contain %s", tt.old)
+		}
+		f, err := Read(strings.NewReader(doc))
+		if err != nil {
+			t.Fatalf("Read: error return %v", err)
+		}
+		_, err = f.ReadScan(0)
+		var encErr *UnsupportedEncodingError
+		if !errors.As(err, &encErr) || encErr.Accession != tt.accession {
+			t.Errorf("ReadScan %s: error return %v, should be UnsupportedEncodingError", tt.accession, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+// traverseParamGroups fills f.paramGroups with the CV params of
+// the referenceable param groups
+func (f *MzML) traverseParamGroups() {
+	f.paramGroups = make(map[string][]CVParam)
+	if f.content.ReferenceableParamGroupList == nil {
+		return
+	}
+	for _, g := range f.content.ReferenceableParamGroupList.ReferenceableParamGroup {
+		f.paramGroups[g.ID] = g.CvPar
+	}
+}
+
+// groupCvParams returns the CV params of the referenced param groups
+func (f *MzML) groupCvParams(refs []referenceableParamGroupRef) []CVParam {
+	var cvPar []CVParam
+	for _, ref := range refs {
+		cvPar = append(cvPar, f.paramGroups[ref.Ref]...)
+	}
+	return cvPar
+}
+
+// cvParams returns the CV params of an element, followed by the
+// CV params of the param groups that it references
+func cvParams(cvPar []CVParam, groupCvPar []CVParam) []CVParam {
+	if len(groupCvPar) == 0 {
+		return cvPar
+	}
+	all := make([]CVParam, 0, len(cvPar)+len(groupCvPar))
+	all = append(all, cvPar...)
+	return append(all, groupCvPar...)
+}
+
+// resolveSpectrum looks up the CV params of the param groups that
+// are referenced in a spectrum
+func (f *MzML) resolveSpectrum(spec *spectrum) {
+	spec.groupCvPar = f.groupCvParams(spec.ParamGroupRef)
+	for i := range spec.ScanList.Scan {
+		scan := &spec.ScanList.Scan[i]
+		scan.groupCvPar = f.groupCvParams(scan.ParamGroupRef)
+		for j := range scan.ScanWindowList.ScanWindow {
+			w := &scan.ScanWindowList.ScanWindow[j]
+			w.groupCvPar = f.groupCvParams(w.ParamGroupRef)
+		}
+	}
+	for i := range spec.PrecursorList {
+		for j := range spec.PrecursorList[i].Precursor {
+			f.resolvePrecursor(&spec.PrecursorList[i].Precursor[j])
+		}
+	}
+	f.resolveBinaryDataArrays(&spec.BinaryDataArrayList)
+}
+
+// resolveChromatogram looks up the CV params of the param groups that
+// are referenced in a chromatogram
+func (f *MzML) resolveChromatogram(c *chromatogram) {
+	c.groupCvPar = f.groupCvParams(c.ParamGroupRef)
+	for i := range c.Precursor {
+		f.resolvePrecursor(&c.Precursor[i])
+	}
+	for i := range c.Product {
+		w := &c.Product[i].IsolationWindow
+		w.groupCvPar = f.groupCvParams(w.ParamGroupRef)
+	}
+	f.resolveBinaryDataArrays(&c.BinaryDataArrayList)
+}
+
+func (f *MzML) resolvePrecursor(p *XMLprecursor) {
+	p.IsolationWindow.groupCvPar = f.groupCvParams(p.IsolationWindow.ParamGroupRef)
+	for i := range p.SelectedIonList.SelectedIon {
+		ion := &p.SelectedIonList.SelectedIon[i]
+		ion.groupCvPar = f.groupCvParams(ion.ParamGroupRef)
+	}
+	p.Activation.groupCvPar = f.groupCvParams(p.Activation.ParamGroupRef)
+}
+
+func (f *MzML) resolveBinaryDataArrays(l *binaryDataArrayList) {
+	for i := range l.BinaryDataArray {
+		b := &l.BinaryDataArray[i]
+		b.groupCvPar = f.groupCvParams(b.ParamGroupRef)
+	}
+}
+
+// expandParamGroups replaces the param group references of a binary
+// data array by the CV params of the groups, so that these can be modified
+func expandParamGroups(b *binaryDataArray) {
+	b.CvPar = cvParams(b.CvPar, b.groupCvPar)
+	b.ParamGroupRef = nil
+	b.groupCvPar = nil
+}
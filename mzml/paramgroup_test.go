@@ -0,0 +1,98 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"strings"
+	"testing"
+)
+
+// testParamGroupMzML returns a document in which the MS level of MS2 spectra
+// and the data type of binary arrays are specified in param groups
+func testParamGroupMzML() string {
+	doc := testMzML(3, 0)
+	doc = strings.Replace(doc, `    </fileDescription>
+`, `    </fileDescription>
+    <referenceableParamGroupList count="2">
+      <referenceableParamGroup id="MS2">
+        <cvParam cvRef="MS" accession="MS:1000511" name="ms level" value="2"/>
+        <cvParam cvRef="MS" accession="MS:1000127" name="centroid spectrum" value=""/>
+      </referenceableParamGroup>
+      <referenceableParamGroup id="f64">
+        <cvParam cvRef="MS" accession="MS:1000523" name="64-bit float" value=""/>
+      </referenceableParamGroup>
+    </referenceableParamGroupList>
+`, 1)
+	doc = strings.ReplaceAll(doc, `<cvParam cvRef="MS" accession="MS:1000511" name="ms level" value="2"/>
+          <scanList`, `<referenceableParamGroupRef ref="MS2"/>
+          <scanList`)
+	return strings.ReplaceAll(doc, `<cvParam cvRef="MS" accession="MS:1000523" name="64-bit float" value=""/>
+              <cvParam`, `<referenceableParamGroupRef ref="f64"/>
+              <cvParam`)
+}
+
+func TestParamGroups(t *testing.T) {
+	doc := testParamGroupMzML()
+	for _, indexed := range []bool{false, true} {
+		var f MzML
+		var err error
+		if indexed {
+			f, err = ReadIndexed(strings.NewReader(doc))
+		} else {
+			f, err = Read(strings.NewReader(doc))
+		}
+		if err != nil {
+			t.Fatalf("Read: error return %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			msLevel, err := f.MSLevel(i)
+			if err != nil || msLevel != 1+i {
+				t.Errorf("MSLevel(%d): %d (%v), should be %d", i, msLevel, err, 1+i)
+			}
+			centroid, err := f.Centroid(i)
+			if err != nil || centroid != (i == 1) {
+				t.Errorf("Centroid(%d): %v (%v)", i, centroid, err)
+			}
+			p, err := f.ReadScan(i)
+			if err != nil || len(p) != 2 || p[0].Mz != 100+float64(i) || p[1].Intens != 2000 {
+				t.Errorf("ReadScan(%d): %v (%v)", i, p, err)
+			}
+		}
+		cType, err := f.ChromatogramType(0)
+		if err != nil || cType != `MS:1000235` {
+			t.Errorf("ChromatogramType: %s (%v)", cType, err)
+		}
+		points, err := f.ReadChromatogram(0)
+		if err != nil || len(points) != 3 || points[2].Intens != 30 {
+			t.Errorf("ReadChromatogram: %v (%v)", points, err)
+		}
+
+		// Changing the compression must keep the data type from the param group
+		err = f.SetCompression(1, Zlib, Zlib)
+		if err != nil {
+			t.Fatalf("SetCompression: error return %v", err)
+		}
+		var sb strings.Builder
+		err = f.Write(&sb)
+		if err != nil {
+			t.Fatalf("Write: error return %v", err)
+		}
+		if !strings.Contains(sb.String(), `<referenceableParamGroup id="f64">`) ||
+			!strings.Contains(sb.String(), `<referenceableParamGroupRef ref="MS2">`) {
+			t.Errorf("Write: param groups missing")
+		}
+		f, err = Read(strings.NewReader(sb.String()))
+		if err != nil {
+			t.Fatalf("Read: error return %v", err)
+		}
+		msLevel, err := f.MSLevel(1)
+		if err != nil || msLevel != 2 {
+			t.Errorf("MSLevel after write: %d (%v), should be 2", msLevel, err)
+		}
+		p, err := f.ReadScan(1)
+		if err != nil || len(p) != 2 || p[0].Mz != 101 || p[1].Intens != 2000 {
+			t.Errorf("ReadScan after write: %v (%v)", p, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"math"
+	"strconv"
+)
+
+// Precursor contains the parsed info of a precursor of a spectrum.
+// Fields that are not present are NaN. Note that a ScanIndex of 0 refers
+// to the first spectrum, use NewPrecursor to create a Precursor in which
+// all values are unknown.
+type Precursor struct {
+	SpectrumRef string // Identifier of the precursor spectrum
+	// Index of the precursor spectrum, or -1 if the precursor spectrum
+	// is not in the file
+	ScanIndex       int
+	IsolationWindow IsolationWindow
+	SelectedIons    []SelectedIon
+	// CV terms of the dissociation methods, e.g. MS:1000422
+	// (beam-type collision-induced dissociation)
+	Activation                []string
+	CollisionEnergy           float64 // Collision energy in eV
+	NormalizedCollisionEnergy float64 // Normalized collision energy in percent
+}
+
+// SelectedIon contains the m/z, charge and intensity of a selected ion.
+// Charge is 0 if the charge state is unknown.
+type SelectedIon struct {
+	Mz              float64
+	Charge          int
+	PossibleCharges []int
+	Intensity       float64
+}
+
+// CV terms and names of dissociation methods
+var dissociationMethods = map[string]string{
+	"MS:1000133": "collision-induced dissociation",
+	"MS:1000134": "plasma desorption",
+	"MS:1000135": "post-source decay",
+	"MS:1000136": "surface-induced dissociation",
+	"MS:1000242": "blackbody infrared radiative dissociation",
+	"MS:1000250": "electron capture dissociation",
+	"MS:1000262": "infrared multiphoton dissociation",
+	"MS:1000282": "sustained off-resonance irradiation",
+	"MS:1000422": "beam-type collision-induced dissociation",
+	"MS:1000433": "low-energy collision-induced dissociation",
+	"MS:1000435": "photodissociation",
+	"MS:1000598": "electron transfer dissociation",
+	"MS:1000599": "pulsed q dissociation",
+	"MS:1001880": "in-source collision-induced dissociation",
+	"MS:1002000": "LIFT",
+	"MS:1002472": "trap-type collision-induced dissociation",
+	"MS:1002631": "Electron-Transfer/Higher-Energy Collision Dissociation (EThcD)",
+	"MS:1002678": "supplemental beam-type collision-induced dissociation",
+	"MS:1002679": "supplemental collision-induced dissociation",
+}
+
+// NewPrecursor returns a Precursor without precursor spectrum, isolation
+// window and collision energies
+func NewPrecursor() Precursor {
+	nan := math.NaN()
+	return Precursor{
+		ScanIndex:                 -1,
+		IsolationWindow:           IsolationWindow{TargetMz: nan, LowerOffset: nan, UpperOffset: nan},
+		CollisionEnergy:           nan,
+		NormalizedCollisionEnergy: nan,
+	}
+}
+
+// Precursors returns the precursors of a scan, with the CV terms parsed
+func (f *MzML) Precursors(scanIndex int) ([]Precursor, error) {
+	spec, err := f.spectrum(scanIndex)
+	if err != nil {
+		return nil, err
+	}
+	var precursors []Precursor
+	for _, precList := range spec.PrecursorList {
+		for i := range precList.Precursor {
+			p, err := f.parsePrecursor(&precList.Precursor[i])
+			if err != nil {
+				return nil, err
+			}
+			precursors = append(precursors, p)
+		}
+	}
+	return precursors, nil
+}
+
+func (f *MzML) parsePrecursor(xmlPrec *XMLprecursor) (Precursor, error) {
+	var err error
+	p := NewPrecursor()
+	p.SpectrumRef = xmlPrec.SpectrumRef
+	if index, ok := f.id2Index[xmlPrec.SpectrumRef]; ok && xmlPrec.SpectrumRef != `` {
+		p.ScanIndex = index
+	}
+	w := &xmlPrec.IsolationWindow
+	p.IsolationWindow, err = parseIsolationWindow(cvParams(w.CvPar, w.groupCvPar))
+	if err != nil {
+		return p, err
+	}
+	for _, ion := range xmlPrec.SelectedIonList.SelectedIon {
+		s, err := parseSelectedIon(cvParams(ion.CvPar, ion.groupCvPar))
+		if err != nil {
+			return p, err
+		}
+		p.SelectedIons = append(p.SelectedIons, s)
+	}
+	a := &xmlPrec.Activation
+	for _, cvParam := range cvParams(a.CvPar, a.groupCvPar) {
+		switch cvParam.Accession {
+		case "MS:1000045", "MS:1000509": // collision energy, activation energy
+			p.CollisionEnergy, err = strconv.ParseFloat(cvParam.Value, 64)
+		case "MS:1000138": // normalized collision energy
+			p.NormalizedCollisionEnergy, err = strconv.ParseFloat(cvParam.Value, 64)
+		default:
+			if _, ok := dissociationMethods[cvParam.Accession]; ok {
+				p.Activation = append(p.Activation, cvParam.Accession)
+			}
+		}
+		if err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+func parseSelectedIon(cvPar []CVParam) (SelectedIon, error) {
+	s := SelectedIon{Mz: math.NaN(), Intensity: math.NaN()}
+	for _, cvParam := range cvPar {
+		var err error
+		switch cvParam.Accession {
+		case "MS:1000744", "MS:1000040": // selected ion m/z, m/z (obsolete)
+			s.Mz, err = strconv.ParseFloat(cvParam.Value, 64)
+		case "MS:1000041": // charge state
+			s.Charge, err = strconv.Atoi(cvParam.Value)
+		case "MS:1000633": // possible charge state
+			var charge int
+			charge, err = strconv.Atoi(cvParam.Value)
+			s.PossibleCharges = append(s.PossibleCharges, charge)
+		case "MS:1000042": // peak intensity
+			s.Intensity, err = strconv.ParseFloat(cvParam.Value, 64)
+		}
+		if err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
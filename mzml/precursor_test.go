@@ -0,0 +1,80 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestPrecursors(t *testing.T) {
+	// Add a second selected ion and a second precursor to scan=2
+	doc := strings.Replace(testMzML(4, -1), `                </selectedIon>
+              </selectedIonList>`, `                </selectedIon>
+                <selectedIon>
+                  <cvParam cvRef="MS" accession="MS:1000744" name="selected ion m/z" value="334.0"/>
+                  <cvParam cvRef="MS" accession="MS:1000633" name="possible charge state" value="3"/>
+                  <cvParam cvRef="MS" accession="MS:1000633" name="possible charge state" value="4"/>
+                  <cvParam cvRef="MS" accession="MS:1000042" name="peak intensity" value="1234.5"/>
+                </selectedIon>
+              </selectedIonList>`, 1)
+	doc = strings.Replace(doc, `          </precursorList>`, `            <precursor spectrumRef="controllerType=0 controllerNumber=1 scan=99">
+              <activation>
+                <cvParam cvRef="MS" accession="MS:1000598" name="electron transfer dissociation" value=""/>
+                <cvParam cvRef="MS" accession="MS:1000138" name="normalized collision energy" value="25"/>
+              </activation>
+            </precursor>
+          </precursorList>`, 1)
+	for _, indexed := range []bool{false, true} {
+		var f MzML
+		var err error
+		if indexed {
+			f, err = ReadIndexed(strings.NewReader(doc))
+		} else {
+			f, err = Read(strings.NewReader(doc))
+		}
+		if err != nil {
+			t.Fatalf("Read: error return %v", err)
+		}
+		precs, err := f.Precursors(0)
+		if err != nil || len(precs) != 0 {
+			t.Errorf("Precursors(0): %v (%v), should be empty", precs, err)
+		}
+		precs, err = f.Precursors(1)
+		if err != nil {
+			t.Fatalf("Precursors: error return %v", err)
+		}
+		if len(precs) != 2 {
+			t.Fatalf("Precursors: %d precursors, should be 2", len(precs))
+		}
+		p := precs[0]
+		if p.SpectrumRef != `scan=1` || p.ScanIndex != 0 {
+			t.Errorf("Precursors: spectrum ref %s index %d, should be scan=1 index 0", p.SpectrumRef, p.ScanIndex)
+		}
+		if p.IsolationWindow.TargetMz != 501.5 || p.IsolationWindow.LowerOffset != 1 || p.IsolationWindow.UpperOffset != 1 {
+			t.Errorf("Precursors: isolation window %v", p.IsolationWindow)
+		}
+		if len(p.Activation) != 1 || p.Activation[0] != `MS:1000422` || p.CollisionEnergy != 30 ||
+			!math.IsNaN(p.NormalizedCollisionEnergy) {
+			t.Errorf("Precursors: activation %v energy %f %f", p.Activation, p.CollisionEnergy, p.NormalizedCollisionEnergy)
+		}
+		if len(p.SelectedIons) != 2 {
+			t.Fatalf("Precursors: %d selected ions, should be 2", len(p.SelectedIons))
+		}
+		ion := p.SelectedIons[0]
+		if ion.Mz != 501.5 || ion.Charge != 2 || !math.IsNaN(ion.Intensity) {
+			t.Errorf("Precursors: selected ion %v", ion)
+		}
+		ion = p.SelectedIons[1]
+		if ion.Mz != 334 || ion.Charge != 0 || len(ion.PossibleCharges) != 2 || ion.Intensity != 1234.5 {
+			t.Errorf("Precursors: selected ion %v", ion)
+		}
+		p = precs[1]
+		if p.ScanIndex != -1 || !math.IsNaN(p.IsolationWindow.TargetMz) || len(p.SelectedIons) != 0 ||
+			p.Activation[0] != `MS:1000598` || p.NormalizedCollisionEnergy != 25 || !math.IsNaN(p.CollisionEnergy) {
+			t.Errorf("Precursors: second precursor %v", p)
+		}
+	}
+}
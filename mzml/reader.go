@@ -11,7 +11,6 @@ import (
 	"encoding/xml"
 	"io"
 	"io/ioutil"
-	"log"
 	"math"
 	"strconv"
 
@@ -47,10 +46,19 @@ func Read(reader io.Reader) (MzML, error) {
 		}
 	}
 
+	mzML.traverseParamGroups()
+	mzML.traverseChromatograms()
 	err := mzML.traverseScan()
 	return mzML, err
 }
 
+// Children of MS:1000572 (binary data compression type) that can't be decoded
+var unsupportedCompression = map[string]bool{
+	`MS:1003089`: true, // truncation, delta prediction and zlib compression
+	`MS:1003090`: true, // truncation, linear prediction and zlib compression
+	`MS:1003091`: true, // truncation and zlib compression
+}
+
 // binaryDataPars decodes the CV terms in a mzML binarydata section
 //
 // CV Terms for binary data compression
@@ -62,21 +70,27 @@ func Read(reader io.Reader) (MzML, error) {
 // MS:1002746 MS-Numpress linear prediction compression followed by zlib compression
 // MS:1002747 MS-Numpress positive integer compression followed by zlib compression
 // MS:1002748 MS-Numpress short logged float compression followed by zlib compression
+// MS:1003089 truncation, delta prediction and zlib compression (not supported)
+// MS:1003090 truncation, linear prediction and zlib compression (not supported)
+// MS:1003091 truncation and zlib compression (not supported)
 //
 // CV Terms for binary data array types
 // MS:1000514 m/z array
 // MS:1000515 intensity array
 //
 // CV Terms for binary-data-type
+// MS:1000519 32-bit integer
 // MS:1000521 32-bit float
+// MS:1000522 64-bit integer
 // MS:1000523 64-bit float
 func binaryDataPars(binaryDataArray *binaryDataArray) (
-	bool, bool, bool, bool, error) {
+	Compression, DataType, bool, bool, error) {
 	zlibCompression := bool(false) // Default: no compression
-	bits64 := bool(false)          // Default: 32 bits
+	numpress := NoCompression
+	dataType := Float32 // Default: 32 bits float
 	mzArray := bool(false)
 	intensityArray := bool(false)
-	for _, cvParam := range binaryDataArray.CvPar {
+	for _, cvParam := range cvParams(binaryDataArray.CvPar, binaryDataArray.groupCvPar) {
 		switch cvParam.Accession {
 		case `MS:1000574`: // zlib compression
 			zlibCompression = true
@@ -84,68 +98,170 @@ func binaryDataPars(binaryDataArray *binaryDataArray) (
 			mzArray = true
 		case `MS:1000515`: // intensity array
 			intensityArray = true
-		case `MS:1000523`: // 64-bit float
-			bits64 = true
-		case `MS:1002312`, `MS:1002313`, `MS:1002314`,
-			`MS:1002746`, `MS:1002747`, `MS:1002748`:
-			// MS-Numpress compression types
-			log.Fatalf("Compression type not supported (CV term %s", cvParam.Accession)
+		case `MS:1000519`:
+			dataType = Int32
+		case `MS:1000521`:
+			dataType = Float32
+		case `MS:1000522`:
+			dataType = Int64
+		case `MS:1000523`:
+			dataType = Float64
+		case `MS:1002312`:
+			numpress = NumpressLinear
+		case `MS:1002313`:
+			numpress = NumpressPic
+		case `MS:1002314`:
+			numpress = NumpressSlof
+		case `MS:1002746`:
+			numpress = NumpressLinear
+			zlibCompression = true
+		case `MS:1002747`:
+			numpress = NumpressPic
+			zlibCompression = true
+		case `MS:1002748`:
+			numpress = NumpressSlof
+			zlibCompression = true
+		default:
+			if unsupportedCompression[cvParam.Accession] {
+				return NoCompression, dataType, false, false,
+					&UnsupportedEncodingError{Accession: cvParam.Accession}
+			}
+		}
+	}
+	return combineCompression(numpress, zlibCompression), dataType, mzArray, intensityArray, nil
+}
+
+// combineCompression returns the compression that results from applying
+// MS-Numpress compression numpress (or NoCompression), optionally followed by zlib
+func combineCompression(numpress Compression, zlibCompression bool) Compression {
+	if !zlibCompression {
+		return numpress
+	}
+	switch numpress {
+	case NumpressLinear:
+		return NumpressLinearZlib
+	case NumpressPic:
+		return NumpressPicZlib
+	case NumpressSlof:
+		return NumpressSlofZlib
+	}
+	return Zlib
+}
+
+// splitCompression is the inverse of combineCompression
+func splitCompression(c Compression) (Compression, bool) {
+	switch c {
+	case Zlib:
+		return NoCompression, true
+	case NumpressLinearZlib:
+		return NumpressLinear, true
+	case NumpressPicZlib:
+		return NumpressPic, true
+	case NumpressSlofZlib:
+		return NumpressSlof, true
+	}
+	return c, false
+}
+
+// inflateBinary returns the bytes of a binary data array after
+// base64 decoding and zlib decompression
+func inflateBinary(binaryDataArray *binaryDataArray, zlibCompression bool) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(binaryDataArray.Binary)
+	if err != nil {
+		return nil, err
+	}
+	if zlibCompression {
+		b := bytes.NewReader(data)
+		z, err := zlib.NewReader(b)
+		if err != nil {
+			return nil, err
+		}
+		defer z.Close()
+		d, err := ioutil.ReadAll(z)
+		if err != nil {
+			return nil, err
+		}
+		data = d
+	}
+	return data, nil
+}
+
+// decodeNumpress decodes MS-Numpress compressed data
+func decodeNumpress(data []byte, numpress Compression) ([]float64, error) {
+	switch numpress {
+	case NumpressLinear:
+		return numpressDecodeLinear(data)
+	case NumpressPic:
+		return numpressDecodePic(data)
+	}
+	return numpressDecodeSlof(data)
+}
+
+// decodeBinary decodes the values of a binary data array
+func decodeBinary(binaryDataArray *binaryDataArray, compression Compression,
+	dataType DataType) ([]float64, error) {
+	numpress, zlibCompression := splitCompression(compression)
+	data, err := inflateBinary(binaryDataArray, zlibCompression)
+	if err != nil {
+		return nil, err
+	}
+	if numpress != NoCompression {
+		return decodeNumpress(data, numpress)
+	}
+	var values []float64
+	switch dataType {
+	case Float64:
+		cnt := len(data) / 8
+		values = make([]float64, cnt)
+		for i := 0; i < cnt; i++ {
+			bits := binary.LittleEndian.Uint64(data[i*8:])
+			values[i] = math.Float64frombits(bits)
+		}
+	case Int64:
+		cnt := len(data) / 8
+		values = make([]float64, cnt)
+		for i := 0; i < cnt; i++ {
+			values[i] = float64(int64(binary.LittleEndian.Uint64(data[i*8:])))
+		}
+	case Int32:
+		cnt := len(data) / 4
+		values = make([]float64, cnt)
+		for i := 0; i < cnt; i++ {
+			values[i] = float64(int32(binary.LittleEndian.Uint32(data[i*4:])))
+		}
+	default:
+		cnt := len(data) / 4
+		values = make([]float64, cnt)
+		for i := 0; i < cnt; i++ {
+			bits := binary.LittleEndian.Uint32(data[i*4:])
+			values[i] = float64(math.Float32frombits(bits))
 		}
 	}
-	return zlibCompression, bits64, mzArray, intensityArray, nil
+	return values, nil
 }
 
 func fillScan(p []Peak, binaryDataArray *binaryDataArray) ([]Peak, error) {
-	zlibCompression, bits64, mzArray, intensityArray, _ :=
+	compression, dataType, mzArray, intensityArray, err :=
 		binaryDataPars(binaryDataArray)
+	if err != nil {
+		return nil, err
+	}
 	// We are only interrested in mz and intensity
 	if mzArray || intensityArray {
-		data, err := base64.StdEncoding.DecodeString(binaryDataArray.Binary)
+		values, err := decodeBinary(binaryDataArray, compression, dataType)
 		if err != nil {
 			return nil, err
 		}
-		if zlibCompression {
-			b := bytes.NewReader(data)
-			z, err := zlib.NewReader(b)
-			if err != nil {
-				return nil, err
-			}
-			defer z.Close()
-			d, err := ioutil.ReadAll(z)
-			if err != nil {
-				return nil, err
-			}
-			data = d
+		if len(values) > len(p) {
+			return nil, ErrInvalidArrayLength
 		}
-		if bits64 {
-			cnt := len(data) / 8
-			if mzArray {
-				for i := 0; i < cnt; i++ {
-					bits := binary.LittleEndian.Uint64(data[i*8:])
-					float := math.Float64frombits(bits)
-					p[i].Mz = float64(float)
-				}
-			} else {
-				for i := 0; i < cnt; i++ {
-					bits := binary.LittleEndian.Uint64(data[i*8:])
-					float := math.Float64frombits(bits)
-					p[i].Intens = float64(float)
-				}
+		if mzArray {
+			for i, v := range values {
+				p[i].Mz = v
 			}
 		} else {
-			cnt := len(data) / 4
-			if mzArray {
-				for i := 0; i < cnt; i++ {
-					bits := binary.LittleEndian.Uint32(data[i*4:])
-					float := math.Float32frombits(bits)
-					p[i].Mz = float64(float)
-				}
-			} else {
-				for i := 0; i < cnt; i++ {
-					bits := binary.LittleEndian.Uint32(data[i*4:])
-					float := math.Float32frombits(bits)
-					p[i].Intens = float64(float)
-				}
+			for i, v := range values {
+				p[i].Intens = v
 			}
 		}
 	}
@@ -154,16 +270,20 @@ func fillScan(p []Peak, binaryDataArray *binaryDataArray) ([]Peak, error) {
 
 // NumSpecs returns the number of spectra
 func (f *MzML) NumSpecs() int {
+	if f.reader != nil {
+		return len(f.specOffsets)
+	}
 	return len(f.content.Run.SpectrumList.Spectrum)
 }
 
 // RetentionTime returns the retention time of a spectrum
 func (f *MzML) RetentionTime(scanIndex int) (float64, error) {
-	if scanIndex < 0 || scanIndex >= f.NumSpecs() {
-		return 0.0, ErrInvalidScanIndex
+	spec, err := f.spectrum(scanIndex)
+	if err != nil {
+		return 0.0, err
 	}
-	for _, scan := range f.content.Run.SpectrumList.Spectrum[scanIndex].ScanList.Scan {
-		for _, cvParam := range scan.CvPar {
+	for _, scan := range spec.ScanList.Scan {
+		for _, cvParam := range cvParams(scan.CvPar, scan.groupCvPar) {
 			if cvParam.Accession == "MS:1000016" {
 				retentionTime, err := strconv.ParseFloat(cvParam.Value, 64)
 				// Check if the retention time is in minutes, otherwise assume it's seconds
@@ -182,11 +302,12 @@ func (f *MzML) RetentionTime(scanIndex int) (float64, error) {
 // IonInjectionTime returns the ion injection time of a spectrum in ms,
 // or NaN is not found
 func (f *MzML) IonInjectionTime(scanIndex int) (float64, error) {
-	if scanIndex < 0 || scanIndex >= f.NumSpecs() {
-		return 0.0, ErrInvalidScanIndex
+	spec, err := f.spectrum(scanIndex)
+	if err != nil {
+		return 0.0, err
 	}
-	for _, scan := range f.content.Run.SpectrumList.Spectrum[scanIndex].ScanList.Scan {
-		for _, cvParam := range scan.CvPar {
+	for _, scan := range spec.ScanList.Scan {
+		for _, cvParam := range cvParams(scan.CvPar, scan.groupCvPar) {
 			if cvParam.Accession == "MS:1000927" {
 				t, err := strconv.ParseFloat(cvParam.Value, 64)
 				// Check if the ion injection time is in miliseconds,
@@ -209,12 +330,12 @@ func (f *MzML) IonInjectionTime(scanIndex int) (float64, error) {
 // use ReadScan(f, ScanIndex(f, scanNum))
 func (f *MzML) ReadScan(scanIndex int) ([]Peak, error) {
 
-	if scanIndex < 0 || scanIndex >= f.NumSpecs() {
-		return nil, ErrInvalidScanIndex
+	spec, err := f.spectrum(scanIndex)
+	if err != nil {
+		return nil, err
 	}
-	p := make([]Peak, f.content.Run.SpectrumList.Spectrum[scanIndex].DefaultArrayLength)
-	var err error
-	for _, b := range f.content.Run.SpectrumList.Spectrum[scanIndex].BinaryDataArrayList.BinaryDataArray {
+	p := make([]Peak, spec.DefaultArrayLength)
+	for _, b := range spec.BinaryDataArrayList.BinaryDataArray {
 		p, err = fillScan(p, &b)
 		if err != nil {
 			return p, err
@@ -226,11 +347,12 @@ func (f *MzML) ReadScan(scanIndex int) ([]Peak, error) {
 
 // Centroid returns true if the spectrum contains centroid peaks
 func (f *MzML) Centroid(scanIndex int) (bool, error) {
-	if scanIndex < 0 || scanIndex >= f.NumSpecs() {
-		return false, ErrInvalidScanIndex
+	spec, err := f.spectrum(scanIndex)
+	if err != nil {
+		return false, err
 	}
 
-	for _, cvParam := range f.content.Run.SpectrumList.Spectrum[scanIndex].CvPar {
+	for _, cvParam := range cvParams(spec.CvPar, spec.groupCvPar) {
 		if cvParam.Accession == "MS:1000127" { // centroid spectrum
 			return true, nil
 		}
@@ -240,11 +362,12 @@ func (f *MzML) Centroid(scanIndex int) (bool, error) {
 
 // TotalIonCurrent returns the total ion current, or NaN if not found
 func (f *MzML) TotalIonCurrent(scanIndex int) (float64, error) {
-	if scanIndex < 0 || scanIndex >= f.NumSpecs() {
-		return 0.0, ErrInvalidScanIndex
+	spec, err := f.spectrum(scanIndex)
+	if err != nil {
+		return 0.0, err
 	}
 
-	for _, cvParam := range f.content.Run.SpectrumList.Spectrum[scanIndex].CvPar {
+	for _, cvParam := range cvParams(spec.CvPar, spec.groupCvPar) {
 		if cvParam.Accession == "MS:1000285" { // total ion current
 			tic, err := strconv.ParseFloat(cvParam.Value, 64)
 			return tic, err
@@ -255,11 +378,12 @@ func (f *MzML) TotalIonCurrent(scanIndex int) (float64, error) {
 
 // MSLevel returns the MS level of a scan
 func (f *MzML) MSLevel(scanIndex int) (int, error) {
-	if scanIndex < 0 || scanIndex >= f.NumSpecs() {
-		return 0, ErrInvalidScanIndex
+	spec, err := f.spectrum(scanIndex)
+	if err != nil {
+		return 0, err
 	}
 
-	for _, cvParam := range f.content.Run.SpectrumList.Spectrum[scanIndex].CvPar {
+	for _, cvParam := range cvParams(spec.CvPar, spec.groupCvPar) {
 		if cvParam.Accession == "MS:1000511" { // ms level
 			msLevel, err := strconv.ParseInt(cvParam.Value, 10, 32)
 			return int(msLevel), err
@@ -307,6 +431,7 @@ func (f *MzML) traverseScan() error {
 	err := error(nil)
 
 	for i := range f.content.Run.SpectrumList.Spectrum {
+		f.resolveSpectrum(&f.content.Run.SpectrumList.Spectrum[i])
 		err = f.addSpecToIndex(i)
 		if err != nil {
 			return err
@@ -345,12 +470,13 @@ func (f *MzML) ScanID(scanIndex int) (string, error) {
 
 // GetPrecursors returns the mzML precursors struct for a given scanIndex
 func (f *MzML) GetPrecursors(scanIndex int) ([]XMLprecursor, error) {
-	if scanIndex >= 0 && scanIndex < f.NumSpecs() {
-		var p []XMLprecursor
-		if f.content.Run.SpectrumList.Spectrum[scanIndex].PrecursorList != nil {
-			p = f.content.Run.SpectrumList.Spectrum[scanIndex].PrecursorList[0].Precursor
-		}
-		return p, nil
+	spec, err := f.spectrum(scanIndex)
+	if err != nil {
+		return nil, err
+	}
+	var p []XMLprecursor
+	if spec.PrecursorList != nil {
+		p = spec.PrecursorList[0].Precursor
 	}
-	return nil, ErrInvalidScanIndex
+	return p, nil
 }
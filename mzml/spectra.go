@@ -0,0 +1,68 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"math"
+
+	"github.com/524D/galms/spectra"
+)
+
+// spectrumSource makes an MzML usable as spectra.Source
+type spectrumSource struct {
+	f *MzML
+}
+
+// Spectra returns an iterator over the spectra that match filter
+func (f *MzML) Spectra(filter spectra.Filter) *spectra.Iterator {
+	return spectra.NewIterator(spectrumSource{f: f}, filter)
+}
+
+func (s spectrumSource) NumSpecs() int {
+	return s.f.NumSpecs()
+}
+
+func (s spectrumSource) SpectrumHeader(scanIndex int) (spectra.Spectrum, error) {
+	var spec spectra.Spectrum
+	info, err := s.f.SpectrumInfo(scanIndex)
+	if err != nil {
+		return spec, err
+	}
+	spec.Index = scanIndex
+	spec.ID, err = s.f.ScanID(scanIndex)
+	if err != nil {
+		return spec, err
+	}
+	spec.MSLevel = info.MSLevel
+	spec.RetentionTime = info.RetentionTime
+	spec.Centroid = info.Centroid
+	spec.Polarity = info.Polarity
+	precursors, err := s.f.Precursors(scanIndex)
+	if err != nil {
+		return spec, err
+	}
+	for _, p := range precursors {
+		if len(p.SelectedIons) == 0 {
+			// Use the isolation window if no ion was selected
+			spec.Precursors = append(spec.Precursors, spectra.Precursor{
+				Mz:        p.IsolationWindow.TargetMz,
+				Intensity: math.NaN(),
+				ScanIndex: p.ScanIndex,
+			})
+		}
+		for _, ion := range p.SelectedIons {
+			spec.Precursors = append(spec.Precursors, spectra.Precursor{
+				Mz:        ion.Mz,
+				Charge:    ion.Charge,
+				Intensity: ion.Intensity,
+				ScanIndex: p.ScanIndex,
+			})
+		}
+	}
+	return spec, nil
+}
+
+func (s spectrumSource) ReadPeaks(scanIndex int) ([]spectra.Peak, error) {
+	return s.f.ReadScan(scanIndex)
+}
@@ -0,0 +1,38 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/524D/galms/spectra"
+)
+
+func TestSpectra(t *testing.T) {
+	f, err := ReadIndexed(strings.NewReader(testMzML(6, 0)))
+	if err != nil {
+		t.Fatalf("ReadIndexed: error return %v", err)
+	}
+	it := f.Spectra(spectra.Filter{MSLevels: []int{2}, MinRT: 100, MinPrecursorMz: 500, MaxPrecursorMz: 510})
+	var ids []string
+	for it.Next() {
+		s := it.Spectrum()
+		ids = append(ids, s.ID)
+		if s.MSLevel != 2 || s.RetentionTime != 60*float64(s.Index) || len(s.Peaks) != 2 ||
+			s.Peaks[0].Mz != 100+float64(s.Index) {
+			t.Errorf("Spectrum %d: %+v", s.Index, s)
+		}
+		if len(s.Precursors) != 1 || s.Precursors[0].Mz != 500.5+float64(s.Index) ||
+			s.Precursors[0].Charge != 2 || s.Precursors[0].ScanIndex != s.Index-1 {
+			t.Errorf("Spectrum %d: precursors %+v", s.Index, s.Precursors)
+		}
+	}
+	if it.Err() != nil {
+		t.Fatalf("Spectra: error %v", it.Err())
+	}
+	if strings.Join(ids, ",") != `scan=4,scan=6` {
+		t.Errorf("Spectra: %v, should be scan=4,scan=6", ids)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/524D/galms/spectra"
+)
+
+// Polarity is the polarity of a scan
+type Polarity = spectra.Polarity
+
+// Scan polarities
+const (
+	UnknownPolarity = spectra.UnknownPolarity
+	Positive        = spectra.Positive
+	Negative        = spectra.Negative
+)
+
+// ScanWindow contains the m/z limits of a scan window
+type ScanWindow struct {
+	LowerLimit float64
+	UpperLimit float64
+}
+
+// SpectrumInfo contains metadata of a spectrum.
+// Values that are not present are NaN.
+type SpectrumInfo struct {
+	MSLevel          int
+	RetentionTime    float64 // Retention time in seconds
+	Centroid         bool
+	Polarity         Polarity
+	FilterString     string
+	TotalIonCurrent  float64
+	BasePeakMz       float64
+	BasePeakIntens   float64
+	LowestMz         float64
+	HighestMz        float64
+	IonInjectionTime float64 // Ion injection time in ms
+	ScanWindows      []ScanWindow
+}
+
+// SpectrumInfo returns the metadata of a spectrum
+func (f *MzML) SpectrumInfo(scanIndex int) (SpectrumInfo, error) {
+	info := SpectrumInfo{
+		MSLevel:          1,
+		RetentionTime:    math.NaN(),
+		TotalIonCurrent:  math.NaN(),
+		BasePeakMz:       math.NaN(),
+		BasePeakIntens:   math.NaN(),
+		LowestMz:         math.NaN(),
+		HighestMz:        math.NaN(),
+		IonInjectionTime: math.NaN(),
+	}
+	spec, err := f.spectrum(scanIndex)
+	if err != nil {
+		return info, err
+	}
+	err = info.parseCvParams(cvParams(spec.CvPar, spec.groupCvPar))
+	if err != nil {
+		return info, err
+	}
+	for _, scan := range spec.ScanList.Scan {
+		err = info.parseCvParams(cvParams(scan.CvPar, scan.groupCvPar))
+		if err != nil {
+			return info, err
+		}
+		for _, w := range scan.ScanWindowList.ScanWindow {
+			var scanWindow ScanWindow
+			cvPar := cvParams(w.CvPar, w.groupCvPar)
+			scanWindow.LowerLimit, err = cvFloat(cvPar, "MS:1000501") // scan window lower limit
+			if err != nil {
+				return info, err
+			}
+			scanWindow.UpperLimit, err = cvFloat(cvPar, "MS:1000500") // scan window upper limit
+			if err != nil {
+				return info, err
+			}
+			info.ScanWindows = append(info.ScanWindows, scanWindow)
+		}
+	}
+	return info, nil
+}
+
+// parseCvParams fills the fields of info for which a CV param is present.
+// Spectrum and scan CV params are parsed by the same function, because
+// some of the terms (e.g. polarity) are used in both.
+func (info *SpectrumInfo) parseCvParams(cvPar []CVParam) error {
+	var err error
+	for _, cvParam := range cvPar {
+		switch cvParam.Accession {
+		case "MS:1000511": // ms level
+			info.MSLevel, err = strconv.Atoi(cvParam.Value)
+		case "MS:1000016": // scan start time
+			info.RetentionTime, err = strconv.ParseFloat(cvParam.Value, 64)
+			// Check if the retention time is in minutes, otherwise assume it's seconds
+			if cvParam.UnitAccession == "UO:0000031" ||
+				cvParam.UnitAccession == "MS:1000038" {
+				info.RetentionTime *= 60
+			}
+		case "MS:1000127": // centroid spectrum
+			info.Centroid = true
+		case "MS:1000130": // positive scan
+			info.Polarity = Positive
+		case "MS:1000129": // negative scan
+			info.Polarity = Negative
+		case "MS:1000512": // filter string
+			info.FilterString = cvParam.Value
+		case "MS:1000285": // total ion current
+			info.TotalIonCurrent, err = strconv.ParseFloat(cvParam.Value, 64)
+		case "MS:1000504": // base peak m/z
+			info.BasePeakMz, err = strconv.ParseFloat(cvParam.Value, 64)
+		case "MS:1000505": // base peak intensity
+			info.BasePeakIntens, err = strconv.ParseFloat(cvParam.Value, 64)
+		case "MS:1000528": // lowest observed m/z
+			info.LowestMz, err = strconv.ParseFloat(cvParam.Value, 64)
+		case "MS:1000527": // highest observed m/z
+			info.HighestMz, err = strconv.ParseFloat(cvParam.Value, 64)
+		case "MS:1000927": // ion injection time
+			info.IonInjectionTime, err = strconv.ParseFloat(cvParam.Value, 64)
+			// Convert seconds to milliseconds, otherwise assume it's milliseconds
+			if cvParam.UnitAccession == "UO:0000010" {
+				info.IonInjectionTime *= 1000
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzml
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSpectrumInfo(t *testing.T) {
+	doc := strings.Replace(testMzML(2, -1), `<cvParam cvRef="MS" accession="MS:1000511" name="ms level" value="1"/>`,
+		`<cvParam cvRef="MS" accession="MS:1000511" name="ms level" value="1"/>
+          <cvParam cvRef="MS" accession="MS:1000130" name="positive scan" value=""/>
+          <cvParam cvRef="MS" accession="MS:1000127" name="centroid spectrum" value=""/>
+          <cvParam cvRef="MS" accession="MS:1000504" name="base peak m/z" value="200" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+          <cvParam cvRef="MS" accession="MS:1000505" name="base peak intensity" value="2000" unitCvRef="MS" unitAccession="MS:1000131" unitName="number of detector counts"/>
+          <cvParam cvRef="MS" accession="MS:1000528" name="lowest observed m/z" value="100" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+          <cvParam cvRef="MS" accession="MS:1000527" name="highest observed m/z" value="200" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>`, 1)
+	doc = strings.Replace(doc, `            </scan>`, `              <cvParam cvRef="MS" accession="MS:1000512" name="filter string" value="FTMS + p NSI Full ms [350.0000-1800.0000]"/>
+              <cvParam cvRef="MS" accession="MS:1000927" name="ion injection time" value="0.05" unitCvRef="UO" unitAccession="UO:0000010" unitName="second"/>
+              <scanWindowList count="1">
+                <scanWindow>
+                  <cvParam cvRef="MS" accession="MS:1000501" name="scan window lower limit" value="350" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+                  <cvParam cvRef="MS" accession="MS:1000500" name="scan window upper limit" value="1800" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+                </scanWindow>
+              </scanWindowList>
+            </scan>`, 1)
+	f, err := Read(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	for pass := 0; pass < 2; pass++ {
+		info, err := f.SpectrumInfo(0)
+		if err != nil {
+			t.Fatalf("SpectrumInfo: error return %v", err)
+		}
+		if info.MSLevel != 1 || info.RetentionTime != 0 || !info.Centroid || info.Polarity != Positive ||
+			info.FilterString != `FTMS + p NSI Full ms [350.0000-1800.0000]` ||
+			info.BasePeakMz != 200 || info.BasePeakIntens != 2000 || info.LowestMz != 100 || info.HighestMz != 200 ||
+			math.Abs(info.IonInjectionTime-50) > 1e-9 || !math.IsNaN(info.TotalIonCurrent) {
+			t.Errorf("SpectrumInfo(0): %+v", info)
+		}
+		if len(info.ScanWindows) != 1 || info.ScanWindows[0] != (ScanWindow{LowerLimit: 350, UpperLimit: 1800}) {
+			t.Errorf("SpectrumInfo(0): scan windows %v", info.ScanWindows)
+		}
+		info, err = f.SpectrumInfo(1)
+		if err != nil || info.MSLevel != 2 || info.RetentionTime != 60 || info.Polarity != UnknownPolarity ||
+			!math.IsNaN(info.BasePeakMz) || len(info.ScanWindows) != 0 {
+			t.Errorf("SpectrumInfo(1): %+v (%v)", info, err)
+		}
+
+		// Scan windows must survive writing, empty lists must not be written
+		var sb strings.Builder
+		err = f.Write(&sb)
+		if err != nil {
+			t.Fatalf("Write: error return %v", err)
+		}
+		if strings.Count(sb.String(), `<scanWindowList`) != 1 {
+			t.Errorf("Write: %d scan window lists, should be 1", strings.Count(sb.String(), `<scanWindowList`))
+		}
+		f, err = Read(strings.NewReader(sb.String()))
+		if err != nil {
+			t.Fatalf("Read: error return %v", err)
+		}
+	}
+}
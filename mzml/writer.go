@@ -6,64 +6,270 @@ package mzml
 import (
 	"bytes"
 	"compress/zlib"
+	"crypto/sha1"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/xml"
 	"io"
 	"math"
+	"strconv"
 )
 
+const (
+	mzMLNamespace      = "http://psi.hupo.org/ms/mzml"
+	xsiNamespace       = "http://www.w3.org/2001/XMLSchema-instance"
+	mzMLSchemaLocation = "http://psi.hupo.org/ms/mzml http://psidev.info/files/ms/mzML/xsd/mzML1.1.0.xsd"
+	idxSchemaLocation  = "http://psi.hupo.org/ms/mzml http://psidev.info/files/ms/mzML/xsd/mzML1.1.2_idx.xsd"
+)
+
+// Write writes the mzML file (without index) to an io.Writer
 func (f *MzML) Write(writer io.Writer) error {
-	writer.Write(([]byte)(
-		`<?xml version="1.0" encoding="utf-8"?>
-`))
-	enc := xml.NewEncoder(writer)
-	// FIXME: We want readable XML, with XML tags starting on a new line.
-	// GO's Encode doesn't always insert newlines, and using
-	// Indent only works if the indent string is not empty,
-	// resuling in a single space indent.
-	enc.Indent(` `, `  `)
-	var content mzMLContentWrite
-
-	content.XMLName = f.content.XMLName
-	content.Sl1 = "http://psi.hupo.org/ms/mzml http://psidev.info/files/ms/mzML/xsd/mzML1.1.0.xsd"
-	content.Version = "1.1.0"
-	content.Sl2 = "http://www.w3.org/2001/XMLSchema-instance"
-	content.CvList = f.content.CvList
-	content.FileDescription = f.content.FileDescription
-	content.ReferenceableParamGroupList = f.content.ReferenceableParamGroupList
-	content.SoftwareList = f.content.SoftwareList
-	content.InstrumentConfigurationList = f.content.InstrumentConfigurationList
-	content.DataProcessingList = f.content.DataProcessingList
-	content.Run = f.content.Run
-
-	err := enc.Encode(&content)
+	w := mzMLWriter{w: writer}
+	w.str("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n")
+	f.writeMzML(&w, ``)
+	return w.err
+}
+
+// WriteIndexed writes the mzML file as indexedmzML to an io.Writer.
+// The index contains the offsets of all spectra and chromatograms,
+// and the file is closed with a SHA-1 checksum as defined in the
+// mzML 1.1 specification.
+func (f *MzML) WriteIndexed(writer io.Writer) error {
+	h := sha1.New()
+	w := mzMLWriter{w: io.MultiWriter(writer, h)}
+	w.str("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n")
+	w.str(startTag("indexedmzML", "xmlns", mzMLNamespace, "xmlns:xsi", xsiNamespace,
+		"xsi:schemaLocation", idxSchemaLocation) + "\n")
+	f.writeMzML(&w, `  `)
+
+	count := 1
+	if len(w.chromOffsets) > 0 {
+		count++
+	}
+	w.str("  ")
+	indexListOffset := w.offset
+	w.str(startTag("indexList", "count", strconv.Itoa(count)) + "\n")
+	w.writeIndex("spectrum", w.specIDs, w.specOffsets)
+	if len(w.chromOffsets) > 0 {
+		w.writeIndex("chromatogram", w.chromIDs, w.chromOffsets)
+	}
+	w.str("  </indexList>\n")
+	w.str("  <indexListOffset>" + strconv.FormatInt(indexListOffset, 10) + "</indexListOffset>\n")
+	// The checksum covers everything up to and including the <fileChecksum> tag
+	w.str("  <fileChecksum>")
+	if w.err != nil {
+		return w.err
+	}
+	_, err := io.WriteString(writer, hex.EncodeToString(h.Sum(nil))+"</fileChecksum>\n</indexedmzML>\n")
 	return err
 }
 
+// mzMLWriter writes XML and keeps track of the offsets of
+// spectra and chromatograms
+type mzMLWriter struct {
+	w            io.Writer
+	offset       int64
+	err          error
+	specIDs      []string
+	specOffsets  []int64
+	chromIDs     []string
+	chromOffsets []int64
+}
+
+func (w *mzMLWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	w.err = err
+	return n, err
+}
+
+func (w *mzMLWriter) str(s string) {
+	io.WriteString(w, s)
+}
+
+// element writes v as XML element with the given name, indented by prefix.
+// The offset of the start tag is returned.
+func (w *mzMLWriter) element(prefix string, name string, v interface{}) int64 {
+	var b bytes.Buffer
+	enc := xml.NewEncoder(&b)
+	enc.Indent(prefix, `  `)
+	err := enc.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}})
+	if err != nil {
+		if w.err == nil {
+			w.err = err
+		}
+		return 0
+	}
+	b.WriteByte('\n')
+	offset := w.offset + int64(len(prefix))
+	w.Write(b.Bytes())
+	return offset
+}
+
+func (w *mzMLWriter) writeIndex(name string, ids []string, offsets []int64) {
+	w.str("    " + startTag("index", "name", name) + "\n")
+	for i, id := range ids {
+		w.str("      " + startTag("offset", "idRef", id) + strconv.FormatInt(offsets[i], 10) + "</offset>\n")
+	}
+	w.str("    </index>\n")
+}
+
+// startTag returns an XML start tag, attrs contains attribute name/value pairs
+func startTag(name string, attrs ...string) string {
+	var b bytes.Buffer
+	b.WriteString("<" + name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		b.WriteString(" " + attrs[i] + "=\"")
+		xml.EscapeText(&b, []byte(attrs[i+1]))
+		b.WriteString("\"")
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// writeMzML writes the <mzML> element, indented by prefix
+func (f *MzML) writeMzML(w *mzMLWriter, prefix string) {
+	c := &f.content
+	w.str(prefix + startTag("mzML", "xmlns", mzMLNamespace, "xmlns:xsi", xsiNamespace,
+		"xsi:schemaLocation", mzMLSchemaLocation, "version", "1.1.0") + "\n")
+	p := prefix + `  `
+	w.element(p, "cvList", &c.CvList)
+	desc := c.FileDescription
+	if desc.FileDescriptionXML == `` {
+		// fileContent is required
+		var err error
+		desc.FileDescriptionXML, err = fileDescriptionXML(f.defaultFileContent(), nil)
+		if err != nil && w.err == nil {
+			w.err = err
+		}
+	}
+	w.element(p, "fileDescription", &desc)
+	if c.ReferenceableParamGroupList != nil {
+		w.element(p, "referenceableParamGroupList", c.ReferenceableParamGroupList)
+	}
+	if c.SoftwareList != nil {
+		w.element(p, "softwareList", c.SoftwareList)
+	}
+	if c.InstrumentConfigurationList != nil {
+		w.element(p, "instrumentConfigurationList", c.InstrumentConfigurationList)
+	}
+	if c.DataProcessingList != nil {
+		w.element(p, "dataProcessingList", c.DataProcessingList)
+	}
+
+	w.str(p + startTag("run", nonEmptyAttrs(
+		"id", c.Run.ID,
+		"defaultInstrumentConfigurationRef", c.Run.DefaultInstrumentConfigurationRef,
+		"startTimeStamp", c.Run.StartTimeStamp,
+		"defaultSourceFileRef", c.Run.DefaultSourceFileRef)...) + "\n")
+	p += `  `
+	w.str(p + startTag("spectrumList", nonEmptyAttrs(
+		"count", strconv.Itoa(f.NumSpecs()),
+		"defaultDataProcessingRef", c.Run.SpectrumList.DefaultDataProcessingRef)...) + "\n")
+	for i := 0; i < f.NumSpecs(); i++ {
+		spec, err := f.spectrum(i)
+		if err != nil {
+			w.err = err
+			return
+		}
+		w.specIDs = append(w.specIDs, spec.ID)
+		w.specOffsets = append(w.specOffsets, w.element(p+`  `, "spectrum", spec))
+	}
+	w.str(p + "</spectrumList>\n")
+	f.writeChromatogramList(w, p)
+	w.str(prefix + "  </run>\n")
+	w.str(prefix + "</mzML>\n")
+}
+
+// writeChromatogramList writes the chromatogram list, indented by prefix
+func (f *MzML) writeChromatogramList(w *mzMLWriter, prefix string) {
+	cl := &f.content.Run.ChromatogramList
+	if len(cl.Chromatogram) == 0 {
+		return
+	}
+	w.str(prefix + startTag("chromatogramList", nonEmptyAttrs(
+		"count", strconv.Itoa(len(cl.Chromatogram)),
+		"defaultDataProcessingRef", cl.DefaultDataProcessingRef)...) + "\n")
+	for i := range cl.Chromatogram {
+		w.chromIDs = append(w.chromIDs, cl.Chromatogram[i].ID)
+		w.chromOffsets = append(w.chromOffsets, w.element(prefix+`  `, "chromatogram", &cl.Chromatogram[i]))
+	}
+	w.str(prefix + "</chromatogramList>\n")
+}
+
+// nonEmptyAttrs removes attribute name/value pairs with an empty value
+func nonEmptyAttrs(attrs ...string) []string {
+	res := make([]string, 0, len(attrs))
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] != `` {
+			res = append(res, attrs[i], attrs[i+1])
+		}
+	}
+	return res
+}
+
 // AppendSoftwareInfo adds info to the SoftwareList tag of the mzML file
 func (f *MzML) AppendSoftwareInfo(id string, version string) error {
 	var sw software
 
 	sw.ID = id
 	sw.Version = version
+	if f.content.SoftwareList == nil {
+		f.content.SoftwareList = &softwareList{}
+	}
 	f.content.SoftwareList.Count++
 	f.content.SoftwareList.Software = append(f.content.SoftwareList.Software, sw)
 	return nil
 }
 
-// AppendDataProcessing adds info to the DataProcessing tag of the mzML file
+// AppendDataProcessing adds info to the DataProcessing tag of the mzML file.
+// The first data processing becomes the default for spectra and chromatograms.
 func (f *MzML) AppendDataProcessing(proc DataProcessing) error {
+	if f.content.DataProcessingList == nil {
+		f.content.DataProcessingList = &dataProcessingList{}
+	}
+	if f.content.Run.SpectrumList.DefaultDataProcessingRef == `` {
+		f.content.Run.SpectrumList.DefaultDataProcessingRef = proc.ID
+	}
+	if f.content.Run.ChromatogramList.DefaultDataProcessingRef == `` {
+		f.content.Run.ChromatogramList.DefaultDataProcessingRef = proc.ID
+	}
 	f.content.DataProcessingList.Count++
 	f.content.DataProcessingList.DataProcessingd = append(f.content.DataProcessingList.DataProcessingd, proc)
 	return nil
 }
 
-// UpdateScan sets the mz/intensity info of a scan
+// updatedSpectrum returns the spectrum with the given index for modification
+func (f *MzML) updatedSpectrum(scanIndex int) (*spectrum, error) {
+	spec, err := f.spectrum(scanIndex)
+	if err != nil {
+		return nil, err
+	}
+	if f.reader != nil {
+		// Keep the modified spectrum, it can't be written back to file
+		if f.updated == nil {
+			f.updated = make(map[int]*spectrum)
+		}
+		f.updated[scanIndex] = spec
+	}
+	return spec, nil
+}
+
+// UpdateScan sets the mz/intensity info of a scan.
+// Other binary data arrays (e.g. ion mobility) follow the peaks: the
+// value of each new peak is taken from the old peak with the same m/z.
+// If the scan has such arrays and a new peak has an m/z that isn't in
+// the scan, ErrUnmatchedPeaks is returned and the scan is not changed;
+// use UpdateArrays to set or remove the other arrays first.
 func (f *MzML) UpdateScan(scanIndex int, p []Peak,
 	updateMz bool, updateIntens bool) error {
-	if scanIndex < 0 || scanIndex >= f.NumSpecs() {
-		return ErrInvalidScanIndex
+	spec, err := f.updatedSpectrum(scanIndex)
+	if err != nil {
+		return err
 	}
 	// Workaround for msConvert:
 	// Insert a dummy peak if there is none, otherwise msConvert generates an error
@@ -72,63 +278,187 @@ func (f *MzML) UpdateScan(scanIndex int, p []Peak,
 		p = append(p, peak)
 	}
 
-	f.content.Run.SpectrumList.Spectrum[scanIndex].DefaultArrayLength = int64(len(p))
-	for i := range f.content.Run.SpectrumList.Spectrum[scanIndex].BinaryDataArrayList.BinaryDataArray {
-		zlibCompression, bits64, mzArray, intensityArray, err :=
-			binaryDataPars(&f.content.Run.SpectrumList.Spectrum[scanIndex].BinaryDataArrayList.BinaryDataArray[i])
+	// Other arrays must be reordered if the m/z values or the number of peaks change
+	var indices []int
+	if (updateMz || spec.DefaultArrayLength != int64(len(p))) && hasOtherArrays(spec) {
+		indices, err = matchPeaks(spec, p)
+		if err != nil {
+			return err
+		}
+		if indices == nil {
+			return ErrUnmatchedPeaks
+		}
+	}
+	spec.DefaultArrayLength = int64(len(p))
+	arrays := spec.BinaryDataArrayList.BinaryDataArray[:0]
+	for i := range spec.BinaryDataArrayList.BinaryDataArray {
+		b := spec.BinaryDataArrayList.BinaryDataArray[i]
+		compression, dataType, mzArray, intensityArray, err :=
+			binaryDataPars(&b)
 		if err != nil {
 			return err
 		}
-		// We are only interested in mz and intensity
 		if (mzArray && updateMz) || (intensityArray && updateIntens) {
-
-			b64, err := encodeBinary(p, zlibCompression, bits64, mzArray)
+			values := make([]float64, len(p))
+			if mzArray {
+				for j, peak := range p {
+					values[j] = peak.Mz
+				}
+			} else {
+				for j, peak := range p {
+					values[j] = peak.Intens
+				}
+			}
+			err = setBinary(&b, values, compression, dataType)
 			if err != nil {
 				return err
 			}
-			f.content.Run.SpectrumList.Spectrum[scanIndex].BinaryDataArrayList.BinaryDataArray[i].Binary = b64
-			f.content.Run.SpectrumList.Spectrum[scanIndex].BinaryDataArrayList.BinaryDataArray[i].ArrayLength = len(p)
-			f.content.Run.SpectrumList.Spectrum[scanIndex].BinaryDataArrayList.BinaryDataArray[i].EncodedLength = len(b64)
+		} else if !mzArray && !intensityArray && indices != nil {
+			a, err := decodeArray(&b)
+			if err != nil {
+				return err
+			}
+			a = a.selected(indices)
+			err = encodeArray(&b, &a, compression)
+			if err != nil {
+				return err
+			}
+		}
+		arrays = append(arrays, b)
+	}
+	spec.BinaryDataArrayList.BinaryDataArray = arrays
+	spec.BinaryDataArrayList.Count = len(arrays)
+	return nil
+}
+
+// SetCompression changes the compression of the m/z and intensity
+// arrays of a scan. Note that MS-Numpress compression is lossy.
+func (f *MzML) SetCompression(scanIndex int, mzCompression Compression,
+	intensCompression Compression) error {
+	spec, err := f.updatedSpectrum(scanIndex)
+	if err != nil {
+		return err
+	}
+	for i := range spec.BinaryDataArrayList.BinaryDataArray {
+		b := &spec.BinaryDataArrayList.BinaryDataArray[i]
+		compression, dataType, mzArray, intensityArray, err := binaryDataPars(b)
+		if err != nil {
+			return err
+		}
+		newCompression := compression
+		if mzArray {
+			newCompression = mzCompression
+		} else if intensityArray {
+			newCompression = intensCompression
+		}
+		if newCompression == compression {
+			continue
+		}
+		values, err := decodeBinary(b, compression, dataType)
+		if err != nil {
+			return err
+		}
+		err = setBinary(b, values, newCompression, dataType)
+		if err != nil {
+			return err
+		}
+		setCompressionCvParams(b, newCompression)
+	}
+	return nil
+}
+
+// CV terms that describe the compression of binary data arrays
+var compressionCvParams = map[Compression]CVParam{
+	NoCompression:      {CvRef: `MS`, Accession: `MS:1000576`, Name: `no compression`},
+	Zlib:               {CvRef: `MS`, Accession: `MS:1000574`, Name: `zlib compression`},
+	NumpressLinear:     {CvRef: `MS`, Accession: `MS:1002312`, Name: `MS-Numpress linear prediction compression`},
+	NumpressPic:        {CvRef: `MS`, Accession: `MS:1002313`, Name: `MS-Numpress positive integer compression`},
+	NumpressSlof:       {CvRef: `MS`, Accession: `MS:1002314`, Name: `MS-Numpress short logged float compression`},
+	NumpressLinearZlib: {CvRef: `MS`, Accession: `MS:1002746`, Name: `MS-Numpress linear prediction compression followed by zlib compression`},
+	NumpressPicZlib:    {CvRef: `MS`, Accession: `MS:1002747`, Name: `MS-Numpress positive integer compression followed by zlib compression`},
+	NumpressSlofZlib:   {CvRef: `MS`, Accession: `MS:1002748`, Name: `MS-Numpress short logged float compression followed by zlib compression`},
+}
+
+// setCompressionCvParams replaces the compression CV terms of a binary data array
+func setCompressionCvParams(b *binaryDataArray, compression Compression) {
+	expandParamGroups(b)
+	cvPar := make([]CVParam, 0, len(b.CvPar))
+	for _, cv := range b.CvPar {
+		switch cv.Accession {
+		case `MS:1000574`, `MS:1000576`, `MS:1002312`, `MS:1002313`, `MS:1002314`,
+			`MS:1002746`, `MS:1002747`, `MS:1002748`:
+			// Remove
+		default:
+			cvPar = append(cvPar, cv)
 		}
 	}
+	b.CvPar = append(cvPar, compressionCvParams[compression])
+}
+
+// setBinary stores values in a binary data array
+func setBinary(b *binaryDataArray, values []float64, compression Compression,
+	dataType DataType) error {
+	b64, err := encodeBinary(values, compression, dataType)
+	if err != nil {
+		return err
+	}
+	b.Binary = b64
+	b.ArrayLength = len(values)
+	b.EncodedLength = len(b64)
 	return nil
 }
 
-func encodeBinary(p []Peak, zlibCompression bool, bits64 bool, mzArray bool) (
+func encodeBinary(values []float64, compression Compression, dataType DataType) (
 	string, error) {
 
-	var data []byte
 	var rawUncompressed []byte
+	var err error
 
-	// Some code duplication below in order to optimize loops
-	if bits64 {
-		// Allocate room for uncompressed binary data
-		rawUncompressed = make([]byte, len(p)*8)
-		if mzArray {
-			for i, peak := range p {
-				u64bits := math.Float64bits(peak.Mz)
+	numpress, zlibCompression := splitCompression(compression)
+	switch numpress {
+	case NumpressLinear:
+		rawUncompressed, err = numpressEncodeLinear(values, validFixedPoint(numpressOptimalLinearFixedPoint(values)))
+	case NumpressPic:
+		rawUncompressed, err = numpressEncodePic(values)
+	case NumpressSlof:
+		rawUncompressed, err = numpressEncodeSlof(values, validFixedPoint(numpressOptimalSlofFixedPoint(values)))
+	default:
+		switch dataType {
+		case Float64:
+			// Allocate room for uncompressed binary data
+			rawUncompressed = make([]byte, len(values)*8)
+			for i, v := range values {
+				u64bits := math.Float64bits(v)
 				binary.LittleEndian.PutUint64(rawUncompressed[(8*i):], u64bits)
 			}
-		} else {
-			for i, peak := range p {
-				u64bits := math.Float64bits(peak.Intens)
-				binary.LittleEndian.PutUint64(rawUncompressed[(8*i):], u64bits)
+		case Int64:
+			rawUncompressed = make([]byte, len(values)*8)
+			for i, v := range values {
+				binary.LittleEndian.PutUint64(rawUncompressed[(8*i):], uint64(int64(math.Round(v))))
 			}
-		}
-	} else {
-		rawUncompressed = make([]byte, len(p)*4)
-		if mzArray {
-			for i, peak := range p {
-				u32bits := math.Float32bits(float32(peak.Mz))
-				binary.LittleEndian.PutUint32(rawUncompressed[(4*i):], u32bits)
+		case Int32:
+			rawUncompressed = make([]byte, len(values)*4)
+			for i, v := range values {
+				binary.LittleEndian.PutUint32(rawUncompressed[(4*i):], uint32(int32(math.Round(v))))
 			}
-		} else {
-			for i, peak := range p {
-				u32bits := math.Float32bits(float32(peak.Intens))
+		default:
+			rawUncompressed = make([]byte, len(values)*4)
+			for i, v := range values {
+				u32bits := math.Float32bits(float32(v))
 				binary.LittleEndian.PutUint32(rawUncompressed[(4*i):], u32bits)
 			}
 		}
 	}
+	if err != nil {
+		return ``, err
+	}
+	return deflateBinary(rawUncompressed, zlibCompression), nil
+}
+
+// deflateBinary optionally applies zlib compression to data, and
+// returns the base64 encoded result
+func deflateBinary(rawUncompressed []byte, zlibCompression bool) string {
+	var data []byte
 	if zlibCompression {
 		var b bytes.Buffer
 		z := zlib.NewWriter(&b)
@@ -139,6 +469,14 @@ func encodeBinary(p []Peak, zlibCompression bool, bits64 bool, mzArray bool) (
 	} else {
 		data = rawUncompressed
 	}
-	encodedStr := base64.StdEncoding.EncodeToString(data)
-	return encodedStr, nil
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// validFixedPoint replaces a fixed point that can't be used to encode
+// data (e.g. because all values are zero) by 1
+func validFixedPoint(fixedPoint float64) float64 {
+	if fixedPoint <= 0 || math.IsInf(fixedPoint, 0) || math.IsNaN(fixedPoint) {
+		return 1
+	}
+	return fixedPoint
 }
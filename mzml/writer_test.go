@@ -4,7 +4,13 @@
 package mzml
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -131,3 +137,58 @@ func TestAllWrite1(t *testing.T) {
 	//
 	// }
 }
+
+func TestWriteIndexed(t *testing.T) {
+	f, err := Read(strings.NewReader(testMzML(4, -1)))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	var b bytes.Buffer
+	err = f.WriteIndexed(&b)
+	if err != nil {
+		t.Fatalf("WriteIndexed: error return %v", err)
+	}
+	out := b.Bytes()
+
+	// Check the checksum
+	const checksumTag = `<fileChecksum>`
+	end := bytes.Index(out, []byte(checksumTag)) + len(checksumTag)
+	sum := sha1.Sum(out[:end])
+	m := regexp.MustCompile(`<fileChecksum>([0-9a-f]{40})</fileChecksum>`).FindSubmatch(out)
+	if m == nil || string(m[1]) != hex.EncodeToString(sum[:]) {
+		t.Errorf("WriteIndexed: invalid checksum")
+	}
+	// Check the offsets
+	m = regexp.MustCompile(`<indexListOffset>([0-9]+)</indexListOffset>`).FindSubmatch(out)
+	if m == nil {
+		t.Fatalf("WriteIndexed: no indexListOffset")
+	}
+	offset, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(out[offset:], []byte(`<indexList `)) {
+		t.Errorf("WriteIndexed: indexListOffset %d doesn't point to indexList", offset)
+	}
+	offsets := regexp.MustCompile(`<offset idRef="scan=[0-9]+">([0-9]+)</offset>`).FindAllSubmatch(out, -1)
+	if len(offsets) != 4 {
+		t.Fatalf("WriteIndexed: %d offsets, should be 4", len(offsets))
+	}
+	for _, o := range offsets {
+		offset, _ := strconv.Atoi(string(o[1]))
+		if !bytes.HasPrefix(out[offset:], []byte(`<spectrum `)) {
+			t.Errorf("WriteIndexed: offset %d doesn't point to spectrum", offset)
+		}
+	}
+
+	// The index must be usable without rebuilding it
+	f2, err := ReadIndexed(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("ReadIndexed: error return %v", err)
+	}
+	_, err = f2.readIndex()
+	if err != nil || !f2.checkIndex() {
+		t.Errorf("ReadIndexed: index invalid (%v)", err)
+	}
+	p, err := f2.ReadScan(3)
+	if err != nil || len(p) != 2 || p[0].Mz != 103 {
+		t.Errorf("ReadScan: %v (%v)", p, err)
+	}
+}
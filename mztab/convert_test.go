@@ -0,0 +1,205 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mztab
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/524D/galms/mzidentml"
+	"github.com/524D/galms/pepxml"
+)
+
+// checkPSM checks the values of a row of the PSM section
+func checkPSM(t *testing.T, m *MzTab, row int, want map[string]string) {
+	t.Helper()
+	for col, v := range want {
+		got, err := m.PSMs.Value(row, col)
+		if err != nil {
+			t.Errorf("PSM %d %s: error return %v", row, col, err)
+		} else if got != v {
+			t.Errorf("PSM %d %s: got %q, want %q", row, col, got, v)
+		}
+	}
+}
+
+func TestFromMzIdentML(t *testing.T) {
+	m := mzidentml.New("test")
+	m.SetAnalysisSoftware("galms", "0.1", nil)
+	m.SetSearchProtocol(mzidentml.SearchProtocol{
+		Modifications: []mzidentml.SearchModification{
+			{Residues: "M", MassDelta: 15.994915, Accession: "UNIMOD:35", Name: "Oxidation"},
+		},
+	})
+	_, err := m.AppendSearchDatabase(mzidentml.SearchDatabase{Location: "/db/human.fasta", Name: "human"})
+	if err != nil {
+		t.Fatalf("AppendSearchDatabase: error return %v", err)
+	}
+	_, err = m.AppendSpectraData(mzidentml.SpectraData{Location: "file:///data/run1.mzML",
+		SpectrumIDFormat: mzidentml.CVParam{Accession: "MS:1000768", Name: "Thermo nativeID format"}})
+	if err != nil {
+		t.Fatalf("AppendSpectraData: error return %v", err)
+	}
+	_, err = m.AppendIdentification(mzidentml.Identification{
+		PepSeq: "PEPTMK", Charge: 2, ExperimentalMassToCharge: 500.25, CalculatedMassToCharge: 500.24,
+		PassThreshold: true, Rank: 1, SpecID: "scan=10", RetentionTime: 600,
+		Cv: []mzidentml.CVParam{
+			{Accession: "MS:1001121", Name: "number of matched peaks", Value: "12"},
+			{Accession: "MS:1002257", Name: "Comet:expectation value", Value: "1.5E-5"},
+			{Accession: "MS:1002255", Name: "Comet:spscore", Value: "120.5"},
+		},
+		Mods: []mzidentml.Modification{
+			{Location: 5, Residues: "M", MassDelta: 15.994915, Accession: "UNIMOD:35", Name: "Oxidation"},
+		},
+		Evidence: []mzidentml.PeptideEvidence{
+			{Accession: "P1", Pre: "K", Post: "A", Start: 3, End: 8},
+			{Accession: "DECOY_P2", Pre: "-", Post: "R", Start: 1, End: 6, IsDecoy: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("AppendIdentification: error return %v", err)
+	}
+
+	tab, err := FromMzIdentML(&m)
+	if err != nil {
+		t.Fatalf("FromMzIdentML: error return %v", err)
+	}
+	for k, v := range map[string]string{
+		"mzTab-type":                 "Identification",
+		"ms_run[1]-location":         "file:///data/run1.mzML",
+		"software[1]":                "[, , galms, 0.1]",
+		"psm_search_engine_score[1]": "[MS, MS:1002257, Comet:expectation value, ]",
+		"fixed_mod[1]":               "[MS, MS:1002453, No fixed modifications searched, ]",
+		"variable_mod[1]":            "[UNIMOD, UNIMOD:35, Oxidation, ]",
+	} {
+		if got := tab.MetadataValue(k); got != v {
+			t.Errorf("Metadata %s: got %q, want %q", k, got, v)
+		}
+	}
+	if len(tab.PSMs.Rows) != 2 {
+		t.Fatalf("FromMzIdentML: %d PSMs, should be 2", len(tab.PSMs.Rows))
+	}
+	checkPSM(t, &tab, 0, map[string]string{
+		"sequence":               "PEPTMK",
+		"accession":              "P1",
+		"unique":                 "0",
+		"database":               "human",
+		"search_engine_score[1]": "1.5E-5",
+		"modifications":          "5-UNIMOD:35",
+		"retention_time":         "600",
+		"charge":                 "2",
+		"exp_mass_to_charge":     "500.25",
+		"spectra_ref":            "ms_run[1]:scan=10",
+		"start":                  "3",
+		decoyColumn:              "0",
+	})
+	checkPSM(t, &tab, 1, map[string]string{"accession": "DECOY_P2", "pre": "-", decoyColumn: "1"})
+	// Only known scores are reported by default
+	if got := tab.MetadataValue("psm_search_engine_score[2]"); got != `` {
+		t.Errorf("Metadata psm_search_engine_score[2]: got %q, want none", got)
+	}
+
+	var sb strings.Builder
+	err = tab.Write(&sb)
+	if err != nil {
+		t.Fatalf("Write: error return %v", err)
+	}
+
+	// Scores selected by accession
+	tab, err = FromMzIdentML(&m, "MS:1002255", "MS:1002257")
+	if err != nil {
+		t.Fatalf("FromMzIdentML: error return %v", err)
+	}
+	if got := tab.MetadataValue("psm_search_engine_score[1]"); got != "[MS, MS:1002255, Comet:spscore, ]" {
+		t.Errorf("Metadata psm_search_engine_score[1]: got %q", got)
+	}
+	checkPSM(t, &tab, 0, map[string]string{"search_engine_score[1]": "120.5", "search_engine_score[2]": "1.5E-5"})
+}
+
+const testPepXML = `<?xml version="1.0" encoding="UTF-8"?>
+<msms_pipeline_analysis date="2021-01-01T00:00:00" summary_xml="test.pep.xml">
+<msms_run_summary base_name="/data/run1" raw_data_type="raw" raw_data=".mzML">
+<search_summary base_name="/data/run1" search_engine="Comet" search_engine_version="2021.01" precursor_mass_type="monoisotopic" fragment_mass_type="monoisotopic" search_id="1">
+<search_database local_path="/db/human.fasta" type="AA"/>
+<aminoacid_modification aminoacid="C" massdiff="57.021464" mass="160.030649" variable="N"/>
+<aminoacid_modification aminoacid="M" massdiff="15.9949" mass="147.0354" variable="Y"/>
+<terminal_modification terminus="n" massdiff="42.0106" mass="43.0184" variable="Y" protein_terminus="N"/>
+</search_summary>
+<spectrum_query spectrum="run1.100.100.2" start_scan="100" end_scan="100" precursor_neutral_mass="1000.5" assumed_charge="2" index="1" retention_time_sec="1200.5">
+<search_result>
+<search_hit hit_rank="1" peptide="PEPMCK" peptide_prev_aa="K" peptide_next_aa="A" protein="P1" num_tot_proteins="2" calc_neutral_pep_mass="1000.49" massdiff="0.01">
+<alternative_protein protein="P2"/>
+<modification_info mod_nterm_mass="43.0184">
+<mod_aminoacid_mass position="4" mass="147.0354"/>
+<mod_aminoacid_mass position="5" mass="160.030649"/>
+<mod_aminoacid_mass position="6" mass="136.1"/>
+</modification_info>
+<search_score name="expect" value="0.001"/>
+<search_score name="xcorr" value="3.5"/>
+<analysis_result analysis="peptideprophet">
+<peptideprophet_result probability="0.98"/>
+</analysis_result>
+</search_hit>
+<search_hit hit_rank="2" peptide="PEPTIDK" peptide_prev_aa="R" peptide_next_aa="-" protein="P3" num_tot_proteins="1" calc_neutral_pep_mass="1000.2" massdiff="0.3">
+<search_score name="expect" value="0.5"/>
+<search_score name="xcorr" value="1.2"/>
+</search_hit>
+</search_result>
+</spectrum_query>
+</msms_run_summary>
+</msms_pipeline_analysis>
+`
+
+func TestFromPepXML(t *testing.T) {
+	p, err := pepxml.Read(strings.NewReader(testPepXML))
+	if err != nil {
+		t.Fatalf("pepxml.Read: error return %v", err)
+	}
+	tab, err := FromPepXML(&p, "expect")
+	if err != nil {
+		t.Fatalf("FromPepXML: error return %v", err)
+	}
+	for k, v := range map[string]string{
+		"ms_run[1]-location":         "file:///data/run1.mzML",
+		"software[1]":                "[, , Comet, 2021.01]",
+		"psm_search_engine_score[1]": "[, , expect, ]",
+		"psm_search_engine_score[2]": "[MS, MS:1002357, PSM-level probability, ]",
+		"fixed_mod[1]":               "[, , CHEMMOD:+57.021464, ]",
+		"variable_mod[2]":            "[, , CHEMMOD:+42.0106, ]",
+	} {
+		if got := tab.MetadataValue(k); got != v {
+			t.Errorf("Metadata %s: got %q, want %q", k, got, v)
+		}
+	}
+	if len(tab.PSMs.Rows) != 3 {
+		t.Fatalf("FromPepXML: %d PSMs, should be 3", len(tab.PSMs.Rows))
+	}
+	checkPSM(t, &tab, 0, map[string]string{
+		"sequence":               "PEPMCK",
+		"accession":              "P1",
+		"unique":                 "0",
+		"database":               "/db/human.fasta",
+		"search_engine":          "[, , Comet, 2021.01]",
+		"search_engine_score[1]": "0.001",
+		"search_engine_score[2]": "0.98",
+		"modifications":          "0-CHEMMOD:+42.0106,4-CHEMMOD:+15.9949,5-CHEMMOD:+57.021464,6-CHEMMOD:+8.005",
+		"retention_time":         "1200.5",
+		"exp_mass_to_charge":     "501.257276466812",
+		"spectra_ref":            "ms_run[1]:scan=100",
+		"opt_global_rank":        "1",
+		"PSM_ID":                 "1",
+	})
+	// The alternative protein is the same PSM, the second rank is another PSM
+	checkPSM(t, &tab, 1, map[string]string{"accession": "P2", "PSM_ID": "1"})
+	checkPSM(t, &tab, 2, map[string]string{"accession": "P3", "PSM_ID": "2", "unique": "1",
+		"opt_global_rank": "2", "search_engine_score[2]": Null})
+
+	tab, err = FromPepXML(&p)
+	if err != nil {
+		t.Fatalf("FromPepXML: error return %v", err)
+	}
+	if got := tab.MetadataValue("psm_search_engine_score[2]"); got != "[, , xcorr, ]" {
+		t.Errorf("Metadata psm_search_engine_score[2]: got %q", got)
+	}
+}
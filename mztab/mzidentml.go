@@ -0,0 +1,201 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mztab
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/524D/galms/mzidentml"
+)
+
+// Accessions of common PSI-MS search engine scores and PSM-level statistics
+var knownScores = map[string]bool{
+	"MS:1001155": true, // SEQUEST:xcorr
+	"MS:1001171": true, // Mascot:score
+	"MS:1001172": true, // Mascot:expectation value
+	"MS:1001328": true, // OMSSA:evalue
+	"MS:1001330": true, // X!Tandem:expect
+	"MS:1001331": true, // X!Tandem:hyperscore
+	"MS:1001491": true, // percolator:Q value
+	"MS:1001492": true, // percolator:score
+	"MS:1001493": true, // percolator:PEP
+	"MS:1002049": true, // MS-GF:RawScore
+	"MS:1002052": true, // MS-GF:SpecEValue
+	"MS:1002053": true, // MS-GF:EValue
+	"MS:1002054": true, // MS-GF:QValue
+	"MS:1002252": true, // Comet:xcorr
+	"MS:1002257": true, // Comet:expectation value
+	"MS:1002338": true, // Andromeda:score
+	"MS:1002354": true, // PSM-level q-value
+	"MS:1002357": true, // PSM-level probability
+}
+
+// FromMzIdentML converts the identifications of an mzIdentML file to an
+// mzTab identification summary with a PSM section. The search scores that
+// are reported are given by accession, e.g. "MS:1002257". If no scores are
+// given, the known search engine scores that are present are reported, or
+// the first numeric cvParam when no known score is present. Identifications
+// that match multiple proteins get one row per protein.
+func FromMzIdentML(m *mzidentml.MzIdentML, scores ...string) (MzTab, error) {
+	t := newIdentification("Identifications converted from mzIdentML")
+
+	msRuns := make(map[string]int)
+	for i, sd := range m.SpectraData() {
+		msRuns[sd.ID] = i + 1
+		t.SetMetadata("ms_run["+strconv.Itoa(i+1)+"]-location", fileURI(sd.Location))
+	}
+	searchEngine := Null
+	for i, s := range m.AnalysisSoftware() {
+		p := Param{Name: s.Name, Value: s.Version}
+		if len(s.Cv) > 0 {
+			p.CvLabel, p.Accession, p.Name = "MS", s.Cv[0].Accession, s.Cv[0].Name
+		}
+		t.SetMetadata("software["+strconv.Itoa(i+1)+"]", p.String())
+		if i == 0 {
+			searchEngine = p.String()
+		}
+	}
+
+	// Select the scores, the names are taken from the cvParams
+	scoreParams := make([]Param, 0, len(scores))
+	scoreIdx := make(map[string]int)
+	for _, acc := range scores {
+		scoreIdx[acc] = len(scoreParams)
+		scoreParams = append(scoreParams, Param{CvLabel: "MS", Accession: acc})
+	}
+	var first *mzidentml.CVParam
+	for i := 0; i < m.NumIdents(); i++ {
+		ident, err := m.Ident(i)
+		if err != nil {
+			return t, err
+		}
+		for _, cv := range ident.Cv {
+			if j, ok := scoreIdx[cv.Accession]; ok {
+				scoreParams[j].Name = cv.Name
+				continue
+			}
+			if _, err := strconv.ParseFloat(cv.Value, 64); err != nil {
+				continue
+			}
+			if first == nil {
+				cv := cv
+				first = &cv
+			}
+			if len(scores) == 0 && knownScores[cv.Accession] {
+				scoreIdx[cv.Accession] = len(scoreParams)
+				scoreParams = append(scoreParams, Param{CvLabel: "MS", Accession: cv.Accession, Name: cv.Name})
+			}
+		}
+	}
+	if len(scoreParams) == 0 && first != nil {
+		scoreIdx[first.Accession] = 0
+		scoreParams = append(scoreParams, Param{CvLabel: "MS", Accession: first.Accession, Name: first.Name})
+	}
+	for i, p := range scoreParams {
+		t.SetMetadata("psm_search_engine_score["+strconv.Itoa(i+1)+"]", p.String())
+	}
+
+	var fixed, variable []Param
+	for _, mod := range m.SearchModifications() {
+		p := modParam(mod.Accession, mod.Name, mod.MassDelta)
+		if mod.Fixed {
+			fixed = append(fixed, p)
+		} else {
+			variable = append(variable, p)
+		}
+	}
+	t.setMods(fixed, variable)
+
+	// Database names, by DBSequence id
+	dbNames := make(map[string]string)
+	for _, db := range m.SearchDatabases() {
+		dbNames[db.ID] = db.Name
+		if db.Name == `` {
+			dbNames[db.ID] = db.Location
+		}
+	}
+
+	t.PSMs.Columns = psmColumns(len(scoreParams), decoyColumn)
+	for i := 0; i < m.NumIdents(); i++ {
+		ident, err := m.Ident(i)
+		if err != nil {
+			return t, err
+		}
+		row := map[string]string{
+			"sequence":            ident.PepSeq,
+			"PSM_ID":              strconv.Itoa(i + 1),
+			"search_engine":       searchEngine,
+			"modifications":       mzIdentMLMods(ident.Mods),
+			"charge":              strconv.Itoa(ident.Charge),
+			"exp_mass_to_charge":  formatFloat(ident.ExperimentalMassToCharge),
+			"calc_mass_to_charge": formatFloat(ident.CalculatedMassToCharge),
+		}
+		if ident.RetentionTime >= 0 {
+			row["retention_time"] = formatFloat(ident.RetentionTime)
+		}
+		if run, ok := msRuns[ident.SpectraDataRef]; ok {
+			row["spectra_ref"] = "ms_run[" + strconv.Itoa(run) + "]:" + ident.SpecID
+		}
+		for _, cv := range ident.Cv {
+			if j, ok := scoreIdx[cv.Accession]; ok {
+				row["search_engine_score["+strconv.Itoa(j+1)+"]"] = cv.Value
+			}
+		}
+		accessions := make(map[string]bool)
+		for _, e := range ident.Evidence {
+			accessions[e.Accession] = true
+		}
+		unique := "0"
+		if len(accessions) == 1 {
+			unique = "1"
+		}
+		if len(ident.Evidence) == 0 {
+			err = t.PSMs.AppendRow(row)
+			if err != nil {
+				return t, err
+			}
+		}
+		for _, e := range ident.Evidence {
+			row["accession"] = nullIfEmpty(e.Accession)
+			row["unique"] = unique
+			row["database"] = Null
+			if seq, err := m.DBSequenceByID(e.DBSequenceRef); err == nil {
+				row["database"] = nullIfEmpty(dbNames[seq.SearchDatabaseRef])
+			}
+			row["pre"] = nullIfEmpty(e.Pre)
+			row["post"] = nullIfEmpty(e.Post)
+			row["start"] = nullIfZero(e.Start)
+			row["end"] = nullIfZero(e.End)
+			row[decoyColumn] = "0"
+			if e.IsDecoy {
+				row[decoyColumn] = "1"
+			}
+			err = t.PSMs.AppendRow(row)
+			if err != nil {
+				return t, err
+			}
+		}
+	}
+	return t, nil
+}
+
+// mzIdentMLMods formats the modifications of a peptide
+func mzIdentMLMods(mods []mzidentml.Modification) string {
+	if len(mods) == 0 {
+		return Null
+	}
+	res := make([]string, 0, len(mods))
+	for _, mod := range mods {
+		id := mod.Accession
+		if id == `` {
+			id = chemMod(mod.MassDelta)
+		}
+		if mod.Location >= 0 {
+			id = strconv.Itoa(mod.Location) + "-" + id
+		}
+		res = append(res, id)
+	}
+	return strings.Join(res, ",")
+}
@@ -0,0 +1,239 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+// Package mztab reads and writes mzTab 1.0 files
+package mztab
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Null is the value of cells that have no value
+const Null = "null"
+
+// MzTab contains the content of an mzTab file
+type MzTab struct {
+	Metadata       []Metadata
+	Comments       []string
+	Proteins       Section // PRT section
+	Peptides       Section // PEP section
+	PSMs           Section // PSM section
+	SmallMolecules Section // SML section
+}
+
+// Metadata is a key/value pair of the MTD section
+type Metadata struct {
+	Key   string
+	Value string
+}
+
+// Section is a table of the mzTab file. Each row has the
+// same number of values as there are columns.
+type Section struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// The line prefixes of a section
+type sectionPrefix struct {
+	header string
+	row    string
+}
+
+var (
+	prtPrefix = sectionPrefix{header: "PRH", row: "PRT"}
+	pepPrefix = sectionPrefix{header: "PEH", row: "PEP"}
+	psmPrefix = sectionPrefix{header: "PSH", row: "PSM"}
+	smlPrefix = sectionPrefix{header: "SMH", row: "SML"}
+)
+
+var (
+	ErrInvalidFormat = errors.New("mztab: invalid format")
+	ErrMissingHeader = errors.New("mztab: row before section header")
+	ErrColumnCount   = errors.New("mztab: number of values doesn't match columns")
+	ErrUnknownColumn = errors.New("mztab: unknown column")
+	ErrInvalidRow    = errors.New("mztab: invalid row index")
+	ErrInvalidValue  = errors.New("mztab: value contains tab or newline")
+)
+
+// MetadataValue returns the value of a metadata key,
+// or an empty string if the key is not present
+func (m *MzTab) MetadataValue(key string) string {
+	for _, md := range m.Metadata {
+		if md.Key == key {
+			return md.Value
+		}
+	}
+	return ``
+}
+
+// SetMetadata sets the value of a metadata key. If the key is not
+// present yet, it is appended.
+func (m *MzTab) SetMetadata(key string, value string) {
+	for i := range m.Metadata {
+		if m.Metadata[i].Key == key {
+			m.Metadata[i].Value = value
+			return
+		}
+	}
+	m.Metadata = append(m.Metadata, Metadata{Key: key, Value: value})
+}
+
+// Column returns the index of a column, or -1 if the column doesn't exist
+func (s *Section) Column(name string) int {
+	for i, c := range s.Columns {
+		if c == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Value returns the value of a cell
+func (s *Section) Value(row int, column string) (string, error) {
+	if row < 0 || row >= len(s.Rows) {
+		return ``, ErrInvalidRow
+	}
+	col := s.Column(column)
+	if col < 0 {
+		return ``, ErrUnknownColumn
+	}
+	return s.Rows[row][col], nil
+}
+
+// AppendRow appends a row. Columns that are not in values get the value "null".
+func (s *Section) AppendRow(values map[string]string) error {
+	row := make([]string, len(s.Columns))
+	for i := range row {
+		row[i] = Null
+	}
+	for k, v := range values {
+		col := s.Column(k)
+		if col < 0 {
+			return ErrUnknownColumn
+		}
+		row[col] = v
+	}
+	s.Rows = append(s.Rows, row)
+	return nil
+}
+
+// Read reads an mzTab file from an io.Reader
+func Read(reader io.Reader) (MzTab, error) {
+	var m MzTab
+	sections := map[string]*Section{
+		prtPrefix.header: &m.Proteins, prtPrefix.row: &m.Proteins,
+		pepPrefix.header: &m.Peptides, pepPrefix.row: &m.Peptides,
+		psmPrefix.header: &m.PSMs, psmPrefix.row: &m.PSMs,
+		smlPrefix.header: &m.SmallMolecules, smlPrefix.row: &m.SmallMolecules,
+	}
+	r := bufio.NewReader(reader)
+	for lineNr := 1; ; lineNr++ {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return m, err
+		}
+		if line == `` && err == io.EOF {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == `` {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		switch fields[0] {
+		case "MTD":
+			if len(fields) < 3 {
+				return m, fmt.Errorf("%w: line %d", ErrInvalidFormat, lineNr)
+			}
+			m.Metadata = append(m.Metadata, Metadata{Key: fields[1], Value: strings.Join(fields[2:], "\t")})
+		case "COM":
+			m.Comments = append(m.Comments, strings.Join(fields[1:], "\t"))
+		case prtPrefix.header, pepPrefix.header, psmPrefix.header, smlPrefix.header:
+			s := sections[fields[0]]
+			if s.Columns != nil {
+				return m, fmt.Errorf("%w: line %d", ErrInvalidFormat, lineNr)
+			}
+			s.Columns = fields[1:]
+		case prtPrefix.row, pepPrefix.row, psmPrefix.row, smlPrefix.row:
+			s := sections[fields[0]]
+			if s.Columns == nil {
+				return m, fmt.Errorf("%w: line %d", ErrMissingHeader, lineNr)
+			}
+			if len(fields)-1 != len(s.Columns) {
+				return m, fmt.Errorf("%w: line %d", ErrColumnCount, lineNr)
+			}
+			s.Rows = append(s.Rows, fields[1:])
+		default:
+			return m, fmt.Errorf("%w: line %d", ErrInvalidFormat, lineNr)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return m, nil
+}
+
+// Write writes the mzTab file. Sections without columns are not written.
+func (m *MzTab) Write(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+	for _, md := range m.Metadata {
+		err := writeLine(w, "MTD", []string{md.Key, md.Value})
+		if err != nil {
+			return err
+		}
+	}
+	for _, c := range m.Comments {
+		err := writeLine(w, "COM", []string{c})
+		if err != nil {
+			return err
+		}
+	}
+	sections := []struct {
+		prefix sectionPrefix
+		s      *Section
+	}{
+		{prtPrefix, &m.Proteins},
+		{pepPrefix, &m.Peptides},
+		{psmPrefix, &m.PSMs},
+		{smlPrefix, &m.SmallMolecules},
+	}
+	for _, sec := range sections {
+		if len(sec.s.Columns) == 0 {
+			continue
+		}
+		w.WriteString("\n")
+		err := writeLine(w, sec.prefix.header, sec.s.Columns)
+		if err != nil {
+			return err
+		}
+		for _, row := range sec.s.Rows {
+			if len(row) != len(sec.s.Columns) {
+				return ErrColumnCount
+			}
+			err = writeLine(w, sec.prefix.row, row)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// writeLine writes a line with the given prefix and tab separated values
+func writeLine(w *bufio.Writer, prefix string, values []string) error {
+	w.WriteString(prefix)
+	for _, v := range values {
+		if strings.ContainsAny(v, "\t\r\n") {
+			return ErrInvalidValue
+		}
+		w.WriteString("\t")
+		w.WriteString(v)
+	}
+	_, err := w.WriteString("\n")
+	return err
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mztab
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testMzTab = "MTD\tmzTab-version\t1.0.0\n" +
+	"MTD\tmzTab-mode\tSummary\n" +
+	"MTD\tmzTab-type\tIdentification\n" +
+	"MTD\tms_run[1]-location\tfile:///data/run1.mzML\n" +
+	"COM\tTest file\n" +
+	"\n" +
+	"PRH\taccession\tdescription\tbest_search_engine_score[1]\n" +
+	"PRT\tP1\tProtein one\t0.99\n" +
+	"\n" +
+	"PEH\tsequence\taccession\tunique\n" +
+	"PEP\tPEPTIDEK\tP1\t1\n" +
+	"\n" +
+	"PSH\tsequence\tPSM_ID\taccession\tcharge\n" +
+	"PSM\tPEPTIDEK\t1\tP1\t2\n" +
+	"PSM\tPEPTMCK\t2\tP1\tnull\n" +
+	"\n" +
+	"SMH\tidentifier\tchemical_formula\n" +
+	"SML\tCHEBI:15377\tH2O\n"
+
+func TestRead(t *testing.T) {
+	m, err := Read(strings.NewReader(testMzTab))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	if v := m.MetadataValue("ms_run[1]-location"); v != "file:///data/run1.mzML" {
+		t.Errorf("MetadataValue: got %q", v)
+	}
+	if len(m.Metadata) != 4 || len(m.Comments) != 1 {
+		t.Errorf("Read: %d metadata, %d comments, should be 4 and 1", len(m.Metadata), len(m.Comments))
+	}
+	if len(m.Proteins.Rows) != 1 || len(m.Peptides.Rows) != 1 || len(m.PSMs.Rows) != 2 ||
+		len(m.SmallMolecules.Rows) != 1 {
+		t.Errorf("Read: %d proteins, %d peptides, %d PSMs, %d small molecules", len(m.Proteins.Rows),
+			len(m.Peptides.Rows), len(m.PSMs.Rows), len(m.SmallMolecules.Rows))
+	}
+	v, err := m.PSMs.Value(1, "sequence")
+	if err != nil || v != "PEPTMCK" {
+		t.Errorf("Value: got %q, error return %v", v, err)
+	}
+	_, err = m.PSMs.Value(2, "sequence")
+	if err != ErrInvalidRow {
+		t.Errorf("Value: error return %v, should be %v", err, ErrInvalidRow)
+	}
+	_, err = m.PSMs.Value(0, "nosuchcolumn")
+	if err != ErrUnknownColumn {
+		t.Errorf("Value: error return %v, should be %v", err, ErrUnknownColumn)
+	}
+
+	var sb strings.Builder
+	err = m.Write(&sb)
+	if err != nil {
+		t.Fatalf("Write: error return %v", err)
+	}
+	if sb.String() != testMzTab {
+		t.Errorf("Write: got\n%s\nshould be\n%s", sb.String(), testMzTab)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		err  error
+	}{
+		{"row before header", "PSM\tPEPTIDEK\n", ErrMissingHeader},
+		{"column count", "PSH\tsequence\tcharge\nPSM\tPEPTIDEK\n", ErrColumnCount},
+		{"duplicate header", "PSH\tsequence\nPSH\tsequence\n", ErrInvalidFormat},
+		{"unknown prefix", "XXX\tvalue\n", ErrInvalidFormat},
+		{"metadata without value", "MTD\tmzTab-version\n", ErrInvalidFormat},
+	}
+	for _, tt := range tests {
+		_, err := Read(strings.NewReader(tt.in))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Read %s: error return %v, should be %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestAppendRow(t *testing.T) {
+	var m MzTab
+	m.SetMetadata("mzTab-version", "0.9")
+	m.SetMetadata("mzTab-version", "1.0.0")
+	if len(m.Metadata) != 1 || m.MetadataValue("mzTab-version") != "1.0.0" {
+		t.Errorf("SetMetadata: got %v", m.Metadata)
+	}
+	m.PSMs.Columns = []string{"sequence", "charge"}
+	err := m.PSMs.AppendRow(map[string]string{"sequence": "PEPTIDEK"})
+	if err != nil {
+		t.Errorf("AppendRow: error return %v", err)
+	}
+	if !reflect.DeepEqual(m.PSMs.Rows, [][]string{{"PEPTIDEK", Null}}) {
+		t.Errorf("AppendRow: got %v", m.PSMs.Rows)
+	}
+	err = m.PSMs.AppendRow(map[string]string{"mass": "1"})
+	if err != ErrUnknownColumn {
+		t.Errorf("AppendRow: error return %v, should be %v", err, ErrUnknownColumn)
+	}
+	m.PSMs.Rows[0][0] = "PEP\tTIDEK"
+	err = m.Write(&strings.Builder{})
+	if err != ErrInvalidValue {
+		t.Errorf("Write: error return %v, should be %v", err, ErrInvalidValue)
+	}
+}
+
+func TestParam(t *testing.T) {
+	tests := []struct {
+		p    Param
+		want string
+	}{
+		{Param{CvLabel: "MS", Accession: "MS:1001207", Name: "Mascot"}, "[MS, MS:1001207, Mascot, ]"},
+		{Param{Name: "X! Tandem", Value: "2017.2.1"}, "[, , X! Tandem, 2017.2.1]"},
+		{Param{Name: "Comet, modified"}, `[, , "Comet, modified", ]`},
+	}
+	for _, tt := range tests {
+		if got := tt.p.String(); got != tt.want {
+			t.Errorf("Param.String: got %s, want %s", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mztab
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/524D/galms/elements"
+	"github.com/524D/galms/mass"
+	"github.com/524D/galms/molecule"
+	"github.com/524D/galms/pepxml"
+)
+
+// Masses of the unmodified peptide termini
+const (
+	nTermMass = 1.007825032
+	cTermMass = 17.00273965
+)
+
+// Tolerance for matching the mass of a modified residue to a search modification
+const modMassTol = 0.01
+
+// FromPepXML converts the search hits of a pepXML file to an mzTab
+// identification summary with a PSM section. The search scores that
+// are reported are given by name, e.g. "expect". If no scores are given,
+// all scores are reported. PeptideProphet and iProphet probabilities are
+// added as extra scores when present. Hits that match multiple proteins
+// get one row per protein.
+func FromPepXML(p *pepxml.PepXML, scores ...string) (MzTab, error) {
+	t := newIdentification("Identifications converted from pepXML")
+
+	runs := p.Runs()
+	var searches []pepxml.SearchSummary
+	for i, run := range runs {
+		t.SetMetadata("ms_run["+strconv.Itoa(i+1)+"]-location", fileURI(run.BaseName+run.RawData))
+		searches = append(searches, run.Searches...)
+	}
+	searchEngine := Null
+	database := Null
+	for i, s := range searches {
+		p := Param{Name: s.SearchEngine, Value: s.SearchEngineVersion}
+		t.SetMetadata("software["+strconv.Itoa(i+1)+"]", p.String())
+		if i == 0 {
+			searchEngine = p.String()
+			database = nullIfEmpty(s.Database)
+		}
+	}
+
+	// Find the scores and probabilities that are present
+	if len(scores) == 0 {
+		present := make(map[string]bool)
+		for i := 0; i < p.NumQueries(); i++ {
+			q, err := p.Query(i)
+			if err != nil {
+				return t, err
+			}
+			for _, h := range q.Hits {
+				for name := range h.Scores {
+					present[name] = true
+				}
+			}
+		}
+		for name := range present {
+			scores = append(scores, name)
+		}
+		sort.Strings(scores)
+	}
+	hasPeptideProphet, hasIProphet := false, false
+	for i := 0; i < p.NumQueries(); i++ {
+		q, err := p.Query(i)
+		if err != nil {
+			return t, err
+		}
+		for _, h := range q.Hits {
+			hasPeptideProphet = hasPeptideProphet || h.PeptideProphet != nil
+			hasIProphet = hasIProphet || h.IProphet != nil
+		}
+	}
+	scoreParams := make([]Param, 0, len(scores)+2)
+	for _, name := range scores {
+		scoreParams = append(scoreParams, Param{Name: name})
+	}
+	if hasPeptideProphet {
+		scoreParams = append(scoreParams, Param{CvLabel: "MS", Accession: "MS:1002357", Name: "PSM-level probability"})
+	}
+	if hasIProphet {
+		scoreParams = append(scoreParams, Param{Name: "iProphet probability"})
+	}
+	for i, sp := range scoreParams {
+		t.SetMetadata("psm_search_engine_score["+strconv.Itoa(i+1)+"]", sp.String())
+	}
+
+	var fixed, variable []Param
+	var mods []pepxml.Modification
+	for _, s := range searches {
+		for _, mod := range s.Modifications {
+			if mod.Variable {
+				variable = append(variable, modParam(``, ``, mod.MassDiff))
+			} else {
+				fixed = append(fixed, modParam(``, ``, mod.MassDiff))
+			}
+			mods = append(mods, mod)
+		}
+	}
+	t.setMods(fixed, variable)
+
+	t.PSMs.Columns = psmColumns(len(scoreParams), "opt_global_rank")
+	psmID := 0
+	for i := 0; i < p.NumQueries(); i++ {
+		q, err := p.Query(i)
+		if err != nil {
+			return t, err
+		}
+		spectraRef := q.SpectrumNativeID
+		if spectraRef == `` {
+			spectraRef = "scan=" + strconv.Itoa(q.StartScan)
+		}
+		for _, h := range q.Hits {
+			// Each hit is a PSM, the rows of its proteins share the PSM_ID
+			psmID++
+			row := map[string]string{
+				"sequence":            h.Peptide,
+				"PSM_ID":              strconv.Itoa(psmID),
+				"unique":              "1",
+				"database":            database,
+				"search_engine":       searchEngine,
+				"modifications":       pepXMLMods(&h, mods),
+				"retention_time":      formatFloat(q.RetentionTime),
+				"charge":              strconv.Itoa(q.Charge),
+				"exp_mass_to_charge":  formatFloat(mz(q.PrecursorNeutralMass, q.Charge)),
+				"calc_mass_to_charge": formatFloat(mz(h.CalcNeutralPepMass, q.Charge)),
+				"spectra_ref":         "ms_run[" + strconv.Itoa(q.Run+1) + "]:" + spectraRef,
+				"pre":                 nullIfEmpty(h.PrevAA),
+				"post":                nullIfEmpty(h.NextAA),
+				"opt_global_rank":     strconv.Itoa(h.Rank),
+			}
+			for j, name := range scores {
+				if v, ok := h.Scores[name]; ok {
+					row["search_engine_score["+strconv.Itoa(j+1)+"]"] = formatFloat(v)
+				}
+			}
+			j := len(scores)
+			if h.PeptideProphet != nil {
+				row["search_engine_score["+strconv.Itoa(j+1)+"]"] = formatFloat(*h.PeptideProphet)
+			}
+			if hasPeptideProphet {
+				j++
+			}
+			if h.IProphet != nil {
+				row["search_engine_score["+strconv.Itoa(j+1)+"]"] = formatFloat(*h.IProphet)
+			}
+			proteins := append([]string{h.Protein}, h.AlternativeProteins...)
+			if len(proteins) > 1 || h.NumTotProteins > 1 {
+				row["unique"] = "0"
+			}
+			for _, prot := range proteins {
+				row["accession"] = nullIfEmpty(prot)
+				err = t.PSMs.AppendRow(row)
+				if err != nil {
+					return t, err
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+// pepXMLMods formats the modifications of a search hit. pepXML stores the
+// mass of the modified residue, the mass difference is taken from the
+// matching search modification, or computed from the residue mass.
+func pepXMLMods(h *pepxml.SearchHit, mods []pepxml.Modification) string {
+	var res []string
+	if h.NTermMass != 0 {
+		delta := terminalDelta(mods, "n", h.NTermMass, nTermMass)
+		res = append(res, "0-"+chemMod(delta))
+	}
+	for _, mp := range h.Mods {
+		if mp.Position < 1 || mp.Position > len(h.Peptide) {
+			continue
+		}
+		aa := h.Peptide[mp.Position-1 : mp.Position]
+		delta := math.NaN()
+		for _, mod := range mods {
+			if mod.AminoAcid == aa && math.Abs(mod.Mass-mp.Mass) < modMassTol {
+				delta = mod.MassDiff
+				break
+			}
+		}
+		if math.IsNaN(delta) {
+			delta = roundMass(mp.Mass - residueMass(aa[0]))
+		}
+		res = append(res, strconv.Itoa(mp.Position)+"-"+chemMod(delta))
+	}
+	if h.CTermMass != 0 {
+		delta := terminalDelta(mods, "c", h.CTermMass, cTermMass)
+		res = append(res, strconv.Itoa(len(h.Peptide)+1)+"-"+chemMod(delta))
+	}
+	if len(res) == 0 {
+		return Null
+	}
+	return strings.Join(res, ",")
+}
+
+// terminalDelta returns the mass difference of a modified terminus
+func terminalDelta(mods []pepxml.Modification, terminus string, m float64, unmodified float64) float64 {
+	for _, mod := range mods {
+		if strings.EqualFold(mod.Terminus, terminus) && math.Abs(mod.Mass-m) < modMassTol {
+			return mod.MassDiff
+		}
+	}
+	return roundMass(m - unmodified)
+}
+
+// residueMass returns the monoisotopic mass of an amino acid residue
+func residueMass(aa byte) float64 {
+	mol, err := molecule.AminoAcid(aa)
+	if err != nil {
+		return 0
+	}
+	min, _, err := mass.MinMax(mol, elements.New())
+	if err != nil {
+		return 0
+	}
+	return min.Mass
+}
+
+// roundMass rounds a computed mass difference to 4 decimals, which
+// is the precision of masses in pepXML
+func roundMass(m float64) float64 {
+	return math.Round(m*1e4) / 1e4
+}
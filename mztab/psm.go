@@ -0,0 +1,141 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mztab
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mass of a proton, used to compute m/z values
+const protonMass = 1.007276466812
+
+// Column of the PSM section that marks decoy identifications
+const decoyColumn = "opt_global_cv_MS:1002217_decoy_peptide"
+
+// Param is a parameter in mzTab notation: [cvLabel, accession, name, value].
+// User parameters have an empty cvLabel and accession.
+type Param struct {
+	CvLabel   string
+	Accession string
+	Name      string
+	Value     string
+}
+
+// String formats the parameter in mzTab notation
+func (p Param) String() string {
+	return "[" + p.CvLabel + ", " + p.Accession + ", " + quoteParam(p.Name) + ", " + quoteParam(p.Value) + "]"
+}
+
+// quoteParam quotes names and values that contain a comma
+func quoteParam(s string) string {
+	if strings.ContainsAny(s, ",[]") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// psmColumns returns the columns of the PSM section
+// for the given number of scores
+func psmColumns(numScores int, opt ...string) []string {
+	cols := []string{"sequence", "PSM_ID", "accession", "unique", "database",
+		"database_version", "search_engine"}
+	for i := 1; i <= numScores; i++ {
+		cols = append(cols, "search_engine_score["+strconv.Itoa(i)+"]")
+	}
+	cols = append(cols, "modifications", "retention_time", "charge", "exp_mass_to_charge",
+		"calc_mass_to_charge", "spectra_ref", "pre", "post", "start", "end")
+	return append(cols, opt...)
+}
+
+// newIdentification returns an MzTab with the metadata that is
+// required for an identification summary file
+func newIdentification(description string) MzTab {
+	var m MzTab
+	m.SetMetadata("mzTab-version", "1.0.0")
+	m.SetMetadata("mzTab-mode", "Summary")
+	m.SetMetadata("mzTab-type", "Identification")
+	m.SetMetadata("description", description)
+	return m
+}
+
+// setMods sets the fixed_mod and variable_mod metadata.
+// mzTab requires an explicit term if no modifications were searched.
+func (m *MzTab) setMods(fixed []Param, variable []Param) {
+	if len(fixed) == 0 {
+		fixed = []Param{{CvLabel: "MS", Accession: "MS:1002453", Name: "No fixed modifications searched"}}
+	}
+	if len(variable) == 0 {
+		variable = []Param{{CvLabel: "MS", Accession: "MS:1002454", Name: "No variable modifications searched"}}
+	}
+	for i, p := range fixed {
+		m.SetMetadata("fixed_mod["+strconv.Itoa(i+1)+"]", p.String())
+	}
+	for i, p := range variable {
+		m.SetMetadata("variable_mod["+strconv.Itoa(i+1)+"]", p.String())
+	}
+}
+
+// modParam returns the mzTab parameter of a modification
+func modParam(accession string, name string, massDelta float64) Param {
+	if accession != `` {
+		label, _, _ := strings.Cut(accession, ":")
+		return Param{CvLabel: label, Accession: accession, Name: name}
+	}
+	return Param{Name: chemMod(massDelta)}
+}
+
+// chemMod returns the identifier of a modification that is only known by mass
+func chemMod(massDelta float64) string {
+	s := strconv.FormatFloat(massDelta, 'f', -1, 64)
+	if massDelta >= 0 {
+		s = "+" + s
+	}
+	return "CHEMMOD:" + s
+}
+
+// fileURI converts a file name into a URI, names that are already a URI
+// are returned unchanged
+func fileURI(name string) string {
+	if strings.Contains(name, "://") {
+		return name
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+	}
+	return "file://" + filepath.ToSlash(name)
+}
+
+// formatFloat formats a value, NaN is formatted as "null"
+func formatFloat(v float64) string {
+	if v != v {
+		return Null
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// nullIfEmpty returns "null" for an empty string
+func nullIfEmpty(s string) string {
+	if s == `` {
+		return Null
+	}
+	return s
+}
+
+// nullIfZero returns "null" for 0
+func nullIfZero(i int) string {
+	if i == 0 {
+		return Null
+	}
+	return strconv.Itoa(i)
+}
+
+// mz computes the m/z of a neutral mass at the given charge
+func mz(neutralMass float64, charge int) float64 {
+	if charge == 0 {
+		return neutralMass
+	}
+	return (neutralMass + float64(charge)*protonMass) / float64(charge)
+}
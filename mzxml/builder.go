@@ -0,0 +1,214 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzxml
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Instrument describes an MS instrument. The values are the names
+// that are used in mzXML, e.g. "ESI" for the ionisation or "FTMS"
+// for the mass analyzer.
+type Instrument struct {
+	Manufacturer    string
+	Model           string
+	Ionisation      string
+	MassAnalyzer    string
+	Detector        string
+	SoftwareName    string
+	SoftwareVersion string
+}
+
+// ParentFile describes a file from which the mzXML file was generated
+type ParentFile struct {
+	FileName string
+	FileType string // "RAWData" or "processedData"
+	FileSha1 string
+}
+
+// ScanData contains the data of a scan that is added with AppendScan
+type ScanData struct {
+	ScanNum         int64 // If 0, the index of the scan + 1 is used
+	MSLevel         int
+	RetentionTime   float64 // Retention time in seconds, NaN if unknown
+	Centroid        bool
+	Polarity        Polarity
+	FilterLine      string
+	CollisionEnergy float64 // NaN if unknown
+	StartMz         float64 // Lower limit of the scan range, NaN if unknown
+	EndMz           float64 // Upper limit of the scan range, NaN if unknown
+	Peaks           []Peak
+	Precursors      []Precursor
+	Precision       int64 // 32 or 64, if 0 64 is used
+	Compress        bool  // Use zlib compression for the peaks
+}
+
+// New returns an MzXML without scans. Metadata and scans can be
+// added, after which the result can be written.
+func New() MzXML {
+	var f MzXML
+	f.id2Index = make(map[int64]int64)
+	f.parents = []int64{}
+	return f
+}
+
+// AppendParentFile adds a file from which the mzXML file was generated
+func (f *MzXML) AppendParentFile(p ParentFile) {
+	f.content.Run.ParentFile = append(f.content.Run.ParentFile,
+		parentFile{FileName: p.FileName, FileType: p.FileType, FileSha1: p.FileSha1})
+}
+
+// ParentFiles returns the files from which the mzXML file was generated
+func (f *MzXML) ParentFiles() []ParentFile {
+	var files []ParentFile
+	for _, p := range f.content.Run.ParentFile {
+		files = append(files, ParentFile{FileName: p.FileName, FileType: p.FileType, FileSha1: p.FileSha1})
+	}
+	return files
+}
+
+// AppendInstrument adds an MS instrument
+func (f *MzXML) AppendInstrument(instr Instrument) {
+	run := &f.content.Run
+	run.MsInstrument = append(run.MsInstrument, msInstrument{
+		MsInstrumentID: len(run.MsInstrument) + 1,
+		MsManufacturer: msManufacturer{Category: "msManufacturer", Value: instr.Manufacturer},
+		MsModel:        msModel{Category: "msModel", Value: instr.Model},
+		MsIonisation:   msIonisation{Category: "msIonisation", Value: instr.Ionisation},
+		MsMassAnalyzer: msMassAnalyzer{Category: "msMassAnalyzer", Value: instr.MassAnalyzer},
+		MsDetector:     msDetector{Category: "msDetector", Value: instr.Detector},
+		Software: instrumentSoftware{Type: "acquisition", Name: instr.SoftwareName,
+			Version: instr.SoftwareVersion},
+	})
+}
+
+// Instruments returns the MS instruments
+func (f *MzXML) Instruments() []Instrument {
+	var instruments []Instrument
+	for _, m := range f.content.Run.MsInstrument {
+		instruments = append(instruments, Instrument{
+			Manufacturer:    m.MsManufacturer.Value,
+			Model:           m.MsModel.Value,
+			Ionisation:      m.MsIonisation.Value,
+			MassAnalyzer:    m.MsMassAnalyzer.Value,
+			Detector:        m.MsDetector.Value,
+			SoftwareName:    m.Software.Name,
+			SoftwareVersion: m.Software.Version,
+		})
+	}
+	return instruments
+}
+
+// AppendSoftware adds a dataProcessing element with the software
+// that processed the file. softwareType is "acquisition",
+// "conversion" or "processing".
+func (f *MzXML) AppendSoftware(softwareType string, name string, version string) {
+	f.content.Run.DataProcessing = append(f.content.Run.DataProcessing, dataProcessing{
+		Software: software{Type: softwareType, Name: name, Version: version},
+	})
+}
+
+// AppendScan adds a scan, and returns its index.
+// This is not possible for files that are read with ReadIndexed.
+func (f *MzXML) AppendScan(s ScanData) (int64, error) {
+	if f.reader != nil {
+		return 0, ErrAppendIndexed
+	}
+	scanIndex := f.NumSpecs()
+	sc := scan{
+		ScanNum:    s.ScanNum,
+		MsLevel:    s.MSLevel,
+		PeaksCount: int64(len(s.Peaks)),
+		FilterLine: s.FilterLine,
+		Centroided: "0",
+		Peaks: peaks{
+			Precision: s.Precision,
+			ByteOrder: "network",
+			PairOrder: "m/z-int",
+		},
+	}
+	if sc.ScanNum == 0 {
+		sc.ScanNum = scanIndex + 1
+	}
+	if _, ok := f.id2Index[sc.ScanNum]; ok {
+		return 0, ErrInvalidScanID
+	}
+	if s.Centroid {
+		sc.Centroided = "1"
+	}
+	switch s.Polarity {
+	case Positive:
+		sc.Polarity = `+`
+	case Negative:
+		sc.Polarity = `-`
+	}
+	if !math.IsNaN(s.RetentionTime) {
+		sc.RetentionTime = "PT" + strconv.FormatFloat(s.RetentionTime, 'f', -1, 64) + "S"
+	}
+	if !math.IsNaN(s.CollisionEnergy) {
+		sc.CollisionEnergy = strconv.FormatFloat(s.CollisionEnergy, 'f', -1, 64)
+	}
+	if !math.IsNaN(s.StartMz) {
+		sc.StartMz = s.StartMz
+	}
+	if !math.IsNaN(s.EndMz) {
+		sc.EndMz = s.EndMz
+	}
+	if len(s.Peaks) > 0 {
+		sc.LowMz, sc.HighMz, sc.BasePeakMz, sc.BasePeakIntensity, sc.TotIonCurrent = peakStats(s.Peaks)
+	}
+	for _, p := range s.Precursors {
+		sc.PrecursorMz = append(sc.PrecursorMz, f.newPrecursorMz(&p))
+	}
+	if sc.Peaks.Precision == 0 {
+		sc.Peaks.Precision = 64
+	}
+	sc.Peaks.CompressionType = "none"
+	if s.Compress {
+		sc.Peaks.CompressionType = "zlib"
+	}
+	err := encodePeaks(&sc.Peaks, s.Peaks)
+	if err != nil {
+		return 0, err
+	}
+
+	run := &f.content.Run
+	oldCap := cap(run.Specs)
+	run.Specs = append(run.Specs, sc)
+	run.ScanCount = int64(len(run.Specs))
+	if cap(run.Specs) != oldCap {
+		// The scans were moved, so the index must be rebuild
+		return scanIndex, f.traverseScan()
+	}
+	_, err = f.addSpecToIndex(scanIndex, -1, &run.Specs[len(run.Specs)-1])
+	return scanIndex, err
+}
+
+// newPrecursorMz returns the mzXML representation of a precursor
+func (f *MzXML) newPrecursorMz(p *Precursor) precursorMz {
+	pm := precursorMz{
+		PrecursorScanNum: p.ScanNum,
+		PrecursorCharge:  p.Charge,
+		ActivationMethod: p.ActivationMethod,
+		MzStr:            strconv.FormatFloat(p.Mz, 'f', -1, 64),
+	}
+	if pm.PrecursorScanNum == 0 && p.ScanIndex >= 0 && p.ScanIndex < f.NumSpecs() {
+		pm.PrecursorScanNum = f.index2id[p.ScanIndex]
+	}
+	if !math.IsNaN(p.Intensity) {
+		intensity := p.Intensity
+		pm.PrecursorIntensity = &intensity
+	}
+	if !math.IsNaN(p.WindowWideness) {
+		pm.WindowWideness = p.WindowWideness
+	}
+	charges := make([]string, len(p.PossibleCharges))
+	for i, c := range p.PossibleCharges {
+		charges[i] = strconv.Itoa(c)
+	}
+	pm.PossibleCharges = strings.Join(charges, ",")
+	return pm
+}
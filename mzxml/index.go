@@ -0,0 +1,338 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// The scan index of an mzXML file
+type scanIndex struct {
+	Name   string      `xml:"name,attr"`
+	Offset []offsetRef `xml:"offset"`
+}
+
+type offsetRef struct {
+	ID     int64  `xml:"id,attr"`
+	Offset string `xml:",chardata"`
+}
+
+// Number of bytes at the end of the file in which we look for <indexOffset>
+const indexTailSize = 4096
+
+var reIndexOffset = regexp.MustCompile(`<indexOffset>\s*([0-9]+)\s*</indexOffset>`)
+
+// ReadIndexed reads an mzXML file from an io.ReadSeeker. Only the
+// elements before the first scan are read here; each scan is read when
+// it is accessed, at the offset that <index> gives for it. Without a
+// usable index, the offsets are found by parsing the whole file once.
+// The MzXML keeps using the reader, so it must stay open and must not
+// be used elsewhere while the MzXML is in use.
+func ReadIndexed(reader io.ReadSeeker) (MzXML, error) {
+	var mzXML MzXML
+
+	mzXML.reader = reader
+	mzXML.cacheIndex = -1
+	err := mzXML.readHeader()
+	if err != nil {
+		return mzXML, err
+	}
+	ids, err := mzXML.readIndex()
+	if err != nil || !mzXML.checkIndex() {
+		ids, err = mzXML.rebuildIndex()
+		if err != nil {
+			return mzXML, err
+		}
+	}
+	mzXML.setIDs(ids)
+	return mzXML, nil
+}
+
+// newDecoderAt returns an XML decoder that starts reading at offset
+func (f *MzXML) newDecoderAt(offset int64) (*xml.Decoder, error) {
+	_, err := f.reader.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	d := xml.NewDecoder(f.reader)
+	d.CharsetReader = charset.NewReaderLabel
+	return d, nil
+}
+
+// readHeader reads everything in the mzXML file that precedes the scans
+func (f *MzXML) readHeader() error {
+	d, err := f.newDecoderAt(0)
+	if err != nil {
+		return err
+	}
+	for {
+		t, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		start, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		run := &f.content.Run
+		switch start.Name.Local {
+		case "mzXML":
+			f.content.XMLName = start.Name
+		case "msRun":
+			for _, a := range start.Attr {
+				switch a.Name.Local {
+				case "scanCount":
+					run.ScanCount, _ = strconv.ParseInt(a.Value, 10, 64)
+				case "startTime":
+					run.StartTime = a.Value
+				case "endTime":
+					run.EndTime = a.Value
+				}
+			}
+		case "parentFile":
+			var p parentFile
+			err = d.DecodeElement(&p, &start)
+			run.ParentFile = append(run.ParentFile, p)
+		case "msInstrument":
+			var m msInstrument
+			err = d.DecodeElement(&m, &start)
+			run.MsInstrument = append(run.MsInstrument, m)
+		case "dataProcessing":
+			var p dataProcessing
+			err = d.DecodeElement(&p, &start)
+			run.DataProcessing = append(run.DataProcessing, p)
+		case "scan", "index":
+			// The scans themselves are read on demand
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readIndex reads the offsets of the scans from <index>
+func (f *MzXML) readIndex() ([]int64, error) {
+	size, err := f.reader.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	tailStart := size - indexTailSize
+	if tailStart < 0 {
+		tailStart = 0
+	}
+	_, err = f.reader.Seek(tailStart, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	tail, err := io.ReadAll(f.reader)
+	if err != nil {
+		return nil, err
+	}
+	m := reIndexOffset.FindSubmatch(tail)
+	if m == nil {
+		return nil, ErrInvalidOffset
+	}
+	indexOffset, err := strconv.ParseInt(string(m[1]), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	var index scanIndex
+	d, start, err := f.elementDecoderAt(indexOffset, "index")
+	if err != nil {
+		return nil, err
+	}
+	err = d.DecodeElement(&index, start)
+	if err != nil {
+		return nil, err
+	}
+	if index.Name != "scan" {
+		return nil, ErrInvalidOffset
+	}
+	ids := make([]int64, 0, len(index.Offset))
+	f.scanOffsets = make([]int64, 0, len(index.Offset))
+	for _, o := range index.Offset {
+		offset, err := strconv.ParseInt(strings.TrimSpace(o.Offset), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		f.scanOffsets = append(f.scanOffsets, offset)
+		ids = append(ids, o.ID)
+	}
+	return ids, nil
+}
+
+// checkIndex returns false if the scan offsets can't be right: they
+// must increase, and the first and last must point to a <scan>.
+// readScan verifies each offset when the scan is read.
+func (f *MzXML) checkIndex() bool {
+	n := len(f.scanOffsets)
+	if n == 0 {
+		// No offsets: only valid for a file without scans
+		return f.content.Run.ScanCount == 0
+	}
+	for i := 1; i < n; i++ {
+		if f.scanOffsets[i] <= f.scanOffsets[i-1] {
+			return false
+		}
+	}
+	return f.elementAt(f.scanOffsets[0], "scan") &&
+		f.elementAt(f.scanOffsets[n-1], "scan")
+}
+
+// elementAt reports whether a start tag <name starts at offset
+func (f *MzXML) elementAt(offset int64, name string) bool {
+	_, err := f.reader.Seek(offset, io.SeekStart)
+	if err != nil {
+		return false
+	}
+	b := make([]byte, len(name)+2)
+	_, err = io.ReadFull(f.reader, b)
+	if err != nil {
+		return false
+	}
+	return bytes.HasPrefix(b, []byte("<"+name)) &&
+		(b[len(b)-1] == ' ' || b[len(b)-1] == '>' ||
+			b[len(b)-1] == '\t' || b[len(b)-1] == '\r' || b[len(b)-1] == '\n')
+}
+
+// rebuildIndex parses the whole file to find the offset and number of each scan
+func (f *MzXML) rebuildIndex() ([]int64, error) {
+	d, err := f.newDecoderAt(0)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	f.scanOffsets = nil
+	for {
+		offset := d.InputOffset()
+		t, err := d.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				return ids, nil
+			}
+			return nil, err
+		}
+		if start, ok := t.(xml.StartElement); ok && start.Name.Local == "scan" {
+			f.scanOffsets = append(f.scanOffsets, offset)
+			id := int64(0)
+			for _, a := range start.Attr {
+				if a.Name.Local == "num" {
+					id, err = strconv.ParseInt(a.Value, 10, 64)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+			ids = append(ids, id)
+		}
+	}
+}
+
+// setIDs stores the scan numbers, and maps them back to scan indices
+func (f *MzXML) setIDs(ids []int64) {
+	f.index2id = ids
+	f.id2Index = make(map[int64]int64, len(ids))
+	for i, id := range ids {
+		f.id2Index[id] = int64(i)
+	}
+}
+
+// elementDecoderAt checks that element name starts at offset, and returns
+// its start element and a decoder that continues after it
+func (f *MzXML) elementDecoderAt(offset int64, name string) (*xml.Decoder, *xml.StartElement, error) {
+	if !f.elementAt(offset, name) {
+		return nil, nil, ErrInvalidOffset
+	}
+	d, err := f.newDecoderAt(offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := d.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	start, ok := t.(xml.StartElement)
+	if !ok || start.Name.Local != name {
+		return nil, nil, ErrInvalidOffset
+	}
+	return d, &start, nil
+}
+
+// scanDecoderAt returns a decoder for the scan with the given index.
+// ErrInvalidOffset is returned if its offset doesn't point to a scan
+// with the scan number from the index.
+func (f *MzXML) scanDecoderAt(scanIndex int64) (*xml.Decoder, *xml.StartElement, error) {
+	d, start, err := f.elementDecoderAt(f.scanOffsets[scanIndex], "scan")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, a := range start.Attr {
+		if a.Name.Local == "num" && a.Value != strconv.FormatInt(f.index2id[scanIndex], 10) {
+			return nil, nil, ErrInvalidOffset
+		}
+	}
+	return d, start, nil
+}
+
+// readScan reads a single scan (including its nested scans)
+// from the underlying file
+func (f *MzXML) readScan(scanIndex int64) (*scan, error) {
+	d, start, err := f.scanDecoderAt(scanIndex)
+	if err != nil {
+		// Offset or scan number is wrong, so the index can't be trusted
+		ids, err := f.rebuildIndex()
+		if err != nil {
+			return nil, err
+		}
+		f.setIDs(ids)
+		if scanIndex >= f.NumSpecs() {
+			return nil, ErrInvalidScanIndex
+		}
+		d, start, err = f.scanDecoderAt(scanIndex)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var s scan
+	err = d.DecodeElement(&s, start)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// scan returns the scan with the given index,
+// reading it from file if needed
+func (f *MzXML) scan(scanIndex int64) (*scan, error) {
+	if scanIndex < 0 || scanIndex >= f.NumSpecs() {
+		return nil, ErrInvalidScanIndex
+	}
+	if f.reader == nil {
+		return f.index2Scan[scanIndex], nil
+	}
+	if s, ok := f.updated[scanIndex]; ok {
+		return s, nil
+	}
+	if f.cacheScan != nil && f.cacheIndex == scanIndex {
+		return f.cacheScan, nil
+	}
+	s, err := f.readScan(scanIndex)
+	if err != nil {
+		return nil, err
+	}
+	f.cacheScan = s
+	f.cacheIndex = scanIndex
+	return s, nil
+}
@@ -0,0 +1,222 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzxml
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// encode32 returns the base64 encoding of a network order 32 bit float array
+func encode32(v []float32) string {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.BigEndian.PutUint32(b[4*i:], math.Float32bits(x))
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// testMzXML generates a small mzXML document with numSpecs spectra.
+// Spectrum i has scan number 10+i, MS level 1+(i%2), retention time
+// i minutes and two peaks with m/z 100+i and 200+i. MS2 spectra are
+// nested in the preceding MS1 spectrum.
+// If offsetShift >= 0, an index is added with all offsets moved by
+// offsetShift bytes.
+func testMzXML(numSpecs int, offsetShift int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<?xml version="1.0" encoding="ISO-8859-1"?>
+<mzXML xmlns="http://sashimi.sourceforge.net/schema_revision/mzXML_3.2">
+ <msRun scanCount="%d" startTime="PT0S" endTime="PT%dS">
+  <parentFile fileName="test.raw" fileType="RAWData" fileSha1="0000000000000000000000000000000000000000"/>
+  <dataProcessing centroided="1">
+   <software type="conversion" name="test" version="1.0"/>
+  </dataProcessing>
+`, numSpecs, 60*(numSpecs-1))
+	for i := 0; i < numSpecs; i++ {
+		fmt.Fprintf(&sb, `  <scan num="%d" msLevel="%d" peaksCount="2" retentionTime="PT%dS" polarity="+">
+`, 10+i, 1+(i%2), 60*i)
+		if i%2 == 1 {
+			fmt.Fprintf(&sb, "   <precursorMz precursorScanNum=\"%d\" precursorIntensity=\"100\" precursorCharge=\"2\">%d.5</precursorMz>\n",
+				9+i, 500+i)
+		}
+		fmt.Fprintf(&sb, "   <peaks precision=\"32\" byteOrder=\"network\" pairOrder=\"m/z-int\">%s</peaks>\n",
+			encode32([]float32{100 + float32(i), 1000, 200 + float32(i), 2000}))
+		// Close MS1 scans after their MS2 scan
+		if i%2 == 1 || i == numSpecs-1 {
+			sb.WriteString("  </scan>\n")
+		}
+		if i%2 == 1 {
+			sb.WriteString("  </scan>\n")
+		}
+	}
+	sb.WriteString(" </msRun>\n")
+	if offsetShift >= 0 {
+		doc := sb.String()
+		indexOffset := len(doc) + 1
+		sb.WriteString(" <index name=\"scan\">\n")
+		pos := 0
+		for i := 0; i < numSpecs; i++ {
+			pos += strings.Index(doc[pos:], "<scan ")
+			fmt.Fprintf(&sb, "  <offset id=\"%d\">%d</offset>\n", 10+i, pos+offsetShift)
+			pos++
+		}
+		fmt.Fprintf(&sb, " </index>\n <indexOffset>%d</indexOffset>\n", indexOffset)
+		sb.WriteString(" <sha1>0000000000000000000000000000000000000000</sha1>\n")
+	}
+	sb.WriteString("</mzXML>\n")
+	return sb.String()
+}
+
+func checkScans(t *testing.T, f *MzXML, numSpecs int) {
+	if n := f.NumSpecs(); n != int64(numSpecs) {
+		t.Fatalf("NumSpecs: %d, should be %d", n, numSpecs)
+	}
+	scanIndex, err := f.ScanIndex(13)
+	if err != nil || scanIndex != 3 {
+		t.Errorf("ScanIndex: %d (%v), should be 3", scanIndex, err)
+	}
+	// Access in non-sequential order
+	for _, i := range []int64{3, 0, 4, 3} {
+		p, err := f.ReadScan(i)
+		if err != nil {
+			t.Fatalf("ReadScan: error return %v", err)
+		}
+		if len(p) != 2 || p[0].Mz != 100+float64(i) || p[1].Intens != 2000 {
+			t.Errorf("ReadScan(%d): %v", i, p)
+		}
+		msLevel, err := f.MSLevel(i)
+		if err != nil || msLevel != 1+int(i%2) {
+			t.Errorf("MSLevel(%d): %d (%v), should be %d", i, msLevel, err, 1+(i%2))
+		}
+		rt, err := f.RetentionTime(i)
+		if err != nil || rt != 60*float64(i) {
+			t.Errorf("RetentionTime(%d): %f (%v), should be %f", i, rt, err, 60*float64(i))
+		}
+	}
+	_, err = f.ReadScan(int64(numSpecs))
+	if err != ErrInvalidScanIndex {
+		t.Errorf("ReadScan: error return %v, should be ErrInvalidScanIndex", err)
+	}
+	centroid, err := f.Centroid(0)
+	if err != nil || !centroid {
+		t.Errorf("Centroid: %v (%v), should be true", centroid, err)
+	}
+}
+
+var reSha1 = regexp.MustCompile(`<sha1>([0-9a-f]+)</sha1>`)
+var reIndexOffsetTest = regexp.MustCompile(`<indexOffset>([0-9]+)</indexOffset>`)
+var reOffset = regexp.MustCompile(`<offset id="([0-9]+)">([0-9]+)</offset>`)
+
+// checkIndex checks the offsets and checksum of a written mzXML file
+func checkIndex(t *testing.T, doc string, numSpecs int) {
+	m := reSha1.FindStringSubmatch(doc)
+	if m == nil {
+		t.Fatalf("Write: no sha1 found")
+	}
+	end := strings.Index(doc, "<sha1>") + len("<sha1>")
+	sum := sha1.Sum([]byte(doc[:end]))
+	if hex.EncodeToString(sum[:]) != m[1] {
+		t.Errorf("Write: sha1 %s, should be %s", m[1], hex.EncodeToString(sum[:]))
+	}
+	m = reIndexOffsetTest.FindStringSubmatch(doc)
+	if m == nil {
+		t.Fatalf("Write: no indexOffset found")
+	}
+	indexOffset, _ := strconv.Atoi(m[1])
+	if !strings.HasPrefix(doc[indexOffset:], `<index name="scan">`) {
+		t.Errorf("Write: indexOffset %d doesn't point to index", indexOffset)
+	}
+	offsets := reOffset.FindAllStringSubmatch(doc, -1)
+	if len(offsets) != numSpecs {
+		t.Fatalf("Write: %d offsets, should be %d", len(offsets), numSpecs)
+	}
+	for _, o := range offsets {
+		offset, _ := strconv.Atoi(o[2])
+		if !strings.HasPrefix(doc[offset:], `<scan num="`+o[1]+`"`) {
+			t.Errorf("Write: offset %d doesn't point to scan %s", offset, o[1])
+		}
+	}
+}
+
+func TestReadIndexed(t *testing.T) {
+	tests := []struct {
+		name        string
+		offsetShift int
+	}{
+		{name: "Valid index", offsetShift: 0},
+		{name: "No index", offsetShift: -1},
+		{name: "Corrupt index", offsetShift: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ReadIndexed(strings.NewReader(testMzXML(5, tt.offsetShift)))
+			if err != nil {
+				t.Fatalf("ReadIndexed: error return %v", err)
+			}
+			checkScans(t, &f, 5)
+
+			var sb strings.Builder
+			err = f.Write(&sb)
+			if err != nil {
+				t.Fatalf("Write: error return %v", err)
+			}
+			checkIndex(t, sb.String(), 5)
+			f2, err := ReadIndexed(strings.NewReader(sb.String()))
+			if err != nil {
+				t.Fatalf("ReadIndexed after write: error return %v", err)
+			}
+			checkScans(t, &f2, 5)
+			f3, err := Read(strings.NewReader(sb.String()))
+			if err != nil {
+				t.Fatalf("Read after write: error return %v", err)
+			}
+			checkScans(t, &f3, 5)
+			// Writing the same content must give the same result
+			var sb2 strings.Builder
+			err = f3.Write(&sb2)
+			if err != nil || sb2.String() != sb.String() {
+				t.Errorf("Write after Read: output differs (%v)", err)
+			}
+		})
+	}
+}
+
+func TestCorruptOffset(t *testing.T) {
+	// The offset of scan 12 is replaced by the offset of scan 11
+	doc := testMzXML(5, 0)
+	off := func(id string) string {
+		s := doc[strings.Index(doc, `<offset id="`+id+`">`):]
+		return s[:strings.Index(s, "\n")]
+	}
+	doc = strings.Replace(doc, off(`12`), strings.Replace(off(`11`), `"11"`, `"12"`, 1), 1)
+	f, err := ReadIndexed(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("ReadIndexed: error return %v", err)
+	}
+	p, err := f.ReadScan(2)
+	if err != nil || len(p) != 2 || p[0].Mz != 102 {
+		t.Errorf("ReadScan(2): %v (%v)", p, err)
+	}
+
+	// Increasing offsets, but one points to the next scan
+	f, err = ReadIndexed(strings.NewReader(testMzXML(5, 0)))
+	if err != nil {
+		t.Fatalf("ReadIndexed: error return %v", err)
+	}
+	f.scanOffsets[2] = f.scanOffsets[3]
+	for _, i := range []int64{2, 3} {
+		p, err = f.ReadScan(i)
+		if err != nil || len(p) != 2 || p[0].Mz != 100+float64(i) {
+			t.Errorf("ReadScan(%d): %v (%v)", i, p, err)
+		}
+	}
+}
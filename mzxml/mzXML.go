@@ -6,9 +6,13 @@ package mzxml
 import (
 	"encoding/xml"
 	"errors"
+	"io"
 	"os"
+
+	"github.com/524D/galms/spectra"
 )
 
+// MzXML contains the content of an mzXML file
 type MzXML struct {
 	mzXMLfile  *os.File
 	decoder    *xml.Decoder
@@ -16,13 +20,17 @@ type MzXML struct {
 	index2id   []int64
 	id2Index   map[int64]int64
 	index2Scan []*scan
+	parents    []int64 // Index of the parent of each scan, -1 if none
+	// Only used when reading indexed files
+	reader      io.ReadSeeker
+	scanOffsets []int64
+	cacheIndex  int64
+	cacheScan   *scan
+	updated     map[int64]*scan
 }
 
 // Peak contains the actual ms peak info
-type Peak struct {
-	Mz     float64
-	Intens float64
-}
+type Peak = spectra.Peak
 
 type mzXMLContent struct {
 	XMLName xml.Name `xml:"mzXML"`
@@ -31,94 +39,99 @@ type mzXMLContent struct {
 
 type msRun struct {
 	ScanCount      int64            `xml:"scanCount,attr"`
-	StartTime      string           `xml:"startTime,attr,omitEmpty"`
-	EndTime        string           `xml:"endTime,attr,omitEmpty"`
-	ParentFile     []parentFile     `xml:"parentFile,omitEmpty"`
-	MsInstrument   []msInstrument   `xml:"msInstrument,omitEmpty"`
-	DataProcessing []dataProcessing `xml:"dataProcessing,omitEmpty"`
-	Specs          []scan           `xml:"scan,omitEmpty"`
+	StartTime      string           `xml:"startTime,attr,omitempty"`
+	EndTime        string           `xml:"endTime,attr,omitempty"`
+	ParentFile     []parentFile     `xml:"parentFile,omitempty"`
+	MsInstrument   []msInstrument   `xml:"msInstrument,omitempty"`
+	DataProcessing []dataProcessing `xml:"dataProcessing,omitempty"`
+	Specs          []scan           `xml:"scan,omitempty"`
 }
 
 type msInstrument struct {
 	MsInstrumentID int                `xml:"msInstrumentID,attr"`
-	MsManufacturer msManufacturer     `xml:"msManufacturer,omitEmpty"`
-	MsModel        msModel            `xml:"msModel,omitEmpty"`
-	MsIonisation   msIonisation       `xml:"msIonisation,omitEmpty"`
-	MsMassAnalyzer msMassAnalyzer     `xml:"msMassAnalyzer,omitEmpty"`
-	MsDetector     msDetector         `xml:"msDetector,omitEmpty"`
-	Software       instrumentSoftware `xml:"software,omitEmpty"`
+	MsManufacturer msManufacturer     `xml:"msManufacturer,omitempty"`
+	MsModel        msModel            `xml:"msModel,omitempty"`
+	MsIonisation   msIonisation       `xml:"msIonisation,omitempty"`
+	MsMassAnalyzer msMassAnalyzer     `xml:"msMassAnalyzer,omitempty"`
+	MsDetector     msDetector         `xml:"msDetector,omitempty"`
+	Software       instrumentSoftware `xml:"software,omitempty"`
 }
 
 type msManufacturer struct {
-	Category string `xml:"category,attr,omitEmpty"`
-	Value    string `xml:"value,attr,omitEmpty"`
+	Category string `xml:"category,attr,omitempty"`
+	Value    string `xml:"value,attr,omitempty"`
 }
 
 type msModel struct {
-	Category string `xml:"category,attr,omitEmpty"`
-	Value    string `xml:"value,attr,omitEmpty"`
+	Category string `xml:"category,attr,omitempty"`
+	Value    string `xml:"value,attr,omitempty"`
 }
 
 type msIonisation struct {
-	Category string `xml:"category,attr,omitEmpty"`
-	Value    string `xml:"value,attr,omitEmpty"`
+	Category string `xml:"category,attr,omitempty"`
+	Value    string `xml:"value,attr,omitempty"`
 }
 
 type msMassAnalyzer struct {
-	Category string `xml:"category,attr,omitEmpty"`
-	Value    string `xml:"value,attr,omitEmpty"`
+	Category string `xml:"category,attr,omitempty"`
+	Value    string `xml:"value,attr,omitempty"`
 }
 
 type msDetector struct {
-	Category string `xml:"category,attr,omitEmpty"`
-	Value    string `xml:"value,attr,omitEmpty"`
+	Category string `xml:"category,attr,omitempty"`
+	Value    string `xml:"value,attr,omitempty"`
 }
 
 type instrumentSoftware struct {
-	Type    string `xml:"type,attr,omitEmpty"`
-	Name    string `xml:"name,attr,omitEmpty"`
-	Version string `xml:"version,attr,omitEmpty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Name    string `xml:"name,attr,omitempty"`
+	Version string `xml:"version,attr,omitempty"`
 }
 
 type dataProcessing struct {
-	// FIXME: 'omitempty' does not work?
-	Centroided          int                 `xml:"centroided,omitEmpty,attr"`
-	Software            software            `xml:"software,omitEmpty"`
-	Comment             string              `xml:"comment,omitEmpty"`
-	ProcessingOperation processingOperation `xml:"processingOperation,omitEmpty"`
-	// ProcessingOperation     string `xml:"processingOperation,omitEmpty"`
-	// ProcessingOperationName string `xml:"processingOperation>name,attr,omitEmpty"`
+	Centroided          int                   `xml:"centroided,omitempty,attr"`
+	Software            software              `xml:"software,omitempty"`
+	Comment             string                `xml:"comment,omitempty"`
+	ProcessingOperation []processingOperation `xml:"processingOperation,omitempty"`
+	// ProcessingOperation     string `xml:"processingOperation,omitempty"`
+	// ProcessingOperationName string `xml:"processingOperation>name,attr,omitempty"`
 }
 
 type software struct {
-	Type    string `xml:"type,attr,omitEmpty"`
-	Name    string `xml:"name,attr,omitEmpty"`
-	Version string `xml:"version,attr,omitEmpty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Name    string `xml:"name,attr,omitempty"`
+	Version string `xml:"version,attr,omitempty"`
 }
 
 type processingOperation struct {
-	Name string `xml:"name,attr,omitEmpty"`
+	Name string `xml:"name,attr,omitempty"`
 }
 
 type parentFile struct {
-	FileName string `xml:"fileName,attr,omitEmpty"`
-	FileType string `xml:"fileType,attr,omitEmpty"`
-	FileSha1 string `xml:"fileSha1,attr,omitEmpty"`
+	FileName string `xml:"fileName,attr,omitempty"`
+	FileType string `xml:"fileType,attr,omitempty"`
+	FileSha1 string `xml:"fileSha1,attr,omitempty"`
 }
 
 type scan struct {
-	ScanNum           int64   `xml:"num,attr"`
-	RetentionTime     string  `xml:"retentionTime,attr,omitEmpty"`
-	Polarity          string  `xml:"polarity,attr,omitEmpty"`
-	MsLevel           int     `xml:"msLevel,attr"`
-	PeaksCount        int64   `xml:"peaksCount,attr"`
-	LowMz             float64 `xml:"lowMz,attr,omitEmpty"`
-	HighMz            float64 `xml:"highMz,attr,omitEmpty"`
-	BasePeakMz        float64 `xml:"basePeakMz,attr,omitEmpty"`
-	BasePeakIntensity float64 `xml:"basePeakIntensity,attr,omitEmpty"`
-	TotIonCurrent     float64 `xml:"totIonCurrent,attr,omitEmpty"`
-	Peaks             peaks   `xml:"peaks,omitEmpty"`
-	FragScans         []scan  `xml:"scan,omitEmpty"`
+	ScanNum           int64         `xml:"num,attr"`
+	RetentionTime     string        `xml:"retentionTime,attr,omitempty"`
+	Polarity          string        `xml:"polarity,attr,omitempty"`
+	FilterLine        string        `xml:"filterLine,attr,omitempty"`
+	Centroided        string        `xml:"centroided,attr,omitempty"`
+	MsLevel           int           `xml:"msLevel,attr"`
+	PeaksCount        int64         `xml:"peaksCount,attr"`
+	LowMz             float64       `xml:"lowMz,attr,omitempty"`
+	HighMz            float64       `xml:"highMz,attr,omitempty"`
+	BasePeakMz        float64       `xml:"basePeakMz,attr,omitempty"`
+	BasePeakIntensity float64       `xml:"basePeakIntensity,attr,omitempty"`
+	TotIonCurrent     float64       `xml:"totIonCurrent,attr,omitempty"`
+	CollisionEnergy   string        `xml:"collisionEnergy,attr,omitempty"`
+	StartMz           float64       `xml:"startMz,attr,omitempty"`
+	EndMz             float64       `xml:"endMz,attr,omitempty"`
+	PrecursorMz       []precursorMz `xml:"precursorMz,omitempty"`
+	Peaks             peaks         `xml:"peaks,omitempty"`
+	FragScans         []scan        `xml:"scan,omitempty"`
 }
 
 // <scan num="9" retentionTime="PT5.16998400S" polarity="+" msLevel="2" peaksCount="104" lowMz="121.17511749" highMz="669.60003662" basePeakMz="355.42813110" basePeakIntensity="16858.51367188" totIonCurrent="199931.18437386">
@@ -126,15 +139,21 @@ type scan struct {
 // <peaks precision="32" byteOrder="network" pairOrder="m/z-int">
 
 type precursorMz struct {
-	PrecursorIntensity float64 `xml:"precursorIntensity,attr,omitEmpty"`
-	MzStr              string  `xml:",chardata"`
+	PrecursorScanNum   int64    `xml:"precursorScanNum,attr,omitempty"`
+	PrecursorIntensity *float64 `xml:"precursorIntensity,attr,omitempty"`
+	PrecursorCharge    int      `xml:"precursorCharge,attr,omitempty"`
+	PossibleCharges    string   `xml:"possibleCharges,attr,omitempty"`
+	WindowWideness     float64  `xml:"windowWideness,attr,omitempty"`
+	ActivationMethod   string   `xml:"activationMethod,attr,omitempty"`
+	MzStr              string   `xml:",chardata"`
 }
 
 type peaks struct {
-	Precision       int64  `xml:"precision,attr,omitEmpty"`
-	ByteOrder       string `xml:"byteOrder,attr,omitEmpty"`
-	PairOrder       string `xml:"pairOrder,attr,omitEmpty"`
-	CompressionType string `xml:"compressionType,attr,omitEmpty"`
+	Precision       int64  `xml:"precision,attr,omitempty"`
+	ByteOrder       string `xml:"byteOrder,attr,omitempty"`
+	PairOrder       string `xml:"pairOrder,attr,omitempty"`
+	CompressionType string `xml:"compressionType,attr,omitempty"`
+	CompressedLen   int64  `xml:"compressedLen,attr,omitempty"`
 	Base64Str       string `xml:",chardata"`
 }
 
@@ -142,4 +161,7 @@ var (
 	ErrInvalidScanID    = errors.New("mzxml: invalid scan id")
 	ErrInvalidScanIndex = errors.New("mzxml: invalid scan index")
 	ErrInvalidFormat    = errors.New("mzxml: invalid data format")
+	ErrInvalidOffset    = errors.New("mzxml: invalid offset in index")
+	ErrPeakCount        = errors.New("mzxml: number of peaks doesn't match scan")
+	ErrAppendIndexed    = errors.New("mzxml: can't append scans to an indexed file")
 )
@@ -0,0 +1,95 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzxml
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Precursor contains the parsed info of a precursor of a scan.
+// Fields that are not present are NaN.
+type Precursor struct {
+	Mz float64
+	// Scan number of the precursor scan, 0 if not present
+	ScanNum int64
+	// Index of the precursor scan, or -1 if the precursor scan
+	// is not in the file
+	ScanIndex       int64
+	Charge          int // 0 if the charge state is unknown
+	PossibleCharges []int
+	Intensity       float64
+	WindowWideness  float64
+	// Activation method, e.g. CID, ETD, HCD
+	ActivationMethod string
+	// Collision energy of the scan. In mzXML, this is an attribute of
+	// the scan, so it's the same for all precursors of a scan
+	CollisionEnergy float64
+}
+
+// Precursors returns the precursors of a scan
+func (f *MzXML) Precursors(scanIndex int64) ([]Precursor, error) {
+	s, err := f.scan(scanIndex)
+	if err != nil {
+		return nil, err
+	}
+	collisionEnergy := math.NaN()
+	if s.CollisionEnergy != `` {
+		collisionEnergy, err = strconv.ParseFloat(s.CollisionEnergy, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var precursors []Precursor
+	for _, pm := range s.PrecursorMz {
+		p, err := f.parsePrecursor(&pm)
+		if err != nil {
+			return nil, err
+		}
+		p.CollisionEnergy = collisionEnergy
+		precursors = append(precursors, p)
+	}
+	return precursors, nil
+}
+
+func (f *MzXML) parsePrecursor(pm *precursorMz) (Precursor, error) {
+	var err error
+	p := Precursor{
+		ScanNum:          pm.PrecursorScanNum,
+		ScanIndex:        -1,
+		Charge:           pm.PrecursorCharge,
+		Intensity:        math.NaN(),
+		WindowWideness:   math.NaN(),
+		ActivationMethod: pm.ActivationMethod,
+	}
+	p.Mz, err = strconv.ParseFloat(strings.TrimSpace(pm.MzStr), 64)
+	if err != nil {
+		return p, err
+	}
+	if pm.PrecursorScanNum != 0 {
+		if index, ok := f.id2Index[pm.PrecursorScanNum]; ok {
+			p.ScanIndex = index
+		}
+	}
+	if pm.PrecursorIntensity != nil {
+		p.Intensity = *pm.PrecursorIntensity
+	}
+	if pm.WindowWideness != 0 {
+		p.WindowWideness = pm.WindowWideness
+	}
+	// possibleCharges is a comma separated list
+	for _, c := range strings.Split(pm.PossibleCharges, ",") {
+		c = strings.TrimSpace(c)
+		if c == `` {
+			continue
+		}
+		charge, err := strconv.Atoi(c)
+		if err != nil {
+			return p, err
+		}
+		p.PossibleCharges = append(p.PossibleCharges, charge)
+	}
+	return p, nil
+}
@@ -19,12 +19,20 @@ import (
 	"golang.org/x/net/html/charset"
 )
 
+// Read reads mzXML file from an io.Reader
+func Read(reader io.Reader) (MzXML, error) {
+	var mzXML MzXML
+	err := mzXML.Read(reader)
+	return mzXML, err
+}
+
+// Read reads mzXML content from an io.Reader into f
 func (f *MzXML) Read(reader io.Reader) error {
 	f.decoder = xml.NewDecoder(reader)
 	f.decoder.CharsetReader = charset.NewReaderLabel
 	err := f.decoder.Decode(&f.content)
 	if err != nil {
-		return nil
+		return err
 	}
 	err = f.traverseScan()
 	return err
@@ -36,24 +44,33 @@ func (f *MzXML) Read(reader io.Reader) error {
 // in the mzMXL file! To read a scan using the mzXML number,
 // use ReadScan(f, ScanIndex(f, scanNum))
 func (f *MzXML) ReadScan(scanIndex int64) ([]Peak, error) {
-	if scanIndex < 0 || scanIndex >= f.content.Run.ScanCount {
-		return nil, ErrInvalidScanIndex
+	scan, err := f.scan(scanIndex)
+	if err != nil {
+		return nil, err
 	}
-	scan := f.index2Scan[scanIndex]
-	cnt := scan.PeaksCount
+	return decodePeaks(&scan.Peaks, scan.PeaksCount)
+}
+
+// byteOrder returns the byte order of the peaks.
+// Only "network" byteorder is allowed according to the schema,
+// but some converters write little endian data.
+func byteOrder(pk *peaks) binary.ByteOrder {
+	if pk.ByteOrder == "little" {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// decodePeaks decodes cnt m/z-intensity pairs.
+// Only "m/z-int" pairorder is allowed according to the schema
+func decodePeaks(pk *peaks, cnt int64) ([]Peak, error) {
 	p := make([]Peak, cnt)
-	data, err := base64.StdEncoding.DecodeString(scan.Peaks.Base64Str)
+	data, err := base64.StdEncoding.DecodeString(pk.Base64Str)
 	if err != nil {
 		fmt.Println("error:", err)
 		return nil, err
 	}
-	// Only "network" byteorder is allowed according to the schema
-	// if (scan.Peaks.ByteOrder=="network"){
-	// }
-	// Only "m/z-int" pairorder is allowed according to the schema
-	// if scan.Peaks.pairOrder == "m/z-int" {
-	// }
-	if scan.Peaks.CompressionType == "zlib" {
+	if pk.CompressionType == "zlib" {
 		b := bytes.NewReader(data)
 		z, err := zlib.NewReader(b)
 		if err != nil {
@@ -66,21 +83,28 @@ func (f *MzXML) ReadScan(scanIndex int64) ([]Peak, error) {
 		}
 		data = p
 	}
-	if scan.Peaks.Precision == 64 {
+	order := byteOrder(pk)
+	if pk.Precision == 64 {
+		if int64(len(data)) < cnt*16 {
+			return nil, ErrInvalidFormat
+		}
 		for i := int64(0); i < cnt; i++ {
-			bits := binary.BigEndian.Uint64(data[i*16:])
+			bits := order.Uint64(data[i*16:])
 			float := math.Float64frombits(bits)
 			p[i].Mz = float64(float)
-			bits = binary.BigEndian.Uint64(data[i*16+8:])
+			bits = order.Uint64(data[i*16+8:])
 			float = math.Float64frombits(bits)
 			p[i].Intens = float64(float)
 		}
 	} else {
+		if int64(len(data)) < cnt*8 {
+			return nil, ErrInvalidFormat
+		}
 		for i := int64(0); i < cnt; i++ {
-			bits := binary.BigEndian.Uint32(data[i*8:])
+			bits := order.Uint32(data[i*8:])
 			float := math.Float32frombits(bits)
 			p[i].Mz = float64(float)
-			bits = binary.BigEndian.Uint32(data[i*8+4:])
+			bits = order.Uint32(data[i*8+4:])
 			float = math.Float32frombits(bits)
 			p[i].Intens = float64(float)
 
@@ -91,7 +115,7 @@ func (f *MzXML) ReadScan(scanIndex int64) ([]Peak, error) {
 
 // NumSpecs returns the number of spectra
 func (f *MzXML) NumSpecs() int64 {
-	return int64(len(f.index2Scan))
+	return int64(len(f.index2id))
 }
 
 // Regular expression to match "duration"
@@ -100,10 +124,11 @@ var reDuration = regexp.MustCompile(`^PT(.*)S`)
 // RetentionTime returns the retention time of a spectrum
 // If no retention time is present, return -1
 func (f *MzXML) RetentionTime(scanIndex int64) (float64, error) {
-	if scanIndex < 0 || scanIndex >= f.NumSpecs() {
-		return 0.0, ErrInvalidScanIndex
+	scan, err := f.scan(scanIndex)
+	if err != nil {
+		return 0.0, err
 	}
-	rtStr := f.content.Run.Specs[scanIndex].RetentionTime
+	rtStr := scan.RetentionTime
 
 	// Retention time is specified in "duration" format: https://www.w3schools.com/xml/schema_dtypes_date.asp
 	// For now, we only accept PT<float>S format
@@ -119,11 +144,15 @@ func (f *MzXML) RetentionTime(scanIndex int64) (float64, error) {
 }
 
 // Centroid returns true is the spectrum contains centroid peaks
-// In mzXML, centroided applied to the whole file, not individual spectra.
-// For compatibility with mzML, we keep the same interface
+// In mzXML 2 and earlier, centroided applies to the whole file, in
+// later versions it can also be specified for individual scans.
 func (f *MzXML) Centroid(scanIndex int64) (bool, error) {
-	if scanIndex < 0 || scanIndex >= f.NumSpecs() {
-		return false, ErrInvalidScanIndex
+	scan, err := f.scan(scanIndex)
+	if err != nil {
+		return false, err
+	}
+	if scan.Centroided != `` {
+		return scan.Centroided == "1" || scan.Centroided == "true", nil
 	}
 	if len(f.content.Run.DataProcessing) > 0 {
 		return (f.content.Run.DataProcessing[0].Centroided != 0), nil
@@ -134,23 +163,26 @@ func (f *MzXML) Centroid(scanIndex int64) (bool, error) {
 // MSLevel returns the MS Level of a spectrum
 // If no MS level is present, return 0
 func (f *MzXML) MSLevel(scanIndex int64) (int, error) {
-	if scanIndex < 0 || scanIndex >= f.NumSpecs() {
-		return 0, ErrInvalidScanIndex
+	scan, err := f.scan(scanIndex)
+	if err != nil {
+		return 0, err
 	}
-	return f.content.Run.Specs[scanIndex].MsLevel, nil
+	return scan.MsLevel, nil
 }
 
 // traverseScan traverses all (recursive)scans and fills the
 // arrays f.index2id and f.id2Index to make scans accessible
 func (f *MzXML) traverseScan() error {
-	f.index2id = make([]int64, f.content.Run.ScanCount, f.content.Run.ScanCount)
+	// scanCount is only used as a hint, it isn't always correct
+	f.index2id = make([]int64, 0, f.content.Run.ScanCount)
 	f.id2Index = make(map[int64]int64, f.content.Run.ScanCount)
-	f.index2Scan = make([]*scan, f.content.Run.ScanCount, f.content.Run.ScanCount)
+	f.index2Scan = make([]*scan, 0, f.content.Run.ScanCount)
+	f.parents = make([]int64, 0, f.content.Run.ScanCount)
 	scanIndex := int64(0)
 	err := error(nil)
 
 	for i := range f.content.Run.Specs {
-		scanIndex, err = f.addSpecToIndex(scanIndex, &f.content.Run.Specs[i])
+		scanIndex, err = f.addSpecToIndex(scanIndex, -1, &f.content.Run.Specs[i])
 		if err != nil {
 			return err
 		}
@@ -158,16 +190,18 @@ func (f *MzXML) traverseScan() error {
 	return err
 }
 
-func (f *MzXML) addSpecToIndex(scanIndex int64,
+func (f *MzXML) addSpecToIndex(scanIndex int64, parent int64,
 	scan *scan) (int64, error) { //x
 	err := error(nil)
-	f.index2id[scanIndex] = scan.ScanNum
+	f.index2id = append(f.index2id, scan.ScanNum)
 	f.id2Index[scan.ScanNum] = scanIndex
-	f.index2Scan[scanIndex] = scan
+	f.index2Scan = append(f.index2Scan, scan)
+	f.parents = append(f.parents, parent)
+	parent = scanIndex
 	scanIndex++
 	if scan.FragScans != nil {
 		for i := range scan.FragScans {
-			scanIndex, err = f.addSpecToIndex(scanIndex, &scan.FragScans[i])
+			scanIndex, err = f.addSpecToIndex(scanIndex, parent, &scan.FragScans[i])
 		}
 	}
 	return scanIndex, err
@@ -182,10 +216,86 @@ func (f *MzXML) ScanIndex(scanID int64) (int64, error) {
 	return 0, ErrInvalidScanID
 }
 
+// ParentScan returns the index of the scan in which a scan is nested,
+// or -1 if the scan is not nested
+func (f *MzXML) ParentScan(scanIndex int64) (int64, error) {
+	if scanIndex < 0 || scanIndex >= f.NumSpecs() {
+		return 0, ErrInvalidScanIndex
+	}
+	err := f.readParents()
+	if err != nil {
+		return 0, err
+	}
+	return f.parents[scanIndex], nil
+}
+
+// ChildScans returns the indices of the scans that are directly
+// nested in a scan
+func (f *MzXML) ChildScans(scanIndex int64) ([]int64, error) {
+	if scanIndex < 0 || scanIndex >= f.NumSpecs() {
+		return nil, ErrInvalidScanIndex
+	}
+	err := f.readParents()
+	if err != nil {
+		return nil, err
+	}
+	// Nested scans directly follow their parent
+	var children []int64
+	for i := scanIndex + 1; i < f.NumSpecs() && f.parents[i] >= scanIndex; i++ {
+		if f.parents[i] == scanIndex {
+			children = append(children, i)
+		}
+	}
+	return children, nil
+}
+
+// readParents determines the nesting of the scans. For indexed files,
+// this requires scanning the complete file, so it is done only when needed.
+func (f *MzXML) readParents() error {
+	if f.parents != nil {
+		return nil
+	}
+	d, err := f.newDecoderAt(0)
+	if err != nil {
+		return err
+	}
+	parents := make([]int64, 0, f.NumSpecs())
+	var stack []int64
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "scan" {
+				parent := int64(-1)
+				if len(stack) > 0 {
+					parent = stack[len(stack)-1]
+				}
+				stack = append(stack, int64(len(parents)))
+				parents = append(parents, parent)
+			}
+		case xml.EndElement:
+			if t.Name.Local == "scan" && len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if int64(len(parents)) != f.NumSpecs() {
+		return ErrInvalidOffset
+	}
+	f.parents = parents
+	return nil
+}
+
 // ScanID converts a scan index (used to access the scan data) into a scan id
 // (used in the mzxml file)
 func (f *MzXML) ScanID(scanIndex int64) (int64, error) {
-	if scanIndex > 0 && scanIndex < f.content.Run.ScanCount {
+	if scanIndex >= 0 && scanIndex < f.NumSpecs() {
 		return f.index2id[scanIndex], nil
 	}
 	return 0, ErrInvalidScanIndex
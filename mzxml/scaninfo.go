@@ -0,0 +1,82 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzxml
+
+import (
+	"math"
+
+	"github.com/524D/galms/spectra"
+)
+
+// Polarity is the polarity of a scan
+type Polarity = spectra.Polarity
+
+// Scan polarities
+const (
+	UnknownPolarity = spectra.UnknownPolarity
+	Positive        = spectra.Positive
+	Negative        = spectra.Negative
+)
+
+// ScanInfo contains metadata of a scan.
+// Values that are not present are NaN.
+type ScanInfo struct {
+	ScanNum         int64
+	MSLevel         int
+	RetentionTime   float64 // Retention time in seconds
+	Centroid        bool
+	Polarity        Polarity
+	FilterLine      string
+	TotalIonCurrent float64
+	BasePeakMz      float64
+	BasePeakIntens  float64
+	LowMz           float64 // Lowest observed m/z
+	HighMz          float64 // Highest observed m/z
+	StartMz         float64 // Lower limit of the scan range
+	EndMz           float64 // Upper limit of the scan range
+}
+
+// ScanInfo returns the metadata of a scan
+func (f *MzXML) ScanInfo(scanIndex int64) (ScanInfo, error) {
+	info := ScanInfo{RetentionTime: math.NaN()}
+	s, err := f.scan(scanIndex)
+	if err != nil {
+		return info, err
+	}
+	info.ScanNum = s.ScanNum
+	info.MSLevel = s.MsLevel
+	if s.RetentionTime != `` {
+		info.RetentionTime, err = f.RetentionTime(scanIndex)
+		if err != nil {
+			return info, err
+		}
+	}
+	info.Centroid, err = f.Centroid(scanIndex)
+	if err != nil {
+		return info, err
+	}
+	switch s.Polarity {
+	case `+`:
+		info.Polarity = Positive
+	case `-`:
+		info.Polarity = Negative
+	}
+	info.FilterLine = s.FilterLine
+	// Zero means that the attribute is not present
+	info.TotalIonCurrent = nanIfZero(s.TotIonCurrent)
+	info.BasePeakMz = nanIfZero(s.BasePeakMz)
+	info.BasePeakIntens = nanIfZero(s.BasePeakIntensity)
+	info.LowMz = nanIfZero(s.LowMz)
+	info.HighMz = nanIfZero(s.HighMz)
+	info.StartMz = nanIfZero(s.StartMz)
+	info.EndMz = nanIfZero(s.EndMz)
+	return info, nil
+}
+
+func nanIfZero(x float64) float64 {
+	if x == 0 {
+		return math.NaN()
+	}
+	return x
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzxml
+
+import (
+	"strconv"
+
+	"github.com/524D/galms/spectra"
+)
+
+// spectrumSource makes an MzXML usable as spectra.Source
+type spectrumSource struct {
+	f *MzXML
+}
+
+// Spectra returns an iterator over the spectra that match filter
+func (f *MzXML) Spectra(filter spectra.Filter) *spectra.Iterator {
+	return spectra.NewIterator(spectrumSource{f: f}, filter)
+}
+
+func (s spectrumSource) NumSpecs() int {
+	return int(s.f.NumSpecs())
+}
+
+func (s spectrumSource) SpectrumHeader(index int) (spectra.Spectrum, error) {
+	var spec spectra.Spectrum
+	scanIndex := int64(index)
+	sc, err := s.f.scan(scanIndex)
+	if err != nil {
+		return spec, err
+	}
+	info, err := s.f.ScanInfo(scanIndex)
+	if err != nil {
+		return spec, err
+	}
+	spec.Index = index
+	spec.ID = strconv.FormatInt(info.ScanNum, 10)
+	spec.MSLevel = info.MSLevel
+	spec.RetentionTime = info.RetentionTime
+	spec.Centroid = info.Centroid
+	spec.Polarity = info.Polarity
+	for i := range sc.PrecursorMz {
+		p, err := s.f.parsePrecursor(&sc.PrecursorMz[i])
+		if err != nil {
+			return spec, err
+		}
+		spec.Precursors = append(spec.Precursors, spectra.Precursor{
+			Mz:        p.Mz,
+			Charge:    p.Charge,
+			Intensity: p.Intensity,
+			ScanIndex: int(p.ScanIndex),
+		})
+	}
+	return spec, nil
+}
+
+func (s spectrumSource) ReadPeaks(index int) ([]spectra.Peak, error) {
+	return s.f.ReadScan(int64(index))
+}
@@ -4,14 +4,302 @@
 package mzxml
 
 import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/xml"
 	"io"
+	"math"
+	"strconv"
 )
 
-func (mzXML *MzXML) Write(w io.Writer) error {
-	content := &mzXML.content
-	encoder := xml.NewEncoder(w)
-	encoder.Indent("", "    ")
-	err := encoder.Encode(content)
+const (
+	mzXMLNamespace      = "http://sashimi.sourceforge.net/schema_revision/mzXML_3.2"
+	xsiNamespace        = "http://www.w3.org/2001/XMLSchema-instance"
+	mzXMLSchemaLocation = "http://sashimi.sourceforge.net/schema_revision/mzXML_3.2 http://sashimi.sourceforge.net/schema_revision/mzXML_3.2/mzXML_idx_3.2.xsd"
+)
+
+// Write writes the mzXML file to an io.Writer.
+// The scan offsets, index offset and SHA-1 checksum are recomputed.
+// As in the TPP, the checksum covers everything up to and
+// including the <sha1> tag.
+func (f *MzXML) Write(writer io.Writer) error {
+	h := sha1.New()
+	w := mzXMLWriter{w: io.MultiWriter(writer, h)}
+	w.str("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n")
+	ns := f.content.XMLName.Space
+	if ns == `` || ns == mzXMLNamespace {
+		w.str(startTag("mzXML", "xmlns", mzXMLNamespace, "xmlns:xsi", xsiNamespace,
+			"xsi:schemaLocation", mzXMLSchemaLocation) + "\n")
+	} else {
+		w.str(startTag("mzXML", "xmlns", ns) + "\n")
+	}
+	f.writeMsRun(&w, ` `)
+
+	w.str(" ")
+	indexOffset := w.offset
+	w.str(startTag("index", "name", "scan") + "\n")
+	for i, id := range w.scanIDs {
+		w.str("  " + startTag("offset", "id", strconv.FormatInt(id, 10)) +
+			strconv.FormatInt(w.scanOffsets[i], 10) + "</offset>\n")
+	}
+	w.str(" </index>\n")
+	w.str(" <indexOffset>" + strconv.FormatInt(indexOffset, 10) + "</indexOffset>\n")
+	w.str(" <sha1>")
+	if w.err != nil {
+		return w.err
+	}
+	_, err := io.WriteString(writer, hex.EncodeToString(h.Sum(nil))+"</sha1>\n</mzXML>\n")
 	return err
 }
+
+// mzXMLWriter writes XML and keeps track of the offsets of the scans
+type mzXMLWriter struct {
+	w           io.Writer
+	offset      int64
+	err         error
+	scanIDs     []int64
+	scanOffsets []int64
+}
+
+func (w *mzXMLWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	w.err = err
+	return n, err
+}
+
+func (w *mzXMLWriter) str(s string) {
+	io.WriteString(w, s)
+}
+
+// encode returns v as XML element with the given name, indented by prefix
+func (w *mzXMLWriter) encode(prefix string, name string, v interface{}) []byte {
+	var b bytes.Buffer
+	enc := xml.NewEncoder(&b)
+	enc.Indent(prefix, ` `)
+	err := enc.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}})
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return b.Bytes()
+}
+
+// element writes v as XML element with the given name, indented by prefix
+func (w *mzXMLWriter) element(prefix string, name string, v interface{}) {
+	w.Write(w.encode(prefix, name, v))
+	w.str("\n")
+}
+
+// startTag returns an XML start tag, attrs contains attribute name/value pairs
+func startTag(name string, attrs ...string) string {
+	var b bytes.Buffer
+	b.WriteString("<" + name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		b.WriteString(" " + attrs[i] + "=\"")
+		xml.EscapeText(&b, []byte(attrs[i+1]))
+		b.WriteString("\"")
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// nonEmptyAttrs removes attribute name/value pairs with an empty value
+func nonEmptyAttrs(attrs ...string) []string {
+	res := make([]string, 0, len(attrs))
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] != `` {
+			res = append(res, attrs[i], attrs[i+1])
+		}
+	}
+	return res
+}
+
+// writeMsRun writes the <msRun> element, indented by prefix
+func (f *MzXML) writeMsRun(w *mzXMLWriter, prefix string) {
+	run := &f.content.Run
+	w.str(prefix + startTag("msRun", nonEmptyAttrs(
+		"scanCount", strconv.FormatInt(f.NumSpecs(), 10),
+		"startTime", run.StartTime,
+		"endTime", run.EndTime)...) + "\n")
+	p := prefix + ` `
+	for i := range run.ParentFile {
+		w.element(p, "parentFile", &run.ParentFile[i])
+	}
+	for i := range run.MsInstrument {
+		w.element(p, "msInstrument", &run.MsInstrument[i])
+	}
+	for i := range run.DataProcessing {
+		w.element(p, "dataProcessing", &run.DataProcessing[i])
+	}
+	// Nested scans are written by their parent, so the index
+	// is advanced by the number of scans that was written
+	for i := int64(0); i < f.NumSpecs() && w.err == nil; {
+		s, err := f.scan(i)
+		if err != nil {
+			w.err = err
+			return
+		}
+		i += f.writeScan(w, p, s, i)
+	}
+	w.str(prefix + "</msRun>\n")
+}
+
+// writeScan writes a scan and its nested scans, indented by prefix.
+// The number of written scans is returned.
+func (f *MzXML) writeScan(w *mzXMLWriter, prefix string, s *scan, scanIndex int64) int64 {
+	if u, ok := f.updated[scanIndex]; ok {
+		s = u
+	}
+	// Encode the scan without its children, and write the
+	// children before the end tag
+	s2 := *s
+	s2.FragScans = nil
+	b := w.encode(prefix, "scan", &s2)
+	b = bytes.TrimSuffix(b, []byte(prefix+"</scan>"))
+	w.scanIDs = append(w.scanIDs, s.ScanNum)
+	w.scanOffsets = append(w.scanOffsets, w.offset+int64(len(prefix)))
+	w.Write(b)
+	n := int64(1)
+	for i := range s.FragScans {
+		n += f.writeScan(w, prefix+` `, &s.FragScans[i], scanIndex+n)
+	}
+	w.str(prefix + "</scan>\n")
+	return n
+}
+
+// updatedScan returns the scan with the given index for modification
+func (f *MzXML) updatedScan(scanIndex int64) (*scan, error) {
+	s, err := f.scan(scanIndex)
+	if err != nil {
+		return nil, err
+	}
+	if f.reader != nil {
+		// Keep the modified scan, it can't be written back to file
+		if f.updated == nil {
+			f.updated = make(map[int64]*scan)
+		}
+		f.updated[scanIndex] = s
+	}
+	return s, nil
+}
+
+// UpdateScan sets the mz/intensity info of a scan.
+// The peaks are encoded with the precision, byte order and compression
+// of the original scan. If updateMz or updateIntens is false, the
+// number of peaks must be unchanged.
+// The m/z range, base peak and total ion current of the scan are
+// updated if they were present.
+func (f *MzXML) UpdateScan(scanIndex int64, p []Peak,
+	updateMz bool, updateIntens bool) error {
+	s, err := f.updatedScan(scanIndex)
+	if err != nil {
+		return err
+	}
+	if !updateMz || !updateIntens {
+		if int64(len(p)) != s.PeaksCount {
+			return ErrPeakCount
+		}
+		old, err := decodePeaks(&s.Peaks, s.PeaksCount)
+		if err != nil {
+			return err
+		}
+		newPeaks := make([]Peak, len(p))
+		for i := range p {
+			newPeaks[i] = old[i]
+			if updateMz {
+				newPeaks[i].Mz = p[i].Mz
+			}
+			if updateIntens {
+				newPeaks[i].Intens = p[i].Intens
+			}
+		}
+		p = newPeaks
+	}
+	err = encodePeaks(&s.Peaks, p)
+	if err != nil {
+		return err
+	}
+	s.PeaksCount = int64(len(p))
+	updateScanStats(s, p)
+	return nil
+}
+
+// updateScanStats updates the peak statistics of the scan that are present
+func updateScanStats(s *scan, p []Peak) {
+	lowMz, highMz, basePeakMz, basePeakIntens, tic := peakStats(p)
+	if s.LowMz != 0 {
+		s.LowMz = lowMz
+	}
+	if s.HighMz != 0 {
+		s.HighMz = highMz
+	}
+	if s.BasePeakMz != 0 {
+		s.BasePeakMz = basePeakMz
+	}
+	if s.BasePeakIntensity != 0 {
+		s.BasePeakIntensity = basePeakIntens
+	}
+	if s.TotIonCurrent != 0 {
+		s.TotIonCurrent = tic
+	}
+}
+
+// peakStats returns the m/z range, base peak and total ion current of peaks
+func peakStats(p []Peak) (lowMz, highMz, basePeakMz, basePeakIntens, tic float64) {
+	if len(p) == 0 {
+		return 0, 0, 0, 0, 0
+	}
+	lowMz, highMz = math.Inf(1), math.Inf(-1)
+	basePeak := Peak{}
+	for _, peak := range p {
+		lowMz = math.Min(lowMz, peak.Mz)
+		highMz = math.Max(highMz, peak.Mz)
+		if peak.Intens > basePeak.Intens {
+			basePeak = peak
+		}
+		tic += peak.Intens
+	}
+	return lowMz, highMz, basePeak.Mz, basePeak.Intens, tic
+}
+
+// encodePeaks encodes m/z-intensity pairs with the precision, byte order
+// and compression of pk
+func encodePeaks(pk *peaks, p []Peak) error {
+	order := byteOrder(pk)
+	var data []byte
+	if pk.Precision == 64 {
+		data = make([]byte, 16*len(p))
+		for i, peak := range p {
+			order.PutUint64(data[i*16:], math.Float64bits(peak.Mz))
+			order.PutUint64(data[i*16+8:], math.Float64bits(peak.Intens))
+		}
+	} else {
+		data = make([]byte, 8*len(p))
+		for i, peak := range p {
+			order.PutUint32(data[i*8:], math.Float32bits(float32(peak.Mz)))
+			order.PutUint32(data[i*8+4:], math.Float32bits(float32(peak.Intens)))
+		}
+	}
+	if pk.CompressionType == "zlib" {
+		var b bytes.Buffer
+		z := zlib.NewWriter(&b)
+		_, err := z.Write(data)
+		if err != nil {
+			return err
+		}
+		err = z.Close()
+		if err != nil {
+			return err
+		}
+		data = b.Bytes()
+		pk.CompressedLen = int64(len(data))
+	}
+	pk.Base64Str = base64.StdEncoding.EncodeToString(data)
+	return nil
+}
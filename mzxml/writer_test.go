@@ -0,0 +1,236 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package mzxml
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestUpdateScan(t *testing.T) {
+	tests := []struct {
+		name        string
+		precision   int64
+		byteOrder   string
+		compression string
+	}{
+		{name: "32 bit", precision: 32, byteOrder: "network"},
+		{name: "64 bit", precision: 64, byteOrder: "network"},
+		{name: "64 bit zlib", precision: 64, byteOrder: "network", compression: "zlib"},
+		{name: "32 bit little endian zlib", precision: 32, byteOrder: "little", compression: "zlib"},
+	}
+	newPeaks := []Peak{{Mz: 42.5, Intens: 10}, {Mz: 43.5, Intens: 30}, {Mz: 44.5, Intens: 20}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Read(strings.NewReader(testMzXML(5, 0)))
+			if err != nil {
+				t.Fatalf("Read: error return %v", err)
+			}
+			// Re-encode all scans with the requested encoding
+			for i := int64(0); i < f.NumSpecs(); i++ {
+				p, err := f.ReadScan(i)
+				if err != nil {
+					t.Fatalf("ReadScan: error return %v", err)
+				}
+				pk := &f.index2Scan[i].Peaks
+				pk.Precision = tt.precision
+				pk.ByteOrder = tt.byteOrder
+				pk.CompressionType = tt.compression
+				err = encodePeaks(pk, p)
+				if err != nil {
+					t.Fatalf("encodePeaks: error return %v", err)
+				}
+			}
+			f.index2Scan[3].TotIonCurrent = 3000
+			err = f.UpdateScan(3, newPeaks, true, true)
+			if err != nil {
+				t.Fatalf("UpdateScan: error return %v", err)
+			}
+			// Only intensities, number of peaks must match
+			err = f.UpdateScan(4, newPeaks, false, true)
+			if err != ErrPeakCount {
+				t.Errorf("UpdateScan: error return %v, should be ErrPeakCount", err)
+			}
+			err = f.UpdateScan(4, []Peak{{Mz: 1, Intens: 5}, {Mz: 2, Intens: 6}}, false, true)
+			if err != nil {
+				t.Fatalf("UpdateScan: error return %v", err)
+			}
+
+			var sb strings.Builder
+			err = f.Write(&sb)
+			if err != nil {
+				t.Fatalf("Write: error return %v", err)
+			}
+			checkIndex(t, sb.String(), 5)
+			f2, err := ReadIndexed(strings.NewReader(sb.String()))
+			if err != nil {
+				t.Fatalf("ReadIndexed: error return %v", err)
+			}
+			p, err := f2.ReadScan(3)
+			if err != nil || len(p) != 3 || p[0] != newPeaks[0] || p[2] != newPeaks[2] {
+				t.Errorf("ReadScan after update: %v (%v)", p, err)
+			}
+			p, err = f2.ReadScan(4)
+			if err != nil || len(p) != 2 || p[0].Mz != 104 || p[1].Intens != 6 {
+				t.Errorf("ReadScan after update: %v (%v)", p, err)
+			}
+			s, err := f2.scan(3)
+			if err != nil || s.Peaks.Precision != tt.precision ||
+				s.Peaks.ByteOrder != tt.byteOrder || s.Peaks.CompressionType != tt.compression {
+				t.Errorf("Peaks encoding after update: %+v (%v)", s.Peaks, err)
+			}
+			if s.TotIonCurrent != 60 {
+				t.Errorf("TotIonCurrent after update: %f, should be 60", s.TotIonCurrent)
+			}
+			if s.BasePeakMz != 0 {
+				t.Errorf("BasePeakMz after update: %f, should not be set", s.BasePeakMz)
+			}
+		})
+	}
+}
+
+func TestUpdateScanIndexed(t *testing.T) {
+	f, err := ReadIndexed(strings.NewReader(testMzXML(5, 0)))
+	if err != nil {
+		t.Fatalf("ReadIndexed: error return %v", err)
+	}
+	// Update a parent and one of its nested scans
+	for _, i := range []int64{2, 3} {
+		err = f.UpdateScan(i, []Peak{{Mz: 40 + float64(i), Intens: 1}}, true, true)
+		if err != nil {
+			t.Fatalf("UpdateScan: error return %v", err)
+		}
+	}
+	var sb strings.Builder
+	err = f.Write(&sb)
+	if err != nil {
+		t.Fatalf("Write: error return %v", err)
+	}
+	checkIndex(t, sb.String(), 5)
+	f2, err := Read(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	for i := int64(0); i < 5; i++ {
+		p, err := f2.ReadScan(i)
+		if err != nil {
+			t.Fatalf("ReadScan: error return %v", err)
+		}
+		if (i == 2 || i == 3) && (len(p) != 1 || p[0].Mz != 40+float64(i)) {
+			t.Errorf("ReadScan(%d) after update: %v", i, p)
+		}
+		if i != 2 && i != 3 && (len(p) != 2 || p[0].Mz != 100+float64(i)) {
+			t.Errorf("ReadScan(%d) after update: %v", i, p)
+		}
+	}
+	parent, err := f2.ParentScan(3)
+	if err != nil || parent != 2 {
+		t.Errorf("ParentScan after update: %d (%v), should be 2", parent, err)
+	}
+}
+
+func TestPrecursors(t *testing.T) {
+	doc := strings.Replace(testMzXML(5, 0), `precursorCharge="2">503.5`,
+		`precursorCharge="2" possibleCharges="2,3" windowWideness="2" activationMethod="HCD">503.5`, 1)
+	doc = strings.Replace(doc, `<scan num="13"`, `<scan num="13" collisionEnergy="30"`, 1)
+	f, err := ReadIndexed(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("ReadIndexed: error return %v", err)
+	}
+	prec, err := f.Precursors(0)
+	if err != nil || len(prec) != 0 {
+		t.Errorf("Precursors(0): %v (%v), should be empty", prec, err)
+	}
+	prec, err = f.Precursors(1)
+	if err != nil || len(prec) != 1 {
+		t.Fatalf("Precursors(1): %v (%v)", prec, err)
+	}
+	p := prec[0]
+	if p.Mz != 501.5 || p.ScanNum != 10 || p.ScanIndex != 0 || p.Charge != 2 ||
+		p.Intensity != 100 || !math.IsNaN(p.WindowWideness) || !math.IsNaN(p.CollisionEnergy) {
+		t.Errorf("Precursors(1): %+v", p)
+	}
+	prec, err = f.Precursors(3)
+	if err != nil || len(prec) != 1 {
+		t.Fatalf("Precursors(3): %v (%v)", prec, err)
+	}
+	p = prec[0]
+	if p.Mz != 503.5 || p.ScanIndex != 2 || p.ActivationMethod != "HCD" ||
+		p.CollisionEnergy != 30 || p.WindowWideness != 2 ||
+		len(p.PossibleCharges) != 2 || p.PossibleCharges[1] != 3 {
+		t.Errorf("Precursors(3): %+v", p)
+	}
+}
+
+func TestNestedScans(t *testing.T) {
+	doc := testMzXML(5, 0)
+	eager, err := Read(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	lazy, err := ReadIndexed(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("ReadIndexed: error return %v", err)
+	}
+	for _, f := range []*MzXML{&eager, &lazy} {
+		for i := int64(0); i < 5; i++ {
+			parent, err := f.ParentScan(i)
+			want := int64(-1)
+			if i%2 == 1 {
+				want = i - 1
+			}
+			if err != nil || parent != want {
+				t.Errorf("ParentScan(%d): %d (%v), should be %d", i, parent, err, want)
+			}
+			children, err := f.ChildScans(i)
+			if err != nil {
+				t.Fatalf("ChildScans: error return %v", err)
+			}
+			if i%2 == 0 && i < 4 && (len(children) != 1 || children[0] != i+1) {
+				t.Errorf("ChildScans(%d): %v, should be [%d]", i, children, i+1)
+			}
+			if (i%2 == 1 || i == 4) && len(children) != 0 {
+				t.Errorf("ChildScans(%d): %v, should be empty", i, children)
+			}
+		}
+		_, err = f.ParentScan(5)
+		if err != ErrInvalidScanIndex {
+			t.Errorf("ParentScan: error return %v, should be ErrInvalidScanIndex", err)
+		}
+	}
+}
+
+func TestWritePrecursorIntensity(t *testing.T) {
+	nan := math.NaN()
+	f := New()
+	for i, intensity := range []float64{nan, 0, 250} {
+		_, err := f.AppendScan(ScanData{MSLevel: 2, RetentionTime: nan, CollisionEnergy: nan, StartMz: nan, EndMz: nan,
+			Precursors: []Precursor{{Mz: 500 + float64(i), ScanIndex: -1, Intensity: intensity, WindowWideness: nan}}})
+		if err != nil {
+			t.Fatalf("AppendScan: error return %v", err)
+		}
+	}
+	var sb strings.Builder
+	err := f.Write(&sb)
+	if err != nil {
+		t.Fatalf("Write: error return %v", err)
+	}
+	if n := strings.Count(sb.String(), "precursorIntensity="); n != 2 {
+		t.Errorf("Write: %d precursorIntensity attributes, should be 2", n)
+	}
+	f2, err := Read(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	for i, want := range []float64{nan, 0, 250} {
+		prec, err := f2.Precursors(int64(i))
+		if err != nil || len(prec) != 1 {
+			t.Fatalf("Precursors(%d): %v (%v)", i, prec, err)
+		}
+		if got := prec[0].Intensity; got != want && !(math.IsNaN(got) && math.IsNaN(want)) {
+			t.Errorf("Precursors(%d): intensity %v, should be %v", i, got, want)
+		}
+	}
+}
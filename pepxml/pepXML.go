@@ -5,6 +5,119 @@ package pepxml
 
 import (
 	"encoding/xml"
+	"errors"
+)
+
+// PepXML contains the spectrum queries of a pepXML file
+type PepXML struct {
+	runs    []RunSummary
+	queries []SpectrumQuery
+}
+
+// RunSummary contains the information of an msms_run_summary
+type RunSummary struct {
+	BaseName       string
+	RawDataType    string
+	RawData        string
+	MsManufacturer string
+	MsModel        string
+	Enzyme         Enzyme
+	Searches       []SearchSummary
+}
+
+// Enzyme describes the enzyme used to digest the sample
+type Enzyme struct {
+	Name  string
+	Cut   string // Residues after which the enzyme cuts
+	NoCut string // Residues that block cleavage
+	Sense string // "C" or "N"
+}
+
+// SearchSummary contains the settings of a database search
+type SearchSummary struct {
+	BaseName            string
+	SearchEngine        string
+	SearchEngineVersion string
+	PrecursorMassType   string // "monoisotopic" or "average"
+	FragmentMassType    string // "monoisotopic" or "average"
+	SearchID            int
+	Database            string
+	DatabaseType        string // "AA" or "NA"
+	SearchEnzyme        string
+	MaxMissedCleavages  int
+	MinNumTermini       int
+	Modifications       []Modification
+	Params              []Param
+}
+
+// Modification describes a static or variable modification that
+// was specified for the search
+type Modification struct {
+	AminoAcid       string // Empty for terminal modifications
+	Terminus        string // "n" or "c" for terminal modifications
+	ProteinTerminus bool
+	MassDiff        float64
+	Mass            float64 // Mass of the modified residue or terminus
+	Variable        bool
+	Symbol          string
+}
+
+// Param is a name/value pair of a search parameter
+type Param struct {
+	Name  string
+	Value string
+}
+
+// SpectrumQuery contains the search results of a single spectrum
+type SpectrumQuery struct {
+	Run                  int // Index of the msms_run_summary
+	Spectrum             string
+	SpectrumNativeID     string
+	StartScan            int
+	EndScan              int
+	PrecursorNeutralMass float64
+	Charge               int
+	Index                int
+	RetentionTime        float64 // Retention time in seconds, NaN if absent
+	Hits                 []SearchHit
+}
+
+// SearchHit is a peptide that was matched to a spectrum
+type SearchHit struct {
+	Rank                int
+	Peptide             string
+	ModifiedPeptide     string // Equal to Peptide if unmodified
+	PrevAA              string
+	NextAA              string
+	Protein             string
+	AlternativeProteins []string
+	NumTotProteins      int
+	NumMatchedIons      int
+	TotNumIons          int
+	CalcNeutralPepMass  float64
+	MassDiff            float64
+	NumTolTerm          int
+	NumMissedCleavages  int
+	Mods                []ModPosition
+	NTermMass           float64 // Mass of the modified N-terminus, 0 if unmodified
+	CTermMass           float64 // Mass of the modified C-terminus, 0 if unmodified
+	Scores              map[string]float64
+	PeptideProphet      *float64 // PeptideProphet probability, nil if absent
+	IProphet            *float64 // iProphet probability, nil if absent
+}
+
+// ModPosition is a modified residue of a peptide
+type ModPosition struct {
+	Position int     // 1-based position in the peptide
+	Mass     float64 // Mass of the modified residue
+}
+
+var (
+	ErrInvalidQueryIndex = errors.New("pepxml: invalid query index")
+	ErrInvalidFormat     = errors.New("pepxml: invalid format")
+	ErrMissingAttribute  = errors.New("pepxml: missing required attribute")
+	ErrInvalidAttribute  = errors.New("pepxml: invalid attribute value")
+	ErrWriterState       = errors.New("pepxml: write calls out of order")
 )
 
 // Types for parsing pepXML
@@ -28,13 +141,13 @@ type msmsRunSummary struct {
 	RawDataType    string          `xml:"raw_data_type,attr,omitempty"`
 	RawData        string          `xml:"raw_data,attr,omitempty"`
 	SampleEnzyme   sampleEnzyme    `xml:"sample_enzyme"`
-	SearchSummary  searchSummary   `xml:"search_summary"`
+	SearchSummary  []searchSummary `xml:"search_summary"`
 	SpectrumQuery  []spectrumQuery `xml:"spectrum_query"`
 }
 
 type sampleEnzyme struct {
-	Name        string      `xml:"name,attr,omitempty"`
-	Specificity specificity `xml:"specificity"`
+	Name        string       `xml:"name,attr,omitempty"`
+	Specificity *specificity `xml:"specificity"`
 }
 
 type specificity struct {
@@ -44,16 +157,17 @@ type specificity struct {
 }
 
 type searchSummary struct {
-	BaseName                  string                    `xml:"base_name,attr,omitempty"`
-	SearchEngine              string                    `xml:"search_engine,attr,omitempty"`
-	SearchEngineVersion       string                    `xml:"search_engine_version,attr,omitempty"`
-	PrecursorMassType         string                    `xml:"precursor_mass_type,attr,omitempty"`
-	FragmentMassType          string                    `xml:"fragment_mass_type,attr,omitempty"`
-	SearchID                  string                    `xml:"search_id,attr,omitempty"`
-	SearchDatabase            searchDatabase            `xml:"search_database"`
-	EnzymaticSearchConstraint enzymaticSearchConstraint `xml:"enzymatic_search_constraint"`
-	AminoacidModification     []aminoacidModification   `xml:"aminoacid_modification,omitempty"`
-	Parameter                 []strParameter            `xml:"parameter,omitempty"`
+	BaseName                  string                     `xml:"base_name,attr,omitempty"`
+	SearchEngine              string                     `xml:"search_engine,attr,omitempty"`
+	SearchEngineVersion       string                     `xml:"search_engine_version,attr,omitempty"`
+	PrecursorMassType         string                     `xml:"precursor_mass_type,attr,omitempty"`
+	FragmentMassType          string                     `xml:"fragment_mass_type,attr,omitempty"`
+	SearchID                  string                     `xml:"search_id,attr,omitempty"`
+	SearchDatabase            *searchDatabase            `xml:"search_database"`
+	EnzymaticSearchConstraint *enzymaticSearchConstraint `xml:"enzymatic_search_constraint"`
+	AminoacidModification     []aminoacidModification    `xml:"aminoacid_modification,omitempty"`
+	TerminalModification      []terminalModification     `xml:"terminal_modification,omitempty"`
+	Parameter                 []strParameter             `xml:"parameter,omitempty"`
 }
 
 type searchDatabase struct {
@@ -63,8 +177,8 @@ type searchDatabase struct {
 
 type enzymaticSearchConstraint struct {
 	Enzyme                  string `xml:"enzyme,attr,omitempty"`
-	MaxNumInternalCleavages int    `xml:"max_num_internal_cleavages,attr,omitempty"`
-	MinNumberTermini        int    `xml:"min_number_termini,attr,omitempty"`
+	MaxNumInternalCleavages int    `xml:"max_num_internal_cleavages,attr"`
+	MinNumberTermini        int    `xml:"min_number_termini,attr"`
 }
 type aminoacidModification struct {
 	Aminoacid string `xml:"aminoacid,attr,omitempty"`
@@ -74,21 +188,30 @@ type aminoacidModification struct {
 	Symbol    string `xml:"symbol,attr,omitempty"`
 }
 
+type terminalModification struct {
+	Terminus        string `xml:"terminus,attr,omitempty"`
+	Massdiff        string `xml:"massdiff,attr,omitempty"`
+	Mass            string `xml:"mass,attr,omitempty"`
+	Variable        string `xml:"variable,attr,omitempty"`
+	Symbol          string `xml:"symbol,attr,omitempty"`
+	ProteinTerminus string `xml:"protein_terminus,attr,omitempty"`
+}
+
 type strParameter struct {
 	Name  string `xml:"name,attr,omitempty"`
 	Value string `xml:"value,attr,omitempty"`
 }
 
 type spectrumQuery struct {
-	Spectrum             string       `xml:"spectrum,attr,omitempty"`
-	SpectrumNativeID     string       `xml:"spectrumNativeID,attr,omitempty"`
-	StartScan            int          `xml:"start_scan,attr"`
-	EndScan              int          `xml:"end_scan,attr"`
-	PrecursorNeutralMass float64      `xml:"precursor_neutral_mass,attr"`
-	AssumedCharge        int          `xml:"assumed_charge,attr"`
-	Index                int          `xml:"index,attr"`
-	RetentionTime        float64      `xml:"retention_time_sec,attr"`
-	SearchResult         searchResult `xml:"search_result"`
+	Spectrum             string         `xml:"spectrum,attr,omitempty"`
+	SpectrumNativeID     string         `xml:"spectrumNativeID,attr,omitempty"`
+	StartScan            int            `xml:"start_scan,attr"`
+	EndScan              int            `xml:"end_scan,attr"`
+	PrecursorNeutralMass float64        `xml:"precursor_neutral_mass,attr"`
+	AssumedCharge        int            `xml:"assumed_charge,attr"`
+	Index                int            `xml:"index,attr"`
+	RetentionTime        float64        `xml:"retention_time_sec,attr,omitempty"`
+	SearchResult         []searchResult `xml:"search_result"`
 }
 
 type searchResult struct {
@@ -98,8 +221,8 @@ type searchResult struct {
 type searchHit struct {
 	HitRank            int                  `xml:"hit_rank,attr"`
 	Peptide            string               `xml:"peptide,attr"`
-	PeptidePrevAA      string               `xml:"peptide_prev_aa,attr"`
-	PeptideNextAA      string               `xml:"peptide_next_aa,attr"`
+	PeptidePrevAA      string               `xml:"peptide_prev_aa,attr,omitempty"`
+	PeptideNextAA      string               `xml:"peptide_next_aa,attr,omitempty"`
 	Protein            string               `xml:"protein,attr"`
 	NumTotProteins     int                  `xml:"num_tot_proteins,attr"`
 	NumMatchedIons     int                  `xml:"num_matched_ions,attr"`
@@ -108,7 +231,7 @@ type searchHit struct {
 	Massdiff           float64              `xml:"massdiff,attr"`
 	NumTolTerm         int                  `xml:"num_tol_term,attr"`
 	NumMissedCleavages int                  `xml:"num_missed_cleavages,attr"`
-	NumMatchedPeptides int                  `xml:"num_matched_peptides,attr"`
+	NumMatchedPeptides int                  `xml:"num_matched_peptides,attr,omitempty"`
 	AlternativeProtein []alternativeProtein `xml:"alternative_protein"`
 	ModificationInfo   []modificationInfo   `xml:"modification_info"`
 	SearchScore        []searchScore        `xml:"search_score"`
@@ -120,14 +243,16 @@ type alternativeProtein struct {
 }
 
 type modificationInfo struct {
-	ModifiedPeptide  string             `xml:"modified_peptide,attr"`
+	ModifiedPeptide  string             `xml:"modified_peptide,attr,omitempty"`
+	ModNTermMass     float64            `xml:"mod_nterm_mass,attr,omitempty"`
+	ModCTermMass     float64            `xml:"mod_cterm_mass,attr,omitempty"`
 	ModAminoacidMass []modAminoacidMass `xml:"mod_aminoacid_mass"`
 }
 
 type modAminoacidMass struct {
 	Position int     `xml:"position,attr"`
 	Mass     float64 `xml:"mass,attr"`
-	Static   float64 `xml:"static,attr"`
+	Static   float64 `xml:"static,attr,omitempty"`
 }
 
 type searchScore struct {
@@ -136,12 +261,19 @@ type searchScore struct {
 }
 
 type analysisResult struct {
-	PeptideprophetResult peptideprophetResult `xml:"peptideprophet_result"`
+	Analysis             string                `xml:"analysis,attr"`
+	PeptideprophetResult *peptideprophetResult `xml:"peptideprophet_result"`
+	InterprophetResult   *interprophetResult   `xml:"interprophet_result"`
 }
 
 type peptideprophetResult struct {
-	SearchScoreSummary searchScoreSummary `xml:"search_score_summary"`
-	Probability        float64            `xml:"probability,attr"`
+	SearchScoreSummary *searchScoreSummary `xml:"search_score_summary"`
+	Probability        float64             `xml:"probability,attr"`
+}
+
+type interprophetResult struct {
+	SearchScoreSummary *searchScoreSummary `xml:"search_score_summary"`
+	Probability        float64             `xml:"probability,attr"`
 }
 
 type searchScoreSummary struct {
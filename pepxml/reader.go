@@ -0,0 +1,292 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package pepxml
+
+import (
+	"encoding/xml"
+	"io"
+	"math"
+	"strconv"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Reader reads the spectrum queries of a pepXML file one by one
+type Reader struct {
+	decoder *xml.Decoder
+	runs    []RunSummary
+}
+
+// NewReader returns a Reader that reads pepXML from r
+func NewReader(r io.Reader) *Reader {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = charset.NewReaderLabel
+	return &Reader{decoder: d}
+}
+
+// Runs returns the msms_run_summary elements that have been read so far
+func (r *Reader) Runs() []RunSummary {
+	return r.runs
+}
+
+// Read returns the next spectrum query. At the end of the file,
+// it returns io.EOF.
+func (r *Reader) Read() (SpectrumQuery, error) {
+	for {
+		t, err := r.decoder.Token()
+		if err != nil {
+			return SpectrumQuery{}, err
+		}
+		se, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "msms_pipeline_analysis":
+		case "msms_run_summary":
+			r.runs = append(r.runs, runSummary(se.Attr))
+		case "sample_enzyme":
+			var e sampleEnzyme
+			err = r.decoder.DecodeElement(&e, &se)
+			if err != nil {
+				return SpectrumQuery{}, err
+			}
+			if len(r.runs) == 0 {
+				return SpectrumQuery{}, ErrInvalidFormat
+			}
+			enzyme := Enzyme{Name: e.Name}
+			if e.Specificity != nil {
+				enzyme.Cut = e.Specificity.Cut
+				enzyme.NoCut = e.Specificity.NoCut
+				enzyme.Sense = e.Specificity.Sense
+			}
+			r.runs[len(r.runs)-1].Enzyme = enzyme
+		case "search_summary":
+			var s searchSummary
+			err = r.decoder.DecodeElement(&s, &se)
+			if err != nil {
+				return SpectrumQuery{}, err
+			}
+			if len(r.runs) == 0 {
+				return SpectrumQuery{}, ErrInvalidFormat
+			}
+			search, err := s.toSearchSummary()
+			if err != nil {
+				return SpectrumQuery{}, err
+			}
+			run := &r.runs[len(r.runs)-1]
+			run.Searches = append(run.Searches, search)
+		case "spectrum_query":
+			if len(r.runs) == 0 {
+				return SpectrumQuery{}, ErrInvalidFormat
+			}
+			// Attributes that are absent keep their initial value
+			q := spectrumQuery{RetentionTime: math.NaN()}
+			err = r.decoder.DecodeElement(&q, &se)
+			if err != nil {
+				return SpectrumQuery{}, err
+			}
+			return q.toSpectrumQuery(len(r.runs) - 1), nil
+		default:
+			// Analysis summaries, dataset derivation etc.
+			err = r.decoder.Skip()
+			if err != nil {
+				return SpectrumQuery{}, err
+			}
+		}
+	}
+}
+
+// Read reads all spectrum queries of a pepXML file from an io.Reader
+func Read(reader io.Reader) (PepXML, error) {
+	var p PepXML
+	r := NewReader(reader)
+	for {
+		q, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return p, err
+		}
+		p.queries = append(p.queries, q)
+	}
+	p.runs = r.Runs()
+	return p, nil
+}
+
+// Runs returns the msms_run_summary elements of the file
+func (p *PepXML) Runs() []RunSummary {
+	return p.runs
+}
+
+// NumQueries returns the number of spectrum queries
+func (p *PepXML) NumQueries() int {
+	return len(p.queries)
+}
+
+// Query returns a spectrum query. The index runs from 0 to NumQueries()-1
+func (p *PepXML) Query(i int) (SpectrumQuery, error) {
+	if i < 0 || i >= len(p.queries) {
+		return SpectrumQuery{}, ErrInvalidQueryIndex
+	}
+	return p.queries[i], nil
+}
+
+// runSummary fills a RunSummary from the attributes of an msms_run_summary.
+// The element itself isn't decoded, because it contains all spectrum queries.
+func runSummary(attrs []xml.Attr) RunSummary {
+	var run RunSummary
+	for _, a := range attrs {
+		switch a.Name.Local {
+		case "base_name":
+			run.BaseName = a.Value
+		case "raw_data_type":
+			run.RawDataType = a.Value
+		case "raw_data":
+			run.RawData = a.Value
+		case "msManufacturer":
+			run.MsManufacturer = a.Value
+		case "msModel":
+			run.MsModel = a.Value
+		}
+	}
+	return run
+}
+
+func (s *searchSummary) toSearchSummary() (SearchSummary, error) {
+	var err error
+	search := SearchSummary{
+		BaseName:            s.BaseName,
+		SearchEngine:        s.SearchEngine,
+		SearchEngineVersion: s.SearchEngineVersion,
+		PrecursorMassType:   s.PrecursorMassType,
+		FragmentMassType:    s.FragmentMassType,
+	}
+	if s.SearchDatabase != nil {
+		search.Database = s.SearchDatabase.LocalPath
+		search.DatabaseType = s.SearchDatabase.Type
+	}
+	if s.EnzymaticSearchConstraint != nil {
+		search.SearchEnzyme = s.EnzymaticSearchConstraint.Enzyme
+		search.MaxMissedCleavages = s.EnzymaticSearchConstraint.MaxNumInternalCleavages
+		search.MinNumTermini = s.EnzymaticSearchConstraint.MinNumberTermini
+	}
+	if s.SearchID != `` {
+		search.SearchID, err = strconv.Atoi(s.SearchID)
+		if err != nil {
+			return search, err
+		}
+	}
+	for _, m := range s.AminoacidModification {
+		mod := Modification{
+			AminoAcid: m.Aminoacid,
+			Variable:  m.Variable == "Y",
+			Symbol:    m.Symbol,
+		}
+		mod.MassDiff, mod.Mass, err = parseModMass(m.Massdiff, m.Mass)
+		if err != nil {
+			return search, err
+		}
+		search.Modifications = append(search.Modifications, mod)
+	}
+	for _, m := range s.TerminalModification {
+		mod := Modification{
+			Terminus:        m.Terminus,
+			ProteinTerminus: m.ProteinTerminus == "Y",
+			Variable:        m.Variable == "Y",
+			Symbol:          m.Symbol,
+		}
+		mod.MassDiff, mod.Mass, err = parseModMass(m.Massdiff, m.Mass)
+		if err != nil {
+			return search, err
+		}
+		search.Modifications = append(search.Modifications, mod)
+	}
+	for _, p := range s.Parameter {
+		search.Params = append(search.Params, Param{Name: p.Name, Value: p.Value})
+	}
+	return search, nil
+}
+
+func parseModMass(massDiffStr, massStr string) (float64, float64, error) {
+	massDiff, err := strconv.ParseFloat(massDiffStr, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	mass, err := strconv.ParseFloat(massStr, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return massDiff, mass, nil
+}
+
+func (q *spectrumQuery) toSpectrumQuery(run int) SpectrumQuery {
+	query := SpectrumQuery{
+		Run:                  run,
+		Spectrum:             q.Spectrum,
+		SpectrumNativeID:     q.SpectrumNativeID,
+		StartScan:            q.StartScan,
+		EndScan:              q.EndScan,
+		PrecursorNeutralMass: q.PrecursorNeutralMass,
+		Charge:               q.AssumedCharge,
+		Index:                q.Index,
+		RetentionTime:        q.RetentionTime,
+	}
+	// Multiple search results occur when a spectrum was searched more than once
+	for _, r := range q.SearchResult {
+		for i := range r.SearchHit {
+			query.Hits = append(query.Hits, r.SearchHit[i].toSearchHit())
+		}
+	}
+	return query
+}
+
+func (h *searchHit) toSearchHit() SearchHit {
+	hit := SearchHit{
+		Rank:               h.HitRank,
+		Peptide:            h.Peptide,
+		ModifiedPeptide:    h.Peptide,
+		PrevAA:             h.PeptidePrevAA,
+		NextAA:             h.PeptideNextAA,
+		Protein:            h.Protein,
+		NumTotProteins:     h.NumTotProteins,
+		NumMatchedIons:     h.NumMatchedIons,
+		TotNumIons:         h.TotNumIons,
+		CalcNeutralPepMass: h.CalcNeutralPepMass,
+		MassDiff:           h.Massdiff,
+		NumTolTerm:         h.NumTolTerm,
+		NumMissedCleavages: h.NumMissedCleavages,
+		Scores:             make(map[string]float64, len(h.SearchScore)),
+	}
+	for _, p := range h.AlternativeProtein {
+		hit.AlternativeProteins = append(hit.AlternativeProteins, p.Protein)
+	}
+	// The schema allows only one modification_info
+	if len(h.ModificationInfo) > 0 {
+		mi := h.ModificationInfo[0]
+		if mi.ModifiedPeptide != `` {
+			hit.ModifiedPeptide = mi.ModifiedPeptide
+		}
+		hit.NTermMass = mi.ModNTermMass
+		hit.CTermMass = mi.ModCTermMass
+		for _, m := range mi.ModAminoacidMass {
+			hit.Mods = append(hit.Mods, ModPosition{Position: m.Position, Mass: m.Mass})
+		}
+	}
+	for _, s := range h.SearchScore {
+		hit.Scores[s.Name] = s.Value
+	}
+	for _, a := range h.AnalysisResult {
+		if a.PeptideprophetResult != nil {
+			p := a.PeptideprophetResult.Probability
+			hit.PeptideProphet = &p
+		}
+		if a.InterprophetResult != nil {
+			p := a.InterprophetResult.Probability
+			hit.IProphet = &p
+		}
+	}
+	return hit
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package pepxml
+
+import (
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPepXML = `<?xml version="1.0" encoding="UTF-8"?>
+<msms_pipeline_analysis date="2021-01-01T00:00:00" xmlns="http://regis-web.systemsbiology.net/pepXML" summary_xml="test.pep.xml">
+<analysis_summary analysis="peptideprophet" time="2021-01-01T00:00:00">
+<peptideprophet_summary version="1" min_prob="0.05"><inputfile name="test.pep.xml"/></peptideprophet_summary>
+</analysis_summary>
+<msms_run_summary base_name="/data/run1" raw_data_type="raw" raw_data=".mzML" msManufacturer="Thermo" msModel="Q Exactive">
+<sample_enzyme name="trypsin">
+<specificity cut="KR" no_cut="P" sense="C"/>
+</sample_enzyme>
+<search_summary base_name="/data/run1" search_engine="Comet" search_engine_version="2021.01" precursor_mass_type="monoisotopic" fragment_mass_type="monoisotopic" search_id="1">
+<search_database local_path="/db/human.fasta" type="AA"/>
+<enzymatic_search_constraint enzyme="trypsin" max_num_internal_cleavages="2" min_number_termini="2"/>
+<aminoacid_modification aminoacid="C" massdiff="57.021464" mass="160.030649" variable="N"/>
+<aminoacid_modification aminoacid="M" massdiff="15.994915" mass="147.035400" variable="Y" symbol="*"/>
+<terminal_modification terminus="n" massdiff="42.010565" mass="43.018390" variable="Y" protein_terminus="Y"/>
+<parameter name="peptide_mass_tolerance" value="20.00"/>
+</search_summary>
+<spectrum_query spectrum="run1.00010.00010.2" spectrumNativeID="scan=10" start_scan="10" end_scan="10" precursor_neutral_mass="1234.5678" assumed_charge="2" index="1" retention_time_sec="600.5">
+<search_result>
+<search_hit hit_rank="1" peptide="PEPTMCK" peptide_prev_aa="K" peptide_next_aa="A" protein="sp|P1|PROT1" num_tot_proteins="2" num_matched_ions="8" tot_num_ions="12" calc_neutral_pep_mass="1234.5600" massdiff="0.0078" num_tol_term="2" num_missed_cleavages="0">
+<alternative_protein protein="sp|P2|PROT2"/>
+<modification_info modified_peptide="n[43]PEPTM[147]C[160]K" mod_nterm_mass="43.018390">
+<mod_aminoacid_mass position="5" mass="147.035400"/>
+<mod_aminoacid_mass position="6" mass="160.030649"/>
+</modification_info>
+<search_score name="xcorr" value="3.25"/>
+<search_score name="expect" value="1.5e-5"/>
+<analysis_result analysis="peptideprophet">
+<peptideprophet_result probability="0.9876" all_ntt_prob="(0,0,0.9876)"/>
+</analysis_result>
+<analysis_result analysis="interprophet">
+<interprophet_result probability="0.9912" all_ntt_prob="(0,0,0.9912)"/>
+</analysis_result>
+</search_hit>
+<search_hit hit_rank="2" peptide="PEPTIDEK" protein="sp|P3|PROT3" calc_neutral_pep_mass="1234.6000" massdiff="-0.03" num_tot_proteins="1">
+<search_score name="xcorr" value="1.5"/>
+</search_hit>
+</search_result>
+</spectrum_query>
+</msms_run_summary>
+<msms_run_summary base_name="/data/run2" raw_data_type="raw" raw_data=".mzXML">
+<search_summary base_name="/data/run2" search_engine="X! Tandem" precursor_mass_type="monoisotopic" fragment_mass_type="monoisotopic">
+<search_database local_path="/db/human.fasta" type="AA"/>
+</search_summary>
+<spectrum_query spectrum="run2.00020.00020.3" start_scan="20" end_scan="20" precursor_neutral_mass="2000.1" assumed_charge="3" index="2">
+<search_result/>
+</spectrum_query>
+</msms_run_summary>
+</msms_pipeline_analysis>
+`
+
+func TestReader(t *testing.T) {
+	r := NewReader(strings.NewReader(testPepXML))
+	q, err := r.Read()
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	if q.Run != 0 || q.Spectrum != "run1.00010.00010.2" || q.SpectrumNativeID != "scan=10" ||
+		q.StartScan != 10 || q.Charge != 2 || q.PrecursorNeutralMass != 1234.5678 ||
+		q.RetentionTime != 600.5 || len(q.Hits) != 2 {
+		t.Fatalf("Read: %+v", q)
+	}
+	h := q.Hits[0]
+	if h.Rank != 1 || h.Peptide != "PEPTMCK" || h.ModifiedPeptide != "n[43]PEPTM[147]C[160]K" ||
+		h.PrevAA != "K" || h.NextAA != "A" || h.Protein != "sp|P1|PROT1" ||
+		!reflect.DeepEqual(h.AlternativeProteins, []string{"sp|P2|PROT2"}) ||
+		h.CalcNeutralPepMass != 1234.56 || h.NTermMass != 43.01839 {
+		t.Errorf("Hit 1: %+v", h)
+	}
+	wantMods := []ModPosition{{Position: 5, Mass: 147.0354}, {Position: 6, Mass: 160.030649}}
+	if !reflect.DeepEqual(h.Mods, wantMods) {
+		t.Errorf("Mods: %v, should be %v", h.Mods, wantMods)
+	}
+	wantScores := map[string]float64{"xcorr": 3.25, "expect": 1.5e-5}
+	if !reflect.DeepEqual(h.Scores, wantScores) {
+		t.Errorf("Scores: %v, should be %v", h.Scores, wantScores)
+	}
+	if h.PeptideProphet == nil || *h.PeptideProphet != 0.9876 || h.IProphet == nil || *h.IProphet != 0.9912 {
+		t.Errorf("Probabilities: %v %v", h.PeptideProphet, h.IProphet)
+	}
+	h = q.Hits[1]
+	if h.ModifiedPeptide != "PEPTIDEK" || h.Mods != nil || h.Scores["xcorr"] != 1.5 ||
+		h.PeptideProphet != nil || h.IProphet != nil {
+		t.Errorf("Hit 2: %+v", h)
+	}
+
+	q, err = r.Read()
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	if q.Run != 1 || q.Charge != 3 || !math.IsNaN(q.RetentionTime) || len(q.Hits) != 0 {
+		t.Errorf("Read: %+v", q)
+	}
+	_, err = r.Read()
+	if err != io.EOF {
+		t.Errorf("Read: error return %v, should be io.EOF", err)
+	}
+
+	runs := r.Runs()
+	if len(runs) != 2 {
+		t.Fatalf("Runs: %d, should be 2", len(runs))
+	}
+	wantEnzyme := Enzyme{Name: "trypsin", Cut: "KR", NoCut: "P", Sense: "C"}
+	if runs[0].BaseName != "/data/run1" || runs[0].MsModel != "Q Exactive" || runs[0].Enzyme != wantEnzyme {
+		t.Errorf("Run 1: %+v", runs[0])
+	}
+	if len(runs[0].Searches) != 1 {
+		t.Fatalf("Searches: %d, should be 1", len(runs[0].Searches))
+	}
+	s := runs[0].Searches[0]
+	if s.SearchEngine != "Comet" || s.SearchID != 1 || s.Database != "/db/human.fasta" ||
+		s.SearchEnzyme != "trypsin" || s.MaxMissedCleavages != 2 || s.MinNumTermini != 2 ||
+		!reflect.DeepEqual(s.Params, []Param{{Name: "peptide_mass_tolerance", Value: "20.00"}}) {
+		t.Errorf("Search: %+v", s)
+	}
+	wantMod := []Modification{
+		{AminoAcid: "C", MassDiff: 57.021464, Mass: 160.030649},
+		{AminoAcid: "M", MassDiff: 15.994915, Mass: 147.0354, Variable: true, Symbol: "*"},
+		{Terminus: "n", MassDiff: 42.010565, Mass: 43.01839, Variable: true, ProteinTerminus: true},
+	}
+	if !reflect.DeepEqual(s.Modifications, wantMod) {
+		t.Errorf("Modifications: %+v, should be %+v", s.Modifications, wantMod)
+	}
+	if runs[1].RawData != ".mzXML" || len(runs[1].Searches) != 1 || runs[1].Searches[0].SearchEngine != "X! Tandem" {
+		t.Errorf("Run 2: %+v", runs[1])
+	}
+}
+
+func TestRead(t *testing.T) {
+	p, err := Read(strings.NewReader(testPepXML))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	if p.NumQueries() != 2 || len(p.Runs()) != 2 {
+		t.Errorf("NumQueries: %d, runs %d", p.NumQueries(), len(p.Runs()))
+	}
+	q, err := p.Query(1)
+	if err != nil || q.Spectrum != "run2.00020.00020.3" {
+		t.Errorf("Query: %+v, error return %v", q, err)
+	}
+	_, err = p.Query(2)
+	if err != ErrInvalidQueryIndex {
+		t.Errorf("Query: error return %v, should be %v", err, ErrInvalidQueryIndex)
+	}
+	_, err = Read(strings.NewReader(`<msms_pipeline_analysis><spectrum_query/></msms_pipeline_analysis>`))
+	if err != ErrInvalidFormat {
+		t.Errorf("Read: error return %v, should be %v", err, ErrInvalidFormat)
+	}
+}
@@ -0,0 +1,403 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package pepxml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	pepXMLNamespace      = "http://regis-web.systemsbiology.net/pepXML"
+	pepXMLSchemaLocation = pepXMLNamespace + " http://sashimi.sourceforge.net/schema_revision/pepXML/pepXML_v122.xsd"
+)
+
+// Writer writes spectrum queries to a pepXML file
+type Writer struct {
+	w     *bufio.Writer
+	err   error
+	state int
+}
+
+// Writer states
+const (
+	stateStart = iota
+	stateHeader
+	stateRun
+	stateClosed
+)
+
+// NewWriter returns a Writer that writes to w.
+// WriteHeader must be called first, then WriteRun and Write for each run.
+// Close must be called when all spectrum queries are written.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// WriteHeader writes the msms_pipeline_analysis start tag.
+// summaryXML is the name of the pepXML file.
+func (w *Writer) WriteHeader(summaryXML string, date time.Time) error {
+	if w.state != stateStart {
+		return ErrWriterState
+	}
+	if summaryXML == `` {
+		return missingAttr("msms_pipeline_analysis", "summary_xml")
+	}
+	w.str(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	w.str(startTag("msms_pipeline_analysis",
+		"date", date.Format("2006-01-02T15:04:05"),
+		"xmlns", pepXMLNamespace,
+		"xmlns:xsi", "http://www.w3.org/2001/XMLSchema-instance",
+		"xsi:schemaLocation", pepXMLSchemaLocation,
+		"summary_xml", summaryXML) + "\n")
+	w.state = stateHeader
+	return w.err
+}
+
+// WriteRun starts a new msms_run_summary and writes its enzyme and
+// search summaries. The previous run, if any, is ended.
+func (w *Writer) WriteRun(run *RunSummary) error {
+	if w.state != stateHeader && w.state != stateRun {
+		return ErrWriterState
+	}
+	e, err := run.toXML()
+	if err != nil {
+		return err
+	}
+	if w.state == stateRun {
+		w.str(" </msms_run_summary>\n")
+	}
+	w.str(" " + startTag("msms_run_summary", nonEmptyAttrs(
+		"base_name", run.BaseName,
+		"msManufacturer", run.MsManufacturer,
+		"msModel", run.MsModel,
+		"raw_data_type", run.RawDataType,
+		"raw_data", run.RawData)...) + "\n")
+	if e.SampleEnzyme.Name != `` {
+		w.element("  ", "sample_enzyme", &e.SampleEnzyme)
+	}
+	for i := range e.SearchSummary {
+		w.element("  ", "search_summary", &e.SearchSummary[i])
+	}
+	w.state = stateRun
+	return w.err
+}
+
+// Write writes a spectrum query to the current msms_run_summary.
+// The Run field of q is ignored, as are probabilities and
+// a retention time that are NaN.
+func (w *Writer) Write(q *SpectrumQuery) error {
+	if w.state != stateRun {
+		return ErrWriterState
+	}
+	e, err := q.toXML()
+	if err != nil {
+		return err
+	}
+	w.element("  ", "spectrum_query", e)
+	return w.err
+}
+
+// Close ends the open elements and flushes the output.
+// It doesn't close the underlying io.Writer.
+func (w *Writer) Close() error {
+	if w.state == stateStart || w.state == stateClosed {
+		return ErrWriterState
+	}
+	if w.state == stateRun {
+		w.str(" </msms_run_summary>\n")
+	}
+	w.str("</msms_pipeline_analysis>\n")
+	w.state = stateClosed
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+func (w *Writer) str(s string) {
+	if w.err == nil {
+		_, w.err = w.w.WriteString(s)
+	}
+}
+
+// element writes v as XML element with the given name, indented by prefix
+func (w *Writer) element(prefix string, name string, v interface{}) {
+	if w.err != nil {
+		return
+	}
+	var b bytes.Buffer
+	enc := xml.NewEncoder(&b)
+	enc.Indent(prefix, ` `)
+	w.err = enc.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}})
+	b.WriteString("\n")
+	w.str(b.String())
+}
+
+// startTag returns an XML start tag, attrs contains attribute name/value pairs
+func startTag(name string, attrs ...string) string {
+	var b bytes.Buffer
+	b.WriteString("<" + name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		b.WriteString(" " + attrs[i] + "=\"")
+		xml.EscapeText(&b, []byte(attrs[i+1]))
+		b.WriteString("\"")
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// nonEmptyAttrs returns the attribute name/value pairs that have a value
+func nonEmptyAttrs(attrs ...string) []string {
+	res := make([]string, 0, len(attrs))
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] != `` {
+			res = append(res, attrs[i], attrs[i+1])
+		}
+	}
+	return res
+}
+
+func missingAttr(element, attr string) error {
+	return fmt.Errorf("%w: %s %s", ErrMissingAttribute, element, attr)
+}
+
+func invalidAttr(element, attr string) error {
+	return fmt.Errorf("%w: %s %s", ErrInvalidAttribute, element, attr)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "Y"
+	}
+	return "N"
+}
+
+// toXML checks the required attributes of the run and
+// converts it to the pepXML types. Spectrum queries are not included.
+func (run *RunSummary) toXML() (*msmsRunSummary, error) {
+	if run.BaseName == `` {
+		return nil, missingAttr("msms_run_summary", "base_name")
+	}
+	if run.RawDataType == `` {
+		return nil, missingAttr("msms_run_summary", "raw_data_type")
+	}
+	if run.RawData == `` {
+		return nil, missingAttr("msms_run_summary", "raw_data")
+	}
+	e := msmsRunSummary{
+		BaseName:       run.BaseName,
+		MsManufacturer: run.MsManufacturer,
+		MsModel:        run.MsModel,
+		RawDataType:    run.RawDataType,
+		RawData:        run.RawData,
+	}
+	e.SampleEnzyme.Name = run.Enzyme.Name
+	if run.Enzyme.Cut != `` {
+		if run.Enzyme.Sense != "C" && run.Enzyme.Sense != "N" {
+			return nil, invalidAttr("specificity", "sense")
+		}
+		e.SampleEnzyme.Specificity = &specificity{
+			Cut:   run.Enzyme.Cut,
+			NoCut: run.Enzyme.NoCut,
+			Sense: run.Enzyme.Sense,
+		}
+	}
+	for i := range run.Searches {
+		s, err := run.Searches[i].toXML(run.BaseName, i+1)
+		if err != nil {
+			return nil, err
+		}
+		e.SearchSummary = append(e.SearchSummary, *s)
+	}
+	return &e, nil
+}
+
+// toXML checks the required attributes of the search summary and
+// converts it to the pepXML type. If BaseName or SearchID are not set,
+// the base name of the run and the sequence number of the search are used.
+func (s *SearchSummary) toXML(baseName string, searchID int) (*searchSummary, error) {
+	if s.SearchEngine == `` {
+		return nil, missingAttr("search_summary", "search_engine")
+	}
+	if s.PrecursorMassType == `` {
+		return nil, missingAttr("search_summary", "precursor_mass_type")
+	}
+	if s.FragmentMassType == `` {
+		return nil, missingAttr("search_summary", "fragment_mass_type")
+	}
+	if s.BaseName != `` {
+		baseName = s.BaseName
+	}
+	if s.SearchID != 0 {
+		searchID = s.SearchID
+	}
+	e := searchSummary{
+		BaseName:            baseName,
+		SearchEngine:        s.SearchEngine,
+		SearchEngineVersion: s.SearchEngineVersion,
+		PrecursorMassType:   s.PrecursorMassType,
+		FragmentMassType:    s.FragmentMassType,
+		SearchID:            strconv.Itoa(searchID),
+	}
+	if s.Database != `` {
+		e.SearchDatabase = &searchDatabase{LocalPath: s.Database, Type: s.DatabaseType}
+	}
+	if s.SearchEnzyme != `` {
+		e.EnzymaticSearchConstraint = &enzymaticSearchConstraint{
+			Enzyme:                  s.SearchEnzyme,
+			MaxNumInternalCleavages: s.MaxMissedCleavages,
+			MinNumberTermini:        s.MinNumTermini,
+		}
+	}
+	for _, m := range s.Modifications {
+		switch {
+		case m.AminoAcid != ``:
+			e.AminoacidModification = append(e.AminoacidModification, aminoacidModification{
+				Aminoacid: m.AminoAcid,
+				Massdiff:  formatFloat(m.MassDiff),
+				Mass:      formatFloat(m.Mass),
+				Variable:  yesNo(m.Variable),
+				Symbol:    m.Symbol,
+			})
+		case m.Terminus == "n" || m.Terminus == "c":
+			e.TerminalModification = append(e.TerminalModification, terminalModification{
+				Terminus:        m.Terminus,
+				Massdiff:        formatFloat(m.MassDiff),
+				Mass:            formatFloat(m.Mass),
+				Variable:        yesNo(m.Variable),
+				Symbol:          m.Symbol,
+				ProteinTerminus: yesNo(m.ProteinTerminus),
+			})
+		case m.Terminus == ``:
+			return nil, missingAttr("aminoacid_modification", "aminoacid")
+		default:
+			return nil, invalidAttr("terminal_modification", "terminus")
+		}
+	}
+	for _, p := range s.Params {
+		e.Parameter = append(e.Parameter, strParameter{Name: p.Name, Value: p.Value})
+	}
+	return &e, nil
+}
+
+// toXML checks the required attributes of the spectrum query and
+// converts it to the pepXML type
+func (q *SpectrumQuery) toXML() (*spectrumQuery, error) {
+	if q.Spectrum == `` {
+		return nil, missingAttr("spectrum_query", "spectrum")
+	}
+	if q.Index < 1 {
+		return nil, invalidAttr("spectrum_query", "index")
+	}
+	if q.Charge < 0 {
+		return nil, invalidAttr("spectrum_query", "assumed_charge")
+	}
+	e := spectrumQuery{
+		Spectrum:             q.Spectrum,
+		SpectrumNativeID:     q.SpectrumNativeID,
+		StartScan:            q.StartScan,
+		EndScan:              q.EndScan,
+		PrecursorNeutralMass: q.PrecursorNeutralMass,
+		AssumedCharge:        q.Charge,
+		Index:                q.Index,
+		SearchResult:         make([]searchResult, 1),
+	}
+	if !math.IsNaN(q.RetentionTime) {
+		e.RetentionTime = q.RetentionTime
+	}
+	for i := range q.Hits {
+		h, err := q.Hits[i].toXML()
+		if err != nil {
+			return nil, err
+		}
+		e.SearchResult[0].SearchHit = append(e.SearchResult[0].SearchHit, *h)
+	}
+	return &e, nil
+}
+
+// toXML checks the required attributes of the search hit and
+// converts it to the pepXML type
+func (h *SearchHit) toXML() (*searchHit, error) {
+	if h.Rank < 1 {
+		return nil, invalidAttr("search_hit", "hit_rank")
+	}
+	if h.Peptide == `` {
+		return nil, missingAttr("search_hit", "peptide")
+	}
+	if h.Protein == `` {
+		return nil, missingAttr("search_hit", "protein")
+	}
+	e := searchHit{
+		HitRank:            h.Rank,
+		Peptide:            h.Peptide,
+		PeptidePrevAA:      h.PrevAA,
+		PeptideNextAA:      h.NextAA,
+		Protein:            h.Protein,
+		NumTotProteins:     h.NumTotProteins,
+		NumMatchedIons:     h.NumMatchedIons,
+		TotNumIons:         h.TotNumIons,
+		CalcNeutralPepMass: h.CalcNeutralPepMass,
+		Massdiff:           h.MassDiff,
+		NumTolTerm:         h.NumTolTerm,
+		NumMissedCleavages: h.NumMissedCleavages,
+	}
+	// num_tot_proteins counts the protein and the alternative proteins
+	if e.NumTotProteins < 1+len(h.AlternativeProteins) {
+		e.NumTotProteins = 1 + len(h.AlternativeProteins)
+	}
+	for _, p := range h.AlternativeProteins {
+		e.AlternativeProtein = append(e.AlternativeProtein, alternativeProtein{Protein: p})
+	}
+	if len(h.Mods) > 0 || h.NTermMass != 0 || h.CTermMass != 0 ||
+		(h.ModifiedPeptide != `` && h.ModifiedPeptide != h.Peptide) {
+		mi := modificationInfo{
+			ModNTermMass: h.NTermMass,
+			ModCTermMass: h.CTermMass,
+		}
+		if h.ModifiedPeptide != h.Peptide {
+			mi.ModifiedPeptide = h.ModifiedPeptide
+		}
+		for _, m := range h.Mods {
+			if m.Position < 1 || m.Position > len(h.Peptide) {
+				return nil, invalidAttr("mod_aminoacid_mass", "position")
+			}
+			mi.ModAminoacidMass = append(mi.ModAminoacidMass, modAminoacidMass{Position: m.Position, Mass: m.Mass})
+		}
+		e.ModificationInfo = []modificationInfo{mi}
+	}
+	// Sort the scores to make the output reproducible
+	names := make([]string, 0, len(h.Scores))
+	for name := range h.Scores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e.SearchScore = append(e.SearchScore, searchScore{Name: name, Value: h.Scores[name]})
+	}
+	if h.PeptideProphet != nil {
+		e.AnalysisResult = append(e.AnalysisResult, analysisResult{
+			Analysis:             "peptideprophet",
+			PeptideprophetResult: &peptideprophetResult{Probability: *h.PeptideProphet},
+		})
+	}
+	if h.IProphet != nil {
+		e.AnalysisResult = append(e.AnalysisResult, analysisResult{
+			Analysis:           "interprophet",
+			InterprophetResult: &interprophetResult{Probability: *h.IProphet},
+		})
+	}
+	return &e, nil
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package pepxml
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	p, err := Read(strings.NewReader(testPepXML))
+	if err != nil {
+		t.Fatalf("Read: error return %v", err)
+	}
+	var sb strings.Builder
+	w := NewWriter(&sb)
+	err = w.WriteHeader("test.pep.xml", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("WriteHeader: error return %v", err)
+	}
+	runs := p.Runs()
+	for i := range runs {
+		err = w.WriteRun(&runs[i])
+		if err != nil {
+			t.Fatalf("WriteRun: error return %v", err)
+		}
+		for j := 0; j < p.NumQueries(); j++ {
+			q, _ := p.Query(j)
+			if q.Run == i {
+				err = w.Write(&q)
+				if err != nil {
+					t.Fatalf("Write: error return %v", err)
+				}
+			}
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("Close: error return %v", err)
+	}
+	out := sb.String()
+	if !strings.Contains(out, `xmlns="http://regis-web.systemsbiology.net/pepXML"`) ||
+		!strings.Contains(out, `date="2021-01-01T00:00:00"`) {
+		t.Errorf("Write: missing namespace or date")
+	}
+
+	p2, err := Read(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("Read after write: error return %v", err)
+	}
+	// The search IDs of the second run are filled in by the writer
+	runs[1].Searches[0].SearchID = 1
+	if !reflect.DeepEqual(p2.Runs(), runs) {
+		t.Errorf("Runs after write: %+v, should be %+v", p2.Runs(), runs)
+	}
+	if p2.NumQueries() != p.NumQueries() {
+		t.Fatalf("NumQueries after write: %d, should be %d", p2.NumQueries(), p.NumQueries())
+	}
+	for i := 0; i < p.NumQueries(); i++ {
+		q, _ := p.Query(i)
+		q2, _ := p2.Query(i)
+		if !equalQuery(&q, &q2) {
+			t.Errorf("Query %d after write: %+v, should be %+v", i, q2, q)
+		}
+	}
+}
+
+// equalQuery compares spectrum queries, treating NaN values as equal
+func equalQuery(a, b *SpectrumQuery) bool {
+	a1, b1 := *a, *b
+	if math.IsNaN(a1.RetentionTime) && math.IsNaN(b1.RetentionTime) {
+		a1.RetentionTime, b1.RetentionTime = 0, 0
+	}
+	a1.Hits, b1.Hits = nil, nil
+	if !reflect.DeepEqual(a1, b1) || len(a.Hits) != len(b.Hits) {
+		return false
+	}
+	for i := range a.Hits {
+		if !reflect.DeepEqual(a.Hits[i], b.Hits[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWriteValidation(t *testing.T) {
+	run := RunSummary{BaseName: "run", RawDataType: "raw", RawData: ".mzML"}
+	search := SearchSummary{SearchEngine: "Comet", PrecursorMassType: "monoisotopic", FragmentMassType: "monoisotopic"}
+	query := SpectrumQuery{Spectrum: "run.1.1.2", Index: 1, Charge: 2}
+	hit := SearchHit{Rank: 1, Peptide: "PEPTIDE", Protein: "P1"}
+
+	tests := []struct {
+		name   string
+		modify func(r *RunSummary, s *SearchSummary, q *SpectrumQuery, h *SearchHit)
+		err    error
+	}{
+		{name: "Valid", modify: func(r *RunSummary, s *SearchSummary, q *SpectrumQuery, h *SearchHit) {}},
+		{name: "No base name", err: ErrMissingAttribute,
+			modify: func(r *RunSummary, s *SearchSummary, q *SpectrumQuery, h *SearchHit) { r.BaseName = `` }},
+		{name: "No raw data", err: ErrMissingAttribute,
+			modify: func(r *RunSummary, s *SearchSummary, q *SpectrumQuery, h *SearchHit) { r.RawData = `` }},
+		{name: "Enzyme sense", err: ErrInvalidAttribute,
+			modify: func(r *RunSummary, s *SearchSummary, q *SpectrumQuery, h *SearchHit) {
+				r.Enzyme = Enzyme{Name: "trypsin", Cut: "KR"}
+			}},
+		{name: "No search engine", err: ErrMissingAttribute,
+			modify: func(r *RunSummary, s *SearchSummary, q *SpectrumQuery, h *SearchHit) { s.SearchEngine = `` }},
+		{name: "Modification without residue", err: ErrMissingAttribute,
+			modify: func(r *RunSummary, s *SearchSummary, q *SpectrumQuery, h *SearchHit) {
+				s.Modifications = []Modification{{MassDiff: 1}}
+			}},
+		{name: "Invalid terminus", err: ErrInvalidAttribute,
+			modify: func(r *RunSummary, s *SearchSummary, q *SpectrumQuery, h *SearchHit) {
+				s.Modifications = []Modification{{Terminus: "x", MassDiff: 1}}
+			}},
+		{name: "No spectrum", err: ErrMissingAttribute,
+			modify: func(r *RunSummary, s *SearchSummary, q *SpectrumQuery, h *SearchHit) { q.Spectrum = `` }},
+		{name: "No index", err: ErrInvalidAttribute,
+			modify: func(r *RunSummary, s *SearchSummary, q *SpectrumQuery, h *SearchHit) { q.Index = 0 }},
+		{name: "No peptide", err: ErrMissingAttribute,
+			modify: func(r *RunSummary, s *SearchSummary, q *SpectrumQuery, h *SearchHit) { h.Peptide = `` }},
+		{name: "No protein", err: ErrMissingAttribute,
+			modify: func(r *RunSummary, s *SearchSummary, q *SpectrumQuery, h *SearchHit) { h.Protein = `` }},
+		{name: "Invalid mod position", err: ErrInvalidAttribute,
+			modify: func(r *RunSummary, s *SearchSummary, q *SpectrumQuery, h *SearchHit) {
+				h.Mods = []ModPosition{{Position: 8, Mass: 100}}
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, s, q, h := run, search, query, hit
+			tt.modify(&r, &s, &q, &h)
+			r.Searches = []SearchSummary{s}
+			q.Hits = []SearchHit{h}
+			w := NewWriter(&strings.Builder{})
+			err := w.WriteHeader("test.pep.xml", time.Now())
+			if err != nil {
+				t.Fatalf("WriteHeader: error return %v", err)
+			}
+			err = w.WriteRun(&r)
+			if err == nil {
+				err = w.Write(&q)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Write: error return %v, should be %v", err, tt.err)
+			}
+		})
+	}
+
+	w := NewWriter(&strings.Builder{})
+	err := w.Write(&query)
+	if err != ErrWriterState {
+		t.Errorf("Write before WriteRun: error return %v, should be %v", err, ErrWriterState)
+	}
+	err = w.WriteHeader(``, time.Now())
+	if !errors.Is(err, ErrMissingAttribute) {
+		t.Errorf("WriteHeader: error return %v, should be %v", err, ErrMissingAttribute)
+	}
+}
+
+func TestWriteAnalysisResult(t *testing.T) {
+	run := RunSummary{BaseName: "run", RawDataType: "raw", RawData: ".mzML",
+		Searches: []SearchSummary{{SearchEngine: "Comet", PrecursorMassType: "monoisotopic", FragmentMassType: "monoisotopic"}}}
+	prob := 0.95
+	for _, tt := range []struct {
+		name string
+		hit  SearchHit
+		want []string
+	}{
+		{"No probabilities", SearchHit{Rank: 1, Peptide: "PEPTIDE", Protein: "P1"}, nil},
+		{"PeptideProphet", SearchHit{Rank: 1, Peptide: "PEPTIDE", Protein: "P1", PeptideProphet: &prob},
+			[]string{"peptideprophet"}},
+		{"Both", SearchHit{Rank: 1, Peptide: "PEPTIDE", Protein: "P1", PeptideProphet: &prob, IProphet: &prob},
+			[]string{"peptideprophet", "interprophet"}},
+	} {
+		var sb strings.Builder
+		w := NewWriter(&sb)
+		err := w.WriteHeader("test.pep.xml", time.Now())
+		if err == nil {
+			err = w.WriteRun(&run)
+		}
+		if err == nil {
+			err = w.Write(&SpectrumQuery{Spectrum: "run.1.1.2", Index: 1, Charge: 2, RetentionTime: math.NaN(),
+				Hits: []SearchHit{tt.hit}})
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			t.Fatalf("%s: error return %v", tt.name, err)
+		}
+		out := sb.String()
+		if n := strings.Count(out, "<analysis_result"); n != len(tt.want) {
+			t.Errorf("%s: %d analysis_result elements, should be %d", tt.name, n, len(tt.want))
+		}
+		for _, a := range tt.want {
+			if !strings.Contains(out, `analysis="`+a+`"`) {
+				t.Errorf("%s: no %s analysis_result", tt.name, a)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package spectra
+
+// Iterator iterates over the spectra of a Source that match a Filter.
+// Typical use:
+//
+//	it := f.Spectra(spectra.Filter{MSLevels: []int{2}})
+//	for it.Next() {
+//		s := it.Spectrum()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	src    Source
+	filter Filter
+	next   int
+	spec   Spectrum
+	err    error
+}
+
+// NewIterator returns an iterator over the spectra of src that match filter
+func NewIterator(src Source, filter Filter) *Iterator {
+	return &Iterator{src: src, filter: filter}
+}
+
+// Next advances to the next matching spectrum. It returns false when
+// there are no more spectra, or when an error occurred.
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	for it.next < it.src.NumSpecs() {
+		index := it.next
+		it.next++
+		s, err := it.src.SpectrumHeader(index)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if !it.filter.Match(&s) {
+			continue
+		}
+		// Peaks are only read for spectra that match
+		s.Peaks, err = it.src.ReadPeaks(index)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.spec = s
+		return true
+	}
+	return false
+}
+
+// Spectrum returns the current spectrum
+func (it *Iterator) Spectrum() Spectrum {
+	return it.spec
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *Iterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+package spectra
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// testSource contains spectra with MS level 1 and 2, alternating
+type testSource struct {
+	specs     []Spectrum
+	peakReads int
+}
+
+func newTestSource(n int) *testSource {
+	src := &testSource{}
+	for i := 0; i < n; i++ {
+		s := Spectrum{Index: i, MSLevel: 1 + i%2, RetentionTime: float64(10 * i), Polarity: Positive}
+		if s.MSLevel == 2 {
+			s.Precursors = []Precursor{{Mz: 400 + float64(i), Charge: 2, ScanIndex: i - 1}}
+		}
+		src.specs = append(src.specs, s)
+	}
+	return src
+}
+
+func (src *testSource) NumSpecs() int {
+	return len(src.specs)
+}
+
+func (src *testSource) SpectrumHeader(index int) (Spectrum, error) {
+	if index == 99 {
+		return Spectrum{}, errors.New("read error")
+	}
+	return src.specs[index], nil
+}
+
+func (src *testSource) ReadPeaks(index int) ([]Peak, error) {
+	src.peakReads++
+	return []Peak{{Mz: 100 + float64(index), Intens: 1}}, nil
+}
+
+func TestIterator(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  Filter
+		indices []int
+	}{
+		{name: "All", filter: Filter{}, indices: []int{0, 1, 2, 3, 4, 5}},
+		{name: "MS2", filter: Filter{MSLevels: []int{2}}, indices: []int{1, 3, 5}},
+		{name: "RT range", filter: Filter{MinRT: 15, MaxRT: 40}, indices: []int{2, 3, 4}},
+		{name: "Min RT", filter: Filter{MinRT: 35}, indices: []int{4, 5}},
+		{name: "Polarity", filter: Filter{Polarity: Negative}, indices: nil},
+		{name: "Precursor", filter: Filter{MinPrecursorMz: 402, MaxPrecursorMz: 404}, indices: []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := newTestSource(6)
+			it := NewIterator(src, tt.filter)
+			var indices []int
+			for it.Next() {
+				s := it.Spectrum()
+				if len(s.Peaks) != 1 || s.Peaks[0].Mz != 100+float64(s.Index) {
+					t.Errorf("Spectrum %d: peaks %v", s.Index, s.Peaks)
+				}
+				indices = append(indices, s.Index)
+			}
+			if it.Err() != nil {
+				t.Errorf("Err: %v", it.Err())
+			}
+			if len(indices) != len(tt.indices) {
+				t.Fatalf("Indices %v, should be %v", indices, tt.indices)
+			}
+			for i := range indices {
+				if indices[i] != tt.indices[i] {
+					t.Errorf("Indices %v, should be %v", indices, tt.indices)
+				}
+			}
+			// Peaks must only be read for selected spectra
+			if src.peakReads != len(tt.indices) {
+				t.Errorf("Peaks read %d times, should be %d", src.peakReads, len(tt.indices))
+			}
+		})
+	}
+
+	// No retention time
+	f := Filter{MinRT: 1}
+	if f.Match(&Spectrum{RetentionTime: math.NaN()}) {
+		t.Errorf("Match: spectrum without retention time selected")
+	}
+
+	// Errors stop the iteration
+	src := newTestSource(100)
+	it := NewIterator(src, Filter{})
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if n != 99 || it.Err() == nil {
+		t.Errorf("Iterator: %d spectra, error %v", n, it.Err())
+	}
+}
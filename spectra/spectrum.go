@@ -0,0 +1,113 @@
+// Copyright 2021 Rob Marissen
+// SPDX-License-Identifier: MIT
+
+// Package spectra contains types that are shared by the
+// mass spectrometry file formats, and an iterator over spectra
+// that works for all of them.
+package spectra
+
+// Peak contains the actual ms peak info
+type Peak struct {
+	Mz     float64
+	Intens float64
+}
+
+// Polarity is the polarity of a scan
+type Polarity int
+
+// Scan polarities
+const (
+	UnknownPolarity Polarity = iota
+	Positive
+	Negative
+)
+
+// Precursor contains the m/z and charge of a precursor ion.
+// Values that are not present are NaN (or 0 for Charge).
+type Precursor struct {
+	Mz        float64
+	Charge    int
+	Intensity float64
+	// Index of the precursor spectrum, or -1 if unknown
+	ScanIndex int
+}
+
+// Spectrum contains a spectrum as returned by an Iterator
+type Spectrum struct {
+	Index         int    // Index of the spectrum in the file
+	ID            string // Spectrum identifier as used in the file
+	MSLevel       int
+	RetentionTime float64 // Retention time in seconds, NaN if unknown
+	Centroid      bool
+	Polarity      Polarity
+	Precursors    []Precursor
+	Peaks         []Peak
+}
+
+// Source is implemented by file formats that provide spectra
+type Source interface {
+	// NumSpecs returns the number of spectra
+	NumSpecs() int
+	// SpectrumHeader returns a spectrum without peaks
+	SpectrumHeader(index int) (Spectrum, error)
+	// ReadPeaks returns the peaks of a spectrum
+	ReadPeaks(index int) ([]Peak, error)
+}
+
+// Filter selects spectra. The zero value selects all spectra.
+type Filter struct {
+	// MS levels to select, empty selects all levels
+	MSLevels []int
+	// Retention time range in seconds. A MaxRT of 0 means no upper limit.
+	MinRT float64
+	MaxRT float64
+	// Polarity to select, UnknownPolarity selects all spectra
+	Polarity Polarity
+	// Precursor m/z window. If MaxPrecursorMz is not 0, only spectra
+	// with a precursor inside the window are selected.
+	MinPrecursorMz float64
+	MaxPrecursorMz float64
+}
+
+// Match returns true if the filter selects spectrum s.
+// Only the metadata (not the peaks) of s is used.
+func (filter *Filter) Match(s *Spectrum) bool {
+	if len(filter.MSLevels) > 0 {
+		found := false
+		for _, l := range filter.MSLevels {
+			if l == s.MSLevel {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if filter.MinRT > 0 || filter.MaxRT > 0 {
+		// Comparisons with NaN are false, so spectra without
+		// retention time are not selected
+		if !(s.RetentionTime >= filter.MinRT) {
+			return false
+		}
+		if filter.MaxRT > 0 && !(s.RetentionTime <= filter.MaxRT) {
+			return false
+		}
+	}
+	if filter.Polarity != UnknownPolarity && filter.Polarity != s.Polarity {
+		return false
+	}
+	if filter.MaxPrecursorMz != 0 {
+		found := false
+		for _, p := range s.Precursors {
+			if p.Mz >= filter.MinPrecursorMz && p.Mz <= filter.MaxPrecursorMz {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}